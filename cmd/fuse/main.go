@@ -3,62 +3,155 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
 
+	"github.com/v3io/flex-fuse/pkg/common"
 	"github.com/v3io/flex-fuse/pkg/flex"
 	"github.com/v3io/flex-fuse/pkg/journal"
 )
 
-func handleAction() *flex.Response {
-	journal.Debug("Handling action", os.Args)
+// action handles a command, given the command line arguments that follow it
+type action func(args []string) *flex.Response
 
-	if len(os.Args) < 2 {
-		return getArgumentFailResponse("Fuse requires at least an action argument")
-	}
+// actions are the commands the driver handles, by name. They're set on init, as the capabilities command
+// reports the actions themselves
+var actions map[string]action
 
-	switch action := os.Args[1]; action {
-	case "init":
-		result := flex.NewSuccessResponse("No initialization required")
-		result.Capabilities = map[string]interface{}{
-			"attach": false,
-		}
+func init() {
+	actions = map[string]action{
+		"init": withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+			return mounter.Init()
+		}),
 
-		return result
+		"getvolumename": withArgs(1, "Get volume name requires 1 exactly argument", func(args []string) *flex.Response {
+			return flex.GetVolumeName(args[0])
+		}),
 
-	case "mount":
-		if len(os.Args) != 4 {
-			return getArgumentFailResponse("Mount requires 2 exactly arguments")
-		}
+		"mount": withArgs(2, "Mount requires 2 exactly arguments",
+			withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+				return mounter.Mount(args[0], args[1])
+			})),
 
-		mounter, err := flex.NewMounter()
-		if err != nil {
-			return flex.NewFailResponse("Failed to create mounter", err)
-		}
+		"unmount": withArgs(1, "Mount requires 1 exactly argument",
+			withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+				return mounter.Unmount(args[0])
+			})),
+
+		"check": withArgs(1, "Check requires 1 exactly argument",
+			withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+				return mounter.Check(args[0])
+			})),
 
-		return mounter.Mount(os.Args[2], os.Args[3])
+		"describe": withArgs(1, "Describe requires 1 exactly argument",
+			withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+				return mounter.Describe(args[0])
+			})),
 
-	case "unmount":
-		if len(os.Args) != 3 {
-			return getArgumentFailResponse("Mount requires 1 exactly argument")
+		"list": withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+			return mounter.List()
+		}),
+
+		"healthcheck": withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+			return mounter.HealthCheck()
+		}),
+
+		"serve-state": withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+
+			// only returns once serving fails
+			return flex.NewFailResponse("Failed to serve mount state", mounter.ServeState())
+		}),
+
+		"drain": withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+			return mounter.Drain()
+		}),
+
+		"drift-check": withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+			return mounter.DriftCheck()
+		}),
+
+		"reap": withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+			return mounter.Reap()
+		}),
+
+		"force-clear": withArgs(1, "Force clear requires 1 exactly argument",
+			withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+				return mounter.ForceClear(args[0])
+			})),
+
+		"capabilities": withMounter(func(mounter *flex.Mounter, args []string) *flex.Response {
+			return mounter.Capabilities(getActionNames())
+		}),
+
+		"spec-schema": func(args []string) *flex.Response {
+			result := flex.NewSuccessResponse("Spec schema")
+			result.Schema = flex.SpecSchema()
+
+			return result
+		},
+	}
+}
+
+// withArgs returns an action that fails with a message unless it's given a number of arguments
+func withArgs(count int, message string, handler action) action {
+	return func(args []string) *flex.Response {
+		if len(args) != count {
+			return getArgumentFailResponse(message)
 		}
 
+		return handler(args)
+	}
+}
+
+// withMounter returns an action that is handled by a mounter created for it
+func withMounter(handler func(mounter *flex.Mounter, args []string) *flex.Response) action {
+	return func(args []string) *flex.Response {
 		mounter, err := flex.NewMounter()
 		if err != nil {
 			return flex.NewFailResponse("Failed to create mounter", err)
 		}
 
-		return mounter.Unmount(os.Args[2])
+		return handler(mounter, args)
+	}
+}
 
-	default:
-		return getArgumentFailResponse(fmt.Sprintf("Received (%s) action is not supported", action))
+// getActionNames returns the names of the commands the driver handles, sorted
+func getActionNames() []string {
+	var actionNames []string
+	for actionName := range actions {
+		actionNames = append(actionNames, actionName)
 	}
+
+	sort.Strings(actionNames)
+
+	return actionNames
+}
+
+func handleAction() *flex.Response {
+	journal.Debug("Handling action", "args", common.RedactSecrets(os.Args))
+
+	if len(os.Args) < 2 {
+		return getArgumentFailResponse("Fuse requires at least an action argument")
+	}
+
+	handler, found := actions[os.Args[1]]
+	if !found {
+		return getArgumentFailResponse(fmt.Sprintf("Received (%s) action is not supported", os.Args[1]))
+	}
+
+	return handler(os.Args[2:])
 }
 
 func getArgumentFailResponse(message string) *flex.Response {
-	return flex.NewFailResponse(message, fmt.Errorf("Got %s", os.Args))
+	return flex.NewPermanentFailResponse(message, fmt.Errorf("Got %s", common.RedactSecrets(os.Args)))
 }
 
 func main() {
 
+	// the environment applies before the first log, as the config is only loaded by the mounter
+	journal.SetFromEnvironment()
+
 	// handle the action and print the result
 	fmt.Print(handleAction().ToJSON())
+
+	journal.Flush()
 }
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestGetActionNames(t *testing.T) {
+	actionNames := getActionNames()
+
+	if len(actionNames) != len(actions) || !sort.StringsAreSorted(actionNames) {
+		t.Fatalf("Expected the %d actions sorted, got %v", len(actions), actionNames)
+	}
+
+	for _, actionName := range []string{"init", "mount", "unmount", "capabilities"} {
+		if _, found := actions[actionName]; !found {
+			t.Fatalf("Expected action %s, got %v", actionName, actionNames)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces secrets in anything that is logged or recorded
+const RedactedValue = "<redacted>"
+
+// secretFlags are the command line flags whose values are secrets
+var secretFlags = []string{"--session_key", "--creds", "--auth"}
+
+var secretFlagValueRegexp = regexp.MustCompile(`(` + strings.Join(secretFlags, "|") + `)([ =])\S+`)
+
+// RedactSecrets returns a copy of a command line with its secrets replaced by RedactedValue: the values of secret
+// flags, and the secret fields of JSON arguments (e.g. the options kubelet passes to mount, which hold the
+// access key)
+func RedactSecrets(args []string) []string {
+	redactedArgs := append([]string{}, args...)
+
+	for argIdx, arg := range redactedArgs {
+		for _, secretFlag := range secretFlags {
+			if arg == secretFlag && argIdx+1 < len(redactedArgs) {
+				redactedArgs[argIdx+1] = RedactedValue
+			} else if strings.HasPrefix(arg, secretFlag+"=") {
+				redactedArgs[argIdx] = secretFlag + "=" + RedactedValue
+			}
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(arg), "{") {
+			redactedArgs[argIdx] = redactJSONSecrets(arg)
+		}
+	}
+
+	return redactedArgs
+}
+
+// RedactText returns a copy of free text (e.g. a process' output) with the given secrets, and the values of secret
+// flags, replaced by RedactedValue
+func RedactText(text string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.Replace(text, secret, RedactedValue, -1)
+		}
+	}
+
+	return secretFlagValueRegexp.ReplaceAllString(text, "${1}${2}"+RedactedValue)
+}
+
+// redactJSONSecrets redacts the secret fields of a JSON object, returning anything else as is
+func redactJSONSecrets(jsonString string) string {
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(jsonString), &fields); err != nil {
+		return jsonString
+	}
+
+	redacted := false
+	for fieldName := range fields {
+		if isSecretField(fieldName) {
+			fields[fieldName] = RedactedValue
+			redacted = true
+		}
+	}
+
+	if !redacted {
+		return jsonString
+	}
+
+	// the redacted value's brackets would otherwise be escaped
+	var redactedJSON strings.Builder
+	encoder := json.NewEncoder(&redactedJSON)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(fields); err != nil {
+		return RedactedValue
+	}
+
+	return strings.TrimSuffix(redactedJSON.String(), "\n")
+}
+
+// isSecretField returns whether a field holds a secret: any kubernetes secret, or an access or session key under
+// any of its spellings
+func isSecretField(fieldName string) bool {
+	if strings.HasPrefix(fieldName, "kubernetes.io/secret/") {
+		return true
+	}
+
+	switch strings.ToLower(strings.Replace(fieldName, "_", "", -1)) {
+	case "accesskey", "sessionkey":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	for _, testCase := range []struct {
+		name         string
+		args         []string
+		expectedArgs []string
+	}{
+		{name: "no secrets", args: []string{"v3io-fuse", "--mountpoint", "/fuse_mount"},
+			expectedArgs: []string{"v3io-fuse", "--mountpoint", "/fuse_mount"}},
+		{name: "separate value", args: []string{"v3io-fuse", "--session_key", "key", "-a", "c"},
+			expectedArgs: []string{"v3io-fuse", "--session_key", RedactedValue, "-a", "c"}},
+		{name: "joined value", args: []string{"docker", "--auth=user:password"},
+			expectedArgs: []string{"docker", "--auth=" + RedactedValue}},
+		{name: "flag at the end", args: []string{"v3io-fuse", "--creds"}, expectedArgs: []string{"v3io-fuse", "--creds"}},
+		{name: "json options", args: []string{"mount", "/target",
+			`{"container":"bigdata","kubernetes.io/secret/accessKey":"key","access_key":"key"}`},
+			expectedArgs: []string{"mount", "/target",
+				`{"access_key":"<redacted>","container":"bigdata","kubernetes.io/secret/accessKey":"<redacted>"}`}},
+		{name: "json without secrets", args: []string{`{"container": "bigdata"}`},
+			expectedArgs: []string{`{"container": "bigdata"}`}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			redactedArgs := RedactSecrets(testCase.args)
+			if !reflect.DeepEqual(redactedArgs, testCase.expectedArgs) {
+				t.Fatalf("Expected %v, got %v", testCase.expectedArgs, redactedArgs)
+			}
+		})
+	}
+}
+
+func TestRedactText(t *testing.T) {
+	for _, testCase := range []struct {
+		name         string
+		text         string
+		secrets      []string
+		expectedText string
+	}{
+		{name: "secret", text: "connecting with key123", secrets: []string{"key123"},
+			expectedText: "connecting with <redacted>"},
+		{name: "flag value", text: "running v3io-fuse --session_key key123 -a c",
+			expectedText: "running v3io-fuse --session_key <redacted> -a c"},
+		{name: "empty secret", text: "nothing to hide", secrets: []string{""}, expectedText: "nothing to hide"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if redactedText := RedactText(testCase.text, testCase.secrets...); redactedText != testCase.expectedText {
+				t.Fatalf("Expected %q, got %q", testCase.expectedText, redactedText)
+			}
+		})
+	}
+}
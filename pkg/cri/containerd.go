@@ -3,6 +3,7 @@ package cri
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"path"
@@ -17,23 +18,39 @@ import (
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/cio"
 	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/images/archive"
+	metricsv1 "github.com/containerd/containerd/metrics/types/v1"
+	metricsv2 "github.com/containerd/containerd/metrics/types/v2"
 	"github.com/containerd/containerd/namespaces"
 	"github.com/containerd/containerd/oci"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/containerd/containerd/runtime/restart"
+	"github.com/containerd/typeurl"
 	"github.com/opencontainers/runtime-spec/specs-go"
 )
 
+const (
+	statsSampleInterval = 500 * time.Millisecond
+	restartPolicyLabel  = "containerd.io/restart.policy"
+	containerLogsDir    = "/var/log/containers"
+)
+
 type Containerd struct {
 	containerdContext context.Context
 	kubernetesContext context.Context
 	containerdClient  *containerd.Client
+	timeouts          Timeouts
 }
 
-func NewContainerd(containerdSock string, contextName string) (*Containerd, error) {
+func NewContainerd(containerdSock string, contextName string, timeouts Timeouts) (*Containerd, error) {
 	var err error
 
-	newContainerd := Containerd{}
+	newContainerd := Containerd{
+		timeouts: timeouts,
+	}
 
 	newContainerd.containerdClient, err = containerd.New(containerdSock)
 	if err != nil {
@@ -49,6 +66,160 @@ func NewContainerd(containerdSock string, contextName string) (*Containerd, erro
 	return &newContainerd, nil
 }
 
+// ExecInContainer runs a command in a running container
+func (c *Containerd) ExecInContainer(containerName string, command []string) (string, error) {
+	ctx, cancel := context.WithTimeout(c.containerdContext, execTimeout)
+	defer cancel()
+
+	container, err := c.containerdClient.LoadContainer(ctx, containerName)
+	if err != nil {
+		return "", err
+	}
+
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+
+	spec, err := container.Spec(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// the exec'd process runs like the container's own process, other than its args
+	processSpec := *spec.Process
+	processSpec.Args = command
+	processSpec.Terminal = false
+
+	var stdout, stderr bytes.Buffer
+
+	execID := fmt.Sprintf("exec-%d", time.Now().UnixNano())
+	process, err := task.Exec(ctx, execID, &processSpec, cio.NewCreator(cio.WithStreams(nil, &stdout, &stderr)))
+	if err != nil {
+		return "", err
+	}
+
+	defer process.Delete(ctx) // nolint: errcheck
+
+	exitStatusChan, err := process.Wait(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	journal.Debug("Executing in container", "containerName", containerName, "command", command)
+
+	if err := process.Start(ctx); err != nil {
+		return "", err
+	}
+
+	exitStatus := <-exitStatusChan
+	exitCode, _, err := exitStatus.Result()
+	if err != nil {
+		return "", err
+	}
+
+	// let the output drain before reading it
+	process.IO().Wait()
+
+	output := stdout.String() + stderr.String()
+	if exitCode != 0 {
+		return output, fmt.Errorf("Failed to execute %v in container %s: exit code %d, %s",
+			command,
+			containerName,
+			exitCode,
+			output)
+	}
+
+	return output, nil
+}
+
+// PullImage pulls an image, unless it's present locally and the pull policy allows using it. An image kubelet's
+// runtime has in the k8s namespace (e.g. the default iguazio/v3io-fuse:local, which no registry serves) is
+// imported from there rather than pulled, and under PullPolicyAlways only if the pull fails
+func (c *Containerd) PullImage(image string, options PullOptions) error {
+	if options.Policy != PullPolicyAlways {
+		if _, err := c.ImageDigest(image); err == nil {
+			return nil
+		}
+
+		if c.importFromK8sNamespace(image) {
+			return nil
+		}
+	}
+
+	if err := c.pullImage(image, options); err != nil {
+		if options.Policy == PullPolicyAlways && c.importFromK8sNamespace(image) {
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// importFromK8sNamespace imports an image from the k8s namespace, returning whether it was imported
+func (c *Containerd) importFromK8sNamespace(image string) bool {
+	importedImages, err := c.tryImportFromK8sNamespace(image)
+	if err != nil {
+		journal.Debug("Failed to import image from k8s namespace", "image", image, "err", err.Error())
+		return false
+	}
+
+	journal.Info("Imported image from k8s namespace", "image", image, "lenImportedImages", len(importedImages))
+
+	return true
+}
+
+func (c *Containerd) pullImage(image string, options PullOptions) error {
+	ctx, cancel := withOperationTimeout(c.containerdContext, options.Timeout)
+	defer cancel()
+
+	journal.Info("Pulling image", "image", image, "timeout", options.Timeout)
+	pullStartTime := time.Now()
+
+	if _, err := c.containerdClient.Pull(ctx, image, getPullOpts(options.RegistryAuthConfigPath)...); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("Timed out pulling image %s after %s", image, time.Since(pullStartTime))
+		}
+
+		return fmt.Errorf("Failed to pull image %s: %s", image, err)
+	}
+
+	journal.Info("Pulled image", "image", image, "duration", time.Since(pullStartTime))
+
+	return nil
+}
+
+// getPullOpts returns the options of pulling an image, with a resolver that authenticates with the credentials of
+// a docker config.json if given. The config is read when the registry asks for credentials
+func getPullOpts(registryAuthConfigPath string) []containerd.RemoteOpt {
+	pullOpts := []containerd.RemoteOpt{containerd.WithPullUnpack}
+
+	if registryAuthConfigPath == "" {
+		return pullOpts
+	}
+
+	resolver := docker.NewResolver(docker.ResolverOptions{
+		Hosts: docker.ConfigureDefaultRegistries(docker.WithAuthorizer(newRegistryAuthorizer(registryAuthConfigPath))),
+	})
+
+	return append(pullOpts, containerd.WithResolver(resolver))
+}
+
+// newRegistryAuthorizer returns an authorizer that answers registries' challenges with the credentials of a docker
+// config.json
+func newRegistryAuthorizer(registryAuthConfigPath string) docker.Authorizer {
+	return docker.NewDockerAuthorizer(docker.WithAuthCreds(func(host string) (string, string, error) {
+		return getRegistryCredentials(registryAuthConfigPath, host)
+	}))
+}
+
+// Name returns the name of the runtime
+func (c *Containerd) Name() string {
+	return "containerd"
+}
+
 func (c *Containerd) Close() error {
 	return c.containerdClient.Close()
 }
@@ -57,31 +228,55 @@ func (c *Containerd) Close() error {
 func (c *Containerd) CreateContainer(image string,
 	containerName string,
 	targetPath string,
-	args []string) error {
+	args []string,
+	options ContainerOptions) error {
 
-	// get the path to a log file
-	logFilePath, err := c.getLogFilePath(containerName, targetPath)
-	if err != nil {
-		return err
+	ctx, cancel := withOperationTimeout(c.containerdContext, c.timeouts.Create)
+	defer cancel()
+
+	if options.LogDriver != "" && options.LogDriver != LogDriverNone {
+		journal.Warn("Log driver isn't supported by containerd, using the default",
+			"containerName", containerName,
+			"logDriver", options.LogDriver)
 	}
 
-	journal.Debug("Creating log file",
-		"containerName", containerName,
-		"targetPath", targetPath,
-		"logFilePath", logFilePath)
+	ioCreator := cio.NullIO
+	if options.LogDriver != LogDriverNone {
+
+		// get the path to a log file
+		logFilePath, err := c.getLogFilePath(containerName, targetPath)
+		if err != nil {
+			return err
+		}
+
+		journal.Debug("Creating log file",
+			"containerName", containerName,
+			"targetPath", targetPath,
+			"logFilePath", logFilePath)
+
+		ioCreator = cio.LogFile(logFilePath)
+	}
 
-	v3ioFUSEContainer, err := c.createContainer(image, containerName, targetPath, args)
+	v3ioFUSEContainer, err := c.createContainer(ctx, image, containerName, targetPath, args, options)
 	if err != nil {
+		if errdefs.IsAlreadyExists(err) {
+			return fmt.Errorf("%w: %s", ErrContainerNameInUse, containerName)
+		}
+
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("Timed out creating v3io-fuse container %s after %s", targetPath, c.timeouts.Create)
+		}
+
 		return err
 	}
 
 	// create the actual process
-	v3ioFUSETask, err := v3ioFUSEContainer.NewTask(c.containerdContext, cio.LogFile(logFilePath))
+	v3ioFUSETask, err := v3ioFUSEContainer.NewTask(ctx, ioCreator)
 	if err != nil {
 		return err
 	}
 
-	if err := v3ioFUSETask.Start(c.containerdContext); err != nil {
+	if err := v3ioFUSETask.Start(ctx); err != nil {
 		return err
 	}
 
@@ -90,26 +285,34 @@ func (c *Containerd) CreateContainer(image string,
 
 // RemoveContainer removes a container
 func (c *Containerd) RemoveContainer(containerName string) error {
+	ctx, cancel := withOperationTimeout(c.containerdContext, c.timeouts.Remove)
+	defer cancel()
+
 	journal.Debug("Removing container", "containerName", containerName)
 
-	container, err := c.containerdClient.LoadContainer(c.containerdContext, containerName)
+	container, err := c.containerdClient.LoadContainer(ctx, containerName)
 	if err != nil {
+		if errdefs.IsNotFound(err) {
+			journal.Debug("Container not found, nothing to remove", "containerName", containerName)
+			return nil
+		}
+
 		return err
 	}
 
-	task, err := container.Task(c.containerdContext, cio.Load)
+	task, err := container.Task(ctx, cio.Load)
 	if err != nil {
 		journal.Debug("No task found for container, removing container",
 			"containerName", containerName)
 
-		return container.Delete(c.containerdContext)
+		return container.Delete(ctx)
 	}
 
 	journal.Debug("Got task for container",
 		"containerName", containerName,
 		"id", task.ID())
 
-	status, err := task.Status(c.containerdContext)
+	status, err := task.Status(ctx)
 	if err != nil {
 		return err
 	}
@@ -121,7 +324,7 @@ func (c *Containerd) RemoveContainer(containerName string) error {
 	if status.Status != containerd.Stopped && status.Status != containerd.Created {
 		journal.Debug("Killing task", "containerName", containerName)
 
-		err = task.Kill(c.containerdContext,
+		err = task.Kill(ctx,
 			syscall.SIGTERM,
 			containerd.WithKillAll)
 
@@ -132,7 +335,7 @@ func (c *Containerd) RemoveContainer(containerName string) error {
 		journal.Debug("Waiting for task to die", "containerName", containerName)
 
 		// wait for task to exit
-		taskExitStatusChan, err := task.Wait(c.containerdContext)
+		taskExitStatusChan, err := task.Wait(ctx)
 		if err != nil {
 			return fmt.Errorf("Failed waiting for %s's task: %s", containerName, err)
 		}
@@ -146,27 +349,267 @@ func (c *Containerd) RemoveContainer(containerName string) error {
 		}
 	}
 
-	if _, err := task.Delete(c.containerdContext); err != nil {
+	if _, err := task.Delete(ctx); err != nil {
 		return fmt.Errorf("Failed to delete %s's task: %s", containerName, err)
 	}
 
 	journal.Debug("Task deleted, deleting container", "containerName", containerName)
 
-	return container.Delete(c.containerdContext)
+	return container.Delete(ctx)
+}
+
+// ContainerStatus returns the state of a container
+func (c *Containerd) ContainerStatus(containerName string) (*ContainerStatus, error) {
+	ctx, cancel := withOperationTimeout(c.containerdContext, c.timeouts.Inspect)
+	defer cancel()
+
+	container, err := c.containerdClient.LoadContainer(ctx, containerName)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return &ContainerStatus{State: ContainerStateNotFound}, nil
+		}
+
+		return nil, err
+	}
+
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return &ContainerStatus{State: ContainerStateCreated}, nil
+		}
+
+		return nil, err
+	}
+
+	status, err := task.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch status.Status {
+	case containerd.Running, containerd.Paused, containerd.Pausing:
+		return &ContainerStatus{State: ContainerStateRunning}, nil
+	case containerd.Created:
+		return &ContainerStatus{State: ContainerStateCreated}, nil
+	case containerd.Stopped:
+		return &ContainerStatus{
+			State:     ContainerStateExited,
+			ExitCode:  int(status.ExitStatus),
+			OOMKilled: c.isTaskOOMKilled(task),
+		}, nil
+	default:
+		return &ContainerStatus{State: ContainerStateUnknown}, nil
+	}
+}
+
+// ImageLabels returns the labels of a local image, as set in its config
+func (c *Containerd) ImageLabels(image string) (map[string]string, error) {
+	ctx, cancel := withOperationTimeout(c.containerdContext, c.timeouts.Inspect)
+	defer cancel()
+
+	imageInstance, err := c.containerdClient.GetImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+
+	configDescriptor, err := imageInstance.Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	configContents, err := content.ReadBlob(ctx, imageInstance.ContentStore(), configDescriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	imageConfig := struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}{}
+
+	if err := json.Unmarshal(configContents, &imageConfig); err != nil {
+		return nil, fmt.Errorf("Failed to parse config of image %s: %s", image, err)
+	}
+
+	return imageConfig.Config.Labels, nil
+}
+
+// ImageDigest returns the digest of a local image's config
+func (c *Containerd) ImageDigest(image string) (string, error) {
+	ctx, cancel := withOperationTimeout(c.containerdContext, c.timeouts.Inspect)
+	defer cancel()
+
+	imageInstance, err := c.containerdClient.GetImage(ctx, image)
+	if err != nil {
+		return "", err
+	}
+
+	configDescriptor, err := imageInstance.Config(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return configDescriptor.Digest.String(), nil
+}
+
+// ListContainers returns the names of all containers whose name starts with a prefix. Containers are named by
+// their ID
+func (c *Containerd) ListContainers(prefix string) ([]string, error) {
+	ctx, cancel := withOperationTimeout(c.containerdContext, c.timeouts.Inspect)
+	defer cancel()
+
+	allContainers, err := c.containerdClient.Containers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list containers: %s", err)
+	}
+
+	var containerNames []string
+	for _, container := range allContainers {
+		if strings.HasPrefix(container.ID(), prefix) {
+			containerNames = append(containerNames, container.ID())
+		}
+	}
+
+	return containerNames, nil
+}
+
+// RenameContainer isn't supported, as containers are named by their ID, which is immutable
+func (c *Containerd) RenameContainer(containerName string, newContainerName string) error {
+	return ErrRenameUnsupported
+}
+
+// Stats returns the resource usage of a container. containerd only reports cumulative CPU time, so CPU usage
+// is derived from two samples taken statsSampleInterval apart
+func (c *Containerd) Stats(containerName string) (ContainerStats, error) {
+	ctx, cancel := context.WithTimeout(c.containerdContext, statsTimeout)
+	defer cancel()
+
+	container, err := c.containerdClient.LoadContainer(ctx, containerName)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	firstSample, err := c.sampleTaskUsage(ctx, task)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	time.Sleep(statsSampleInterval)
+
+	secondSample, err := c.sampleTaskUsage(ctx, task)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	stats := ContainerStats{
+		MemoryBytes: secondSample.memoryBytes,
+	}
+
+	elapsed := secondSample.timestamp.Sub(firstSample.timestamp)
+	if elapsed > 0 && secondSample.cpuNanoseconds >= firstSample.cpuNanoseconds {
+		stats.CPUNanoCores = uint64(float64(secondSample.cpuNanoseconds-firstSample.cpuNanoseconds) /
+			elapsed.Seconds())
+	}
+
+	return stats, nil
+}
+
+type taskUsage struct {
+	timestamp      time.Time
+	cpuNanoseconds uint64
+	memoryBytes    uint64
+}
+
+func (c *Containerd) sampleTaskUsage(ctx context.Context, task containerd.Task) (*taskUsage, error) {
+	metric, err := task.Metrics(ctx)
+	if err != nil {
+		if errdefs.IsNotImplemented(err) {
+			return nil, fmt.Errorf("%w (%s)", ErrStatsUnsupported, err)
+		}
+
+		return nil, err
+	}
+
+	metricData, err := typeurl.UnmarshalAny(metric.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := taskUsage{
+		timestamp: metric.Timestamp,
+	}
+
+	switch metrics := metricData.(type) {
+	case *metricsv1.Metrics:
+		if metrics.CPU != nil && metrics.CPU.Usage != nil {
+			usage.cpuNanoseconds = metrics.CPU.Usage.Total
+		}
+
+		if metrics.Memory != nil && metrics.Memory.Usage != nil {
+			usage.memoryBytes = metrics.Memory.Usage.Usage
+		}
+	case *metricsv2.Metrics:
+		if metrics.CPU != nil {
+			usage.cpuNanoseconds = metrics.CPU.UsageUsec * 1000
+		}
+
+		if metrics.Memory != nil {
+			usage.memoryBytes = metrics.Memory.Usage
+		}
+	default:
+		return nil, fmt.Errorf("%w (metrics type %T)", ErrStatsUnsupported, metricData)
+	}
+
+	return &usage, nil
+}
+
+// isTaskOOMKilled checks the OOM kill counter of a stopped task's cgroup, which lives on until the task is deleted.
+// containerd doesn't keep an exit reason, so if the counter can't be read the task is assumed not to be OOM killed
+func (c *Containerd) isTaskOOMKilled(task containerd.Task) bool {
+	metric, err := task.Metrics(c.containerdContext)
+	if err != nil {
+		journal.Debug("Failed to get task metrics", "task", task.ID(), "err", err.Error())
+		return false
+	}
+
+	metricData, err := typeurl.UnmarshalAny(metric.Data)
+	if err != nil {
+		return false
+	}
+
+	switch metrics := metricData.(type) {
+	case *metricsv1.Metrics:
+		return metrics.MemoryOomControl != nil && metrics.MemoryOomControl.OomKill > 0
+	case *metricsv2.Metrics:
+		return metrics.MemoryEvents != nil && metrics.MemoryEvents.OomKill > 0
+	default:
+		return false
+	}
 }
 
-func (c *Containerd) createContainer(image string,
+func (c *Containerd) createContainer(ctx context.Context,
+	image string,
 	containerName string,
 	targetPath string,
-	args []string) (containerd.Container, error) {
+	args []string,
+	options ContainerOptions) (containerd.Container, error) {
 
-	args = append(args, " 2>&1 | multilog s16777215 n20 /var/log/containers/flex-fuse-`cat /proc/self/cgroup |  grep memory | awk -F  \"/\"  '{print $NF}'`")
+	// the container's cgroup is named by its ID, so multilog writes to getMultilogDir
+	if options.LogDriver != LogDriverNone {
+		args = append(args, " 2>&1 | multilog s16777215 n20 /var/log/containers/flex-fuse-`cat /proc/self/cgroup |  grep memory | awk -F  \"/\"  '{print $NF}'`")
+	}
 
 	journal.Debug("Creating container",
 		"image", image,
 		"containerName", containerName,
 		"targetPath", targetPath,
-		"args", args)
+		"args", common.RedactSecrets(args))
 
 	// try to get image from k8s namespace
 	importedImages, err := c.tryImportFromK8sNamespace(image)
@@ -185,17 +628,21 @@ func (c *Containerd) createContainer(image string,
 	}
 
 	// assume image exists
-	v3ioFUSEImage, err := c.containerdClient.GetImage(c.containerdContext, image)
+	v3ioFUSEImage, err := c.containerdClient.GetImage(ctx, image)
 	if err != nil {
 		journal.Debug("Image does not exist, pulling",
 			"containerName", containerName,
 			"image", image)
 
 		// pull the v3io-fuse image
-		v3ioFUSEImage, err = c.containerdClient.Pull(c.containerdContext,
+		v3ioFUSEImage, err = c.containerdClient.Pull(ctx,
 			image,
-			containerd.WithPullUnpack)
+			getPullOpts(options.RegistryAuthConfigPath)...)
 		if err != nil {
+			if errdefs.IsNotFound(err) {
+				return nil, fmt.Errorf("%w: %s: %s", ErrImageNotFound, image, err)
+			}
+
 			return nil, err
 		}
 	}
@@ -221,42 +668,127 @@ func (c *Containerd) createContainer(image string,
 		},
 	}
 
-	options := []oci.SpecOpts{
+	specOpts := []oci.SpecOpts{
 		oci.WithDefaultSpec(),
 		oci.WithDefaultUnixDevices,
 		oci.WithMounts(mounts),
 		oci.WithImageConfig(v3ioFUSEImage),
 		oci.WithProcessArgs(args...),
-		oci.WithPrivileged,
-		oci.WithAllDevicesAllowed,
-		oci.WithHostDevices,
 		oci.WithHostNamespace(specs.NetworkNamespace),
 		oci.WithHostHostsFile,
 		oci.WithHostResolvconf,
-		oci.WithDevices("/dev/fuse", "", "rwm"),
 		withCgroupParent("/kubepods"),
 		withRootfsPropagation,
 	}
 
+	if len(options.Capabilities) > 0 {
+
+		// containerd takes capabilities with their CAP_ prefix
+		var capabilities []string
+		for _, capability := range options.Capabilities {
+			capabilities = append(capabilities, "CAP_"+capability)
+		}
+
+		specOpts = append(specOpts, oci.WithAddedCapabilities(capabilities))
+
+		for _, device := range options.Devices {
+			specOpts = append(specOpts, oci.WithDevices(device, "", "rwm"))
+		}
+	} else {
+		specOpts = append(specOpts,
+			oci.WithPrivileged,
+			oci.WithAllDevicesAllowed,
+			oci.WithHostDevices,
+			oci.WithDevices("/dev/fuse", "", "rwm"))
+	}
+
+	// containerd has no server side auto-remove, so exited containers stay until removed explicitly
+	if options.AutoRemove {
+		journal.Debug("Auto-remove isn't supported by containerd, ignoring", "containerName", containerName)
+	}
+
+	if options.Hostname != "" {
+		specOpts = append(specOpts, oci.WithHostname(options.Hostname))
+	}
+
+	var containerOpts []containerd.NewContainerOpts
+
+	if len(options.Labels) > 0 {
+		containerOpts = append(containerOpts, containerd.WithAdditionalContainerLabels(options.Labels))
+	}
+
+	// restarts are left to containerd's restart monitor, which restarts containers labeled as desired running.
+	// Newer monitors also honor the policy label, and with it the max retries
+	if options.RestartPolicy == RestartPolicyOnFailure || options.RestartPolicy == RestartPolicyAlways {
+		restartPolicy := options.RestartPolicy
+		if options.RestartPolicy == RestartPolicyOnFailure && options.RestartMaxRetries > 0 {
+			restartPolicy = fmt.Sprintf("%s:%d", RestartPolicyOnFailure, options.RestartMaxRetries)
+		}
+
+		containerOpts = append(containerOpts, containerd.WithAdditionalContainerLabels(map[string]string{
+			restart.StatusLabel: string(containerd.Running),
+			restartPolicyLabel:  restartPolicy,
+		}))
+	}
+
+	if options.SELinuxLabel != "" {
+		specOpts = append(specOpts, oci.WithSelinuxLabel(options.SELinuxLabel))
+	}
+
 	var spec specs.Spec
 
 	snapshotterName := "overlayfs"
 
 	// before creating, try to delete the snapshot if it exists - otherwise it'll fail
-	c.containerdClient.SnapshotService(snapshotterName).Remove(c.containerdContext, containerName)
+	c.containerdClient.SnapshotService(snapshotterName).Remove(ctx, containerName)
 
-	return c.containerdClient.NewContainer(
-		c.containerdContext,
-		containerName,
+	containerOpts = append([]containerd.NewContainerOpts{
 		containerd.WithImage(v3ioFUSEImage),
 		containerd.WithSnapshotter(snapshotterName),
 		containerd.WithNewSnapshot(containerName, v3ioFUSEImage),
 		containerd.WithImageStopSignal(v3ioFUSEImage, "SIGTERM"),
 		containerd.WithRuntime("io.containerd.runc.v2", nil),
-		containerd.WithSpec(&spec, options...),
+		containerd.WithSpec(&spec, specOpts...),
+	}, containerOpts...)
+
+	return c.containerdClient.NewContainer(
+		ctx,
+		containerName,
+		containerOpts...,
 	)
 }
 
+// ContainerLogs returns the last lines of a container's output, as written by multilog. Containers created with
+// LogDriverNone have none
+func (c *Containerd) ContainerLogs(containerName string, tailLines int) (string, error) {
+	logs, err := ioutil.ReadFile(path.Join(getMultilogDir(containerName), "current"))
+	if err != nil {
+		return "", fmt.Errorf("Failed to read logs of container %s: %s", containerName, err)
+	}
+
+	return tailLogLines(string(logs), tailLines), nil
+}
+
+func getMultilogDir(containerName string) string {
+	return path.Join(containerLogsDir, "flex-fuse-"+containerName)
+}
+
+// tailLogLines returns the last lines of a log (all of it if 0)
+func tailLogLines(logs string, tailLines int) string {
+	lines := strings.SplitAfter(logs, "\n")
+
+	// a log ending with a newline splits into a last, empty element, which isn't a line
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if tailLines > 0 && len(lines) > tailLines {
+		lines = lines[len(lines)-tailLines:]
+	}
+
+	return strings.Join(lines, "")
+}
+
 func (c *Containerd) getLogFilePath(containerName string, targetPath string) (string, error) {
 	sanitizedTargetPath := strings.Replace(targetPath, "/", "-", -1)
 
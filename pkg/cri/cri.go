@@ -1,13 +1,179 @@
 package cri
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// statsTimeout bounds a single Stats call
+const statsTimeout = 10 * time.Second
+
+// execTimeout bounds a single ExecInContainer call
+const execTimeout = 10 * time.Second
+
+// pingTimeout bounds checking whether a runtime's daemon is reachable
+const pingTimeout = 5 * time.Second
+
+// ErrContainerNameInUse is returned by CreateContainer when a container of the same name already exists
+var ErrContainerNameInUse = errors.New("container name is already in use")
+
+// ErrImageNotFound is returned by CreateContainer when the image doesn't exist, locally or in its registry
+var ErrImageNotFound = errors.New("image not found")
+
+// ErrRenameUnsupported is returned by RenameContainer when the runtime can't rename containers
+var ErrRenameUnsupported = errors.New("renaming containers is not supported by the runtime")
+
+// ErrStatsUnsupported is returned by Stats when the runtime can't report resource usage
+var ErrStatsUnsupported = errors.New("container stats are not supported by the runtime")
+
+const (
+	ContainerStateRunning  = "running"
+	ContainerStateCreated  = "created"
+	ContainerStateExited   = "exited"
+	ContainerStateNotFound = "not-found"
+	ContainerStateUnknown  = "unknown"
+)
+
+const (
+	LogDriverNone = "none"
+)
+
+const (
+	RestartPolicyNo        = "no"
+	RestartPolicyOnFailure = "on-failure"
+	RestartPolicyAlways    = "always"
+)
+
+const (
+	PullPolicyIfNotPresent = "IfNotPresent"
+	PullPolicyAlways       = "Always"
+)
+
+type ContainerStatus struct {
+	State        string
+	ExitCode     int
+	RestartCount int
+
+	// OOMKilled is set if the container's last exit was due to it running out of memory
+	OOMKilled bool
+}
+
+type ContainerStats struct {
+	CPUNanoCores uint64
+	MemoryBytes  uint64
+}
+
+// ContainerOptions holds the optional settings of a created container
+type ContainerOptions struct {
+
+	// SELinuxLabel is the container's SELinux context (user:role:type:level)
+	SELinuxLabel string
+
+	// AutoRemove removes the container once it exits
+	AutoRemove bool
+
+	// Hostname is the container's hostname, or the runtime's default if empty
+	Hostname string
+
+	// RestartPolicy is one of RestartPolicyNo, RestartPolicyOnFailure and RestartPolicyAlways. With on-failure,
+	// RestartMaxRetries bounds the number of restarts (0 is unbounded)
+	RestartPolicy     string
+	RestartMaxRetries int
+
+	// Labels are set on the container
+	Labels map[string]string
+
+	// OverrideEntrypoint runs the first arg as the container's command. Otherwise runtimes that run the image's
+	// entrypoint (docker) pass it only the rest of the args
+	OverrideEntrypoint bool
+
+	// RegistryAuthConfigPath is a docker config.json with the credentials of the image's registry, used if
+	// creating the container pulls the image
+	RegistryAuthConfigPath string
+
+	// Capabilities run the container unprivileged, with only these capabilities (without the CAP_ prefix) and
+	// Devices. Unset runs it privileged, with all devices
+	Capabilities []string
+	Devices      []string
+
+	// LogDriver is where the container's output goes (e.g. journald), with driver specific LogOptions, or the
+	// runtime's default if empty. Runtimes other than docker only support LogDriverNone
+	LogDriver  string
+	LogOptions map[string]string
+}
+
+// Timeouts bound the CRI calls of each type of operation (0 is unbounded). Image pulls are bounded by their
+// PullOptions
+type Timeouts struct {
+	Create  time.Duration
+	Remove  time.Duration
+	Inspect time.Duration
+}
+
+// PullOptions holds the optional settings of an image pull
+type PullOptions struct {
+
+	// Timeout bounds the pull (0 is unbounded)
+	Timeout time.Duration
+
+	// Policy is PullPolicyIfNotPresent, which skips the pull if the image is present locally, or PullPolicyAlways.
+	// Defaults to PullPolicyIfNotPresent if empty
+	Policy string
+
+	// RegistryAuthConfigPath is a docker config.json with the credentials of the image's registry, for private
+	// registries
+	RegistryAuthConfigPath string
+}
+
+// withOperationTimeout bounds a context by an operation's timeout, unless it's unbounded
+func withOperationTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
 type CRI interface {
 
 	// CreateContainer creates a container
-	CreateContainer(string, string, string, []string) error
+	CreateContainer(string, string, string, []string, ContainerOptions) error
 
-	// RemoveContainer removes a container
+	// RemoveContainer removes a container. Removing a container that doesn't exist succeeds
 	RemoveContainer(string) error
 
+	// ContainerStatus returns the state of a container
+	ContainerStatus(string) (*ContainerStatus, error)
+
+	// ImageLabels returns the labels of a local image
+	ImageLabels(string) (map[string]string, error)
+
+	// ImageDigest returns the digest of a local image's config (its ID), which changes with the image's contents
+	ImageDigest(string) (string, error)
+
+	// ExecInContainer runs a command in a running container, returning its output. A command that exits with a
+	// non-zero code fails
+	ExecInContainer(string, []string) (string, error)
+
+	// PullImage pulls an image, unless it's present locally and the pull policy allows using it
+	PullImage(string, PullOptions) error
+
+	// Stats returns the resource usage of a container, or ErrStatsUnsupported
+	Stats(string) (ContainerStats, error)
+
+	// ContainerLogs returns the last lines of a container's output (all of it if 0)
+	ContainerLogs(string, int) (string, error)
+
+	// ListContainers returns the names of all containers whose name starts with a prefix, running or not
+	ListContainers(string) ([]string, error)
+
+	// RenameContainer renames a container, or returns ErrRenameUnsupported
+	RenameContainer(string, string) error
+
+	// Name returns the name of the runtime
+	Name() string
+
 	// Close closes a CRI
 	Close() error
 }
@@ -0,0 +1,669 @@
+package cri
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/common"
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+// namespace and mount propagation modes, as numbered by the CRI API
+const (
+	crioNamespaceModeNode             = 2
+	crioMountPropagationBidirectional = 2
+)
+
+// CRIO drives CRI-O through crictl. CRI-O only runs containers in pod sandboxes, so every fuse container gets a
+// host network sandbox of the same name
+type CRIO struct {
+	crictlBinaryPath string
+	runtimeEndpoint  string
+	podNamespace     string
+	timeouts         Timeouts
+}
+
+func NewCRIO(crictlBinaryPath string, crioSock string, podNamespace string, timeouts Timeouts) (*CRIO, error) {
+	return &CRIO{
+		crictlBinaryPath: crictlBinaryPath,
+		runtimeEndpoint:  "unix://" + crioSock,
+		podNamespace:     podNamespace,
+		timeouts:         timeouts,
+	}, nil
+}
+
+type crioMetadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	UID       string `json:"uid,omitempty"`
+}
+
+type crioSELinuxOptions struct {
+	User  string `json:"user"`
+	Role  string `json:"role"`
+	Type  string `json:"type"`
+	Level string `json:"level"`
+}
+
+type crioCapabilities struct {
+	AddCapabilities []string `json:"add_capabilities"`
+}
+
+type crioSecurityContext struct {
+	Privileged       bool                `json:"privileged"`
+	Capabilities     *crioCapabilities   `json:"capabilities,omitempty"`
+	NamespaceOptions map[string]int      `json:"namespace_options,omitempty"`
+	SELinuxOptions   *crioSELinuxOptions `json:"selinux_options,omitempty"`
+}
+
+type crioDevice struct {
+	ContainerPath string `json:"container_path"`
+	HostPath      string `json:"host_path"`
+	Permissions   string `json:"permissions"`
+}
+
+type crioLinuxConfig struct {
+	CgroupParent    string              `json:"cgroup_parent,omitempty"`
+	SecurityContext crioSecurityContext `json:"security_context"`
+}
+
+type crioPodSandboxConfig struct {
+	Metadata crioMetadata      `json:"metadata"`
+	Hostname string            `json:"hostname,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Linux    crioLinuxConfig   `json:"linux"`
+}
+
+type crioMount struct {
+	ContainerPath string `json:"container_path"`
+	HostPath      string `json:"host_path"`
+	Propagation   int    `json:"propagation,omitempty"`
+}
+
+type crioContainerConfig struct {
+	Metadata crioMetadata      `json:"metadata"`
+	Image    map[string]string `json:"image"`
+	Command  []string          `json:"command"`
+	Args     []string          `json:"args"`
+	Mounts   []crioMount       `json:"mounts"`
+	Devices  []crioDevice      `json:"devices,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Linux    crioLinuxConfig   `json:"linux"`
+}
+
+// CreateContainer creates a container
+func (c *CRIO) CreateContainer(image string,
+	containerName string,
+	targetPath string,
+	args []string,
+	options ContainerOptions) error {
+
+	// CRI has no restart policies or auto removal, kubelet implements them for pods
+	if (options.RestartPolicy != "" && options.RestartPolicy != RestartPolicyNo) || options.AutoRemove {
+		journal.Warn("CRI-O doesn't support restart policies or auto removal, ignoring them",
+			"containerName", containerName,
+			"restartPolicy", options.RestartPolicy,
+			"autoRemove", options.AutoRemove)
+	}
+
+	// CRI-O logs every container to its own log directory
+	if options.LogDriver != "" {
+		journal.Warn("Log driver isn't supported by CRI-O, ignoring it",
+			"containerName", containerName,
+			"logDriver", options.LogDriver)
+	}
+
+	securityContext := crioSecurityContext{
+		Privileged: len(options.Capabilities) == 0,
+	}
+
+	if options.SELinuxLabel != "" {
+		labelParts := strings.SplitN(options.SELinuxLabel, ":", 4)
+		securityContext.SELinuxOptions = &crioSELinuxOptions{
+			User:  labelParts[0],
+			Role:  labelParts[1],
+			Type:  labelParts[2],
+			Level: labelParts[3],
+		}
+	}
+
+	podSandboxSecurityContext := securityContext
+	podSandboxSecurityContext.NamespaceOptions = map[string]int{"network": crioNamespaceModeNode}
+
+	podSandboxConfig := crioPodSandboxConfig{
+		Metadata: crioMetadata{
+			Name:      containerName,
+			Namespace: c.podNamespace,
+			UID:       containerName,
+		},
+		Hostname: options.Hostname,
+		Labels:   options.Labels,
+		Linux: crioLinuxConfig{
+			CgroupParent:    "/kubepods",
+			SecurityContext: podSandboxSecurityContext,
+		},
+	}
+
+	containerConfig := crioContainerConfig{
+		Metadata: crioMetadata{Name: containerName},
+		Image:    map[string]string{"image": image},
+		Command:  args[:1],
+		Args:     args[1:],
+		Mounts: []crioMount{
+			{ContainerPath: "/etc/v3io/fuse", HostPath: "/etc/v3io/fuse"},
+			{
+				ContainerPath: "/fuse_mount",
+				HostPath:      targetPath,
+				Propagation:   crioMountPropagationBidirectional,
+			},
+		},
+		Labels: options.Labels,
+		Linux: crioLinuxConfig{
+			SecurityContext: securityContext,
+		},
+	}
+
+	// the pod sandbox only needs to share the node's network, so the capabilities are only the container's
+	if len(options.Capabilities) > 0 {
+		containerConfig.Linux.SecurityContext.Capabilities = &crioCapabilities{AddCapabilities: options.Capabilities}
+
+		for _, device := range options.Devices {
+			containerConfig.Devices = append(containerConfig.Devices, crioDevice{
+				ContainerPath: device,
+				HostPath:      device,
+				Permissions:   "rwm",
+			})
+		}
+	} else {
+		containerConfig.Mounts = append(containerConfig.Mounts, crioMount{
+			ContainerPath: "/dev/fuse",
+			HostPath:      "/dev/fuse",
+		})
+	}
+
+	podSandboxConfigPath, err := writeCRIOConfig("pod", podSandboxConfig)
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(podSandboxConfigPath) // nolint: errcheck
+
+	containerConfigPath, err := writeCRIOConfig("container", containerConfig)
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(containerConfigPath) // nolint: errcheck
+
+	ctx, cancel := withOperationTimeout(context.Background(), c.timeouts.Create)
+	defer cancel()
+
+	podSandboxID, err := c.runCrictl(ctx, "runp", podSandboxConfigPath)
+	if err != nil {
+		if strings.Contains(err.Error(), "is reserved") {
+			return fmt.Errorf("%w: %s", ErrContainerNameInUse, containerName)
+		}
+
+		return fmt.Errorf("Failed to create pod sandbox of v3io-fuse container %s: %s", targetPath, err)
+	}
+
+	containerID, err := c.runCrictl(ctx,
+		"create",
+		podSandboxID,
+		containerConfigPath,
+		podSandboxConfigPath)
+
+	if err == nil {
+		_, err = c.runCrictl(ctx, "start", containerID)
+	}
+
+	if err != nil {
+
+		// the sandbox is removed even if creating it timed out
+		c.removePodSandbox(context.Background(), podSandboxID) // nolint: errcheck
+
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("Timed out creating v3io-fuse container %s after %s", targetPath, c.timeouts.Create)
+		}
+
+		// CRI-O doesn't pull images on create, so a missing image is one that wasn't pulled or doesn't exist
+		if strings.Contains(err.Error(), "image not known") {
+			return fmt.Errorf("%w: %s: %s", ErrImageNotFound, image, err)
+		}
+
+		return fmt.Errorf("Failed to create v3io-fuse container %s: %s", targetPath, err)
+	}
+
+	return nil
+}
+
+// RemoveContainer removes a container, along with its pod sandbox
+func (c *CRIO) RemoveContainer(containerName string) error {
+	ctx, cancel := withOperationTimeout(context.Background(), c.timeouts.Remove)
+	defer cancel()
+
+	podSandboxIDs, err := c.runCrictl(ctx, "pods", "--name", anchorName(containerName), "--quiet")
+	if err != nil {
+		return fmt.Errorf("Failed to find pod sandbox of container %s: %s", containerName, err)
+	}
+
+	if podSandboxIDs == "" {
+		journal.Debug("Container not found, nothing to remove", "containerName", containerName)
+		return nil
+	}
+
+	for _, podSandboxID := range strings.Fields(podSandboxIDs) {
+		if err := c.removePodSandbox(ctx, podSandboxID); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("Timed out removing container %s after %s", containerName, c.timeouts.Remove)
+			}
+
+			return fmt.Errorf("Failed to remove container %s: %s", containerName, err)
+		}
+	}
+
+	return nil
+}
+
+// ContainerStatus returns the state of a container
+func (c *CRIO) ContainerStatus(containerName string) (*ContainerStatus, error) {
+	ctx, cancel := withOperationTimeout(context.Background(), c.timeouts.Inspect)
+	defer cancel()
+
+	containerID, err := c.getContainerID(ctx, containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	if containerID == "" {
+		return &ContainerStatus{State: ContainerStateNotFound}, nil
+	}
+
+	crictlOutput, err := c.runCrictl(ctx, "inspect", "--output", "json", containerID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect container %s: %s", containerName, err)
+	}
+
+	inspectOutput := struct {
+		Status struct {
+			Metadata struct {
+				Attempt int `json:"attempt"`
+			} `json:"metadata"`
+			State    string `json:"state"`
+			ExitCode int    `json:"exitCode"`
+			Reason   string `json:"reason"`
+		} `json:"status"`
+	}{}
+
+	if err := json.Unmarshal([]byte(crictlOutput), &inspectOutput); err != nil {
+		return nil, fmt.Errorf("Failed to parse crictl inspect output for %s: %s", containerName, err)
+	}
+
+	status := ContainerStatus{
+		ExitCode:     inspectOutput.Status.ExitCode,
+		RestartCount: inspectOutput.Status.Metadata.Attempt,
+		OOMKilled:    inspectOutput.Status.Reason == "OOMKilled",
+	}
+
+	switch inspectOutput.Status.State {
+	case "CONTAINER_RUNNING":
+		status.State = ContainerStateRunning
+	case "CONTAINER_CREATED":
+		status.State = ContainerStateCreated
+	case "CONTAINER_EXITED":
+		status.State = ContainerStateExited
+	default:
+		status.State = ContainerStateUnknown
+	}
+
+	return &status, nil
+}
+
+// ImageLabels returns the labels of a local image
+func (c *CRIO) ImageLabels(image string) (map[string]string, error) {
+	ctx, cancel := withOperationTimeout(context.Background(), c.timeouts.Inspect)
+	defer cancel()
+
+	crictlOutput, err := c.runCrictl(ctx, "inspecti", "--output", "json", image)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect image %s: %s", image, err)
+	}
+
+	// CRI-O reports the image's OCI config in the verbose info
+	inspectOutput := struct {
+		Info struct {
+			ImageSpec struct {
+				Config struct {
+					Labels map[string]string `json:"Labels"`
+				} `json:"config"`
+			} `json:"imageSpec"`
+		} `json:"info"`
+	}{}
+
+	if err := json.Unmarshal([]byte(crictlOutput), &inspectOutput); err != nil {
+		return nil, fmt.Errorf("Failed to parse labels of image %s: %s", image, err)
+	}
+
+	labels := inspectOutput.Info.ImageSpec.Config.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	return labels, nil
+}
+
+// ImageDigest returns the digest of a local image's config
+func (c *CRIO) ImageDigest(image string) (string, error) {
+	ctx, cancel := withOperationTimeout(context.Background(), c.timeouts.Inspect)
+	defer cancel()
+
+	crictlOutput, err := c.runCrictl(ctx, "inspecti", "--output", "json", image)
+	if err != nil {
+		return "", fmt.Errorf("Failed to inspect image %s: %s", image, err)
+	}
+
+	inspectOutput := struct {
+		Status struct {
+			ID string `json:"id"`
+		} `json:"status"`
+	}{}
+
+	if err := json.Unmarshal([]byte(crictlOutput), &inspectOutput); err != nil {
+		return "", fmt.Errorf("Failed to parse crictl inspecti output for %s: %s", image, err)
+	}
+
+	return inspectOutput.Status.ID, nil
+}
+
+// ExecInContainer runs a command in a running container
+func (c *CRIO) ExecInContainer(containerName string, command []string) (string, error) {
+	containerID, err := c.getContainerID(context.Background(), containerName)
+	if err != nil {
+		return "", err
+	}
+
+	if containerID == "" {
+		return "", fmt.Errorf("Container %s not found", containerName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	crictlOutput, err := c.runCrictl(ctx, append([]string{"exec", containerID}, command...)...)
+	if err != nil {
+		return crictlOutput, fmt.Errorf("Failed to execute %v in container %s: %s", command, containerName, err)
+	}
+
+	return crictlOutput, nil
+}
+
+// ContainerLogs returns the last lines of a container's output
+func (c *CRIO) ContainerLogs(containerName string, tailLines int) (string, error) {
+	containerID, err := c.getContainerID(context.Background(), containerName)
+	if err != nil {
+		return "", err
+	}
+
+	if containerID == "" {
+		return "", fmt.Errorf("Container %s not found", containerName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	args := []string{"--runtime-endpoint", c.runtimeEndpoint, "logs"}
+	if tailLines > 0 {
+		args = append(args, "--tail", strconv.Itoa(tailLines))
+	}
+
+	// crictl writes the container's stderr to its own, so both are needed
+	crictlCommand := exec.CommandContext(ctx, c.crictlBinaryPath, append(args, containerID)...)
+
+	journal.Debug("Executing crictl command", "path", crictlCommand.Path, "args", crictlCommand.Args)
+	crictlOutput, err := crictlCommand.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get logs of container %s: [%s] %s", containerName, err.Error(), crictlOutput)
+	}
+
+	return string(crictlOutput), nil
+}
+
+// PullImage pulls an image, unless it's present locally and the pull policy allows using it
+func (c *CRIO) PullImage(image string, options PullOptions) error {
+	if options.Policy != PullPolicyAlways {
+		if _, err := c.ImageDigest(image); err == nil {
+			return nil
+		}
+	}
+
+	var pullEnv []string
+
+	// the credentials are passed in crictl's environment, which unlike its command line only its user can read
+	if options.RegistryAuthConfigPath != "" {
+		username, password, err := getRegistryCredentials(options.RegistryAuthConfigPath, getImageRegistryHost(image))
+		if err != nil {
+			return err
+		}
+
+		if username != "" {
+			pullEnv = append(pullEnv,
+				"CRICTL_AUTH="+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+		}
+	}
+
+	ctx, cancel := withOperationTimeout(context.Background(), options.Timeout)
+	defer cancel()
+
+	journal.Info("Pulling image", "image", image, "timeout", options.Timeout)
+	pullStartTime := time.Now()
+
+	if _, err := c.runCrictlWithEnv(ctx, pullEnv, "pull", image); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("Timed out pulling image %s after %s", image, time.Since(pullStartTime))
+		}
+
+		return fmt.Errorf("Failed to pull image %s: %s", image, err)
+	}
+
+	journal.Info("Pulled image", "image", image, "duration", time.Since(pullStartTime))
+
+	return nil
+}
+
+// ListContainers returns the names of all containers whose name starts with a prefix. Every container has a pod
+// sandbox of its name, which outlives it, so the sandboxes are listed
+func (c *CRIO) ListContainers(prefix string) ([]string, error) {
+	ctx, cancel := withOperationTimeout(context.Background(), c.timeouts.Inspect)
+	defer cancel()
+
+	crictlOutput, err := c.runCrictl(ctx, "pods", "--name", "^"+regexp.QuoteMeta(prefix), "--output", "json")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list pod sandboxes: %s", err)
+	}
+
+	podsOutput := struct {
+		Items []struct {
+			Metadata crioMetadata `json:"metadata"`
+		} `json:"items"`
+	}{}
+
+	if err := json.Unmarshal([]byte(crictlOutput), &podsOutput); err != nil {
+		return nil, fmt.Errorf("Failed to parse crictl pods output: %s", err)
+	}
+
+	var containerNames []string
+	for _, pod := range podsOutput.Items {
+		if strings.HasPrefix(pod.Metadata.Name, prefix) {
+			containerNames = append(containerNames, pod.Metadata.Name)
+		}
+	}
+
+	return containerNames, nil
+}
+
+// RenameContainer isn't supported, as CRI-O names containers and their pod sandboxes for good
+func (c *CRIO) RenameContainer(containerName string, newContainerName string) error {
+	return ErrRenameUnsupported
+}
+
+// Stats returns the resource usage of a container
+func (c *CRIO) Stats(containerName string) (ContainerStats, error) {
+	containerID, err := c.getContainerID(context.Background(), containerName)
+	if err != nil {
+		return ContainerStats{}, err
+	}
+
+	if containerID == "" {
+		return ContainerStats{}, fmt.Errorf("Container %s not found", containerName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	crictlOutput, err := c.runCrictl(ctx, "stats", "--output", "json", "--id", containerID)
+	if ctx.Err() != nil {
+		return ContainerStats{}, fmt.Errorf("Timed out getting stats of container %s", containerName)
+	}
+
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("Failed to get stats of container %s: %s", containerName, err)
+	}
+
+	// 64 bit values are formatted as strings
+	type uint64Value struct {
+		Value string `json:"value"`
+	}
+
+	statsOutput := struct {
+		Stats []struct {
+			CPU struct {
+				UsageNanoCores *uint64Value `json:"usageNanoCores"`
+			} `json:"cpu"`
+			Memory struct {
+				WorkingSetBytes *uint64Value `json:"workingSetBytes"`
+			} `json:"memory"`
+		} `json:"stats"`
+	}{}
+
+	if err := json.Unmarshal([]byte(crictlOutput), &statsOutput); err != nil {
+		return ContainerStats{}, fmt.Errorf("Failed to parse crictl stats output for %s: %s", containerName, err)
+	}
+
+	if len(statsOutput.Stats) == 0 ||
+		statsOutput.Stats[0].CPU.UsageNanoCores == nil ||
+		statsOutput.Stats[0].Memory.WorkingSetBytes == nil {
+		return ContainerStats{}, ErrStatsUnsupported
+	}
+
+	cpuNanoCores, err := strconv.ParseUint(statsOutput.Stats[0].CPU.UsageNanoCores.Value, 10, 64)
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("Failed to parse CPU usage of %s: %s", containerName, err)
+	}
+
+	memoryBytes, err := strconv.ParseUint(statsOutput.Stats[0].Memory.WorkingSetBytes.Value, 10, 64)
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("Failed to parse memory usage of %s: %s", containerName, err)
+	}
+
+	return ContainerStats{
+		CPUNanoCores: cpuNanoCores,
+		MemoryBytes:  memoryBytes,
+	}, nil
+}
+
+// Name returns the name of the runtime
+func (c *CRIO) Name() string {
+	return "crio"
+}
+
+func (c *CRIO) Close() error {
+	return nil
+}
+
+// getContainerID returns the ID of the latest container of a name, or an empty string if there's none
+func (c *CRIO) getContainerID(ctx context.Context, containerName string) (string, error) {
+	containerIDs, err := c.runCrictl(ctx,
+		"ps",
+		"--all",
+		"--latest",
+		"--name", anchorName(containerName),
+		"--quiet")
+
+	if err != nil {
+		return "", fmt.Errorf("Failed to find container %s: %s", containerName, err)
+	}
+
+	return containerIDs, nil
+}
+
+func (c *CRIO) removePodSandbox(ctx context.Context, podSandboxID string) error {
+	if _, err := c.runCrictl(ctx, "stopp", podSandboxID); err != nil {
+		return err
+	}
+
+	_, err := c.runCrictl(ctx, "rmp", podSandboxID)
+
+	return err
+}
+
+// runCrictl runs a crictl command against the CRI-O socket, returning its trimmed output
+func (c *CRIO) runCrictl(ctx context.Context, args ...string) (string, error) {
+	return c.runCrictlWithEnv(ctx, nil, args...)
+}
+
+// runCrictlWithEnv is runCrictl with variables added to crictl's environment, which isn't logged
+func (c *CRIO) runCrictlWithEnv(ctx context.Context, env []string, args ...string) (string, error) {
+	crictlCommand := exec.CommandContext(ctx,
+		c.crictlBinaryPath,
+		append([]string{"--runtime-endpoint", c.runtimeEndpoint}, args...)...)
+
+	if len(env) > 0 {
+		crictlCommand.Env = append(os.Environ(), env...)
+	}
+
+	journal.Debug("Executing crictl command",
+		"path", crictlCommand.Path,
+		"args", common.RedactSecrets(crictlCommand.Args))
+	crictlOutput, err := crictlCommand.Output()
+	if err != nil {
+		stderr := ""
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = string(exitErr.Stderr)
+		}
+
+		return strings.TrimSpace(string(crictlOutput)), fmt.Errorf("[%s] %s", err.Error(), stderr)
+	}
+
+	return strings.TrimSpace(string(crictlOutput)), nil
+}
+
+// writeCRIOConfig writes a pod sandbox or container config for crictl to a temporary file
+func writeCRIOConfig(kind string, config interface{}) (string, error) {
+	configFile, err := ioutil.TempFile("", fmt.Sprintf("v3io-fuse-%s-*.json", kind))
+	if err != nil {
+		return "", fmt.Errorf("Failed to create %s config file: %s", kind, err)
+	}
+
+	defer configFile.Close() // nolint: errcheck
+
+	if err := json.NewEncoder(configFile).Encode(config); err != nil {
+		os.Remove(configFile.Name()) // nolint: errcheck
+		return "", fmt.Errorf("Failed to write %s config file: %s", kind, err)
+	}
+
+	return configFile.Name(), nil
+}
+
+// anchorName turns a name into a crictl name filter matching it exactly, as crictl filters by regular expression
+func anchorName(name string) string {
+	return "^" + name + "$"
+}
@@ -0,0 +1,60 @@
+package cri
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCrictlScript is a crictl that records its command line and the credentials in its environment
+const fakeCrictlScript = `#!/bin/sh
+echo "$*" >> %s/calls
+echo "$CRICTL_AUTH" >> %s/auths
+`
+
+func TestCRIOPullImageCredentials(t *testing.T) {
+	configPath := writeRegistryAuthConfig(t, testRegistryAuthConfig)
+
+	for _, testCase := range []struct {
+		name         string
+		image        string
+		expectedAuth string
+	}{
+		{name: "registry with credentials", image: "registry.local:5000/iguazio/v3io-fuse:3.5.0",
+			expectedAuth: base64.StdEncoding.EncodeToString([]byte("fuse:s3cr3t"))},
+		{name: "registry without credentials", image: "quay.io/iguazio/v3io-fuse:3.5.0"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			recordsDir := t.TempDir()
+			crictlBinaryPath := filepath.Join(recordsDir, "crictl")
+
+			script := strings.Replace(fakeCrictlScript, "%s", recordsDir, -1)
+			if err := ioutil.WriteFile(crictlBinaryPath, []byte(script), 0755); err != nil {
+				t.Fatalf("Failed to write fake crictl: %s", err)
+			}
+
+			crio, _ := NewCRIO(crictlBinaryPath, "/run/crio/crio.sock", "", Timeouts{})
+
+			if err := crio.PullImage(testCase.image, PullOptions{
+				Policy:                 PullPolicyAlways,
+				RegistryAuthConfigPath: configPath,
+			}); err != nil {
+				t.Fatalf("Expected the pull to succeed, got %s", err)
+			}
+
+			calls, _ := ioutil.ReadFile(filepath.Join(recordsDir, "calls"))
+			expectedCall := "--runtime-endpoint unix:///run/crio/crio.sock pull " + testCase.image
+			if strings.TrimSpace(string(calls)) != expectedCall {
+				t.Fatalf("Expected command line %q, got %q", expectedCall, calls)
+			}
+
+			// the credentials stay off the command line, which any user of the node can read
+			auths, _ := ioutil.ReadFile(filepath.Join(recordsDir, "auths"))
+			if strings.TrimSpace(string(auths)) != testCase.expectedAuth {
+				t.Fatalf("Expected auth %q, got %q", testCase.expectedAuth, auths)
+			}
+		})
+	}
+}
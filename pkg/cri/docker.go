@@ -1,18 +1,32 @@
 package cri
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/v3io/flex-fuse/pkg/common"
 	"github.com/v3io/flex-fuse/pkg/journal"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Docker struct {
 	dockerBinaryPath string
+	dockerHost       string
+	timeouts         Timeouts
 }
 
-func NewDocker(dockerBinaryPath string) (*Docker, error) {
+// NewDocker creates a docker CRI, which talks to the daemon at dockerHost (e.g. unix:///var/run/docker.sock), or
+// to the CLI's default daemon if empty
+func NewDocker(dockerBinaryPath string, dockerHost string, timeouts Timeouts) (*Docker, error) {
 	return &Docker{
 		dockerBinaryPath: dockerBinaryPath,
+		dockerHost:       dockerHost,
+		timeouts:         timeouts,
 	}, nil
 }
 
@@ -20,34 +34,130 @@ func NewDocker(dockerBinaryPath string) (*Docker, error) {
 func (d *Docker) CreateContainer(image string,
 	containerName string,
 	targetPath string,
-	args []string) error {
+	args []string,
+	options ContainerOptions) error {
 
 	// Create the new container
 	dockerCommandArgs := []string{
 		"run",
 		"--detach",
-		"--privileged",
 		"-v", "/etc/v3io/fuse:/etc/v3io/fuse",
 		"--name",
 		containerName,
 		"--cgroup-parent",
 		"/kubepods",
-		"--device",
-		"/dev/fuse",
 		"--net=host",
 		"--mount",
 		fmt.Sprintf("type=bind,src=%s,target=/fuse_mount,bind-propagation=shared", targetPath),
-		image,
 	}
 
-	// add the args, but skip the executable name, as the docker image already points to it
+	if options.OverrideEntrypoint {
+		dockerCommandArgs = append(dockerCommandArgs, "--entrypoint", args[0])
+	}
+
+	if len(options.Capabilities) > 0 {
+		for _, capability := range options.Capabilities {
+			dockerCommandArgs = append(dockerCommandArgs, "--cap-add", capability)
+		}
+
+		for _, device := range options.Devices {
+			dockerCommandArgs = append(dockerCommandArgs, "--device", device)
+		}
+	} else {
+		dockerCommandArgs = append(dockerCommandArgs, "--privileged", "--device", "/dev/fuse")
+	}
+
+	if options.AutoRemove {
+		dockerCommandArgs = append(dockerCommandArgs, "--rm")
+	}
+
+	if options.Hostname != "" {
+		dockerCommandArgs = append(dockerCommandArgs, "--hostname", options.Hostname)
+	}
+
+	labelNames := make([]string, 0, len(options.Labels))
+	for labelName := range options.Labels {
+		labelNames = append(labelNames, labelName)
+	}
+
+	sort.Strings(labelNames)
+
+	for _, labelName := range labelNames {
+		dockerCommandArgs = append(dockerCommandArgs,
+			"--label",
+			fmt.Sprintf("%s=%s", labelName, options.Labels[labelName]))
+	}
+
+	if options.LogDriver != "" {
+		dockerCommandArgs = append(dockerCommandArgs, "--log-driver", options.LogDriver)
+
+		logOptionNames := make([]string, 0, len(options.LogOptions))
+		for logOptionName := range options.LogOptions {
+			logOptionNames = append(logOptionNames, logOptionName)
+		}
+
+		sort.Strings(logOptionNames)
+
+		for _, logOptionName := range logOptionNames {
+			dockerCommandArgs = append(dockerCommandArgs,
+				"--log-opt",
+				fmt.Sprintf("%s=%s", logOptionName, options.LogOptions[logOptionName]))
+		}
+	}
+
+	switch options.RestartPolicy {
+	case RestartPolicyOnFailure:
+		restartPolicy := RestartPolicyOnFailure
+		if options.RestartMaxRetries > 0 {
+			restartPolicy = fmt.Sprintf("%s:%d", RestartPolicyOnFailure, options.RestartMaxRetries)
+		}
+
+		dockerCommandArgs = append(dockerCommandArgs, "--restart", restartPolicy)
+	case RestartPolicyAlways:
+		dockerCommandArgs = append(dockerCommandArgs, "--restart", RestartPolicyAlways)
+	}
+
+	if options.SELinuxLabel != "" {
+
+		// docker takes the context's parts as separate label options
+		labelParts := strings.SplitN(options.SELinuxLabel, ":", 4)
+		for labelPartIdx, labelPartName := range []string{"user", "role", "type", "level"} {
+			dockerCommandArgs = append(dockerCommandArgs,
+				"--security-opt",
+				fmt.Sprintf("label=%s:%s", labelPartName, labelParts[labelPartIdx]))
+		}
+	}
+
+	dockerCommandArgs = append(dockerCommandArgs, image)
+
+	// add the args, skipping the executable name, which is either the image's entrypoint or was passed as it
 	dockerCommandArgs = append(dockerCommandArgs, args[1:]...)
 
+	// docker run pulls a missing image, which may need the registry's credentials
+	dockerCommandArgs = withRegistryAuthConfig(dockerCommandArgs, options.RegistryAuthConfigPath)
+
+	ctx, cancel := withOperationTimeout(context.Background(), d.timeouts.Create)
+	defer cancel()
+
 	// execute the command
-	dockerCommand := exec.Command(d.dockerBinaryPath, dockerCommandArgs...)
+	dockerCommand := d.command(ctx, dockerCommandArgs...)
 
-	journal.Debug("Executing docker run command", "path", dockerCommand.Path, "args", dockerCommand.Args)
+	journal.Debug("Executing docker run command", "path", dockerCommand.Path, "args", common.RedactSecrets(dockerCommand.Args))
 	if dockerCommandOutput, err := dockerCommand.CombinedOutput(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("Timed out creating v3io-fuse container %s after %s", targetPath, d.timeouts.Create)
+		}
+
+		if strings.Contains(string(dockerCommandOutput), "is already in use") {
+			return fmt.Errorf("%w: %s", ErrContainerNameInUse, containerName)
+		}
+
+		// docker run pulls a missing image, and only fails this way if the registry doesn't have it either
+		if strings.Contains(string(dockerCommandOutput), "manifest unknown") ||
+			strings.Contains(string(dockerCommandOutput), "pull access denied") {
+			return fmt.Errorf("%w: %s: %s", ErrImageNotFound, image, string(dockerCommandOutput))
+		}
+
 		return fmt.Errorf("Failed to create v3io-fuse container %s: [%s] %s",
 			targetPath,
 			err.Error(),
@@ -65,16 +175,386 @@ func (d *Docker) RemoveContainer(containerName string) error {
 		containerName,
 	}
 
-	dockerCommand := exec.Command(d.dockerBinaryPath, args...)
+	ctx, cancel := withOperationTimeout(context.Background(), d.timeouts.Remove)
+	defer cancel()
+
+	dockerCommand := d.command(ctx, args...)
+
+	journal.Debug("Executing docker rm command", "path", dockerCommand.Path, "args", common.RedactSecrets(dockerCommand.Args))
+	if dockerCommandOutput, err := dockerCommand.CombinedOutput(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("Timed out removing container %s after %s", containerName, d.timeouts.Remove)
+		}
+
+		// the container may have already removed itself
+		if strings.Contains(string(dockerCommandOutput), "No such container") {
+			journal.Debug("Container not found, nothing to remove", "containerName", containerName)
+			return nil
+		}
+
+		return fmt.Errorf("Failed to remove container %s: [%s] %s",
+			containerName,
+			err.Error(),
+			string(dockerCommandOutput))
+	}
+
+	return nil
+}
+
+// ContainerStatus returns the state of a container
+func (d *Docker) ContainerStatus(containerName string) (*ContainerStatus, error) {
+	args := []string{
+		"inspect",
+		"--format",
+		"{{.State.Status}} {{.State.ExitCode}} {{.RestartCount}} {{.State.OOMKilled}}",
+		containerName,
+	}
+
+	ctx, cancel := withOperationTimeout(context.Background(), d.timeouts.Inspect)
+	defer cancel()
+
+	dockerCommand := d.command(ctx, args...)
+
+	journal.Debug("Executing docker inspect command", "path", dockerCommand.Path, "args", common.RedactSecrets(dockerCommand.Args))
+	dockerCommandOutput, err := dockerCommand.CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(dockerCommandOutput), "No such") {
+			return &ContainerStatus{State: ContainerStateNotFound}, nil
+		}
+
+		return nil, fmt.Errorf("Failed to inspect container %s: [%s] %s",
+			containerName,
+			err.Error(),
+			string(dockerCommandOutput))
+	}
+
+	fields := strings.Fields(string(dockerCommandOutput))
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("Unexpected docker inspect output for %s: %s", containerName, dockerCommandOutput)
+	}
+
+	exitCode, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse exit code of %s: %s", containerName, err)
+	}
+
+	restartCount, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse restart count of %s: %s", containerName, err)
+	}
+
+	oomKilled, err := strconv.ParseBool(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse OOM killed state of %s: %s", containerName, err)
+	}
+
+	status := ContainerStatus{
+		ExitCode:     exitCode,
+		RestartCount: restartCount,
+		OOMKilled:    oomKilled,
+	}
+
+	switch fields[0] {
+	case "running", "restarting":
+		status.State = ContainerStateRunning
+	case "created":
+		status.State = ContainerStateCreated
+	case "exited", "dead":
+		status.State = ContainerStateExited
+	default:
+		status.State = ContainerStateUnknown
+	}
+
+	return &status, nil
+}
+
+// ImageLabels returns the labels of a local image
+func (d *Docker) ImageLabels(image string) (map[string]string, error) {
+	args := []string{
+		"image",
+		"inspect",
+		"--format",
+		"{{json .Config.Labels}}",
+		image,
+	}
+
+	ctx, cancel := withOperationTimeout(context.Background(), d.timeouts.Inspect)
+	defer cancel()
+
+	dockerCommand := d.command(ctx, args...)
+
+	journal.Debug("Executing docker image inspect command", "path", dockerCommand.Path, "args", common.RedactSecrets(dockerCommand.Args))
+	dockerCommandOutput, err := dockerCommand.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect image %s: %s", image, err)
+	}
+
+	labels := map[string]string{}
+	if err := json.Unmarshal(dockerCommandOutput, &labels); err != nil {
+		return nil, fmt.Errorf("Failed to parse labels of image %s: %s", image, err)
+	}
+
+	return labels, nil
+}
+
+// ImageDigest returns the digest of a local image's config
+func (d *Docker) ImageDigest(image string) (string, error) {
+	ctx, cancel := withOperationTimeout(context.Background(), d.timeouts.Inspect)
+	defer cancel()
+
+	dockerCommand := d.command(ctx, "image", "inspect", "--format", "{{.Id}}", image)
+
+	journal.Debug("Executing docker image inspect command", "path", dockerCommand.Path, "args", common.RedactSecrets(dockerCommand.Args))
+	dockerCommandOutput, err := dockerCommand.Output()
+	if err != nil {
+		return "", fmt.Errorf("Failed to inspect image %s: %s", image, err)
+	}
+
+	return strings.TrimSpace(string(dockerCommandOutput)), nil
+}
+
+// Ping checks that the docker daemon is reachable
+func (d *Docker) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	dockerCommand := d.command(ctx, "version", "--format", "{{.Server.Version}}")
+
+	dockerCommandOutput, err := dockerCommand.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("Failed to reach docker daemon: [%s] %s", err.Error(), string(dockerCommandOutput))
+	}
+
+	return nil
+}
+
+// ExecInContainer runs a command in a running container
+func (d *Docker) ExecInContainer(containerName string, command []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	dockerCommand := d.command(ctx, append([]string{"exec", containerName}, command...)...)
+
+	journal.Debug("Executing docker exec command", "path", dockerCommand.Path, "args", common.RedactSecrets(dockerCommand.Args))
+	dockerCommandOutput, err := dockerCommand.CombinedOutput()
+	if err != nil {
+		return string(dockerCommandOutput), fmt.Errorf("Failed to execute %v in container %s: [%s] %s",
+			command,
+			containerName,
+			err.Error(),
+			string(dockerCommandOutput))
+	}
+
+	return string(dockerCommandOutput), nil
+}
+
+// PullImage pulls an image, unless it's present locally and the pull policy allows using it
+func (d *Docker) PullImage(image string, options PullOptions) error {
+	if options.Policy != PullPolicyAlways {
+		if _, err := d.ImageDigest(image); err == nil {
+			return nil
+		}
+	}
+
+	ctx, cancel := withOperationTimeout(context.Background(), options.Timeout)
+	defer cancel()
+
+	dockerCommand := d.command(ctx, withRegistryAuthConfig([]string{"pull", image}, options.RegistryAuthConfigPath)...)
+
+	journal.Info("Pulling image", "image", image, "timeout", options.Timeout)
+	pullStartTime := time.Now()
+
+	dockerCommandOutput, err := dockerCommand.CombinedOutput()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("Timed out pulling image %s after %s", image, time.Since(pullStartTime))
+		}
+
+		return fmt.Errorf("Failed to pull image %s: [%s] %s", image, err.Error(), string(dockerCommandOutput))
+	}
+
+	journal.Info("Pulled image", "image", image, "duration", time.Since(pullStartTime))
+
+	return nil
+}
+
+// ContainerLogs returns the last lines of a container's output, which requires a log driver docker can read back
+func (d *Docker) ContainerLogs(containerName string, tailLines int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	tail := "all"
+	if tailLines > 0 {
+		tail = strconv.Itoa(tailLines)
+	}
+
+	dockerCommand := d.command(ctx, "logs", "--tail", tail, containerName)
+
+	journal.Debug("Executing docker logs command", "path", dockerCommand.Path, "args", dockerCommand.Args)
+	dockerCommandOutput, err := dockerCommand.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get logs of container %s: [%s] %s",
+			containerName,
+			err.Error(),
+			string(dockerCommandOutput))
+	}
+
+	return string(dockerCommandOutput), nil
+}
+
+// ListContainers returns the names of all containers whose name starts with a prefix
+func (d *Docker) ListContainers(prefix string) ([]string, error) {
+	ctx, cancel := withOperationTimeout(context.Background(), d.timeouts.Inspect)
+	defer cancel()
+
+	// docker filters by names containing the filter, so the prefix is checked as well
+	dockerCommand := d.command(ctx, "ps", "--all", "--filter", "name="+prefix, "--format", "{{.Names}}")
+
+	journal.Debug("Executing docker ps command", "path", dockerCommand.Path, "args", dockerCommand.Args)
+	dockerCommandOutput, err := dockerCommand.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list containers: %s", err)
+	}
+
+	var containerNames []string
+	for _, containerName := range strings.Fields(string(dockerCommandOutput)) {
+		if strings.HasPrefix(containerName, prefix) {
+			containerNames = append(containerNames, containerName)
+		}
+	}
+
+	return containerNames, nil
+}
+
+// RenameContainer renames a container
+func (d *Docker) RenameContainer(containerName string, newContainerName string) error {
+	ctx, cancel := withOperationTimeout(context.Background(), d.timeouts.Remove)
+	defer cancel()
 
-	journal.Debug("Executing docker rm command", "path", dockerCommand.Path, "args", dockerCommand.Args)
-	if err := dockerCommand.Run(); err != nil {
-		return err
+	dockerCommand := d.command(ctx, "rename", containerName, newContainerName)
+
+	journal.Debug("Executing docker rename command", "path", dockerCommand.Path, "args", dockerCommand.Args)
+	if dockerCommandOutput, err := dockerCommand.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to rename container %s to %s: [%s] %s",
+			containerName,
+			newContainerName,
+			err.Error(),
+			string(dockerCommandOutput))
 	}
 
 	return nil
 }
 
+// Stats returns the resource usage of a container
+func (d *Docker) Stats(containerName string) (ContainerStats, error) {
+	args := []string{
+		"stats",
+		"--no-stream",
+		"--format",
+		"{{.CPUPerc}}|{{.MemUsage}}",
+		containerName,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+
+	dockerCommand := d.command(ctx, args...)
+
+	journal.Debug("Executing docker stats command", "path", dockerCommand.Path, "args", common.RedactSecrets(dockerCommand.Args))
+	dockerCommandOutput, err := dockerCommand.CombinedOutput()
+	if ctx.Err() != nil {
+		return ContainerStats{}, fmt.Errorf("Timed out getting stats of container %s", containerName)
+	}
+
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("Failed to get stats of container %s: [%s] %s",
+			containerName,
+			err.Error(),
+			string(dockerCommandOutput))
+	}
+
+	// e.g. "0.15%|1.5MiB / 7.7GiB"
+	fields := strings.Split(strings.TrimSpace(string(dockerCommandOutput)), "|")
+	if len(fields) != 2 {
+		return ContainerStats{}, fmt.Errorf("Unexpected docker stats output for %s: %s", containerName, dockerCommandOutput)
+	}
+
+	// docker reports "--" when it can't read the container's cgroup stats
+	if strings.HasPrefix(fields[0], "--") {
+		return ContainerStats{}, ErrStatsUnsupported
+	}
+
+	cpuPercent, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("Failed to parse CPU usage of %s: %s", containerName, err)
+	}
+
+	memoryBytes, err := parseDockerSize(strings.TrimSpace(strings.Split(fields[1], "/")[0]))
+	if err != nil {
+		return ContainerStats{}, fmt.Errorf("Failed to parse memory usage of %s: %s", containerName, err)
+	}
+
+	return ContainerStats{
+		CPUNanoCores: uint64(cpuPercent / 100 * 1e9),
+		MemoryBytes:  memoryBytes,
+	}, nil
+}
+
+// Name returns the name of the runtime
+func (d *Docker) Name() string {
+	return "docker"
+}
+
 func (d *Docker) Close() error {
 	return nil
 }
+
+// command creates a docker CLI command against the daemon
+func (d *Docker) command(ctx context.Context, args ...string) *exec.Cmd {
+	if d.dockerHost != "" {
+		args = append([]string{"--host", d.dockerHost}, args...)
+	}
+
+	return exec.CommandContext(ctx, d.dockerBinaryPath, args...)
+}
+
+// withRegistryAuthConfig has the docker CLI read registry credentials from a config.json. docker takes the
+// directory holding it
+func withRegistryAuthConfig(args []string, registryAuthConfigPath string) []string {
+	if registryAuthConfigPath == "" {
+		return args
+	}
+
+	return append([]string{"--config", filepath.Dir(registryAuthConfigPath)}, args...)
+}
+
+// parseDockerSize parses sizes as formatted by docker stats (e.g. 1.5MiB, 300kB)
+func parseDockerSize(size string) (uint64, error) {
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"KiB", 1 << 10},
+		{"MiB", 1 << 20},
+		{"GiB", 1 << 30},
+		{"TiB", 1 << 40},
+		{"kB", 1e3},
+		{"MB", 1e6},
+		{"GB", 1e9},
+		{"TB", 1e12},
+		{"B", 1},
+	}
+
+	for _, unit := range units {
+		if strings.HasSuffix(size, unit.suffix) {
+			value, err := strconv.ParseFloat(strings.TrimSuffix(size, unit.suffix), 64)
+			if err != nil {
+				return 0, err
+			}
+
+			return uint64(value * unit.multiplier), nil
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown size format: %s", size)
+}
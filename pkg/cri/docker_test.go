@@ -0,0 +1,201 @@
+package cri
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDockerScript is a docker CLI whose image store is a directory of one file per present image. It records its
+// command lines, and fails pulls once the store has a pull-fails file
+const fakeDockerScript = `#!/bin/sh
+store=%s
+echo "$*" >> "$store/calls"
+for image; do :; done
+imageFile="$store/$(echo "$image" | tr '/:' '__')"
+while [ "$1" = "--config" ]; do shift 2; done
+case "$1" in
+image)
+	[ -f "$imageFile" ] || exit 1
+	echo sha256:0123
+	;;
+pull)
+	if [ -f "$store/pull-fails" ]; then
+		echo "pull access denied for $image"
+		exit 1
+	fi
+	touch "$imageFile"
+	;;
+esac
+`
+
+// newFakeDocker returns a docker CLI backed by a stub image store, and a function returning its command lines
+func newFakeDocker(t *testing.T, presentImages []string, pullFails bool) (*Docker, func() []string) {
+	storeDir := t.TempDir()
+	dockerBinaryPath := filepath.Join(storeDir, "docker")
+
+	script := strings.Replace(fakeDockerScript, "%s", storeDir, 1)
+	if err := ioutil.WriteFile(dockerBinaryPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake docker: %s", err)
+	}
+
+	for _, image := range presentImages {
+		imageFileName := strings.NewReplacer("/", "_", ":", "_").Replace(image)
+		ioutil.WriteFile(filepath.Join(storeDir, imageFileName), nil, 0644) // nolint: errcheck
+	}
+
+	if pullFails {
+		ioutil.WriteFile(filepath.Join(storeDir, "pull-fails"), nil, 0644) // nolint: errcheck
+	}
+
+	docker, _ := NewDocker(dockerBinaryPath, "", Timeouts{})
+
+	return docker, func() []string {
+		calls, err := ioutil.ReadFile(filepath.Join(storeDir, "calls"))
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return strings.Split(strings.TrimSpace(string(calls)), "\n")
+	}
+}
+
+func TestDockerPullImagePolicy(t *testing.T) {
+	const image = "iguazio/v3io-fuse:3.5.0"
+
+	inspectCall := "image inspect --format {{.Id}} " + image
+	pullCall := "pull " + image
+
+	for _, testCase := range []struct {
+		name          string
+		policy        string
+		present       bool
+		pullFails     bool
+		options       PullOptions
+		expectedCalls []string
+		expectedError string
+	}{
+		{name: "if not present, present", policy: PullPolicyIfNotPresent, present: true,
+			expectedCalls: []string{inspectCall}},
+		{name: "if not present, absent", policy: PullPolicyIfNotPresent,
+			expectedCalls: []string{inspectCall, pullCall}},
+		{name: "default, present", present: true, expectedCalls: []string{inspectCall}},
+		{name: "always, present", policy: PullPolicyAlways, present: true, expectedCalls: []string{pullCall}},
+		{name: "always, absent", policy: PullPolicyAlways, expectedCalls: []string{pullCall}},
+		{name: "pull fails", policy: PullPolicyAlways, present: true, pullFails: true,
+			expectedCalls: []string{pullCall}, expectedError: "Failed to pull image " + image},
+		{name: "registry auth", policy: PullPolicyAlways,
+			options:       PullOptions{RegistryAuthConfigPath: "/etc/v3io/fuse/registry/config.json"},
+			expectedCalls: []string{"--config /etc/v3io/fuse/registry " + pullCall}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var presentImages []string
+			if testCase.present {
+				presentImages = []string{image}
+			}
+
+			docker, getCalls := newFakeDocker(t, presentImages, testCase.pullFails)
+
+			options := testCase.options
+			options.Policy = testCase.policy
+
+			err := docker.PullImage(image, options)
+			if testCase.expectedError == "" && err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if testCase.expectedError != "" && (err == nil || !strings.Contains(err.Error(), testCase.expectedError)) {
+				t.Fatalf("Expected an error containing %q, got %v", testCase.expectedError, err)
+			}
+
+			if calls := getCalls(); !reflect.DeepEqual(calls, testCase.expectedCalls) {
+				t.Fatalf("Expected calls %v, got %v", testCase.expectedCalls, calls)
+			}
+
+			// a successful pull leaves the image present
+			if err == nil {
+				if _, err := docker.ImageDigest(image); err != nil {
+					t.Fatalf("Expected %s to be present, got %s", image, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDockerOperationTimeouts(t *testing.T) {
+	const shortTimeout = 100 * time.Millisecond
+
+	operations := map[string]func(docker *Docker) error{
+		"create": func(docker *Docker) error {
+			return docker.CreateContainer("iguazio/v3io-fuse:3.5.0",
+				"v3io-fuse",
+				"/target",
+				[]string{"/fuse/mounter.sh"},
+				ContainerOptions{})
+		},
+		"remove": func(docker *Docker) error {
+			return docker.RemoveContainer("v3io-fuse")
+		},
+		"inspect": func(docker *Docker) error {
+			_, err := docker.ImageDigest("iguazio/v3io-fuse:3.5.0")
+			return err
+		},
+		"pull": func(docker *Docker) error {
+			return docker.PullImage("iguazio/v3io-fuse:3.5.0",
+				PullOptions{Policy: PullPolicyAlways, Timeout: shortTimeout})
+		},
+	}
+
+	for _, testCase := range []struct {
+		name          string
+		operation     string
+		timeouts      Timeouts
+		expectedError string
+	}{
+		{name: "create", operation: "create", timeouts: Timeouts{Create: shortTimeout},
+			expectedError: "Timed out creating v3io-fuse container /target after 100ms"},
+		{name: "remove", operation: "remove", timeouts: Timeouts{Remove: shortTimeout},
+			expectedError: "Timed out removing container v3io-fuse after 100ms"},
+		{name: "inspect", operation: "inspect", timeouts: Timeouts{Inspect: shortTimeout},
+			expectedError: "Failed to inspect image"},
+		{name: "pull", operation: "pull", expectedError: "Timed out pulling image"},
+		{name: "create outlasts the others", operation: "create",
+			timeouts: Timeouts{Remove: shortTimeout, Inspect: shortTimeout}},
+		{name: "remove outlasts the others", operation: "remove",
+			timeouts: Timeouts{Create: shortTimeout, Inspect: shortTimeout}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			// docker takes longer than the short timeout, but ends in time for an unbounded operation to succeed
+			dockerBinaryPath := filepath.Join(t.TempDir(), "docker")
+			if err := ioutil.WriteFile(dockerBinaryPath, []byte("#!/bin/sh\nexec sleep 0.5\n"), 0755); err != nil {
+				t.Fatalf("Failed to write fake docker: %s", err)
+			}
+
+			docker, _ := NewDocker(dockerBinaryPath, "", testCase.timeouts)
+
+			startTime := time.Now()
+			err := operations[testCase.operation](docker)
+			elapsed := time.Since(startTime)
+
+			if testCase.expectedError == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Fatalf("Expected an error containing %q, got %v", testCase.expectedError, err)
+			}
+
+			if elapsed >= 400*time.Millisecond {
+				t.Fatalf("Expected the operation to time out after %s, took %s", shortTimeout, elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package cri
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const dockerHubHost = "docker.io"
+
+// dockerConfig is the part of a docker config.json that holds registry credentials
+type dockerConfig struct {
+	Auths map[string]dockerConfigAuth `json:"auths"`
+}
+
+type dockerConfigAuth struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// getRegistryCredentials returns the username and password of a registry host from a docker config.json, or
+// empty ones if it has none for the host. Credentials are never logged
+func getRegistryCredentials(configPath string, host string) (string, string, error) {
+	configBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to read registry auth config %s: %s", configPath, err)
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return "", "", fmt.Errorf("Failed to parse registry auth config %s: %s", configPath, err)
+	}
+
+	for authHost, auth := range config.Auths {
+		if normalizeRegistryHost(authHost) != normalizeRegistryHost(host) {
+			continue
+		}
+
+		if auth.Auth == "" {
+			return auth.Username, auth.Password, nil
+		}
+
+		decodedAuth, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return "", "", fmt.Errorf("Failed to decode registry auth of %s", authHost)
+		}
+
+		authParts := strings.SplitN(string(decodedAuth), ":", 2)
+		if len(authParts) != 2 {
+			return "", "", fmt.Errorf("Registry auth of %s is not of the form username:password", authHost)
+		}
+
+		return authParts[0], authParts[1], nil
+	}
+
+	return "", "", nil
+}
+
+// getImageRegistryHost returns the registry an image is pulled from. As with docker, the first part of the name is
+// a registry only if it looks like a host (has a dot or a port, or is localhost)
+func getImageRegistryHost(image string) string {
+	nameParts := strings.SplitN(image, "/", 2)
+	if len(nameParts) == 1 {
+		return dockerHubHost
+	}
+
+	if strings.ContainsAny(nameParts[0], ".:") || nameParts[0] == "localhost" {
+		return nameParts[0]
+	}
+
+	return dockerHubHost
+}
+
+// normalizeRegistryHost strips what docker config.json keys may have around the host (e.g. https://host/v1/),
+// and maps docker hub's aliases to a single host
+func normalizeRegistryHost(host string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host = strings.SplitN(host, "/", 2)[0]
+
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return dockerHubHost
+	}
+
+	return host
+}
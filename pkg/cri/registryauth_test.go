@@ -0,0 +1,172 @@
+package cri
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd"
+)
+
+// testRegistryAuthConfig has fuse:s3cr3t as registry.local:5000's encoded auth, and no-colon as unsplit.local's
+const testRegistryAuthConfig = `{
+	"auths": {
+		"registry.local:5000": {"auth": "ZnVzZTpzM2NyM3Q="},
+		"https://index.docker.io/v1/": {"username": "hub-user", "password": "hub-password"},
+		"broken.local": {"auth": "not base64"},
+		"unsplit.local": {"auth": "bm8tY29sb24="}
+	}
+}`
+
+func TestGetRegistryCredentials(t *testing.T) {
+	configPath := writeRegistryAuthConfig(t, testRegistryAuthConfig)
+
+	for _, testCase := range []struct {
+		name             string
+		configPath       string
+		host             string
+		expectedUsername string
+		expectedPassword string
+		expectError      bool
+	}{
+		{name: "encoded auth", host: "registry.local:5000", expectedUsername: "fuse", expectedPassword: "s3cr3t"},
+		{name: "docker hub alias", host: "registry-1.docker.io", expectedUsername: "hub-user",
+			expectedPassword: "hub-password"},
+		{name: "docker hub", host: "docker.io", expectedUsername: "hub-user", expectedPassword: "hub-password"},
+		{name: "unknown host", host: "quay.io"},
+		{name: "invalid encoding", host: "broken.local", expectError: true},
+		{name: "auth without password", host: "unsplit.local", expectError: true},
+		{name: "missing config", configPath: filepath.Join(t.TempDir(), "missing.json"), host: "quay.io",
+			expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if testCase.configPath == "" {
+				testCase.configPath = configPath
+			}
+
+			username, password, err := getRegistryCredentials(testCase.configPath, testCase.host)
+			if (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+
+			if username != testCase.expectedUsername || password != testCase.expectedPassword {
+				t.Fatalf("Expected credentials %s/%s, got %s/%s",
+					testCase.expectedUsername,
+					testCase.expectedPassword,
+					username,
+					password)
+			}
+		})
+	}
+}
+
+func TestGetImageRegistryHost(t *testing.T) {
+	for _, testCase := range []struct {
+		image        string
+		expectedHost string
+	}{
+		{image: "v3io-fuse", expectedHost: "docker.io"},
+		{image: "iguazio/v3io-fuse:local", expectedHost: "docker.io"},
+		{image: "registry.local:5000/iguazio/v3io-fuse:3.5.0", expectedHost: "registry.local:5000"},
+		{image: "quay.io/iguazio/v3io-fuse", expectedHost: "quay.io"},
+		{image: "localhost/v3io-fuse", expectedHost: "localhost"},
+	} {
+		t.Run(testCase.image, func(t *testing.T) {
+			if host := getImageRegistryHost(testCase.image); host != testCase.expectedHost {
+				t.Fatalf("Expected host %s, got %s", testCase.expectedHost, host)
+			}
+		})
+	}
+}
+
+func TestGetPullOpts(t *testing.T) {
+	for _, testCase := range []struct {
+		name           string
+		configPath     string
+		expectResolver bool
+	}{
+		{name: "without auth"},
+		{name: "with auth", configPath: "/etc/v3io/fuse/registry-auth.json", expectResolver: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			remoteContext := containerd.RemoteContext{}
+			for _, pullOpt := range getPullOpts(testCase.configPath) {
+				if err := pullOpt(nil, &remoteContext); err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+			}
+
+			if !remoteContext.Unpack {
+				t.Fatal("Expected the pulled image to be unpacked")
+			}
+
+			if hasResolver := remoteContext.Resolver != nil; hasResolver != testCase.expectResolver {
+				t.Fatalf("Expected a resolver: %t, got %t", testCase.expectResolver, hasResolver)
+			}
+		})
+	}
+}
+
+func TestRegistryAuthorizer(t *testing.T) {
+	authorizer := newRegistryAuthorizer(writeRegistryAuthConfig(t, testRegistryAuthConfig))
+
+	for _, testCase := range []struct {
+		name                  string
+		host                  string
+		expectedAuthorization string
+		expectError           bool
+	}{
+		{
+			name:                  "known registry",
+			host:                  "registry.local:5000",
+			expectedAuthorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("fuse:s3cr3t")),
+		},
+		{
+			name:        "unknown registry",
+			host:        "quay.io",
+			expectError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := context.Background()
+			manifestURL := "https://" + testCase.host + "/v2/iguazio/v3io-fuse/manifests/3.5.0"
+
+			// the registry challenges the unauthenticated pull, which has the authorizer look up credentials
+			request, _ := http.NewRequest(http.MethodHead, manifestURL, nil)
+			challenge := &http.Response{
+				StatusCode: http.StatusUnauthorized,
+				Header:     http.Header{"Www-Authenticate": []string{`Basic realm="registry"`}},
+				Request:    request,
+			}
+
+			// without credentials for the registry, the challenge can't be answered
+			err := authorizer.AddResponses(ctx, []*http.Response{challenge})
+			if (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+
+			retriedRequest, _ := http.NewRequest(http.MethodHead, manifestURL, nil)
+			if err := authorizer.Authorize(ctx, retriedRequest); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if authorization := retriedRequest.Header.Get("Authorization"); authorization !=
+				testCase.expectedAuthorization {
+				t.Fatalf("Expected authorization %q, got %q", testCase.expectedAuthorization, authorization)
+			}
+		})
+	}
+}
+
+func writeRegistryAuthConfig(t *testing.T, contents string) string {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+
+	if err := ioutil.WriteFile(configPath, []byte(contents), 0600); err != nil {
+		t.Fatalf("Failed to write registry auth config: %s", err)
+	}
+
+	return configPath
+}
@@ -0,0 +1,81 @@
+package flex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const (
+	uptimePath                         = "/proc/uptime"
+	defaultMountTableRecheckDelay      = 500 * time.Millisecond
+	defaultMountTableRecheckBootWindow = 10 * time.Minute
+)
+
+// isMountPointConfirmed is isMountPoint, except that right after node boot, when the mount table may momentarily
+// not reflect a freshly established mount, a negative result is confirmed by checking again after a short delay
+func (m *Mounter) isMountPointConfirmed(targetPath string) bool {
+	return m.confirmMountPoint(targetPath, isMountPoint, getUptime)
+}
+
+// confirmMountPoint is isMountPointConfirmed, reading the mount table and the uptime with the given functions
+func (m *Mounter) confirmMountPoint(targetPath string,
+	isMountPoint func(string) bool,
+	getUptime func() (time.Duration, error)) bool {
+	if isMountPoint(targetPath) {
+		return true
+	}
+
+	if m.Config.DisableMountTableRecheck {
+		return false
+	}
+
+	uptime, err := getUptime()
+	if err != nil {
+		journal.Debug("Failed to get uptime", "err", err.Error())
+		return false
+	}
+
+	if uptime > m.Config.getMountTableRecheckBootWindow() {
+		return false
+	}
+
+	recheckDelay := m.Config.getMountTableRecheckDelay()
+
+	journal.Debug("Confirming target is not mounted during boot",
+		"target", targetPath,
+		"uptime", uptime,
+		"recheckDelay", recheckDelay)
+
+	time.Sleep(recheckDelay)
+
+	if isMountPoint(targetPath) {
+		journal.Info("Target found mounted on recheck", "target", targetPath)
+		return true
+	}
+
+	return false
+}
+
+func getUptime() (time.Duration, error) {
+	uptimeContents, err := ioutil.ReadFile(uptimePath)
+	if err != nil {
+		return 0, err
+	}
+
+	uptimeFields := strings.Fields(string(uptimeContents))
+	if len(uptimeFields) == 0 {
+		return 0, fmt.Errorf("Unexpected %s contents: %s", uptimePath, string(uptimeContents))
+	}
+
+	uptimeSeconds, err := strconv.ParseFloat(uptimeFields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to parse uptime %s: %s", uptimeFields[0], err)
+	}
+
+	return time.Duration(uptimeSeconds * float64(time.Second)), nil
+}
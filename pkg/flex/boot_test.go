@@ -0,0 +1,85 @@
+package flex
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConfirmMountPoint(t *testing.T) {
+	for _, testCase := range []struct {
+		name                     string
+		mountTableReads          []bool
+		uptime                   time.Duration
+		uptimeErr                error
+		disableMountTableRecheck bool
+		expectMounted            bool
+		expectedReads            int
+	}{
+		{
+			name:            "mounted",
+			mountTableReads: []bool{true},
+			uptime:          time.Minute,
+			expectMounted:   true,
+			expectedReads:   1,
+		},
+		{
+			name:            "flaky during boot",
+			mountTableReads: []bool{false, true},
+			uptime:          time.Minute,
+			expectMounted:   true,
+			expectedReads:   2,
+		},
+		{
+			name:            "not mounted during boot",
+			mountTableReads: []bool{false, false},
+			uptime:          time.Minute,
+			expectedReads:   2,
+		},
+		{
+			name:            "flaky after boot",
+			mountTableReads: []bool{false, true},
+			uptime:          time.Hour,
+			expectedReads:   1,
+		},
+		{
+			name:                     "flaky with recheck disabled",
+			mountTableReads:          []bool{false, true},
+			uptime:                   time.Minute,
+			disableMountTableRecheck: true,
+			expectedReads:            1,
+		},
+		{
+			name:            "unknown uptime",
+			mountTableReads: []bool{false, true},
+			uptimeErr:       errors.New("no /proc/uptime"),
+			expectedReads:   1,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter := newTestMounter(&Config{
+				DisableMountTableRecheck:           testCase.disableMountTableRecheck,
+				MountTableRecheckMilliseconds:      1,
+				MountTableRecheckBootWindowSeconds: 600,
+			}, newMemoryFilesystem())
+
+			reads := 0
+			isMountPoint := func(path string) bool {
+				reads++
+				return testCase.mountTableReads[reads-1]
+			}
+
+			getUptime := func() (time.Duration, error) {
+				return testCase.uptime, testCase.uptimeErr
+			}
+
+			if mounted := mounter.confirmMountPoint("/target", isMountPoint, getUptime); mounted != testCase.expectMounted {
+				t.Fatalf("Expected mounted: %t, got %t", testCase.expectMounted, mounted)
+			}
+
+			if reads != testCase.expectedReads {
+				t.Fatalf("Expected %d mount table reads, got %d", testCase.expectedReads, reads)
+			}
+		})
+	}
+}
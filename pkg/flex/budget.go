@@ -0,0 +1,44 @@
+package flex
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+// newMountContext returns a context carrying the whole mount operation's deadline, which every step of the mount
+// draws from. Without a configured timeout the mount is unbounded, as kubelet's own timeout applies
+func (m *Mounter) newMountContext() (context.Context, context.CancelFunc) {
+	if m.Config.MountTimeoutSeconds > 0 {
+		return context.WithTimeout(context.Background(), time.Duration(m.Config.MountTimeoutSeconds)*time.Second)
+	}
+
+	return context.WithCancel(context.Background())
+}
+
+// checkBudget logs the remaining mount budget before a step, and fails if it is exhausted
+func checkBudget(ctx context.Context, step string) error {
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		journal.Debug("Mount budget", "step", step, "remaining", time.Until(deadline).String())
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("Mount budget exhausted before %s: %s", step, ctx.Err())
+	}
+
+	return nil
+}
+
+// excludeFromBudget returns a mount context whose deadline is pushed back by the time a step that doesn't count
+// against the mount's budget took (e.g. pulling the image, which has a timeout of its own). The mount context is
+// only ever canceled once the mount is done, so the returned context needn't be derived from it
+func excludeFromBudget(ctx context.Context, excluded time.Duration) (context.Context, context.CancelFunc) {
+	deadline, hasDeadline := ctx.Deadline()
+	if !hasDeadline {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithDeadline(context.Background(), deadline.Add(excluded))
+}
@@ -0,0 +1,57 @@
+package flex
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExcludeFromBudget(t *testing.T) {
+	for _, testCase := range []struct {
+		name              string
+		timeoutSeconds    int
+		excluded          time.Duration
+		expectedRemaining time.Duration
+	}{
+		{name: "unbounded", excluded: time.Minute},
+		{name: "bounded", timeoutSeconds: 60, excluded: 30 * time.Second, expectedRemaining: 90 * time.Second},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter := newTestMounter(&Config{MountTimeoutSeconds: testCase.timeoutSeconds}, newMemoryFilesystem())
+
+			ctx, cancel := mounter.newMountContext()
+			defer cancel()
+
+			excludedCtx, cancelExcluded := excludeFromBudget(ctx, testCase.excluded)
+			defer cancelExcluded()
+
+			deadline, hasDeadline := excludedCtx.Deadline()
+			if hasDeadline != (testCase.expectedRemaining != 0) {
+				t.Fatalf("Expected a deadline: %t, got %t", testCase.expectedRemaining != 0, hasDeadline)
+			}
+
+			if !hasDeadline {
+				return
+			}
+
+			// the step's time is given back, rather than drawn from the mount's budget
+			if remaining := time.Until(deadline); remaining <= testCase.expectedRemaining-time.Second ||
+				remaining > testCase.expectedRemaining {
+				t.Fatalf("Expected %s of the budget to remain, got %s", testCase.expectedRemaining, remaining)
+			}
+
+			if err := checkBudget(excludedCtx, "creating container"); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+		})
+	}
+
+	// without a deadline, the returned context still follows the mount context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if excludedCtx, cancelExcluded := excludeFromBudget(ctx, time.Second); excludedCtx.Err() == nil {
+		cancelExcluded()
+		t.Fatal("Expected the context to be canceled along with the mount context")
+	}
+}
@@ -0,0 +1,101 @@
+package flex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const fuseFlagsImageLabel = "io.iguazio.fuse.flags"
+
+// Init answers kubelet's init call. The driver has no attach and detach stage, which kubelet is told so that it
+// doesn't call them. Kubelet assumes what isn't answered is supported, so SELinux relabeling, which FUSE mounts
+// can't take (the mount's context is SELinuxLabel instead), is answered as unsupported, and so is fsGroup unless
+// enabled
+func (m *Mounter) Init() *Response {
+	return NewCapabilitiesResponse(Capabilities{
+		Attach:         false,
+		SELinuxRelabel: false,
+		FSGroup:        m.Config.EnableFSGroup,
+	})
+}
+
+// DriverCapabilities describes what the installed driver build supports, so operators can confirm a node's
+// driver supports what their specs rely on
+type DriverCapabilities struct {
+	Version     string          `json:"version"`
+	MountModes  []string        `json:"mountModes"`
+	CRIBackends []string        `json:"criBackends"`
+	ActiveCRI   string          `json:"activeCRI,omitempty"`
+	Commands    []string        `json:"commands"`
+	Features    map[string]bool `json:"features"`
+	Image       string          `json:"image"`
+	ImageFlags  []string        `json:"imageFlags,omitempty"`
+	ImageError  string          `json:"imageError,omitempty"`
+}
+
+// Capabilities reports the driver's build-time capabilities along with what is detected on the node: the CRI in
+// use and the flags the fuse image declares in its fuseFlagsImageLabel label. The commands are those the CLI
+// dispatches
+func (m *Mounter) Capabilities(commands []string) *Response {
+	journal.Debug("Querying capabilities")
+
+	capabilities := DriverCapabilities{
+		Version:     getDriverVersion(),
+		MountModes:  []string{"container", "link"},
+		CRIBackends: []string{"docker", "containerd", "crio"},
+		Commands:    commands,
+		Features: map[string]bool{
+			"metrics":               true,
+			"tracing":               false,
+			"daemon":                false,
+			"shared-sub-path-mount": true,
+			"recreate-on-change":    true,
+			"restart-policy":        true,
+			"preflight-check":       true,
+		},
+		Image: m.Config.getImage(),
+	}
+
+	imageFlags, activeCRI, err := m.getImageFlags()
+	capabilities.ActiveCRI = activeCRI
+	if err != nil {
+		capabilities.ImageError = err.Error()
+	} else {
+		capabilities.ImageFlags = imageFlags
+	}
+
+	response := NewSuccessResponse("Driver capabilities")
+	response.DriverCapabilities = &capabilities
+
+	return response
+}
+
+func (m *Mounter) getImageFlags() ([]string, string, error) {
+	criInstance, err := m.createCRI()
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to create CRI: %s", err)
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	activeCRI := criInstance.Name()
+
+	imageLabels, err := criInstance.ImageLabels(m.Config.getImage())
+	if err != nil {
+		return nil, activeCRI, fmt.Errorf("Could not get labels of image %s: %s", m.Config.getImage(), err)
+	}
+
+	var imageFlags []string
+	for _, flag := range strings.Split(imageLabels[fuseFlagsImageLabel], ",") {
+		if flag = strings.TrimSpace(flag); flag != "" {
+			imageFlags = append(imageFlags, flag)
+		}
+	}
+
+	sort.Strings(imageFlags)
+
+	return imageFlags, activeCRI, nil
+}
@@ -0,0 +1,48 @@
+package flex
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInit(t *testing.T) {
+	for _, testCase := range []struct {
+		name                 string
+		config               Config
+		expectedCapabilities string
+	}{
+		{name: "default", expectedCapabilities: `{"attach":false,"selinuxRelabel":false,"fsGroup":false}`},
+		{name: "fsGroup enabled", config: Config{EnableFSGroup: true},
+			expectedCapabilities: `{"attach":false,"selinuxRelabel":false,"fsGroup":true}`},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter := newTestMounter(&testCase.config, newMemoryFilesystem())
+
+			expectedJSON := `{"status":"Success","message":"No initialization required","capabilities":` +
+				testCase.expectedCapabilities + `}`
+
+			if initJSON := mounter.Init().ToJSON(); initJSON != expectedJSON {
+				t.Fatalf("Expected %s, got %s", expectedJSON, initJSON)
+			}
+
+			// kubelet assumes capabilities it isn't answered are supported, so each is answered explicitly
+			var initResponse struct {
+				Capabilities map[string]interface{} `json:"capabilities"`
+			}
+
+			if err := json.Unmarshal([]byte(mounter.Init().ToJSON()), &initResponse); err != nil {
+				t.Fatalf("Failed to unmarshal: %s", err)
+			}
+
+			for _, capability := range []string{"attach", "selinuxRelabel", "fsGroup"} {
+				if _, found := initResponse.Capabilities[capability]; !found {
+					t.Fatalf("Expected capability %s to be answered, got %v", capability, initResponse.Capabilities)
+				}
+			}
+
+			if attach := initResponse.Capabilities["attach"]; attach != false {
+				t.Fatalf("Expected attach to be false, got %v", attach)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package flex
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const (
+	checkTimeout    = 5 * time.Second
+	checkMaxEntries = 16
+	checkReadSize   = 4096
+)
+
+type CheckResult struct {
+	Name     string `json:"name"`
+	Success  bool   `json:"success"`
+	Warning  bool   `json:"warning,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Check runs read-only consistency probes against a live mount. Each probe is bounded by checkTimeout, since
+// operations against a wedged FUSE mount may never return
+func (m *Mounter) Check(targetPath string) *Response {
+	journal.Debug("Checking mount", "targetPath", targetPath)
+
+	var entries []string
+	var checks []CheckResult
+
+	// the list probe may outlive its timeout, so hand the entries over through a channel
+	entriesChan := make(chan []string, 1)
+
+	checks = append(checks, runCheck("stat", func() (string, error) {
+		info, err := os.Stat(targetPath)
+		if err != nil {
+			return "", err
+		}
+
+		if !info.IsDir() {
+			return "", fmt.Errorf("%s is not a directory", targetPath)
+		}
+
+		return fmt.Sprintf("mode %s", info.Mode()), nil
+	}))
+
+	checks = append(checks, runCheck("list", func() (string, error) {
+		dir, err := os.Open(targetPath)
+		if err != nil {
+			return "", err
+		}
+
+		defer dir.Close() // nolint: errcheck
+
+		names, err := dir.Readdirnames(checkMaxEntries)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+
+		if len(names) == 0 {
+			return "", fmt.Errorf("no entries found in %s", targetPath)
+		}
+
+		entriesChan <- names
+
+		return fmt.Sprintf("listed %d entries", len(names)), nil
+	}))
+
+	select {
+	case entries = <-entriesChan:
+	default:
+	}
+
+	checks = append(checks, runCheck("read", func() (string, error) {
+		for _, entry := range entries {
+			entryPath := path.Join(targetPath, entry)
+
+			info, err := os.Stat(entryPath)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			file, err := os.Open(entryPath)
+			if err != nil {
+				return "", err
+			}
+
+			defer file.Close() // nolint: errcheck
+
+			buffer := make([]byte, checkReadSize)
+			readBytes, err := file.Read(buffer)
+			if err != nil && err != io.EOF {
+				return "", err
+			}
+
+			return fmt.Sprintf("read %d bytes from %s", readBytes, entry), nil
+		}
+
+		return "no regular file found to read, skipped", nil
+	}))
+
+	var failedChecks []string
+	for _, check := range checks {
+		if !check.Success {
+			failedChecks = append(failedChecks, check.Name)
+		}
+	}
+
+	var response *Response
+	if len(failedChecks) > 0 {
+		response = NewFailResponse(fmt.Sprintf("Mount check failed for %s", targetPath),
+			fmt.Errorf("Failed checks: %s", strings.Join(failedChecks, ", ")))
+	} else {
+		response = NewSuccessResponse(fmt.Sprintf("Mount check passed for %s", targetPath))
+	}
+
+	response.Checks = checks
+
+	return response
+}
+
+func runCheck(name string, probe func() (string, error)) CheckResult {
+	type probeResult struct {
+		message string
+		err     error
+	}
+
+	resultChan := make(chan probeResult, 1)
+	startTime := time.Now()
+
+	go func() {
+		message, err := probe()
+		resultChan <- probeResult{message: message, err: err}
+	}()
+
+	result := CheckResult{Name: name}
+
+	select {
+	case probeResult := <-resultChan:
+		result.Success = probeResult.err == nil
+		result.Message = probeResult.message
+		if probeResult.err != nil {
+			result.Message = probeResult.err.Error()
+		}
+	case <-time.After(checkTimeout):
+		result.Message = fmt.Sprintf("timed out after %s", checkTimeout)
+	}
+
+	result.Duration = time.Since(startTime).String()
+
+	journal.Debug("Check completed",
+		"name", result.Name,
+		"success", result.Success,
+		"message", result.Message,
+		"duration", result.Duration)
+
+	return result
+}
@@ -1,18 +1,85 @@
 package flex
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/v3io/flex-fuse/pkg/cri"
 	"github.com/v3io/flex-fuse/pkg/journal"
 )
 
 const (
-	v3ioConfig = "/etc/v3io/fuse/v3io.conf"
+	v3ioConfig             = "/etc/v3io/fuse/v3io.conf"
+	defaultDataURLsTimeout = 10 * time.Second
+	defaultLinkBasePath    = "/mnt/v3io"
+	fuseCapability         = "SYS_ADMIN"
+	imageRepositoryEnvVar  = "FLEX_FUSE_IMAGE_REPOSITORY"
+	imageTagEnvVar         = "FLEX_FUSE_IMAGE_TAG"
+	dryRunEnvVar           = "FLEX_FUSE_DRY_RUN"
+	fuseConfPath           = "/etc/fuse.conf"
+
+	defaultCreateContainerRetries   = 3
+	defaultFailedContainerRetention = 24 * time.Hour
+)
+
+const (
+	AccessModeAllowOther = "allow_other"
+	AccessModeAllowRoot  = "allow_root"
+	AccessModeNone       = "none"
+)
+
+const (
+	NameConflictPolicyRetry = "retry"
+	NameConflictPolicyReuse = "reuse"
+)
+
+const (
+	ContainerNameStrategyPathBased = "path-based"
+	ContainerNameStrategyHash      = "hash"
+	ContainerNameStrategyLabels    = "labels"
+)
+
+const (
+	CleanExitActionFail = "fail"
+	CleanExitActionWait = "wait"
+)
+
+const (
+	CRIDocker     = "docker"
+	CRICRIO       = "crio"
+	CRIContainerd = "containerd"
+	CRITypeAuto   = "auto"
+)
+
+const (
+	UnmountOrderUmountFirst    = "umount-first"
+	UnmountOrderContainerFirst = "container-first"
+)
+
+const (
+	DirCreateFailureModeFail = "fail"
+	DirCreateFailureModeWarn = "warn"
 )
 
+var selinuxLabelRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.]+:[a-zA-Z0-9_.]+:[a-zA-Z0-9_.]+:[a-zA-Z0-9_.:,\-]+$`)
+
+var capabilityRegexp = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
+
+var ErrDataURLsTimeout = errors.New("cluster URL resolution timed out")
+
+// ErrUnknownCluster is returned for a cluster that isn't configured
+var ErrUnknownCluster = errors.New("unknown cluster")
+
 type Config struct {
 	ImageRepository string          `json:"image_repository"`
 	ImageTag        string          `json:"image_tag"`
@@ -22,6 +89,270 @@ type Config struct {
 	Type            string          `json:"type"`
 	Clusters        []ClusterConfig `json:"clusters"`
 	V3ioConfigPath  string          `json:"v3io_config_path"`
+
+	// LinkUseBindMount has link mode bind mount the shared mount onto the target, rather than replace the target
+	// with a symlink to it, for workloads that expect a real directory
+	LinkUseBindMount bool `json:"link_use_bind_mount"`
+
+	// LinkBasePath is the directory link mode mounts are made in, as <namespace>/<container> (default /mnt/v3io)
+	LinkBasePath string `json:"link_base_path"`
+
+	// LinkDefaultNamespace is the namespace of link mode mounts whose spec has none. Unset fails such mounts
+	LinkDefaultNamespace string `json:"link_default_namespace"`
+
+	// ReadinessStrategy selects how a created container is deemed ready (mount-table, stat, list,
+	// container-probe)
+	ReadinessStrategy string `json:"readiness_strategy"`
+
+	// RecreateUnhealthyMount recreates an already mounted target whose mount or container is unhealthy
+	RecreateUnhealthyMount bool `json:"recreate_unhealthy_mount"`
+
+	// CleanupDeadMounts recreates an already mounted target whose mount is dead (e.g. ENOTCONN after a node
+	// hiccup), lazily unmounting it and removing its container first. Unlike RecreateUnhealthyMount, mounts that
+	// are alive but whose container looks unhealthy are left alone
+	CleanupDeadMounts bool `json:"cleanup_dead_mounts"`
+
+	// RetryMissingAccessKey has kubelet retry a mount whose spec has no access key. By default it fails for good,
+	// as the access key secret is usually missing because the pod's namespace is being deleted, and retrying
+	// would only storm a namespace that's going away. Set it if secrets may be created after their pods
+	RetryMissingAccessKey bool `json:"retry_missing_access_key"`
+
+	// DryRun has mount and unmount log and return what they would do (the containers they'd create, with their
+	// args, and the directories, mounts and links they'd touch) rather than doing it, for debugging mount
+	// failures. It can also be set by the dryRunEnvVar environment variable
+	DryRun bool `json:"dry_run"`
+
+	// KeepFailedContainers keeps the exited fuse container of a failed mount for inspection, renamed aside so it
+	// doesn't block the next mount, rather than removing it. The reap command removes kept containers once they're
+	// older than FailedContainerRetentionMinutes (default a day). Only docker can rename containers, other
+	// runtimes remove them as usual
+	KeepFailedContainers            bool `json:"keep_failed_containers"`
+	FailedContainerRetentionMinutes int  `json:"failed_container_retention_minutes"`
+
+	// InheritDirPermissions makes dirsToCreate entries without permissions inherit the mode of their closest
+	// existing parent directory, rather than being created with mode 0000
+	InheritDirPermissions bool `json:"inherit_dir_permissions"`
+
+	// FuseCommand overrides the fuse container's command (default /fuse/mounter.sh)
+	FuseCommand []string `json:"fuse_command"`
+
+	// FuseRawArgs passes FuseCommand verbatim, without appending the connection and mount arguments
+	FuseRawArgs bool `json:"fuse_raw_args"`
+
+	// DataURLsTimeoutSeconds bounds the resolution of a cluster's data URLs (default 10)
+	DataURLsTimeoutSeconds int `json:"data_urls_timeout_seconds"`
+
+	// RejectNonEmptyTarget fails mounts over a target that already holds data, which would be shadowed
+	RejectNonEmptyTarget bool `json:"reject_non_empty_target"`
+
+	// MountDedupWindowSeconds has a mount identical to a target's last successful one (same spec) within this
+	// window return that mount's result rather than redo it, as kubelet may repeat calls. Unset disables it
+	MountDedupWindowSeconds int `json:"mount_dedup_window_seconds"`
+
+	// MaxMountsPerNode fails new mounts while the node has this many v3io fuse mounts. A shared or link mode mount
+	// counts once, however many targets it's bind mounted to. Unset means unlimited
+	MaxMountsPerNode int `json:"max_mounts_per_node"`
+
+	// RequireTargetMode fails mounts over a target whose permission bits aren't exactly this octal mode (e.g.
+	// "0750"), enforcing the node's security policy. Unset means no check
+	RequireTargetMode string `json:"require_target_mode"`
+
+	// PreflightBackendCheck probes the cluster's data URLs before creating the fuse container, so an unreachable
+	// backend fails the mount immediately rather than timing out
+	PreflightBackendCheck   bool `json:"preflight_backend_check"`
+	PreflightTimeoutSeconds int  `json:"preflight_timeout_seconds"`
+
+	// ConnectionStringTemplate formats each data URL passed to the fuse process, substituting {scheme}, {host},
+	// {port} and {url} (e.g. {scheme}://{host}:{port}). Defaults to passing the data URLs as they are
+	ConnectionStringTemplate string `json:"connection_string_template"`
+
+	// KubeletRootDir is where symlinked targets must resolve to (default /var/lib/kubelet)
+	KubeletRootDir string `json:"kubelet_root_dir"`
+
+	// AccessMode selects who besides the mounting user may access the mount (allow_other, allow_root, none).
+	// Defaults to allow_other
+	AccessMode string `json:"access_mode"`
+
+	// SELinuxLabel is the SELinux context (user:role:type:level) of the fuse container, and with
+	// SELinuxMountContext also of the mount itself
+	SELinuxLabel        string `json:"selinux_label"`
+	SELinuxMountContext bool   `json:"selinux_mount_context"`
+
+	// EnableFSGroup tells kubelet on init that mounts support fsGroup, which has kubelet recursively chown every
+	// mount to its pod's fsGroup, walking all of the container's files over FUSE. Off by default
+	EnableFSGroup bool `json:"enable_fs_group"`
+
+	// AutoRemoveContainer has the runtime remove the fuse container once it exits (docker only)
+	AutoRemoveContainer bool `json:"auto_remove_container"`
+
+	// ShareSubPathMounts serves all targets of the same cluster, container and access key from a single fuse
+	// container, bind mounting each target's sub path from it
+	ShareSubPathMounts bool `json:"share_sub_path_mounts"`
+
+	// RemoveSettleMilliseconds delays removing a target's directory after it was unmounted
+	RemoveSettleMilliseconds int `json:"remove_settle_milliseconds"`
+
+	// FuseHostnameTemplate sets the fuse container's hostname, substituting {podUID} and {namespace}
+	FuseHostnameTemplate string `json:"fuse_hostname_template"`
+
+	// FuseRestartPolicy has the runtime restart the fuse container (no, on-failure, always). Defaults to no.
+	// FuseRestartMaxRetries bounds on-failure restarts (default unbounded)
+	FuseRestartPolicy     string `json:"fuse_restart_policy"`
+	FuseRestartMaxRetries int    `json:"fuse_restart_max_retries"`
+
+	// CleanExitAction decides what a mount does when its fuse container exits with code 0 before the mount
+	// appeared (fail, wait). Defaults to fail, with the container's log, as such a container didn't mount. wait
+	// keeps waiting for the mount, for images whose entrypoint exits once it hands the mount off
+	CleanExitAction string `json:"clean_exit_action"`
+
+	// FuseCapabilities run the fuse container unprivileged, with only these capabilities (e.g. SYS_ADMIN) and
+	// FuseDevices (default /dev/fuse). Unset runs it privileged
+	FuseCapabilities []string `json:"fuse_capabilities"`
+	FuseDevices      []string `json:"fuse_devices"`
+
+	// DirCreateFailureMode decides what a failure to create one of the spec's folders does to the mount (fail,
+	// warn). Defaults to fail, which unmounts and fails the mount
+	DirCreateFailureMode string `json:"dir_create_failure_mode"`
+
+	// RecreateOnSpecChange recreates a healthy mount when it's mounted again with a spec that differs in fields
+	// taking effect on container creation (e.g. the container or access key). Other differences are ignored
+	RecreateOnSpecChange bool `json:"recreate_on_spec_change"`
+
+	// MountTableRecheckMilliseconds is how long to wait before confirming that a target isn't mounted during the
+	// first MountTableRecheckBootWindowSeconds after node boot, when the mount table may lag behind (default 500ms
+	// during the first 10 minutes). DisableMountTableRecheck trusts the first check
+	MountTableRecheckMilliseconds      int  `json:"mount_table_recheck_milliseconds"`
+	MountTableRecheckBootWindowSeconds int  `json:"mount_table_recheck_boot_window_seconds"`
+	DisableMountTableRecheck           bool `json:"disable_mount_table_recheck"`
+
+	// LazyUnmountEscalationSeconds is how long a mount that outlived umount gets to go away after being lazily
+	// unmounted, and then after being forcibly unmounted with ForceUnmount, before the unmount fails (default 3)
+	LazyUnmountEscalationSeconds int `json:"lazy_unmount_escalation_seconds"`
+
+	// ForceUnmount has unmount fall back to umount -f when a mount outlives both umount and a lazy umount, rather
+	// than failing
+	ForceUnmount bool `json:"force_unmount"`
+
+	// UnmountOrder is whether unmount runs umount before removing the fuse container, letting the fuse process
+	// exit gracefully, or the other way around as the driver used to (umount-first|container-first, default
+	// umount-first)
+	UnmountOrder string `json:"unmount_order"`
+
+	// UnmountTimeoutSeconds is how long umount gets to remove a mount before escalating to a lazy umount
+	// (default 7), and UnmountPollIntervalMilliseconds how often the mount table is checked meanwhile (default 1000)
+	UnmountTimeoutSeconds           int `json:"unmount_timeout_seconds"`
+	UnmountPollIntervalMilliseconds int `json:"unmount_poll_interval_milliseconds"`
+
+	// DrainConcurrency is how many targets the drain command unmounts in parallel (default 4)
+	DrainConcurrency int `json:"drain_concurrency"`
+
+	// BackendRetryCount and BackendRetryIntervalSeconds have the fuse process retry transient backend errors
+	// before giving up. The retries happen within the mount, so with MountTimeoutSeconds set they should fit in
+	// it, or the driver gives up on the mount while the fuse process is still retrying. Unset means the fuse
+	// process' own defaults
+	BackendRetryCount           int `json:"backend_retry_count"`
+	BackendRetryIntervalSeconds int `json:"backend_retry_interval_seconds"`
+
+	// StateSocketPath is the unix socket the serve-state command serves the node's mount inventory on, for local
+	// monitoring agents
+	StateSocketPath string `json:"state_socket_path"`
+
+	// LatencyBuckets are the upper bounds, in seconds, of the mount and unmount latency histograms served with the
+	// state socket's metrics (default 0.5, 1, 2.5, 5, 10, 30, 60, 120)
+	LatencyBuckets []float64 `json:"latency_buckets"`
+
+	// EventWebhookURL receives a JSON POST of each successful mount and unmount, without secrets. A webhook that
+	// fails or doesn't respond within EventWebhookTimeoutSeconds (default 2) is only logged
+	EventWebhookURL            string `json:"event_webhook_url"`
+	EventWebhookTimeoutSeconds int    `json:"event_webhook_timeout_seconds"`
+
+	// FuseLogDriver is where fuse containers' output goes (json-file|local|journald|syslog|fluentd|none), with
+	// driver specific FuseLogOptions (e.g. tag). Only docker supports all drivers, containerd only supports none.
+	// Unset means the runtime's default
+	FuseLogDriver  string            `json:"fuse_log_driver"`
+	FuseLogOptions map[string]string `json:"fuse_log_options"`
+
+	// CheckFuseMountPoint verifies that a newly created container has the directory its target is mounted at before
+	// waiting for the mount, at the cost of an exec per mount
+	CheckFuseMountPoint bool `json:"check_fuse_mount_point"`
+
+	// DisableDockerFallback uses docker whenever its CLI is installed. Otherwise, the next runtime of
+	// CRIDetectionOrder is used when the docker daemon is unreachable
+	DisableDockerFallback bool `json:"disable_docker_fallback"`
+
+	// CRIType is the runtime fuse containers run in (docker|containerd|crio|auto, default auto). Auto looks for the
+	// runtimes on the node in CRIDetectionOrder (docker|crio|containerd, default docker, crio, containerd)
+	CRIType           string   `json:"cri_type"`
+	CRIDetectionOrder []string `json:"cri_detection_order"`
+
+	// PreferredRuntime is detected before the rest of CRIDetectionOrder, for nodes that have several runtimes
+	// (docker|crio|containerd), so fuse containers run in the one kubelet uses
+	PreferredRuntime string `json:"preferred_runtime"`
+
+	// CRISocketPath is the socket of an explicit CRIType (default is the runtime's standard socket), and
+	// CRINamespace the containerd namespace or CRI-O pod namespace of fuse containers (default v3io)
+	CRISocketPath string `json:"cri_socket_path"`
+	CRINamespace  string `json:"cri_namespace"`
+
+	// FuseOptions are default fuse mount options (e.g. uid=1000), passed with -o. The spec's options override
+	// conflicting ones
+	FuseOptions []string `json:"fuse_options"`
+
+	// NameConflictPolicy decides what happens when the fuse container's name is taken by a container created
+	// concurrently (retry, reuse). Defaults to retry, which removes it and creates the container once more. With
+	// reuse, a running container is used as is
+	NameConflictPolicy string `json:"name_conflict_policy"`
+
+	// CreateContainerRetries is how many times creating the fuse container is retried on transient runtime errors
+	// (default 3), backing off exponentially. A missing image isn't retried
+	CreateContainerRetries int `json:"create_container_retries"`
+
+	// ContainerNameStrategy decides how a target's fuse container is named (path-based, hash, labels). Defaults
+	// to path-based, from the pod uid and volume name in the target path. hash names it by a hash of the target
+	// path, which works for any path. labels names it by the pod uid and volume name labels of the pod it mounts
+	// for, falling back to hash for targets that serve many pods or whose spec wasn't recorded
+	ContainerNameStrategy string `json:"container_name_strategy"`
+
+	// ImagePullTimeoutSeconds bounds pulling the fuse image when it isn't on the node (default
+	// CRITimeoutSeconds). The image is only pulled for mounts that create a container, and the pull doesn't count
+	// against MountTimeoutSeconds
+	ImagePullTimeoutSeconds int `json:"image_pull_timeout_seconds"`
+
+	// CRITimeoutSeconds bounds each CRI operation that has no timeout of its own (default unbounded).
+	// CRICreateTimeoutSeconds, CRIRemoveTimeoutSeconds and CRIInspectTimeoutSeconds bound creating, removing
+	// and inspecting containers and images, so a slow create isn't bound by a timeout tuned for quick removals
+	CRITimeoutSeconds        int `json:"cri_timeout_seconds"`
+	CRICreateTimeoutSeconds  int `json:"cri_create_timeout_seconds"`
+	CRIRemoveTimeoutSeconds  int `json:"cri_remove_timeout_seconds"`
+	CRIInspectTimeoutSeconds int `json:"cri_inspect_timeout_seconds"`
+
+	// RegistryAuthConfigPath is a docker config.json holding the credentials of the fuse image's registry, for
+	// pulling it from a private registry. The credentials are passed to the CRI and never logged
+	RegistryAuthConfigPath string `json:"registry_auth_config_path"`
+
+	// ImagePullPolicy decides whether every mount pulls the fuse image (IfNotPresent, Always). Defaults to
+	// IfNotPresent, which pulls it only if it isn't on the node
+	ImagePullPolicy string `json:"image_pull_policy"`
+
+	// MountTimeoutSeconds bounds the whole mount operation, shared by all of its steps (default unbounded)
+	MountTimeoutSeconds int `json:"mount_timeout_seconds"`
+
+	// LogOutput selects where the driver logs to (journal, stderr, file, syslog). Defaults to the systemd journal
+	LogOutput      string `json:"log_output"`
+	LogFilePath    string `json:"log_file_path"`
+	SyslogTag      string `json:"syslog_tag"`
+	SyslogFacility string `json:"syslog_facility"`
+
+	// LogFileMaxSizeMB rotates the log file once it would grow past it, keeping LogFileMaxBackups rotated files
+	// (default no rotation)
+	LogFileMaxSizeMB  int `json:"log_file_max_size_mb"`
+	LogFileMaxBackups int `json:"log_file_max_backups"`
+
+	// DebugLogRatePerSecond and DebugLogBurst limit how many debug messages of the same kind are logged (default 5
+	// per second after a burst of 10). DisableDebugLogRateLimit logs all of them
+	DebugLogRatePerSecond    float64 `json:"debug_log_rate_per_second"`
+	DebugLogBurst            int     `json:"debug_log_burst"`
+	DisableDebugLogRateLimit bool    `json:"disable_debug_log_rate_limit"`
 }
 
 func NewConfig() (*Config, error) {
@@ -37,9 +368,621 @@ func NewConfig() (*Config, error) {
 
 	journal.Debug("Created configuration", "content", string(content))
 
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid configuration: %s", err)
+	}
+
 	return &config, nil
 }
 
+func (c *Config) validate() error {
+	if _, err := newReadinessStrategy(c.ReadinessStrategy, nil); err != nil {
+		return err
+	}
+
+	if err := c.validateClusters(); err != nil {
+		return err
+	}
+
+	if c.DataURLsTimeoutSeconds < 0 {
+		return errors.New("data_urls_timeout_seconds must not be negative")
+	}
+
+	if c.PreflightTimeoutSeconds < 0 {
+		return errors.New("preflight_timeout_seconds must not be negative")
+	}
+
+	if c.ImagePullTimeoutSeconds < 0 {
+		return errors.New("image_pull_timeout_seconds must not be negative")
+	}
+
+	if c.CRITimeoutSeconds < 0 ||
+		c.CRICreateTimeoutSeconds < 0 ||
+		c.CRIRemoveTimeoutSeconds < 0 ||
+		c.CRIInspectTimeoutSeconds < 0 {
+		return errors.New("cri_timeout_seconds and the per operation CRI timeouts must not be negative")
+	}
+
+	if c.MountTimeoutSeconds < 0 {
+		return errors.New("mount_timeout_seconds must not be negative")
+	}
+
+	if c.ConnectionStringTemplate != "" {
+		if err := validateConnectionStringTemplate(c.ConnectionStringTemplate); err != nil {
+			return err
+		}
+	}
+
+	// fuse refuses allow_other together with allow_root, hence a single mode
+	switch c.AccessMode {
+	case "", AccessModeAllowOther, AccessModeAllowRoot, AccessModeNone:
+	default:
+		return fmt.Errorf("access_mode must be one of %s, %s or %s, got %s",
+			AccessModeAllowOther,
+			AccessModeAllowRoot,
+			AccessModeNone,
+			c.AccessMode)
+	}
+
+	if c.SELinuxLabel != "" && !selinuxLabelRegexp.MatchString(c.SELinuxLabel) {
+		return fmt.Errorf("selinux_label must be of the form user:role:type:level, got %s", c.SELinuxLabel)
+	}
+
+	switch c.FuseRestartPolicy {
+	case "", cri.RestartPolicyNo, cri.RestartPolicyOnFailure, cri.RestartPolicyAlways:
+	default:
+		return fmt.Errorf("fuse_restart_policy must be one of %s, %s or %s, got %s",
+			cri.RestartPolicyNo,
+			cri.RestartPolicyOnFailure,
+			cri.RestartPolicyAlways,
+			c.FuseRestartPolicy)
+	}
+
+	if c.FuseRestartMaxRetries < 0 {
+		return errors.New("fuse_restart_max_retries must not be negative")
+	}
+
+	if c.FuseRestartMaxRetries > 0 && c.FuseRestartPolicy != cri.RestartPolicyOnFailure {
+		return fmt.Errorf("fuse_restart_max_retries requires fuse_restart_policy %s", cri.RestartPolicyOnFailure)
+	}
+
+	// a container that is removed on exit can't be restarted
+	if c.AutoRemoveContainer && c.FuseRestartPolicy != "" && c.FuseRestartPolicy != cri.RestartPolicyNo {
+		return errors.New("auto_remove_container can't be combined with fuse_restart_policy")
+	}
+
+	switch c.FuseLogDriver {
+	case "", "json-file", "local", "journald", "syslog", "fluentd", cri.LogDriverNone:
+	default:
+		return fmt.Errorf("fuse_log_driver must be one of json-file, local, journald, syslog, fluentd or %s, got %s",
+			cri.LogDriverNone,
+			c.FuseLogDriver)
+	}
+
+	if len(c.FuseCapabilities) == 0 && len(c.FuseDevices) > 0 {
+		return errors.New("fuse_devices require fuse_capabilities, as a privileged container has all devices")
+	}
+
+	// fuse can't mount without them, so the mount would only fail later and less clearly
+	if len(c.FuseCapabilities) > 0 {
+		for _, capability := range c.FuseCapabilities {
+			if !capabilityRegexp.MatchString(normalizeCapability(capability)) {
+				return fmt.Errorf("fuse_capabilities entries must be capability names, got %s", capability)
+			}
+		}
+
+		if !containsString(c.getFuseCapabilities(), fuseCapability) {
+			return fmt.Errorf("fuse_capabilities must include %s, got %v", fuseCapability, c.FuseCapabilities)
+		}
+
+		if !containsString(c.getFuseDevices(), fuseDevicePath) {
+			return fmt.Errorf("fuse_devices must include %s, got %v", fuseDevicePath, c.FuseDevices)
+		}
+	}
+
+	if len(c.FuseLogOptions) > 0 && (c.FuseLogDriver == "" || c.FuseLogDriver == cri.LogDriverNone) {
+		return errors.New("fuse_log_options require a fuse_log_driver other than none")
+	}
+
+	switch c.NameConflictPolicy {
+	case "", NameConflictPolicyRetry, NameConflictPolicyReuse:
+	default:
+		return fmt.Errorf("name_conflict_policy must be one of %s or %s, got %s",
+			NameConflictPolicyRetry,
+			NameConflictPolicyReuse,
+			c.NameConflictPolicy)
+	}
+
+	if c.FailedContainerRetentionMinutes < 0 {
+		return errors.New("failed_container_retention_minutes must not be negative")
+	}
+
+	switch c.CleanExitAction {
+	case "", CleanExitActionFail, CleanExitActionWait:
+	default:
+		return fmt.Errorf("clean_exit_action must be one of %s or %s, got %s",
+			CleanExitActionFail,
+			CleanExitActionWait,
+			c.CleanExitAction)
+	}
+
+	switch c.ContainerNameStrategy {
+	case "", ContainerNameStrategyPathBased, ContainerNameStrategyHash, ContainerNameStrategyLabels:
+	default:
+		return fmt.Errorf("container_name_strategy must be one of %s, %s or %s, got %s",
+			ContainerNameStrategyPathBased,
+			ContainerNameStrategyHash,
+			ContainerNameStrategyLabels,
+			c.ContainerNameStrategy)
+	}
+
+	switch c.DirCreateFailureMode {
+	case "", DirCreateFailureModeFail, DirCreateFailureModeWarn:
+	default:
+		return fmt.Errorf("dir_create_failure_mode must be one of %s or %s, got %s",
+			DirCreateFailureModeFail,
+			DirCreateFailureModeWarn,
+			c.DirCreateFailureMode)
+	}
+
+	if c.LogFileMaxSizeMB < 0 || c.LogFileMaxBackups < 0 {
+		return errors.New("log_file_max_size_mb and log_file_max_backups must not be negative")
+	}
+
+	if c.DebugLogRatePerSecond < 0 || c.DebugLogBurst < 0 {
+		return errors.New("debug_log_rate_per_second and debug_log_burst must not be negative")
+	}
+
+	if c.MountTableRecheckMilliseconds < 0 || c.MountTableRecheckBootWindowSeconds < 0 {
+		return errors.New("mount_table_recheck_milliseconds and mount_table_recheck_boot_window_seconds " +
+			"must not be negative")
+	}
+
+	if c.BackendRetryCount < 0 || c.BackendRetryIntervalSeconds < 0 {
+		return errors.New("backend_retry_count and backend_retry_interval_seconds must not be negative")
+	}
+
+	if c.LazyUnmountEscalationSeconds < 0 {
+		return errors.New("lazy_unmount_escalation_seconds must not be negative")
+	}
+
+	switch c.CRIType {
+	case "", CRITypeAuto, CRIDocker, CRICRIO, CRIContainerd:
+	default:
+		return fmt.Errorf("cri_type must be one of %s, %s, %s or %s, got %s",
+			CRITypeAuto,
+			CRIDocker,
+			CRICRIO,
+			CRIContainerd,
+			c.CRIType)
+	}
+
+	for _, runtimeName := range c.CRIDetectionOrder {
+		switch runtimeName {
+		case CRIDocker, CRICRIO, CRIContainerd:
+		default:
+			return fmt.Errorf("cri_detection_order entries must be one of %s, %s or %s, got %s",
+				CRIDocker,
+				CRICRIO,
+				CRIContainerd,
+				runtimeName)
+		}
+	}
+
+	switch c.PreferredRuntime {
+	case "", CRIDocker, CRICRIO, CRIContainerd:
+	default:
+		return fmt.Errorf("preferred_runtime must be one of %s, %s or %s, got %s",
+			CRIDocker,
+			CRICRIO,
+			CRIContainerd,
+			c.PreferredRuntime)
+	}
+
+	if c.RequireTargetMode != "" {
+		if _, err := c.getRequiredTargetMode(); err != nil {
+			return fmt.Errorf("require_target_mode must be an octal mode, got %s", c.RequireTargetMode)
+		}
+	}
+
+	if c.LinkBasePath != "" && (!filepath.IsAbs(c.LinkBasePath) || filepath.Clean(c.LinkBasePath) == "/") {
+		return fmt.Errorf("link_base_path must be an absolute path other than /, got %s", c.LinkBasePath)
+	}
+
+	if c.LinkDefaultNamespace != "" && !isSinglePathComponent(c.LinkDefaultNamespace) {
+		return fmt.Errorf("link_default_namespace must be a single path component, got %s", c.LinkDefaultNamespace)
+	}
+
+	switch c.UnmountOrder {
+	case "", UnmountOrderUmountFirst, UnmountOrderContainerFirst:
+	default:
+		return fmt.Errorf("unmount_order must be one of %s or %s, got %s",
+			UnmountOrderUmountFirst,
+			UnmountOrderContainerFirst,
+			c.UnmountOrder)
+	}
+
+	if c.CreateContainerRetries < 0 {
+		return errors.New("create_container_retries must not be negative")
+	}
+
+	if c.MountDedupWindowSeconds < 0 {
+		return errors.New("mount_dedup_window_seconds must not be negative")
+	}
+
+	for bucketIdx, bucket := range c.LatencyBuckets {
+		if bucket <= 0 || (bucketIdx > 0 && bucket <= c.LatencyBuckets[bucketIdx-1]) {
+			return fmt.Errorf("latency_buckets must be positive and increasing, got %v", c.LatencyBuckets)
+		}
+	}
+
+	switch c.ImagePullPolicy {
+	case "", cri.PullPolicyIfNotPresent, cri.PullPolicyAlways:
+	default:
+		return fmt.Errorf("image_pull_policy must be one of %s or %s, got %s",
+			cri.PullPolicyIfNotPresent,
+			cri.PullPolicyAlways,
+			c.ImagePullPolicy)
+	}
+
+	if c.RegistryAuthConfigPath != "" &&
+		(!filepath.IsAbs(c.RegistryAuthConfigPath) || filepath.Base(c.RegistryAuthConfigPath) != "config.json") {
+		return fmt.Errorf("registry_auth_config_path must be an absolute path to a config.json, got %s",
+			c.RegistryAuthConfigPath)
+	}
+
+	if c.EventWebhookURL != "" {
+		webhookURL, err := url.Parse(c.EventWebhookURL)
+		if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+			return fmt.Errorf("event_webhook_url must be an http or https URL, got %s", c.EventWebhookURL)
+		}
+	}
+
+	if c.EventWebhookTimeoutSeconds < 0 {
+		return errors.New("event_webhook_timeout_seconds must not be negative")
+	}
+
+	if c.MaxMountsPerNode < 0 {
+		return errors.New("max_mounts_per_node must not be negative")
+	}
+
+	if c.UnmountTimeoutSeconds < 0 || c.UnmountPollIntervalMilliseconds < 0 {
+		return errors.New("unmount_timeout_seconds and unmount_poll_interval_milliseconds must not be negative")
+	}
+
+	if c.DrainConcurrency < 0 {
+		return errors.New("drain_concurrency must not be negative")
+	}
+
+	if c.RemoveSettleMilliseconds < 0 {
+		return errors.New("remove_settle_milliseconds must not be negative")
+	}
+
+	if c.FuseRawArgs {
+		if len(c.FuseCommand) == 0 {
+			return errors.New("fuse_raw_args requires fuse_command to be set")
+		}
+
+		// the readiness check looks for the mount on the host side of fuseMountPoint
+		if !strings.Contains(strings.Join(c.FuseCommand, " "), fuseMountPoint) {
+			return fmt.Errorf("fuse_command must mount at %s when fuse_raw_args is set", fuseMountPoint)
+		}
+	}
+
+	return nil
+}
+
+// getImage returns the fuse image. The repository and tag are each taken from the config, else from the
+// environment (imageRepositoryEnvVar, imageTagEnvVar), for air-gapped clusters that push the image to a private
+// registry, else they're the defaults
+func (c *Config) getImage() string {
+	ImageRepository := c.ImageRepository
+	if ImageRepository == "" {
+		ImageRepository = os.Getenv(imageRepositoryEnvVar)
+	}
+
+	if ImageRepository == "" {
+		ImageRepository = "iguazio/v3io-fuse"
+	}
+
+	ImageTag := c.ImageTag
+	if ImageTag == "" {
+		ImageTag = os.Getenv(imageTagEnvVar)
+	}
+
+	if ImageTag == "" {
+		ImageTag = "local"
+	}
+
+	return fmt.Sprintf("%s:%s", ImageRepository, ImageTag)
+}
+
+func (c *Config) getDirCreateFailureMode() string {
+	if c.DirCreateFailureMode == "" {
+		return DirCreateFailureModeFail
+	}
+
+	return c.DirCreateFailureMode
+}
+
+func (c *Config) getDebugLogRatePerSecond() float64 {
+	if c.DebugLogRatePerSecond == 0 {
+		return journal.DefaultDebugRatePerSecond
+	}
+
+	return c.DebugLogRatePerSecond
+}
+
+func (c *Config) getDebugLogBurst() int {
+	if c.DebugLogBurst == 0 {
+		return journal.DefaultDebugBurst
+	}
+
+	return c.DebugLogBurst
+}
+
+func (c *Config) getMountTableRecheckDelay() time.Duration {
+	if c.MountTableRecheckMilliseconds == 0 {
+		return defaultMountTableRecheckDelay
+	}
+
+	return time.Duration(c.MountTableRecheckMilliseconds) * time.Millisecond
+}
+
+func (c *Config) getMountTableRecheckBootWindow() time.Duration {
+	if c.MountTableRecheckBootWindowSeconds == 0 {
+		return defaultMountTableRecheckBootWindow
+	}
+
+	return time.Duration(c.MountTableRecheckBootWindowSeconds) * time.Second
+}
+
+func (c *Config) getLazyUnmountEscalationWindow() time.Duration {
+	if c.LazyUnmountEscalationSeconds == 0 {
+		return defaultLazyUnmountEscalationWindow
+	}
+
+	return time.Duration(c.LazyUnmountEscalationSeconds) * time.Second
+}
+
+func (c *Config) getRequiredTargetMode() (os.FileMode, error) {
+	requiredTargetMode, err := strconv.ParseUint(c.RequireTargetMode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	if os.FileMode(requiredTargetMode) & ^os.ModePerm != 0 {
+		return 0, fmt.Errorf("%s has bits other than permission bits", c.RequireTargetMode)
+	}
+
+	return os.FileMode(requiredTargetMode), nil
+}
+
+func (c *Config) getCRIDetectionOrder() []string {
+	detectionOrder := c.CRIDetectionOrder
+	if len(detectionOrder) == 0 {
+		detectionOrder = []string{CRIDocker, CRICRIO, CRIContainerd}
+	}
+
+	if c.PreferredRuntime == "" {
+		return detectionOrder
+	}
+
+	preferredDetectionOrder := []string{c.PreferredRuntime}
+	for _, runtimeName := range detectionOrder {
+		if runtimeName != c.PreferredRuntime {
+			preferredDetectionOrder = append(preferredDetectionOrder, runtimeName)
+		}
+	}
+
+	return preferredDetectionOrder
+}
+
+func (c *Config) getCRISocketPath(criType string) string {
+	if c.CRISocketPath != "" {
+		return c.CRISocketPath
+	}
+
+	switch criType {
+	case CRIDocker:
+		return dockerSocketPath
+	case CRICRIO:
+		return crioSocketPath
+	default:
+		return containerdSocketPath
+	}
+}
+
+func (c *Config) getLinkBasePath() string {
+	if c.LinkBasePath == "" {
+		return defaultLinkBasePath
+	}
+
+	return filepath.Clean(c.LinkBasePath)
+}
+
+func (c *Config) getCRINamespace() string {
+	if c.CRINamespace == "" {
+		return defaultCRINamespace
+	}
+
+	return c.CRINamespace
+}
+
+// isDryRun returns whether DryRun is set, in the config or the environment
+func (c *Config) isDryRun() bool {
+	if c.DryRun {
+		return true
+	}
+
+	dryRun, err := strconv.ParseBool(os.Getenv(dryRunEnvVar))
+
+	return err == nil && dryRun
+}
+
+func (c *Config) getUnmountOrder() string {
+	if c.UnmountOrder == "" {
+		return UnmountOrderUmountFirst
+	}
+
+	return c.UnmountOrder
+}
+
+func (c *Config) getUnmountTimeout() time.Duration {
+	if c.UnmountTimeoutSeconds == 0 {
+		return defaultUnmountTimeout
+	}
+
+	return time.Duration(c.UnmountTimeoutSeconds) * time.Second
+}
+
+func (c *Config) getUnmountPollInterval() time.Duration {
+	if c.UnmountPollIntervalMilliseconds == 0 {
+		return defaultUnmountPollInterval
+	}
+
+	return time.Duration(c.UnmountPollIntervalMilliseconds) * time.Millisecond
+}
+
+// getFuseCapabilities returns FuseCapabilities as runtimes take them, without the CAP_ prefix
+func (c *Config) getFuseCapabilities() []string {
+	var capabilities []string
+	for _, capability := range c.FuseCapabilities {
+		capabilities = append(capabilities, normalizeCapability(capability))
+	}
+
+	return capabilities
+}
+
+func (c *Config) getFuseDevices() []string {
+	if len(c.FuseDevices) == 0 && len(c.FuseCapabilities) > 0 {
+		return []string{fuseDevicePath}
+	}
+
+	return c.FuseDevices
+}
+
+func normalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidateValue := range values {
+		if candidateValue == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Config) getCreateContainerRetries() int {
+	if c.CreateContainerRetries == 0 {
+		return defaultCreateContainerRetries
+	}
+
+	return c.CreateContainerRetries
+}
+
+func (c *Config) getFailedContainerRetention() time.Duration {
+	if c.FailedContainerRetentionMinutes == 0 {
+		return defaultFailedContainerRetention
+	}
+
+	return time.Duration(c.FailedContainerRetentionMinutes) * time.Minute
+}
+
+func (c *Config) getLatencyBuckets() []float64 {
+	if len(c.LatencyBuckets) == 0 {
+		return defaultLatencyBuckets
+	}
+
+	return c.LatencyBuckets
+}
+
+func (c *Config) getEventWebhookTimeout() time.Duration {
+	if c.EventWebhookTimeoutSeconds == 0 {
+		return defaultEventWebhookTimeout
+	}
+
+	return time.Duration(c.EventWebhookTimeoutSeconds) * time.Second
+}
+
+// getCRITimeouts returns the timeouts of each type of CRI operation, falling back to CRITimeoutSeconds
+func (c *Config) getCRITimeouts() cri.Timeouts {
+	return cri.Timeouts{
+		Create:  c.getCRITimeout(c.CRICreateTimeoutSeconds),
+		Remove:  c.getCRITimeout(c.CRIRemoveTimeoutSeconds),
+		Inspect: c.getCRITimeout(c.CRIInspectTimeoutSeconds),
+	}
+}
+
+func (c *Config) getImagePullTimeout() time.Duration {
+	return c.getCRITimeout(c.ImagePullTimeoutSeconds)
+}
+
+func (c *Config) getCRITimeout(operationTimeoutSeconds int) time.Duration {
+	if operationTimeoutSeconds == 0 {
+		return time.Duration(c.CRITimeoutSeconds) * time.Second
+	}
+
+	return time.Duration(operationTimeoutSeconds) * time.Second
+}
+
+func (c *Config) getDrainConcurrency() int {
+	if c.DrainConcurrency == 0 {
+		return defaultDrainConcurrency
+	}
+
+	return c.DrainConcurrency
+}
+
+func (c *Config) getKubeletRootDir() string {
+	if c.KubeletRootDir == "" {
+		return defaultKubeletRootDir
+	}
+
+	return c.KubeletRootDir
+}
+
+func (c *Config) getAccessMode() string {
+	if c.AccessMode == "" {
+		return AccessModeAllowOther
+	}
+
+	return c.AccessMode
+}
+
+// checkFuseConf verifies that the node's fuse.conf permits a configured allow_other or allow_root access mode,
+// which fuse only permits with user_allow_other. The default access mode isn't checked, as nodes often have no
+// fuse.conf at all
+func (c *Config) checkFuseConf() error {
+	return checkFuseConfAccessMode(c.AccessMode, fuseConfPath)
+}
+
+func checkFuseConfAccessMode(accessMode string, fuseConfPath string) error {
+	if accessMode != AccessModeAllowOther && accessMode != AccessModeAllowRoot {
+		return nil
+	}
+
+	fuseConf, err := ioutil.ReadFile(fuseConfPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to read %s: %s", fuseConfPath, err)
+	}
+
+	for _, line := range strings.Split(string(fuseConf), "\n") {
+		if commentIdx := strings.Index(line, "#"); commentIdx >= 0 {
+			line = line[:commentIdx]
+		}
+
+		if strings.TrimSpace(line) == "user_allow_other" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("access_mode %s requires user_allow_other in %s", accessMode, fuseConfPath)
+}
+
 func (c *Config) DataURLs(cluster string) (string, error) {
 	clusterConfig, err := c.findCluster(cluster)
 	if err != nil {
@@ -48,11 +991,95 @@ func (c *Config) DataURLs(cluster string) (string, error) {
 	return strings.Join(clusterConfig.DataUrls, ","), nil
 }
 
+// DataURLsResolver resolves a cluster's comma separated data URLs. The config resolves them from its clusters,
+// while other resolvers may look them up remotely, which may block
+type DataURLsResolver interface {
+	DataURLs(cluster string) (string, error)
+}
+
+func (c *Config) getDataURLsTimeout() time.Duration {
+	if c.DataURLsTimeoutSeconds > 0 {
+		return time.Duration(c.DataURLsTimeoutSeconds) * time.Second
+	}
+
+	return defaultDataURLsTimeout
+}
+
+// resolveDataURLsWithTimeout resolves the cluster's data URLs, failing with ErrDataURLsTimeout if the resolution
+// doesn't complete within the timeout. A resolution that timed out is left to complete in the background
+func resolveDataURLsWithTimeout(resolver DataURLsResolver, cluster string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type dataURLsResult struct {
+		dataURLs string
+		err      error
+	}
+
+	resultChan := make(chan dataURLsResult, 1)
+	go func() {
+		dataURLs, err := resolver.DataURLs(cluster)
+		resultChan <- dataURLsResult{dataURLs: dataURLs, err: err}
+	}()
+
+	select {
+	case result := <-resultChan:
+		return result.dataURLs, result.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("%w (cluster: %s, timeout: %s)", ErrDataURLsTimeout, cluster, timeout)
+	}
+}
+
+// findCluster returns the configuration of a cluster by name. There is no implicit default, so a config without a
+// cluster named default fails the mounts of specs that don't name one
 func (c *Config) findCluster(cluster string) (*ClusterConfig, error) {
+	for clusterIndex := range c.Clusters {
+		if c.Clusters[clusterIndex].Name == cluster {
+			return &c.Clusters[clusterIndex], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w %s (configured clusters: %s)", ErrUnknownCluster, cluster, c.getClusterNames())
+}
+
+// getClusterImage returns the fuse image for mounts of a cluster, which is the cluster's image override if any.
+// An unknown cluster fails the mount later on, when its data URLs are resolved
+func (c *Config) getClusterImage(cluster string) string {
+	if clusterConfig, err := c.findCluster(cluster); err == nil && clusterConfig.Image != "" {
+		return clusterConfig.Image
+	}
+
+	return c.getImage()
+}
+
+func (c *Config) getClusterNames() string {
+	if len(c.Clusters) == 0 {
+		return "none"
+	}
+
+	var clusterNames []string
 	for _, clusterConfig := range c.Clusters {
-		if clusterConfig.Name == cluster {
-			return &clusterConfig, nil
+		clusterNames = append(clusterNames, clusterConfig.Name)
+	}
+
+	return strings.Join(clusterNames, ", ")
+}
+
+// validateClusters verifies that clusters are named uniquely, as they're looked up by name
+func (c *Config) validateClusters() error {
+	clusterNames := map[string]bool{}
+
+	for _, clusterConfig := range c.Clusters {
+		if clusterConfig.Name == "" {
+			return errors.New("clusters must be named")
+		}
+
+		if clusterNames[clusterConfig.Name] {
+			return fmt.Errorf("cluster %s is configured more than once", clusterConfig.Name)
 		}
+
+		clusterNames[clusterConfig.Name] = true
 	}
-	return nil, fmt.Errorf("no such cluster %s", cluster)
+
+	return nil
 }
@@ -0,0 +1,449 @@
+package flex
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/cri"
+)
+
+// slowDataURLsResolver resolves data URLs after a delay
+type slowDataURLsResolver struct {
+	delay    time.Duration
+	dataURLs string
+}
+
+func (r *slowDataURLsResolver) DataURLs(cluster string) (string, error) {
+	time.Sleep(r.delay)
+
+	return r.dataURLs, nil
+}
+
+func TestResolveDataURLsWithTimeout(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		delay         time.Duration
+		expectTimeout bool
+	}{
+		{name: "fast", delay: 0},
+		{name: "slow", delay: time.Second, expectTimeout: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			resolver := &slowDataURLsResolver{delay: testCase.delay, dataURLs: "tcp://10.0.0.1:1234"}
+
+			dataURLs, err := resolveDataURLsWithTimeout(resolver, "default", 50*time.Millisecond)
+			if testCase.expectTimeout {
+				if !errors.Is(err, ErrDataURLsTimeout) {
+					t.Fatalf("Expected ErrDataURLsTimeout, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil || dataURLs != resolver.dataURLs {
+				t.Fatalf("Expected %s, got %s (err: %v)", resolver.dataURLs, dataURLs, err)
+			}
+		})
+	}
+}
+
+func TestMounterGetDataURLsUsesResolver(t *testing.T) {
+	mounter := newTestMounter(&Config{DataURLsTimeoutSeconds: 1}, newMemoryFilesystem())
+	mounter.dataURLsResolver = &slowDataURLsResolver{delay: 2 * time.Second}
+
+	if _, err := mounter.getDataURLs("default"); !errors.Is(err, ErrDataURLsTimeout) {
+		t.Fatalf("Expected ErrDataURLsTimeout, got %v", err)
+	}
+}
+
+func TestCheckFuseConfAccessMode(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		accessMode  string
+		fuseConf    *string
+		expectError bool
+	}{
+		{name: "default mode without fuse.conf", accessMode: ""},
+		{name: "none without fuse.conf", accessMode: AccessModeNone},
+		{name: "allow_other without fuse.conf", accessMode: AccessModeAllowOther, expectError: true},
+		{
+			name:       "allow_other permitted",
+			accessMode: AccessModeAllowOther,
+			fuseConf:   stringPointer("# mount_max = 1000\n user_allow_other \n"),
+		},
+		{
+			name:       "allow_root permitted",
+			accessMode: AccessModeAllowRoot,
+			fuseConf:   stringPointer("user_allow_other # for v3io\n"),
+		},
+		{
+			name:        "commented out",
+			accessMode:  AccessModeAllowRoot,
+			fuseConf:    stringPointer("#user_allow_other\n"),
+			expectError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			fuseConfPath := filepath.Join(t.TempDir(), "fuse.conf")
+			if testCase.fuseConf != nil {
+				if err := ioutil.WriteFile(fuseConfPath, []byte(*testCase.fuseConf), 0644); err != nil {
+					t.Fatalf("Failed to write fuse.conf: %s", err)
+				}
+			}
+
+			err := checkFuseConfAccessMode(testCase.accessMode, fuseConfPath)
+			if (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+		})
+	}
+}
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func TestUnmountTimeoutConfig(t *testing.T) {
+	for _, testCase := range []struct {
+		name                 string
+		config               Config
+		expectError          bool
+		expectedTimeout      time.Duration
+		expectedPollInterval time.Duration
+	}{
+		{name: "defaults", expectedTimeout: defaultUnmountTimeout, expectedPollInterval: defaultUnmountPollInterval},
+		{name: "extended", config: Config{UnmountTimeoutSeconds: 30, UnmountPollIntervalMilliseconds: 250},
+			expectedTimeout: 30 * time.Second, expectedPollInterval: 250 * time.Millisecond},
+		{name: "negative timeout", config: Config{UnmountTimeoutSeconds: -1}, expectError: true},
+		{name: "negative poll interval", config: Config{UnmountPollIntervalMilliseconds: -1}, expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if err := testCase.config.validate(); (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+
+			if testCase.expectError {
+				return
+			}
+
+			if timeout := testCase.config.getUnmountTimeout(); timeout != testCase.expectedTimeout {
+				t.Fatalf("Expected timeout %s, got %s", testCase.expectedTimeout, timeout)
+			}
+
+			if pollInterval := testCase.config.getUnmountPollInterval(); pollInterval != testCase.expectedPollInterval {
+				t.Fatalf("Expected poll interval %s, got %s", testCase.expectedPollInterval, pollInterval)
+			}
+		})
+	}
+}
+
+func TestGetCRISocketPathAndNamespace(t *testing.T) {
+	for _, testCase := range []struct {
+		name               string
+		config             Config
+		criType            string
+		expectedSocketPath string
+		expectedNamespace  string
+	}{
+		{name: "docker default", criType: CRIDocker, expectedSocketPath: dockerSocketPath,
+			expectedNamespace: defaultCRINamespace},
+		{name: "crio default", criType: CRICRIO, expectedSocketPath: crioSocketPath,
+			expectedNamespace: defaultCRINamespace},
+		{name: "containerd default", criType: CRIContainerd, expectedSocketPath: containerdSocketPath,
+			expectedNamespace: defaultCRINamespace},
+		{name: "configured", config: Config{CRISocketPath: "/run/k3s/containerd.sock", CRINamespace: "fuse"},
+			criType: CRIContainerd, expectedSocketPath: "/run/k3s/containerd.sock", expectedNamespace: "fuse"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if socketPath := testCase.config.getCRISocketPath(testCase.criType); socketPath != testCase.expectedSocketPath {
+				t.Fatalf("Expected socket %s, got %s", testCase.expectedSocketPath, socketPath)
+			}
+
+			if namespace := testCase.config.getCRINamespace(); namespace != testCase.expectedNamespace {
+				t.Fatalf("Expected namespace %s, got %s", testCase.expectedNamespace, namespace)
+			}
+		})
+	}
+}
+
+func TestGetCRIDetectionOrder(t *testing.T) {
+	for _, testCase := range []struct {
+		name                   string
+		detectionOrder         []string
+		preferredRuntime       string
+		expectedDetectionOrder []string
+		expectError            bool
+	}{
+		{name: "default", expectedDetectionOrder: []string{CRIDocker, CRICRIO, CRIContainerd}},
+		{name: "preferred docker", preferredRuntime: CRIDocker,
+			expectedDetectionOrder: []string{CRIDocker, CRICRIO, CRIContainerd}},
+		{name: "preferred containerd", preferredRuntime: CRIContainerd,
+			expectedDetectionOrder: []string{CRIContainerd, CRIDocker, CRICRIO}},
+		{name: "preferred over detection order", detectionOrder: []string{CRICRIO, CRIDocker},
+			preferredRuntime: CRIDocker, expectedDetectionOrder: []string{CRIDocker, CRICRIO}},
+		{name: "invalid", preferredRuntime: "rkt", expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := &Config{CRIDetectionOrder: testCase.detectionOrder, PreferredRuntime: testCase.preferredRuntime}
+			if err := config.validate(); (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+
+			if testCase.expectError {
+				return
+			}
+
+			if detectionOrder := config.getCRIDetectionOrder(); !reflect.DeepEqual(detectionOrder,
+				testCase.expectedDetectionOrder) {
+				t.Fatalf("Expected detection order %v, got %v", testCase.expectedDetectionOrder, detectionOrder)
+			}
+		})
+	}
+}
+
+func TestFuseCapabilitiesConfig(t *testing.T) {
+	for _, testCase := range []struct {
+		name                 string
+		capabilities         []string
+		devices              []string
+		expectError          bool
+		expectedCapabilities []string
+		expectedDevices      []string
+	}{
+		{name: "privileged"},
+		{name: "sys admin", capabilities: []string{"SYS_ADMIN"},
+			expectedCapabilities: []string{"SYS_ADMIN"}, expectedDevices: []string{"/dev/fuse"}},
+		{name: "prefixed lower case", capabilities: []string{"cap_sys_admin", "CAP_NET_ADMIN"},
+			expectedCapabilities: []string{"SYS_ADMIN", "NET_ADMIN"}, expectedDevices: []string{"/dev/fuse"}},
+		{name: "extra device", capabilities: []string{"SYS_ADMIN"}, devices: []string{"/dev/fuse", "/dev/net/tun"},
+			expectedCapabilities: []string{"SYS_ADMIN"}, expectedDevices: []string{"/dev/fuse", "/dev/net/tun"}},
+		{name: "without sys admin", capabilities: []string{"NET_ADMIN"}, expectError: true},
+		{name: "without fuse device", capabilities: []string{"SYS_ADMIN"}, devices: []string{"/dev/net/tun"},
+			expectError: true},
+		{name: "invalid capability", capabilities: []string{"SYS_ADMIN", "sys-admin"}, expectError: true},
+		{name: "devices while privileged", devices: []string{"/dev/fuse"}, expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := &Config{FuseCapabilities: testCase.capabilities, FuseDevices: testCase.devices}
+			if err := config.validate(); (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+
+			if testCase.expectError {
+				return
+			}
+
+			if capabilities := config.getFuseCapabilities(); !reflect.DeepEqual(capabilities,
+				testCase.expectedCapabilities) {
+				t.Fatalf("Expected capabilities %v, got %v", testCase.expectedCapabilities, capabilities)
+			}
+
+			if devices := config.getFuseDevices(); !reflect.DeepEqual(devices, testCase.expectedDevices) {
+				t.Fatalf("Expected devices %v, got %v", testCase.expectedDevices, devices)
+			}
+		})
+	}
+}
+
+func TestGetImagePrecedence(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		repository    string
+		tag           string
+		envRepository string
+		envTag        string
+		expectedImage string
+	}{
+		{name: "default", expectedImage: "iguazio/v3io-fuse:local"},
+		{name: "environment", envRepository: "registry.local/v3io-fuse", envTag: "3.5.0",
+			expectedImage: "registry.local/v3io-fuse:3.5.0"},
+		{name: "config over environment", repository: "registry.corp/v3io-fuse", tag: "3.5.1",
+			envRepository: "registry.local/v3io-fuse", envTag: "3.5.0", expectedImage: "registry.corp/v3io-fuse:3.5.1"},
+		{name: "config repository, environment tag", repository: "registry.corp/v3io-fuse", envTag: "3.5.0",
+			expectedImage: "registry.corp/v3io-fuse:3.5.0"},
+		{name: "environment repository, default tag", envRepository: "registry.local/v3io-fuse",
+			expectedImage: "registry.local/v3io-fuse:local"},
+		{name: "config tag, default repository", tag: "3.5.1", expectedImage: "iguazio/v3io-fuse:3.5.1"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			setEnv(t, imageRepositoryEnvVar, testCase.envRepository)
+			setEnv(t, imageTagEnvVar, testCase.envTag)
+
+			config := &Config{ImageRepository: testCase.repository, ImageTag: testCase.tag}
+			if image := config.getImage(); image != testCase.expectedImage {
+				t.Fatalf("Expected image %s, got %s", testCase.expectedImage, image)
+			}
+		})
+	}
+}
+
+// setEnv sets an environment variable for the test, restoring it once it's done
+func setEnv(t *testing.T, key string, value string) {
+	originalValue, wasSet := os.LookupEnv(key)
+
+	os.Setenv(key, value) // nolint: errcheck
+
+	t.Cleanup(func() {
+		if wasSet {
+			os.Setenv(key, originalValue) // nolint: errcheck
+		} else {
+			os.Unsetenv(key) // nolint: errcheck
+		}
+	})
+}
+
+func TestGetCRITimeouts(t *testing.T) {
+	for _, testCase := range []struct {
+		name                string
+		config              Config
+		expectedTimeouts    cri.Timeouts
+		expectedPullTimeout time.Duration
+	}{
+		{name: "unbounded"},
+		{
+			name:                "global",
+			config:              Config{CRITimeoutSeconds: 30},
+			expectedTimeouts:    cri.Timeouts{Create: 30 * time.Second, Remove: 30 * time.Second, Inspect: 30 * time.Second},
+			expectedPullTimeout: 30 * time.Second,
+		},
+		{
+			name: "per operation",
+			config: Config{
+				CRITimeoutSeconds:        30,
+				CRICreateTimeoutSeconds:  60,
+				CRIRemoveTimeoutSeconds:  10,
+				CRIInspectTimeoutSeconds: 5,
+				ImagePullTimeoutSeconds:  600,
+			},
+			expectedTimeouts:    cri.Timeouts{Create: time.Minute, Remove: 10 * time.Second, Inspect: 5 * time.Second},
+			expectedPullTimeout: 10 * time.Minute,
+		},
+		{
+			name:                "some per operation",
+			config:              Config{CRITimeoutSeconds: 30, CRIRemoveTimeoutSeconds: 10},
+			expectedTimeouts:    cri.Timeouts{Create: 30 * time.Second, Remove: 10 * time.Second, Inspect: 30 * time.Second},
+			expectedPullTimeout: 30 * time.Second,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if timeouts := testCase.config.getCRITimeouts(); timeouts != testCase.expectedTimeouts {
+				t.Fatalf("Expected timeouts %+v, got %+v", testCase.expectedTimeouts, timeouts)
+			}
+
+			if pullTimeout := testCase.config.getImagePullTimeout(); pullTimeout != testCase.expectedPullTimeout {
+				t.Fatalf("Expected pull timeout %s, got %s", testCase.expectedPullTimeout, pullTimeout)
+			}
+		})
+	}
+}
+
+func TestClusterLookup(t *testing.T) {
+	multipleClusters := []ClusterConfig{
+		{Name: "default", DataUrls: []string{"tcp://10.0.0.1:1234"}},
+		{Name: "c2", DataUrls: []string{"tcp://10.0.1.1:1234", "tcp://10.0.1.2:1234"}, Image: "iguazio/v3io-fuse:3.2.0"},
+	}
+
+	singleCluster := []ClusterConfig{{Name: "igz0", DataUrls: []string{"tcp://10.0.0.1:1234"}}}
+
+	for _, testCase := range []struct {
+		name             string
+		clusters         []ClusterConfig
+		cluster          string
+		expectedDataURLs string
+		expectedImage    string
+		expectUnknown    bool
+	}{
+		{
+			name:             "default",
+			clusters:         multipleClusters,
+			cluster:          "default",
+			expectedDataURLs: "tcp://10.0.0.1:1234",
+			expectedImage:    "iguazio/v3io-fuse:3.5.0",
+		},
+		{
+			name:             "named",
+			clusters:         multipleClusters,
+			cluster:          "c2",
+			expectedDataURLs: "tcp://10.0.1.1:1234,tcp://10.0.1.2:1234",
+			expectedImage:    "iguazio/v3io-fuse:3.2.0",
+		},
+		{
+			name:          "unknown",
+			clusters:      multipleClusters,
+			cluster:       "c3",
+			expectedImage: "iguazio/v3io-fuse:3.5.0",
+			expectUnknown: true,
+		},
+		{
+			name:          "single cluster, not named default",
+			clusters:      singleCluster,
+			cluster:       "default",
+			expectedImage: "iguazio/v3io-fuse:3.5.0",
+			expectUnknown: true,
+		},
+		{
+			name:          "single cluster, unknown",
+			clusters:      singleCluster,
+			cluster:       "c2",
+			expectedImage: "iguazio/v3io-fuse:3.5.0",
+			expectUnknown: true,
+		},
+		{
+			name:          "no clusters",
+			cluster:       "default",
+			expectedImage: "iguazio/v3io-fuse:3.5.0",
+			expectUnknown: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := &Config{
+				ImageRepository: "iguazio/v3io-fuse",
+				ImageTag:        "3.5.0",
+				Clusters:        testCase.clusters,
+			}
+
+			dataURLs, err := config.DataURLs(testCase.cluster)
+			if testCase.expectUnknown {
+				if !errors.Is(err, ErrUnknownCluster) {
+					t.Fatalf("Expected ErrUnknownCluster, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if dataURLs != testCase.expectedDataURLs {
+				t.Fatalf("Expected data URLs %s, got %s", testCase.expectedDataURLs, dataURLs)
+			}
+
+			if image := config.getClusterImage(testCase.cluster); image != testCase.expectedImage {
+				t.Fatalf("Expected image %s, got %s", testCase.expectedImage, image)
+			}
+		})
+	}
+}
+
+func TestValidateClusters(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		clusters    []ClusterConfig
+		expectError bool
+	}{
+		{name: "none"},
+		{name: "unique", clusters: []ClusterConfig{{Name: "default"}, {Name: "c2"}}},
+		{name: "unnamed", clusters: []ClusterConfig{{Name: "default"}, {}}, expectError: true},
+		{name: "duplicate", clusters: []ClusterConfig{{Name: "c2"}, {Name: "c2"}}, expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := &Config{Clusters: testCase.clusters}
+
+			if err := config.validateClusters(); (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package flex
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var connectionStringPlaceholderRegexp = regexp.MustCompile(`{[^{}]*}`)
+
+var connectionStringPlaceholders = map[string]bool{
+	"{scheme}": true,
+	"{host}":   true,
+	"{port}":   true,
+	"{url}":    true,
+}
+
+// validateConnectionStringTemplate checks that a template only uses known placeholders, and that it can't produce
+// an endpoint without a host
+func validateConnectionStringTemplate(template string) error {
+	for _, placeholder := range connectionStringPlaceholderRegexp.FindAllString(template, -1) {
+		if !connectionStringPlaceholders[placeholder] {
+			return fmt.Errorf("connection_string_template has unknown placeholder %s", placeholder)
+		}
+	}
+
+	if !strings.Contains(template, "{host}") && !strings.Contains(template, "{url}") {
+		return fmt.Errorf("connection_string_template must contain {host} or {url}, got %s", template)
+	}
+
+	return nil
+}
+
+// validateDataURLs checks that a cluster's comma separated data URLs aren't empty, and that each is a URL or a
+// host:port, as a fuse process without endpoints would only fail the mount on a timeout
+func validateDataURLs(cluster string, dataURLs string) error {
+	if strings.TrimSpace(dataURLs) == "" {
+		return fmt.Errorf("Cluster %s has no data URLs", cluster)
+	}
+
+	for _, dataURL := range strings.Split(dataURLs, ",") {
+		if strings.TrimSpace(dataURL) == "" {
+			return fmt.Errorf("Cluster %s has an empty data URL in %s", cluster, dataURLs)
+		}
+
+		if _, err := getDataURLAddress(dataURL); err != nil {
+			return fmt.Errorf("Cluster %s has an invalid data URL: %s", cluster, err)
+		}
+	}
+
+	return nil
+}
+
+// formatConnectionStrings formats each of the comma separated data URLs with the template, substituting {scheme},
+// {host}, {port} and {url} (the data URL as is). An empty template leaves the data URLs as they are
+func formatConnectionStrings(template string, dataURLs string) (string, error) {
+	if template == "" {
+		return dataURLs, nil
+	}
+
+	var connectionStrings []string
+	for _, dataURL := range strings.Split(dataURLs, ",") {
+		dataURL = strings.TrimSpace(dataURL)
+
+		address, err := getDataURLAddress(dataURL)
+		if err != nil {
+			return "", err
+		}
+
+		host, port, err := splitHostPort(address)
+		if err != nil {
+			return "", err
+		}
+
+		scheme := "tcp"
+		if parsedURL, err := url.Parse(dataURL); err == nil && parsedURL.Host != "" {
+			scheme = parsedURL.Scheme
+		}
+
+		connectionStrings = append(connectionStrings, strings.NewReplacer(
+			"{scheme}", scheme,
+			"{host}", host,
+			"{port}", port,
+			"{url}", dataURL,
+		).Replace(template))
+	}
+
+	return strings.Join(connectionStrings, ","), nil
+}
+
+func splitHostPort(address string) (string, string, error) {
+	parsedURL, err := url.Parse("//" + address)
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid data URL address %s: %s", address, err)
+	}
+
+	return parsedURL.Hostname(), parsedURL.Port(), nil
+}
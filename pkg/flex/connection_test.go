@@ -0,0 +1,143 @@
+package flex
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFormatConnectionStrings(t *testing.T) {
+	for _, testCase := range []struct {
+		name                      string
+		template                  string
+		dataURLs                  string
+		expectedConnectionStrings string
+		expectError               bool
+	}{
+		{
+			name:                      "no template",
+			dataURLs:                  "tcp://10.0.0.1:1234,tcp://10.0.0.2:1234",
+			expectedConnectionStrings: "tcp://10.0.0.1:1234,tcp://10.0.0.2:1234",
+		},
+		{
+			name:                      "host and port",
+			template:                  "{host}:{port}",
+			dataURLs:                  "tcp://10.0.0.1:1234, tcp://10.0.0.2:1235",
+			expectedConnectionStrings: "10.0.0.1:1234,10.0.0.2:1235",
+		},
+		{
+			name:                      "scheme",
+			template:                  "{scheme}://{host}:{port}/v3io",
+			dataURLs:                  "https://webapi.example.com",
+			expectedConnectionStrings: "https://webapi.example.com:443/v3io",
+		},
+		{
+			name:                      "address without a scheme",
+			template:                  "{scheme}://{host}:{port}",
+			dataURLs:                  "10.0.0.1:1234",
+			expectedConnectionStrings: "tcp://10.0.0.1:1234",
+		},
+		{
+			name:                      "url",
+			template:                  "endpoint={url};retries=3",
+			dataURLs:                  "tcp://10.0.0.1:1234",
+			expectedConnectionStrings: "endpoint=tcp://10.0.0.1:1234;retries=3",
+		},
+		{
+			name:        "no port",
+			template:    "{host}:{port}",
+			dataURLs:    "tcp://10.0.0.1",
+			expectError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			connectionStrings, err := formatConnectionStrings(testCase.template, testCase.dataURLs)
+			if testCase.expectError {
+				if err == nil {
+					t.Fatalf("Expected an error, got %s", connectionStrings)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if connectionStrings != testCase.expectedConnectionStrings {
+				t.Fatalf("Expected %s, got %s", testCase.expectedConnectionStrings, connectionStrings)
+			}
+		})
+	}
+}
+
+func TestValidateConnectionStringTemplate(t *testing.T) {
+	for _, testCase := range []struct {
+		template    string
+		expectError bool
+	}{
+		{template: "{host}:{port}"},
+		{template: "{url}"},
+		{template: "{scheme}://{host}"},
+		{template: "{scheme}://{hostname}:{port}", expectError: true},
+		{template: "{scheme}://10.0.0.1:{port}", expectError: true},
+	} {
+		if err := validateConnectionStringTemplate(testCase.template); (err != nil) != testCase.expectError {
+			t.Fatalf("Template %s: expected error: %t, got %v", testCase.template, testCase.expectError, err)
+		}
+	}
+}
+
+func TestValidateDataURLs(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		dataURLs      string
+		expectedError string
+	}{
+		{name: "empty", dataURLs: "", expectedError: "Cluster c1 has no data URLs"},
+		{name: "blank", dataURLs: " ", expectedError: "Cluster c1 has no data URLs"},
+		{name: "single url", dataURLs: "tcp://10.0.0.1:1234"},
+		{name: "single address", dataURLs: "10.0.0.1:1234"},
+		{name: "single url with a default port", dataURLs: "https://webapi.example.com"},
+		{name: "multiple", dataURLs: "tcp://10.0.0.1:1234, tcp://10.0.0.2:1234,10.0.0.3:1234"},
+		{name: "trailing comma", dataURLs: "tcp://10.0.0.1:1234,",
+			expectedError: "Cluster c1 has an empty data URL in tcp://10.0.0.1:1234,"},
+		{name: "no port", dataURLs: "tcp://10.0.0.1", expectedError: "Cluster c1 has an invalid data URL"},
+		{name: "malformed among several", dataURLs: "tcp://10.0.0.1:1234,10.0.0.2",
+			expectedError: "Cluster c1 has an invalid data URL"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := validateDataURLs("c1", testCase.dataURLs)
+			if testCase.expectedError == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Fatalf("Expected an error containing %q, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestCreateV3IOFUSEContainerInvalidDataURLs(t *testing.T) {
+	mounter, criInstance := newFakeCRIMounter(t, &Config{})
+	mounter.dataURLsResolver = &slowDataURLsResolver{}
+
+	err := mounter.createV3IOFUSEContainer(context.Background(),
+		&Spec{Cluster: "c1", Container: "bigdata", AccessKey: "key"},
+		fakeTargetPath)
+	if err == nil || err.Error() != "Cluster c1 has no data URLs" {
+		t.Fatalf("Expected the cluster to be named in the error, got %v", err)
+	}
+
+	// the container isn't started without endpoints
+	for _, call := range criInstance.getCalls() {
+		if call == "CreateContainer" {
+			t.Fatalf("Expected no container to be created, got calls %v", criInstance.getCalls())
+		}
+	}
+}
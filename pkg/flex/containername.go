@@ -0,0 +1,54 @@
+package flex
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+// getContainerName returns the name of a target's fuse container by ContainerNameStrategy. The labels strategy
+// names it by the spec's pod labels, or by those of the spec the target was mounted with if the spec is nil
+func (m *Mounter) getContainerName(targetPath string, spec *Spec) (string, error) {
+	switch m.Config.ContainerNameStrategy {
+	case ContainerNameStrategyHash:
+		return getContainerNameFromTargetPathHash(targetPath), nil
+	case ContainerNameStrategyLabels:
+		return m.getContainerNameFromPodLabels(targetPath, spec), nil
+	default:
+		return getContainerNameFromTargetPath(targetPath)
+	}
+}
+
+// getContainerNameFromTargetPathHash names a container by a hash of its target path, whatever the path's layout
+func getContainerNameFromTargetPathHash(targetPath string) string {
+	targetPathHash := sha256.Sum256([]byte(filepath.Clean(targetPath)))
+
+	return fmt.Sprintf("v3io-fuse-%x", targetPathHash[:16])
+}
+
+// getContainerNameFromPodLabels names a container by the pod uid and volume name labels it's created with. Only
+// a pod's own target is named by its pod, as shared and link mode mounts serve many pods, and so are named by
+// hash, as is a target whose labels aren't known
+func (m *Mounter) getContainerNameFromPodLabels(targetPath string, spec *Spec) string {
+	if getPodUIDFromTargetPath(targetPath) == "" {
+		return getContainerNameFromTargetPathHash(targetPath)
+	}
+
+	if spec == nil {
+		mountedSpec, err := loadMountSpec(targetPath)
+		if err != nil {
+			journal.Warn("Failed to load mount spec", "target", targetPath, "err", err.Error())
+		}
+
+		spec = mountedSpec
+	}
+
+	if spec == nil || spec.PodUID == "" || spec.Name == "" {
+		journal.Debug("Pod labels unknown, naming container by hash", "target", targetPath)
+		return getContainerNameFromTargetPathHash(targetPath)
+	}
+
+	return fmt.Sprintf("v3io-fuse-%s-%s", spec.PodUID, spec.Name)
+}
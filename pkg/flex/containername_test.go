@@ -0,0 +1,86 @@
+package flex
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGetContainerName(t *testing.T) {
+	originalMountSpecsDir := mountSpecsDir
+	t.Cleanup(func() { mountSpecsDir = originalMountSpecsDir })
+
+	const (
+		podTargetPath    = "/var/lib/kubelet/pods/0c082652/volumes/v3io~fuse/v3io"
+		sharedTargetPath = "/mnt/v3io-shared/abc123"
+		customTargetPath = "/data/fuse/v3io"
+	)
+
+	hashNameRegexp := regexp.MustCompile(`^v3io-fuse-[0-9a-f]{32}$`)
+	podSpec := &Spec{PodUID: "0c082652", Name: "pv-v3io"}
+
+	for _, testCase := range []struct {
+		name                  string
+		containerNameStrategy string
+		targetPath            string
+		spec                  *Spec
+		savedSpec             *Spec
+		expectedName          string
+		expectHash            bool
+		expectError           bool
+	}{
+		{name: "path-based", targetPath: podTargetPath, expectedName: "v3io-fuse-0c082652-v3io"},
+		{name: "explicit path-based", containerNameStrategy: ContainerNameStrategyPathBased, targetPath: podTargetPath,
+			expectedName: "v3io-fuse-0c082652-v3io"},
+		{name: "path-based shared", targetPath: sharedTargetPath, expectedName: "v3io-fuse-shared-abc123"},
+		{name: "path-based nonstandard path", targetPath: customTargetPath, expectError: true},
+		{name: "hash", containerNameStrategy: ContainerNameStrategyHash, targetPath: podTargetPath, expectHash: true},
+		{name: "hash nonstandard path", containerNameStrategy: ContainerNameStrategyHash, targetPath: customTargetPath,
+			expectHash: true},
+		{name: "labels", containerNameStrategy: ContainerNameStrategyLabels, targetPath: podTargetPath, spec: podSpec,
+			expectedName: "v3io-fuse-0c082652-pv-v3io"},
+		{name: "labels of the saved spec", containerNameStrategy: ContainerNameStrategyLabels,
+			targetPath: podTargetPath, savedSpec: podSpec, expectedName: "v3io-fuse-0c082652-pv-v3io"},
+		{name: "labels unknown", containerNameStrategy: ContainerNameStrategyLabels, targetPath: podTargetPath,
+			expectHash: true},
+		{name: "labels of a shared mount", containerNameStrategy: ContainerNameStrategyLabels,
+			targetPath: sharedTargetPath, spec: podSpec, expectHash: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mountSpecsDir = t.TempDir()
+			mounter := newTestMounter(&Config{ContainerNameStrategy: testCase.containerNameStrategy},
+				newMemoryFilesystem())
+
+			if testCase.savedSpec != nil {
+				mounter.saveMountSpec(testCase.targetPath, testCase.savedSpec, "") // nolint: errcheck
+			}
+
+			containerName, err := mounter.getContainerName(testCase.targetPath, testCase.spec)
+			if (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+
+			if testCase.expectHash {
+				if !hashNameRegexp.MatchString(containerName) ||
+					containerName != getContainerNameFromTargetPathHash(testCase.targetPath) {
+					t.Fatalf("Expected the target's hash name, got %s", containerName)
+				}
+
+				return
+			}
+
+			if containerName != testCase.expectedName {
+				t.Fatalf("Expected %s, got %s", testCase.expectedName, containerName)
+			}
+		})
+	}
+}
+
+func TestGetContainerNameFromTargetPathHash(t *testing.T) {
+	if getContainerNameFromTargetPathHash("/data/v3io") != getContainerNameFromTargetPathHash("/data//v3io/") {
+		t.Fatal("Expected equivalent paths to be named alike")
+	}
+
+	if getContainerNameFromTargetPathHash("/data/v3io") == getContainerNameFromTargetPathHash("/data/v3io2") {
+		t.Fatal("Expected distinct paths to be named apart")
+	}
+}
@@ -0,0 +1,132 @@
+package flex
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+// mountResultsDir holds the targets' recent mount results. It's a variable so that tests can keep their results
+// apart from the node's
+var mountResultsDir = "/var/run/v3io-fuse/results"
+
+// mountResult is the result of a target's last successful mount, kept to answer identical mount calls kubelet
+// repeats in quick succession
+type mountResult struct {
+	SpecHash    string    `json:"specHash"`
+	CompletedAt time.Time `json:"completedAt"`
+	Response    Response  `json:"response"`
+}
+
+// getSpecHash returns a hash identifying a spec. The spec holds the access key, so only its hash is recorded
+func getSpecHash(spec *Spec) (string, error) {
+	specBytes, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("Failed to marshal spec: %s", err)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(specBytes)), nil
+}
+
+// getRecentMountResult returns the result of the target's last mount if it had the same spec and completed
+// within MountDedupWindowSeconds, or nil. Only successful mounts are recorded, as failed ones are worth retrying.
+// The mount may have gone since (e.g. force cleared, or its fuse container crashed), in which case it's done anew
+func (m *Mounter) getRecentMountResult(targetPath string, specHash string) *Response {
+	if m.Config.MountDedupWindowSeconds == 0 {
+		return nil
+	}
+
+	resultBytes, err := ioutil.ReadFile(getMountResultFilePath(targetPath))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			journal.Warn("Failed to read mount result", "target", targetPath, "err", err.Error())
+		}
+
+		return nil
+	}
+
+	result := mountResult{}
+	if err := json.Unmarshal(resultBytes, &result); err != nil {
+		journal.Warn("Failed to unmarshal mount result", "target", targetPath, "err", err.Error())
+		return nil
+	}
+
+	window := time.Duration(m.Config.MountDedupWindowSeconds) * time.Second
+	if result.SpecHash != specHash || time.Since(result.CompletedAt) > window {
+		return nil
+	}
+
+	if !m.isTargetMounted(targetPath) {
+		journal.Info("Identical mount completed recently, but the target is no longer mounted",
+			"target", targetPath,
+			"completedAt", result.CompletedAt)
+
+		removeRecentMountResult(targetPath)
+
+		return nil
+	}
+
+	journal.Info("Identical mount completed recently, returning its result",
+		"target", targetPath,
+		"completedAt", result.CompletedAt)
+
+	return &result.Response
+}
+
+// isTargetMounted returns whether a target is still mounted. A link mode target is a symlink to the link path,
+// which is what's mounted, unless the link is bind mounted onto the target
+func (m *Mounter) isTargetMounted(targetPath string) bool {
+	if m.Config.Type == "link" && !m.Config.LinkUseBindMount {
+		linkPath, err := m.filesystem.Readlink(targetPath)
+		if err != nil {
+			return false
+		}
+
+		targetPath = filepath.Clean(linkPath)
+	}
+
+	return m.isMountPointConfirmed(targetPath)
+}
+
+// saveRecentMountResult records a successful mount's result for getRecentMountResult
+func (m *Mounter) saveRecentMountResult(targetPath string, specHash string, response *Response) {
+	if m.Config.MountDedupWindowSeconds == 0 || response.Status != "Success" {
+		return
+	}
+
+	if err := os.MkdirAll(mountResultsDir, 0700); err != nil {
+		journal.Warn("Failed to create mount results directory", "err", err.Error())
+		return
+	}
+
+	resultBytes, err := json.Marshal(mountResult{
+		SpecHash:    specHash,
+		CompletedAt: time.Now(),
+		Response:    *response,
+	})
+	if err != nil {
+		journal.Warn("Failed to marshal mount result", "target", targetPath, "err", err.Error())
+		return
+	}
+
+	if err := ioutil.WriteFile(getMountResultFilePath(targetPath), resultBytes, 0600); err != nil {
+		journal.Warn("Failed to save mount result", "target", targetPath, "err", err.Error())
+	}
+}
+
+func removeRecentMountResult(targetPath string) {
+	if err := os.Remove(getMountResultFilePath(targetPath)); err != nil && !os.IsNotExist(err) {
+		journal.Warn("Failed to remove mount result", "target", targetPath, "err", err.Error())
+	}
+}
+
+func getMountResultFilePath(targetPath string) string {
+	return path.Join(mountResultsDir, sanitizePath(targetPath)+".json")
+}
@@ -0,0 +1,177 @@
+package flex
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecentMountResult(t *testing.T) {
+	originalMountResultsDir := mountResultsDir
+	t.Cleanup(func() { mountResultsDir = originalMountResultsDir })
+
+	specHash, _ := getSpecHash(&Spec{Container: "bigdata", AccessKey: "key"})
+	otherSpecHash, _ := getSpecHash(&Spec{Container: "bigdata", AccessKey: "other-key"})
+
+	for _, testCase := range []struct {
+		name            string
+		dedupWindow     int
+		savedResponse   *Response
+		savedAgo        time.Duration
+		requestSpecHash string
+		notMounted      bool
+		expectDuplicate bool
+	}{
+		{name: "duplicate", dedupWindow: 10, savedResponse: NewSuccessResponse("Successfully mounted"),
+			requestSpecHash: specHash, expectDuplicate: true},
+		{name: "distinct spec", dedupWindow: 10, savedResponse: NewSuccessResponse("Successfully mounted"),
+			requestSpecHash: otherSpecHash},
+		{name: "outside the window", dedupWindow: 10, savedResponse: NewSuccessResponse("Successfully mounted"),
+			savedAgo: 11 * time.Second, requestSpecHash: specHash},
+		{name: "failure isn't recorded", dedupWindow: 10, savedResponse: NewFailResponse("Failed to mount", nil),
+			requestSpecHash: specHash},
+		{name: "disabled", savedResponse: NewSuccessResponse("Successfully mounted"), requestSpecHash: specHash},
+		{name: "no longer mounted", dedupWindow: 10, savedResponse: NewSuccessResponse("Successfully mounted"),
+			requestSpecHash: specHash, notMounted: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mountResultsDir = t.TempDir()
+			mounter := newTestMounter(&Config{
+				MountDedupWindowSeconds:  testCase.dedupWindow,
+				DisableMountTableRecheck: true,
+			}, newMemoryFilesystem())
+
+			if testCase.notMounted {
+				useMountInfo(t)
+			} else {
+				useMountInfo(t, fakeTargetPath)
+			}
+
+			mounter.saveRecentMountResult(fakeTargetPath, specHash, testCase.savedResponse)
+
+			if testCase.savedAgo != 0 {
+				ageMountResult(t, fakeTargetPath, testCase.savedAgo)
+			}
+
+			response := mounter.getRecentMountResult(fakeTargetPath, testCase.requestSpecHash)
+			if (response != nil) != testCase.expectDuplicate {
+				t.Fatalf("Expected duplicate: %t, got %+v", testCase.expectDuplicate, response)
+			}
+
+			if response != nil && response.Message != testCase.savedResponse.Message {
+				t.Fatalf("Expected the first request's result, got %+v", response)
+			}
+
+			// an unmount forgets the result, so a mount that follows it is done anew
+			removeRecentMountResult(fakeTargetPath)
+
+			if response := mounter.getRecentMountResult(fakeTargetPath, specHash); response != nil {
+				t.Fatalf("Expected no result after removal, got %+v", response)
+			}
+		})
+	}
+}
+
+// ageMountResult moves a target's recorded mount result back in time
+func ageMountResult(t *testing.T, targetPath string, age time.Duration) {
+	resultBytes, err := ioutil.ReadFile(getMountResultFilePath(targetPath))
+	if err != nil {
+		t.Fatalf("Failed to read mount result: %s", err)
+	}
+
+	result := mountResult{}
+	json.Unmarshal(resultBytes, &result) // nolint: errcheck
+	result.CompletedAt = result.CompletedAt.Add(-age)
+
+	resultBytes, _ = json.Marshal(result)
+	ioutil.WriteFile(getMountResultFilePath(targetPath), resultBytes, 0600) // nolint: errcheck
+}
+
+func TestRecentMountResultLink(t *testing.T) {
+	const linkPath = "/mnt/v3io/default-tenant/bigdata"
+
+	originalMountResultsDir := mountResultsDir
+	mountResultsDir = t.TempDir()
+	t.Cleanup(func() { mountResultsDir = originalMountResultsDir })
+
+	specHash, _ := getSpecHash(&Spec{Container: "bigdata", AccessKey: "key"})
+
+	for _, testCase := range []struct {
+		name            string
+		linked          bool
+		mountedPaths    []string
+		expectDuplicate bool
+	}{
+		{name: "linked and mounted", linked: true, mountedPaths: []string{linkPath}, expectDuplicate: true},
+		{name: "link unmounted", linked: true},
+		{name: "link removed", mountedPaths: []string{linkPath}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			useMountInfo(t, testCase.mountedPaths...)
+
+			filesystem := newMemoryFilesystem()
+			filesystem.MkdirAll(filepath.Dir(fakeTargetPath), 0750) // nolint: errcheck
+
+			if testCase.linked {
+				filesystem.Symlink(linkPath, fakeTargetPath) // nolint: errcheck
+			}
+
+			mounter := newTestMounter(&Config{
+				Type:                     "link",
+				MountDedupWindowSeconds:  10,
+				DisableMountTableRecheck: true,
+			}, filesystem)
+
+			mounter.saveRecentMountResult(fakeTargetPath, specHash, NewSuccessResponse("Successfully mounted as link"))
+
+			// the target is a symlink, and it's the link path that's mounted
+			response := mounter.getRecentMountResult(fakeTargetPath, specHash)
+			if (response != nil) != testCase.expectDuplicate {
+				t.Fatalf("Expected duplicate: %t, got %+v", testCase.expectDuplicate, response)
+			}
+		})
+	}
+}
+
+func TestForceClearForgetsMount(t *testing.T) {
+	originalMountResultsDir, originalStagedV3ioConfigsDir := mountResultsDir, stagedV3ioConfigsDir
+	mountResultsDir, stagedV3ioConfigsDir = t.TempDir(), t.TempDir()
+	t.Cleanup(func() {
+		mountResultsDir, stagedV3ioConfigsDir = originalMountResultsDir, originalStagedV3ioConfigsDir
+	})
+
+	useMountInfo(t)
+	useTempSharedMountsStateDir(t)
+
+	mounter, _ := newFakeCRIMounter(t, &Config{MountDedupWindowSeconds: 10, DisableMountTableRecheck: true})
+
+	filesystem := newMemoryFilesystem()
+	filesystem.mount(fakeTargetPath)
+	mounter.filesystem = filesystem
+
+	specHash, _ := getSpecHash(&Spec{Container: "bigdata", AccessKey: "key"})
+	mounter.saveRecentMountResult(fakeTargetPath, specHash, NewSuccessResponse("Successfully mounted"))
+	ioutil.WriteFile(getStagedV3ioConfigPath(fakeTargetPath), []byte("{}"), 0600) // nolint: errcheck
+
+	if response := mounter.ForceClear(fakeTargetPath); response.Status != "Success" {
+		t.Fatalf("Expected the target to be force cleared, got %+v", response)
+	}
+
+	if _, err := filesystem.Lstat(fakeTargetPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected the target to be unmounted and removed, got %v", err)
+	}
+
+	// a mount that follows is done anew, even once the target is mounted again
+	useMountInfo(t, fakeTargetPath)
+
+	if response := mounter.getRecentMountResult(fakeTargetPath, specHash); response != nil {
+		t.Fatalf("Expected the mount result to be forgotten, got %+v", response)
+	}
+
+	if _, err := os.Stat(getStagedV3ioConfigPath(fakeTargetPath)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the staged v3io config to be removed, got %v", err)
+	}
+}
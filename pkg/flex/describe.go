@@ -0,0 +1,178 @@
+package flex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/v3io/flex-fuse/pkg/cri"
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+type MountInfo struct {
+	TargetPath     string  `json:"targetPath"`
+	ContainerName  string  `json:"containerName,omitempty"`
+	Health         string  `json:"health"`
+	ContainerState string  `json:"containerState,omitempty"`
+	RestartCount   int     `json:"restartCount,omitempty"`
+	OOMKilled      bool    `json:"oomKilled,omitempty"`
+	Hint           string  `json:"hint,omitempty"`
+	CPUNanoCores   *uint64 `json:"cpuNanoCores,omitempty"`
+	MemoryBytes    *uint64 `json:"memoryBytes,omitempty"`
+
+	// DriverVersion and DriverGitCommit identify the driver build that mounted the target, if recorded
+	DriverVersion   string `json:"driverVersion,omitempty"`
+	DriverGitCommit string `json:"driverGitCommit,omitempty"`
+}
+
+// Describe reports the state of a single mount and its backing container
+func (m *Mounter) Describe(targetPath string) *Response {
+	journal.Debug("Describing mount", "targetPath", targetPath)
+
+	criInstance, err := m.createCRI()
+	if err != nil {
+		return NewFailResponse("Failed to create CRI", err)
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	response := NewSuccessResponse(fmt.Sprintf("Described %s", targetPath))
+	response.Mounts = []MountInfo{m.describeMount(criInstance, targetPath)}
+
+	return response
+}
+
+// List reports the state of all v3io mounts on the node
+func (m *Mounter) List() *Response {
+	journal.Debug("Listing mounts")
+
+	targetPaths, err := m.listV3IOMounts()
+	if err != nil {
+		return NewFailResponse("Failed to list mounts", err)
+	}
+
+	criInstance, err := m.createCRI()
+	if err != nil {
+		return NewFailResponse("Failed to create CRI", err)
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	mounts := []MountInfo{}
+	for _, targetPath := range targetPaths {
+		mounts = append(mounts, m.describeMount(criInstance, targetPath))
+	}
+
+	response := NewSuccessResponse(fmt.Sprintf("Found %d mounts", len(mounts)))
+	response.Mounts = mounts
+
+	return response
+}
+
+func (m *Mounter) describeMount(criInstance cri.CRI, targetPath string) MountInfo {
+	mountInfo := MountInfo{
+		TargetPath: targetPath,
+		Health:     string(m.mountpointHealth(targetPath)),
+	}
+
+	// mounts by builds that predate recording the driver version have none
+	if record, err := loadMountRecord(getMountSpecFilePath(targetPath)); err == nil {
+		mountInfo.DriverVersion = record.DriverVersion
+		mountInfo.DriverGitCommit = record.DriverGitCommit
+	}
+
+	containerName, err := m.getContainerName(targetPath, nil)
+	if err != nil {
+		journal.Debug("Failed to get container name", "targetPath", targetPath, "err", err.Error())
+		return mountInfo
+	}
+
+	mountInfo.ContainerName = containerName
+
+	status, err := criInstance.ContainerStatus(containerName)
+	if err != nil {
+		journal.Debug("Failed to get container status", "containerName", containerName, "err", err.Error())
+		mountInfo.ContainerState = cri.ContainerStateUnknown
+		return mountInfo
+	}
+
+	mountInfo.ContainerState = status.State
+	mountInfo.RestartCount = status.RestartCount
+	mountInfo.OOMKilled = status.OOMKilled
+	if status.OOMKilled {
+		mountInfo.Hint = oomKilledHint
+	}
+	if status.State != cri.ContainerStateRunning {
+		return mountInfo
+	}
+
+	// not all runtimes can report stats, in which case the usage is omitted
+	stats, err := criInstance.Stats(containerName)
+	if err != nil {
+		if errors.Is(err, cri.ErrStatsUnsupported) {
+			journal.Debug("Runtime doesn't support container stats", "containerName", containerName)
+		} else {
+			journal.Warn("Failed to get container stats", "containerName", containerName, "err", err.Error())
+		}
+
+		return mountInfo
+	}
+
+	mountInfo.CPUNanoCores = &stats.CPUNanoCores
+	mountInfo.MemoryBytes = &stats.MemoryBytes
+
+	return mountInfo
+}
+
+// listV3IOMounts returns the mount points of v3io volumes, as found in the mount table
+func (m *Mounter) listV3IOMounts() ([]string, error) {
+	if mountInfoFile, err := os.Open(mountInfoPath); err == nil {
+		defer mountInfoFile.Close() // nolint: errcheck
+
+		mountPoints, err := readMountInfoMountPoints(mountInfoFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read mount info: %s", err)
+		}
+
+		var targetPaths []string
+		for _, mountPoint := range mountPoints {
+			if m.isV3IOMountPoint(mountPoint) {
+				targetPaths = append(targetPaths, mountPoint)
+			}
+		}
+
+		return targetPaths, nil
+	}
+
+	mountList, err := exec.Command("mount").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to run mount: %s", err)
+	}
+
+	var targetPaths []string
+	for _, line := range strings.Split(string(mountList), "\n") {
+
+		// <device> on <mount point> type <type> (<options>)
+		onIdx := strings.Index(line, " on ")
+		typeIdx := strings.LastIndex(line, " type ")
+		if onIdx == -1 || typeIdx <= onIdx {
+			continue
+		}
+
+		targetPath := line[onIdx+len(" on ") : typeIdx]
+		if m.isV3IOMountPoint(targetPath) {
+			targetPaths = append(targetPaths, targetPath)
+		}
+	}
+
+	return targetPaths, nil
+}
+
+// isV3IOMountPoint returns whether a mount point is of a v3io volume: a target, a link mode mount or a shared mount
+func (m *Mounter) isV3IOMountPoint(mountPoint string) bool {
+	return strings.Contains(mountPoint, "/volumes/v3io~fuse/") ||
+		strings.HasPrefix(mountPoint, m.Config.getLinkBasePath()+"/") ||
+		strings.HasPrefix(mountPoint, sharedMountsDir+"/")
+}
@@ -0,0 +1,119 @@
+package flex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/v3io/flex-fuse/pkg/cri"
+)
+
+func TestDescribeMountOOMKilled(t *testing.T) {
+	const targetPath = "/var/lib/kubelet/pods/uid/volumes/v3io~fuse/v3io"
+
+	mounter := newTestMounter(&Config{}, newMemoryFilesystem())
+
+	containerName, err := mounter.getContainerName(targetPath, nil)
+	if err != nil {
+		t.Fatalf("Failed to get container name: %s", err)
+	}
+
+	for _, testCase := range []struct {
+		name         string
+		status       cri.ContainerStatus
+		expectedHint string
+	}{
+		{
+			name:         "oom killed",
+			status:       cri.ContainerStatus{State: cri.ContainerStateExited, ExitCode: 137, OOMKilled: true},
+			expectedHint: oomKilledHint,
+		},
+		{
+			name:   "exited",
+			status: cri.ContainerStatus{State: cri.ContainerStateExited, ExitCode: 1},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			criInstance := newFakeCRI()
+			criInstance.containers[containerName] = &testCase.status
+
+			mountInfo := mounter.describeMount(criInstance, targetPath)
+
+			if mountInfo.OOMKilled != testCase.status.OOMKilled || mountInfo.Hint != testCase.expectedHint {
+				t.Fatalf("Expected OOM killed: %t with hint %q, got %+v",
+					testCase.status.OOMKilled,
+					testCase.expectedHint,
+					mountInfo)
+			}
+
+			if mountInfo.ContainerState != cri.ContainerStateExited {
+				t.Fatalf("Expected container state %s, got %s", cri.ContainerStateExited, mountInfo.ContainerState)
+			}
+		})
+	}
+}
+
+func TestDriverVersionRecorded(t *testing.T) {
+	originalDriverVersion, originalDriverGitCommit := DriverVersion, DriverGitCommit
+	originalMountSpecsDir := mountSpecsDir
+	t.Cleanup(func() {
+		DriverVersion, DriverGitCommit = originalDriverVersion, originalDriverGitCommit
+		mountSpecsDir = originalMountSpecsDir
+	})
+
+	spec := &Spec{Container: "bigdata", AccessKey: "key"}
+
+	for _, testCase := range []struct {
+		name                 string
+		driverGitCommit      string
+		expectedLabel        string
+		skipRecord           bool
+		expectedRecordCommit string
+	}{
+		{name: "with commit", driverGitCommit: "0c08265", expectedLabel: "3.5.0-0c08265",
+			expectedRecordCommit: "0c08265"},
+		{name: "without commit", expectedLabel: "3.5.0"},
+		{name: "mounted by an older build", expectedLabel: "3.5.0", skipRecord: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mountSpecsDir = t.TempDir()
+			DriverVersion, DriverGitCommit = "3.5.0", testCase.driverGitCommit
+
+			mounter, criInstance := newFakeCRIMounter(t, &Config{
+				Clusters: []ClusterConfig{{Name: "default", DataUrls: []string{"tcp://10.0.0.1:1234"}}},
+			})
+
+			if err := mounter.createV3IOFUSEContainer(context.Background(), spec, fakeTargetPath); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			containerName, _ := mounter.getContainerName(fakeTargetPath, spec)
+			if label := criInstance.createOptions[containerName].Labels[driverVersionLabel]; label !=
+				testCase.expectedLabel {
+				t.Fatalf("Expected container label %s, got %s", testCase.expectedLabel, label)
+			}
+
+			if !testCase.skipRecord {
+				if err := mounter.saveMountSpec(fakeTargetPath, spec, ""); err != nil {
+					t.Fatalf("Failed to save mount spec: %s", err)
+				}
+			}
+
+			// the driver is upgraded after the mount
+			DriverVersion, DriverGitCommit = "3.6.0", "1d19376"
+
+			expectedVersion := "3.5.0"
+			if testCase.skipRecord {
+				expectedVersion = ""
+			}
+
+			mountInfo := mounter.describeMount(criInstance, fakeTargetPath)
+			if mountInfo.DriverVersion != expectedVersion || mountInfo.DriverGitCommit != testCase.expectedRecordCommit {
+				t.Fatalf("Expected driver version %q and commit %q, got %q and %q",
+					expectedVersion,
+					testCase.expectedRecordCommit,
+					mountInfo.DriverVersion,
+					mountInfo.DriverGitCommit)
+			}
+		})
+	}
+}
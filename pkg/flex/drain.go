@@ -0,0 +1,84 @@
+package flex
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const defaultDrainConcurrency = 4
+
+type DrainResult struct {
+	TargetPath string `json:"targetPath"`
+	Success    bool   `json:"success"`
+	Message    string `json:"message"`
+}
+
+// Drain unmounts all v3io volumes on the node, e.g. before decommissioning it. Up to DrainConcurrency targets are
+// unmounted in parallel, each under its own target lock. A target that fails to unmount doesn't stop the others
+func (m *Mounter) Drain() *Response {
+	journal.Info("Draining mounts")
+
+	mountPoints, err := m.listV3IOMounts()
+	if err != nil {
+		return NewFailResponse("Failed to list mounts", err)
+	}
+
+	// shared mounts are torn down along with their last target, and link mode's mounts aren't per target
+	var targetPaths []string
+	for _, mountPoint := range mountPoints {
+		if strings.Contains(mountPoint, "/volumes/v3io~fuse/") {
+			targetPaths = append(targetPaths, mountPoint)
+		}
+	}
+
+	return m.drainTargets(targetPaths, m.Unmount)
+}
+
+// drainTargets unmounts targets with up to DrainConcurrency unmounts in parallel, reporting each target's result
+func (m *Mounter) drainTargets(targetPaths []string, unmount func(string) *Response) *Response {
+	results := make([]DrainResult, len(targetPaths))
+	semaphore := make(chan struct{}, m.Config.getDrainConcurrency())
+
+	var waitGroup sync.WaitGroup
+	for targetIdx, targetPath := range targetPaths {
+		waitGroup.Add(1)
+		semaphore <- struct{}{}
+
+		go func(targetIdx int, targetPath string) {
+			defer waitGroup.Done()
+			defer func() { <-semaphore }()
+
+			response := unmount(targetPath)
+
+			results[targetIdx] = DrainResult{
+				TargetPath: targetPath,
+				Success:    response.Status == "Success",
+				Message:    response.Message,
+			}
+		}(targetIdx, targetPath)
+	}
+
+	waitGroup.Wait()
+
+	var failedTargets []string
+	for _, result := range results {
+		if !result.Success {
+			failedTargets = append(failedTargets, result.TargetPath)
+		}
+	}
+
+	var response *Response
+	if len(failedTargets) > 0 {
+		response = NewFailResponse(fmt.Sprintf("Failed to drain %d of %d mounts", len(failedTargets), len(results)),
+			fmt.Errorf("Failed targets: %s", strings.Join(failedTargets, ", ")))
+	} else {
+		response = NewSuccessResponse(fmt.Sprintf("Drained %d mounts", len(results)))
+	}
+
+	response.Drained = results
+
+	return response
+}
@@ -0,0 +1,101 @@
+package flex
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDrainTargets(t *testing.T) {
+	var targetPaths []string
+	for targetIdx := 0; targetIdx < 10; targetIdx++ {
+		targetPaths = append(targetPaths, fmt.Sprintf("/var/lib/kubelet/pods/%d/volumes/v3io~fuse/v3io", targetIdx))
+	}
+
+	failedTargetPaths := map[string]bool{targetPaths[3]: true, targetPaths[7]: true}
+
+	for _, testCase := range []struct {
+		name             string
+		drainConcurrency int
+	}{
+		{name: "default", drainConcurrency: 0},
+		{name: "serial", drainConcurrency: 1},
+		{name: "parallel", drainConcurrency: 3},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			var (
+				lock             sync.Mutex
+				running          int
+				maxRunning       int
+				unmountedTargets []string
+			)
+
+			unmount := func(targetPath string) *Response {
+				lock.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				lock.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				lock.Lock()
+				running--
+				unmountedTargets = append(unmountedTargets, targetPath)
+				lock.Unlock()
+
+				if failedTargetPaths[targetPath] {
+					return NewFailResponse("Failed to unmount", errors.New("device is busy"))
+				}
+
+				return NewSuccessResponse("Successfully unmounted")
+			}
+
+			mounter := newTestMounter(&Config{DrainConcurrency: testCase.drainConcurrency}, newMemoryFilesystem())
+
+			response := mounter.drainTargets(targetPaths, unmount)
+
+			if expectedConcurrency := mounter.Config.getDrainConcurrency(); maxRunning != expectedConcurrency {
+				t.Fatalf("Expected %d unmounts in parallel, got %d", expectedConcurrency, maxRunning)
+			}
+
+			if len(unmountedTargets) != len(targetPaths) {
+				t.Fatalf("Expected all %d targets to be unmounted, got %d", len(targetPaths), len(unmountedTargets))
+			}
+
+			if response.Status != "Failure" || !response.Transient {
+				t.Fatalf("Expected a transient failure, got %s", response.Message)
+			}
+
+			var drainedTargets []string
+			for _, result := range response.Drained {
+				drainedTargets = append(drainedTargets, result.TargetPath)
+
+				if result.Success == failedTargetPaths[result.TargetPath] {
+					t.Fatalf("Unexpected result of %s: %+v", result.TargetPath, result)
+				}
+			}
+
+			// results are reported in the order of the targets, whatever order they were unmounted in
+			if !reflect.DeepEqual(drainedTargets, targetPaths) {
+				t.Fatalf("Expected results of %v, got %v", targetPaths, drainedTargets)
+			}
+		})
+	}
+}
+
+func TestDrainTargetsSucceeds(t *testing.T) {
+	mounter := newTestMounter(&Config{}, newMemoryFilesystem())
+
+	response := mounter.drainTargets([]string{"/a", "/b"}, func(targetPath string) *Response {
+		return NewSuccessResponse("Successfully unmounted")
+	})
+
+	if response.Status != "Success" || len(response.Drained) != 2 {
+		t.Fatalf("Expected both targets to be drained, got %s (%+v)", response.Message, response.Drained)
+	}
+}
@@ -0,0 +1,93 @@
+package flex
+
+import (
+	"fmt"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+type DriftResult struct {
+	TargetPath  string `json:"targetPath"`
+	Image       string `json:"image,omitempty"`
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// UpToDate is nil if the image the target was mounted with wasn't recorded
+	UpToDate *bool `json:"upToDate,omitempty"`
+}
+
+// DriftCheck compares the image digest each mounted target recorded at mount time against that of the image
+// configured for its cluster, finding mounts that predate an image upgrade and need a remount to pick it up
+func (m *Mounter) DriftCheck() *Response {
+	journal.Info("Checking mounts for image drift")
+
+	currentImageDigest, err := m.getCurrentImageDigest(m.Config.getImage())
+	if err != nil {
+		return NewFailResponse("Failed to get current v3io FUSE image digest", err)
+	}
+
+	currentImageDigests := map[string]string{m.Config.getImage(): currentImageDigest}
+
+	records, err := loadMountRecords()
+	if err != nil {
+		return NewFailResponse("Failed to load mount records", err)
+	}
+
+	var results []DriftResult
+	var upToDateCount, staleCount, unknownCount int
+
+	for _, record := range records {
+		result := DriftResult{
+			TargetPath:  record.TargetPath,
+			Image:       record.Image,
+			ImageDigest: record.ImageDigest,
+		}
+
+		image := m.Config.getClusterImage(record.Spec.GetClusterName())
+
+		if _, found := currentImageDigests[image]; !found {
+			if currentImageDigests[image], err = m.getCurrentImageDigest(image); err != nil {
+				return NewFailResponse("Failed to get current v3io FUSE image digest", err)
+			}
+		}
+
+		if record.ImageDigest == "" {
+			unknownCount++
+		} else {
+			upToDate := record.ImageDigest == currentImageDigests[image]
+			result.UpToDate = &upToDate
+
+			if upToDate {
+				upToDateCount++
+			} else {
+				staleCount++
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	response := NewSuccessResponse(fmt.Sprintf("%d mounts up to date, %d stale, %d unknown (image %s, digest %s)",
+		upToDateCount,
+		staleCount,
+		unknownCount,
+		m.Config.getImage(),
+		currentImageDigest))
+
+	response.Drift = results
+
+	return response
+}
+
+// getCurrentImageDigest pulls an image, returning its digest
+func (m *Mounter) getCurrentImageDigest(image string) (string, error) {
+	imageDigest, err := m.pullImage(image)
+	if err != nil {
+		return "", err
+	}
+
+	if imageDigest == "" {
+		return "", fmt.Errorf("Failed to get digest of image %s", image)
+	}
+
+	return imageDigest, nil
+}
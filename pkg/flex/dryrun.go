@@ -0,0 +1,262 @@
+package flex
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/v3io/flex-fuse/pkg/common"
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+// planMount describes what mounting a target would do, for DryRun. It only reads the node's state, and makes no
+// CRI calls, so a plan may include steps (e.g. pulling the image) that the mount would find it can skip
+func (m *Mounter) planMount(targetPath string, specString string) *Response {
+	journal.Info("Planning mount (dry run)", "target", targetPath)
+
+	parsedSpec, err := parseSpec(specString)
+	if err != nil {
+		return NewPermanentFailResponse("Failed to unmarshal spec", err)
+	}
+
+	spec := *parsedSpec
+
+	if err := spec.validate(m.Config.Type == "link"); err != nil {
+		return m.newSpecFailResponse("Mount failed validation", err)
+	}
+
+	if m.Config.Type == "link" {
+		linkPlan, err := m.planLinkMount(&spec, targetPath)
+		if err != nil {
+			return NewFailResponse("Failed to plan mount", err)
+		}
+
+		return newPlanResponse("mount", targetPath, linkPlan)
+	}
+
+	plan := []string{fmt.Sprintf("pull image %s", m.Config.getClusterImage(spec.GetClusterName()))}
+
+	resolvedTargetPath, err := m.resolveTargetPath(targetPath)
+	if err != nil {
+		return NewFailResponse("Failed to resolve target", err)
+	}
+
+	targetPath = resolvedTargetPath
+
+	if isMountPoint(targetPath) {
+		plan = append(plan, fmt.Sprintf("target %s is already mounted, mount as its health and spec require", targetPath))
+	}
+
+	plan = append(plan, fmt.Sprintf("record spec of %s", targetPath))
+
+	if m.Config.ShareSubPathMounts && spec.Container != "" {
+		sharedPath := getSharedMountPath(&spec)
+
+		if !isMountPoint(sharedPath) {
+			sharedSpec := spec
+			sharedSpec.SubPath = ""
+
+			containerPlan, err := m.planV3IOFUSEContainer(&sharedSpec, sharedPath)
+			if err != nil {
+				return NewFailResponse("Failed to plan mount", err)
+			}
+
+			plan = append(plan, fmt.Sprintf("create directory %s", sharedPath))
+			plan = append(plan, containerPlan...)
+		}
+
+		plan = append(plan, fmt.Sprintf("bind mount %s to %s", filepath.Join(sharedPath, spec.SubPath), targetPath))
+	} else {
+		containerPlan, err := m.planV3IOFUSEContainer(&spec, targetPath)
+		if err != nil {
+			return NewFailResponse("Failed to plan mount", err)
+		}
+
+		plan = append(plan, containerPlan...)
+	}
+
+	dirsPlan, err := planDirs(spec, targetPath)
+	if err != nil {
+		return NewFailResponse("Failed to plan mount", err)
+	}
+
+	plan = append(plan, dirsPlan...)
+
+	return newPlanResponse("mount", targetPath, plan)
+}
+
+// planLinkMount describes what mounting a target as a link would do
+func (m *Mounter) planLinkMount(spec *Spec, targetPath string) ([]string, error) {
+	namespace := spec.Namespace
+	if namespace == "" {
+		namespace = m.Config.LinkDefaultNamespace
+	}
+
+	linkPath, err := m.getLinkPath(namespace, spec.Container)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []string
+
+	if !isMountPoint(linkPath) {
+		containerPlan, err := m.planV3IOFUSEContainer(spec, linkPath)
+		if err != nil {
+			return nil, err
+		}
+
+		plan = append(plan, fmt.Sprintf("create directory %s", linkPath))
+		plan = append(plan, fmt.Sprintf("pull image %s", m.Config.getClusterImage(spec.GetClusterName())))
+		plan = append(plan, containerPlan...)
+	}
+
+	if m.Config.LinkUseBindMount {
+		return append(plan, fmt.Sprintf("bind mount %s to %s", linkPath, targetPath)), nil
+	}
+
+	return append(plan,
+		fmt.Sprintf("remove target %s", targetPath),
+		fmt.Sprintf("symlink %s to %s", targetPath, linkPath)), nil
+}
+
+// planV3IOFUSEContainer describes the fuse container createV3IOFUSEContainer would create to mount a path
+func (m *Mounter) planV3IOFUSEContainer(spec *Spec, targetPath string) ([]string, error) {
+	dataUrls, err := m.getDataURLs(spec.GetClusterName())
+	if err != nil {
+		return nil, fmt.Errorf("Could not get cluster data urls: %s", err.Error())
+	}
+
+	if err := validateDataURLs(spec.GetClusterName(), dataUrls); err != nil {
+		return nil, err
+	}
+
+	connectionStrings, err := formatConnectionStrings(m.Config.ConnectionStringTemplate, dataUrls)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to format connection strings: %s", err)
+	}
+
+	containerName, err := m.getContainerName(targetPath, spec)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get container name: %s", err.Error())
+	}
+
+	// the v3io config is staged at mount time, so the args name where it would be staged
+	v3ioConfigPath := m.Config.V3ioConfigPath
+	if v3ioConfigPath != "" && !isSubPath(fuseConfigDir, filepath.Clean(v3ioConfigPath)) {
+		v3ioConfigPath = getStagedV3ioConfigPath(targetPath)
+	}
+
+	args, err := m.getFuseArgs(spec, connectionStrings, v3ioConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid fuse mount options: %s", ErrInvalidMountRequest, err)
+	}
+
+	containerOptions, err := m.getContainerOptions(spec, targetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	containerOptionsBytes, err := json.Marshal(containerOptions)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal container options: %s", err)
+	}
+
+	return []string{
+		fmt.Sprintf("remove existing container %s", containerName),
+		fmt.Sprintf("create container %s of image %s with args [%s] and options %s",
+			containerName,
+			m.Config.getClusterImage(spec.GetClusterName()),
+			strings.Join(common.RedactSecrets(args), " "),
+			string(containerOptionsBytes)),
+		fmt.Sprintf("wait for container %s to mount %s", containerName, targetPath),
+	}, nil
+}
+
+// planDirs describes the folders createDirs would create in a mount
+func planDirs(spec Spec, targetPath string) ([]string, error) {
+	if spec.DirsToCreate == "" {
+		return nil, nil
+	}
+
+	var dirsToCreate []DirToCreate
+	if err := json.Unmarshal([]byte(spec.DirsToCreate), &dirsToCreate); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse dirsToCreate [%s]: %s",
+			ErrInvalidMountRequest,
+			spec.DirsToCreate,
+			err.Error())
+	}
+
+	var plan []string
+	for _, dir := range dirsToCreate {
+		plan = append(plan, fmt.Sprintf("create folder %s/%s (filemode: %o)", targetPath, dir.Name, dir.Permissions))
+	}
+
+	return plan, nil
+}
+
+// planUnmount describes what unmounting a target would do, for DryRun
+func (m *Mounter) planUnmount(targetPath string) *Response {
+	journal.Info("Planning unmount (dry run)", "target", targetPath)
+
+	if m.Config.Type == "link" {
+		var plan []string
+		if isMountPoint(targetPath) {
+			plan = append(plan, fmt.Sprintf("umount %s", targetPath))
+		}
+
+		return newPlanResponse("unmount", targetPath, append(plan, fmt.Sprintf("remove link %s", targetPath)))
+	}
+
+	resolvedTargetPath, err := m.resolveTargetPath(targetPath)
+	if err != nil {
+		return NewFailResponse("Failed to resolve target", err)
+	}
+
+	targetPath = resolvedTargetPath
+
+	if sharedPath, found := getSharedMountOfTarget(targetPath); found {
+		return newPlanResponse("unmount", targetPath, []string{
+			fmt.Sprintf("umount %s", targetPath),
+			fmt.Sprintf("remove directory %s", targetPath),
+			fmt.Sprintf("release shared mount %s, tearing it down if no other target uses it", sharedPath),
+		})
+	}
+
+	if !isMountPoint(targetPath) {
+		return newPlanResponse("unmount", targetPath, nil)
+	}
+
+	containerName, err := m.getContainerName(targetPath, nil)
+	if err != nil {
+		return NewFailResponse("Failed to get container name", err)
+	}
+
+	plan := []string{
+		fmt.Sprintf("umount %s", targetPath),
+		fmt.Sprintf("remove container %s", containerName),
+	}
+
+	if m.Config.getUnmountOrder() == UnmountOrderContainerFirst {
+		plan[0], plan[1] = plan[1], plan[0]
+	}
+
+	return newPlanResponse("unmount", targetPath, append(plan, fmt.Sprintf("remove directory %s", targetPath)))
+}
+
+func newPlanResponse(operation string, targetPath string, plan []string) *Response {
+	for _, step := range plan {
+		journal.Info("Dry run step", "operation", operation, "target", targetPath, "step", step)
+	}
+
+	var response *Response
+	if len(plan) == 0 {
+		response = NewSuccessResponse(fmt.Sprintf("Dry run, would %s %s: nothing to do", operation, targetPath))
+	} else {
+		response = NewSuccessResponse(fmt.Sprintf("Dry run, would %s %s in %d steps", operation, targetPath, len(plan)))
+	}
+
+	response.Plan = plan
+
+	return response
+}
@@ -0,0 +1,131 @@
+package flex
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	const specString = `{"container": "bigdata", "subPath": "/a", "accessKey": "secret-access-key",
+		"kubernetes.io/pod.namespace": "default-tenant",
+		"dirsToCreate": "[{\"name\": \"logs\", \"permissions\": 493}]"}`
+
+	containerName, _ := getContainerNameFromTargetPath(fakeTargetPath)
+
+	// a link has no pod directory to name its container by
+	linkContainerName := getContainerNameFromTargetPathHash("/mnt/v3io/default-tenant/bigdata")
+
+	for _, testCase := range []struct {
+		name          string
+		config        Config
+		dryRunEnv     string
+		unmount       bool
+		mountedPaths  []string
+		expectedSteps []string
+	}{
+		{
+			name:   "mount",
+			config: Config{DryRun: true},
+			expectedSteps: []string{
+				"pull image iguazio/v3io-fuse:3.5.0",
+				"record spec of " + fakeTargetPath,
+				"remove existing container " + containerName,
+				"create container " + containerName + " of image iguazio/v3io-fuse:3.5.0 with args [",
+				"wait for container " + containerName + " to mount " + fakeTargetPath,
+				"create folder " + fakeTargetPath + "/logs (filemode: 755)",
+			},
+		},
+		{
+			name:      "mount, set by the environment",
+			dryRunEnv: "true",
+			expectedSteps: []string{
+				"pull image iguazio/v3io-fuse:3.5.0",
+				"record spec of " + fakeTargetPath,
+				"remove existing container " + containerName,
+				"create container " + containerName,
+				"wait for container " + containerName,
+				"create folder " + fakeTargetPath + "/logs",
+			},
+		},
+		{
+			name:   "link mount",
+			config: Config{DryRun: true, Type: "link", ContainerNameStrategy: ContainerNameStrategyHash},
+			expectedSteps: []string{
+				"create directory /mnt/v3io/default-tenant/bigdata",
+				"pull image iguazio/v3io-fuse:3.5.0",
+				"remove existing container " + linkContainerName,
+				"create container " + linkContainerName + " of image iguazio/v3io-fuse:3.5.0 with args [",
+				"wait for container " + linkContainerName + " to mount /mnt/v3io/default-tenant/bigdata",
+				"remove target " + fakeTargetPath,
+				"symlink " + fakeTargetPath + " to /mnt/v3io/default-tenant/bigdata",
+			},
+		},
+		{
+			name:         "unmount",
+			config:       Config{DryRun: true},
+			unmount:      true,
+			mountedPaths: []string{fakeTargetPath},
+			expectedSteps: []string{
+				"umount " + fakeTargetPath,
+				"remove container " + containerName,
+				"remove directory " + fakeTargetPath,
+			},
+		},
+		{
+			name:    "unmount, not mounted",
+			config:  Config{DryRun: true},
+			unmount: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			setEnv(t, dryRunEnvVar, testCase.dryRunEnv)
+			useMountInfo(t, testCase.mountedPaths...)
+			useTempSharedMountsStateDir(t)
+
+			config := testCase.config
+			config.ImageRepository = "iguazio/v3io-fuse"
+			config.ImageTag = "3.5.0"
+			config.Clusters = []ClusterConfig{{Name: "default", DataUrls: []string{"tcp://10.0.0.1:1234"}}}
+
+			mounter, criInstance := newFakeCRIMounter(t, &config)
+			filesystem := newMemoryFilesystem()
+			mounter.filesystem = filesystem
+
+			var response *Response
+			if testCase.unmount {
+				response = mounter.Unmount(fakeTargetPath)
+			} else {
+				response = mounter.Mount(fakeTargetPath, specString)
+			}
+
+			if response.Status != "Success" || !strings.HasPrefix(response.Message, "Dry run") {
+				t.Fatalf("Expected a dry run, got %+v", response)
+			}
+
+			if len(response.Plan) != len(testCase.expectedSteps) {
+				t.Fatalf("Expected %d steps, got %q", len(testCase.expectedSteps), response.Plan)
+			}
+
+			for stepIdx, expectedStep := range testCase.expectedSteps {
+				if !strings.HasPrefix(response.Plan[stepIdx], expectedStep) {
+					t.Fatalf("Expected step %d to start with %q, got %q", stepIdx, expectedStep, response.Plan[stepIdx])
+				}
+
+				if strings.Contains(response.Plan[stepIdx], "secret-access-key") {
+					t.Fatalf("Expected the access key to be left out of step %q", response.Plan[stepIdx])
+				}
+			}
+
+			// nothing is done on the node
+			if calls := criInstance.getCalls(); len(calls) != 0 {
+				t.Fatalf("Expected no CRI calls, got %v", calls)
+			}
+
+			if len(filesystem.entries) != 1 || len(filesystem.mountPoints) != 0 {
+				t.Fatalf("Expected the filesystem to be left as is, got entries %v and mount points %v",
+					filesystem.entries,
+					filesystem.mountPoints)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package flex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/v3io/flex-fuse/pkg/cri"
+)
+
+// fakeTargetPath is a target as kubelet passes it, which fuse container names can be derived from
+const fakeTargetPath = "/var/lib/kubelet/pods/uid/volumes/v3io~fuse/v3io"
+
+// fakeCRI is an in-memory CRI. Containers it creates are running unless createdStatus says otherwise, and its
+// calls are recorded
+type fakeCRI struct {
+	lock sync.Mutex
+
+	containers    map[string]*cri.ContainerStatus
+	createdStatus *cri.ContainerStatus
+	createErrs    []error
+	createOptions map[string]cri.ContainerOptions
+	createArgs    map[string][]string
+
+	images      map[string]map[string]string
+	imageDigest string
+	pullErr     error
+	pulls       []cri.PullOptions
+
+	logs          string
+	logsErr       error
+	logsTailLines []int
+	execOutput    string
+	execErr       error
+	execCommands  [][]string
+	renameErr     error
+
+	calls   []string
+	removed []string
+}
+
+func newFakeCRI() *fakeCRI {
+	return &fakeCRI{
+		containers:    map[string]*cri.ContainerStatus{},
+		createOptions: map[string]cri.ContainerOptions{},
+		createArgs:    map[string][]string{},
+		images:        map[string]map[string]string{},
+	}
+}
+
+func (c *fakeCRI) record(call string) {
+	c.calls = append(c.calls, call)
+}
+
+// CreateContainer fails with the next of createErrs, if any are left
+func (c *fakeCRI) CreateContainer(image string,
+	containerName string,
+	targetPath string,
+	args []string,
+	options cri.ContainerOptions) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("CreateContainer")
+
+	if len(c.createErrs) > 0 {
+		err := c.createErrs[0]
+		c.createErrs = c.createErrs[1:]
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, found := c.containers[containerName]; found {
+		return fmt.Errorf("%w: %s", cri.ErrContainerNameInUse, containerName)
+	}
+
+	status := cri.ContainerStatus{State: cri.ContainerStateRunning}
+	if c.createdStatus != nil {
+		status = *c.createdStatus
+	}
+
+	c.containers[containerName] = &status
+	c.createOptions[containerName] = options
+	c.createArgs[containerName] = args
+
+	return nil
+}
+
+func (c *fakeCRI) RemoveContainer(containerName string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("RemoveContainer")
+
+	if _, found := c.containers[containerName]; found {
+		delete(c.containers, containerName)
+		c.removed = append(c.removed, containerName)
+	}
+
+	return nil
+}
+
+func (c *fakeCRI) ContainerStatus(containerName string) (*cri.ContainerStatus, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("ContainerStatus")
+
+	status, found := c.containers[containerName]
+	if !found {
+		return &cri.ContainerStatus{State: cri.ContainerStateNotFound}, nil
+	}
+
+	statusCopy := *status
+
+	return &statusCopy, nil
+}
+
+func (c *fakeCRI) ImageLabels(image string) (map[string]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("ImageLabels")
+
+	labels, found := c.images[image]
+	if !found {
+		return nil, fmt.Errorf("%w: %s", cri.ErrImageNotFound, image)
+	}
+
+	return labels, nil
+}
+
+func (c *fakeCRI) ImageDigest(image string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("ImageDigest")
+
+	if _, found := c.images[image]; !found {
+		return "", fmt.Errorf("%w: %s", cri.ErrImageNotFound, image)
+	}
+
+	return c.imageDigest, nil
+}
+
+func (c *fakeCRI) ExecInContainer(containerName string, command []string) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("ExecInContainer")
+	c.execCommands = append(c.execCommands, command)
+
+	return c.execOutput, c.execErr
+}
+
+// PullImage makes the image present, unless pullErr is set
+func (c *fakeCRI) PullImage(image string, options cri.PullOptions) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("PullImage")
+	c.pulls = append(c.pulls, options)
+
+	if c.pullErr != nil {
+		return c.pullErr
+	}
+
+	if _, found := c.images[image]; !found {
+		c.images[image] = map[string]string{}
+	}
+
+	return nil
+}
+
+func (c *fakeCRI) Stats(containerName string) (cri.ContainerStats, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("Stats")
+
+	return cri.ContainerStats{}, cri.ErrStatsUnsupported
+}
+
+func (c *fakeCRI) ContainerLogs(containerName string, tailLines int) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("ContainerLogs")
+	c.logsTailLines = append(c.logsTailLines, tailLines)
+
+	return c.logs, c.logsErr
+}
+
+func (c *fakeCRI) ListContainers(prefix string) ([]string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("ListContainers")
+
+	var containerNames []string
+	for containerName := range c.containers {
+		if strings.HasPrefix(containerName, prefix) {
+			containerNames = append(containerNames, containerName)
+		}
+	}
+
+	sort.Strings(containerNames)
+
+	return containerNames, nil
+}
+
+func (c *fakeCRI) RenameContainer(containerName string, newContainerName string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.record("RenameContainer")
+
+	if c.renameErr != nil {
+		return c.renameErr
+	}
+
+	status, found := c.containers[containerName]
+	if !found {
+		return fmt.Errorf("No such container: %s", containerName)
+	}
+
+	delete(c.containers, containerName)
+	c.containers[newContainerName] = status
+
+	return nil
+}
+
+func (c *fakeCRI) Name() string {
+	return "fake"
+}
+
+func (c *fakeCRI) Close() error {
+	return nil
+}
+
+func (c *fakeCRI) getCalls() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]string{}, c.calls...)
+}
+
+// staticReadiness is a ReadinessStrategy that always answers the same
+type staticReadiness struct {
+	ready bool
+	err   error
+}
+
+func (r *staticReadiness) IsReady(targetPath string, containerName string) (bool, error) {
+	return r.ready, r.err
+}
+
+// newFakeCRIMounter returns a mounter whose fuse containers run in a fake CRI and are ready once created, keeping
+// its locks in a temporary directory
+func newFakeCRIMounter(t *testing.T, config *Config) (*Mounter, *fakeCRI) {
+	originalTargetLocksDir := targetLocksDir
+	targetLocksDir = t.TempDir()
+
+	t.Cleanup(func() { targetLocksDir = originalTargetLocksDir })
+
+	criInstance := newFakeCRI()
+
+	mounter := newTestMounter(config, newMemoryFilesystem())
+	mounter.readinessStrategy = &staticReadiness{ready: true}
+	mounter.criFactory = func() (cri.CRI, error) {
+		return criInstance, nil
+	}
+
+	return mounter, criInstance
+}
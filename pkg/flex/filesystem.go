@@ -0,0 +1,143 @@
+package flex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Filesystem is the subset of filesystem operations the mounter performs on targets and the folders it creates
+// in them, so that logic can run against an in-memory filesystem. The bind mounts of link mode and shared sub paths
+// are among them, and so are the mount points checked and detached around them
+type Filesystem interface {
+	MkdirAll(path string, permissions os.FileMode) error
+	Remove(path string) error
+	Symlink(oldPath string, newPath string) error
+	Readlink(path string) (string, error)
+	Stat(path string) (os.FileInfo, error)
+	Lstat(path string) (os.FileInfo, error)
+	EvalSymlinks(path string) (string, error)
+
+	// Readdirnames returns the names of up to n entries of a directory, as os.File's Readdirnames does
+	Readdirnames(path string, n int) ([]string, error)
+
+	IsMountPoint(path string) bool
+	BindMount(sourcePath string, targetPath string) error
+	Unmount(path string) error
+
+	// LazyUnmount detaches a mount even if it's busy or dead, as umount -l does
+	LazyUnmount(path string) error
+
+	// ForceUnmount lazily force unmounts in the host's mount namespace, the last resort of ForceClear
+	ForceUnmount(path string) error
+}
+
+// explainCreateError returns why a path couldn't be created. On a read-only filesystem (e.g. a hardened node's
+// root) it names the directory that is read-only and, if given, the config that redirects the write elsewhere
+func explainCreateError(createdPath string, err error, redirectConfig string) error {
+	if !errors.Is(err, syscall.EROFS) {
+		return err
+	}
+
+	// the failing path is the first one that had to be created, so it's its parent that is read-only
+	readOnlyPath := filepath.Dir(createdPath)
+
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		readOnlyPath = filepath.Dir(pathErr.Path)
+	}
+
+	if redirectConfig != "" {
+		return fmt.Errorf("read-only filesystem, cannot create %s as %s is read-only (set %s to a writable path)",
+			createdPath,
+			readOnlyPath,
+			redirectConfig)
+	}
+
+	return fmt.Errorf("read-only filesystem, cannot create %s as %s is read-only", createdPath, readOnlyPath)
+}
+
+// osFilesystem is the real filesystem
+type osFilesystem struct{}
+
+func (f *osFilesystem) MkdirAll(path string, permissions os.FileMode) error {
+	return os.MkdirAll(path, permissions)
+}
+
+func (f *osFilesystem) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (f *osFilesystem) Symlink(oldPath string, newPath string) error {
+	return os.Symlink(oldPath, newPath)
+}
+
+func (f *osFilesystem) Readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+func (f *osFilesystem) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (f *osFilesystem) Lstat(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+func (f *osFilesystem) EvalSymlinks(path string) (string, error) {
+	return filepath.EvalSymlinks(path)
+}
+
+func (f *osFilesystem) Readdirnames(path string, n int) ([]string, error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer dir.Close() // nolint: errcheck
+
+	return dir.Readdirnames(n)
+}
+
+func (f *osFilesystem) IsMountPoint(path string) bool {
+	return isMountPoint(path)
+}
+
+func (f *osFilesystem) BindMount(sourcePath string, targetPath string) error {
+	if output, err := exec.Command("mount", "--bind", sourcePath, targetPath).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s", string(output))
+	}
+
+	return nil
+}
+
+func (f *osFilesystem) Unmount(path string) error {
+	if output, err := exec.Command("umount", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s", string(output))
+	}
+
+	return nil
+}
+
+func (f *osFilesystem) LazyUnmount(path string) error {
+	if output, err := exec.Command("umount", "-l", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s", string(output))
+	}
+
+	return nil
+}
+
+func (f *osFilesystem) ForceUnmount(path string) error {
+	if output, err := exec.Command("nsenter",
+		"--mount="+hostMountNamespacePath,
+		"--",
+		"umount", "-l", "-f", path).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
@@ -0,0 +1,488 @@
+package flex
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// memoryFilesystem is an in-memory Filesystem of directories and symlinks. Symlinks are only followed by
+// EvalSymlinks, and are reported by Stat as they are. Mount points map to their sources, which are only
+// recorded, and are busy until unmounted
+type memoryFilesystem struct {
+	lock        sync.Mutex
+	entries     map[string]*memoryFileInfo
+	mountPoints map[string]string
+}
+
+func newMemoryFilesystem() *memoryFilesystem {
+	return &memoryFilesystem{
+		entries: map[string]*memoryFileInfo{
+			"/": {name: "/", mode: os.ModeDir | 0755},
+		},
+		mountPoints: map[string]string{},
+	}
+}
+
+func (f *memoryFilesystem) MkdirAll(path string, permissions os.FileMode) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.mkdirAll(filepath.Clean(path), permissions)
+}
+
+func (f *memoryFilesystem) mkdirAll(path string, permissions os.FileMode) error {
+	if entry, found := f.entries[path]; found {
+		if !entry.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: path, Err: os.ErrExist}
+		}
+
+		return nil
+	}
+
+	if err := f.mkdirAll(filepath.Dir(path), permissions); err != nil {
+		return err
+	}
+
+	f.entries[path] = &memoryFileInfo{
+		name: filepath.Base(path),
+		mode: os.ModeDir | permissions,
+	}
+
+	return nil
+}
+
+func (f *memoryFilesystem) Remove(path string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	path = filepath.Clean(path)
+
+	if _, found := f.entries[path]; !found {
+		return &os.PathError{Op: "remove", Path: path, Err: os.ErrNotExist}
+	}
+
+	if _, found := f.mountPoints[path]; found {
+		return &os.PathError{Op: "remove", Path: path, Err: syscall.EBUSY}
+	}
+
+	for entryPath := range f.entries {
+		if filepath.Dir(entryPath) == path && entryPath != path {
+			return &os.PathError{Op: "remove", Path: path, Err: syscall.ENOTEMPTY}
+		}
+	}
+
+	delete(f.entries, path)
+
+	return nil
+}
+
+func (f *memoryFilesystem) Symlink(oldPath string, newPath string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	newPath = filepath.Clean(newPath)
+
+	if _, found := f.entries[newPath]; found {
+		return &os.LinkError{Op: "symlink", Old: oldPath, New: newPath, Err: os.ErrExist}
+	}
+
+	if parent, found := f.entries[filepath.Dir(newPath)]; !found || !parent.IsDir() {
+		return &os.LinkError{Op: "symlink", Old: oldPath, New: newPath, Err: os.ErrNotExist}
+	}
+
+	f.entries[newPath] = &memoryFileInfo{
+		name:       filepath.Base(newPath),
+		mode:       os.ModeSymlink | 0777,
+		linkTarget: oldPath,
+	}
+
+	return nil
+}
+
+func (f *memoryFilesystem) Stat(path string) (os.FileInfo, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	entry, found := f.entries[filepath.Clean(path)]
+	if !found {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+
+	return entry, nil
+}
+
+// Readlink returns the target of a symlink created with Symlink
+func (f *memoryFilesystem) Readlink(path string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	entry, found := f.entries[filepath.Clean(path)]
+	if !found || entry.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: path, Err: os.ErrInvalid}
+	}
+
+	return entry.linkTarget, nil
+}
+
+func (f *memoryFilesystem) Lstat(path string) (os.FileInfo, error) {
+	return f.Stat(path)
+}
+
+// EvalSymlinks resolves the symlinks among a path's components
+func (f *memoryFilesystem) EvalSymlinks(path string) (string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	resolvedPath := "/"
+
+	for _, component := range strings.Split(strings.TrimPrefix(filepath.Clean(path), "/"), "/") {
+		if component == "" {
+			continue
+		}
+
+		resolvedPath = filepath.Join(resolvedPath, component)
+
+		for linkCount := 0; ; linkCount++ {
+			entry, found := f.entries[resolvedPath]
+			if !found {
+				return "", &os.PathError{Op: "lstat", Path: resolvedPath, Err: os.ErrNotExist}
+			}
+
+			if entry.mode&os.ModeSymlink == 0 {
+				break
+			}
+
+			if linkCount == 255 {
+				return "", &os.PathError{Op: "lstat", Path: path, Err: syscall.ELOOP}
+			}
+
+			if filepath.IsAbs(entry.linkTarget) {
+				resolvedPath = filepath.Clean(entry.linkTarget)
+			} else {
+				resolvedPath = filepath.Join(filepath.Dir(resolvedPath), entry.linkTarget)
+			}
+		}
+	}
+
+	return resolvedPath, nil
+}
+
+func (f *memoryFilesystem) Readdirnames(path string, n int) ([]string, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	path = filepath.Clean(path)
+
+	if entry, found := f.entries[path]; !found || !entry.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+
+	var names []string
+	for entryPath := range f.entries {
+		if filepath.Dir(entryPath) == path && entryPath != path {
+			names = append(names, filepath.Base(entryPath))
+		}
+	}
+
+	sort.Strings(names)
+
+	if n > 0 {
+		if len(names) == 0 {
+			return nil, io.EOF
+		}
+
+		if len(names) > n {
+			names = names[:n]
+		}
+	}
+
+	return names, nil
+}
+
+func (f *memoryFilesystem) IsMountPoint(path string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	_, found := f.mountPoints[filepath.Clean(path)]
+
+	return found
+}
+
+// BindMount records the source as mounted on the target, which must be a directory
+func (f *memoryFilesystem) BindMount(sourcePath string, targetPath string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	targetPath = filepath.Clean(targetPath)
+
+	if entry, found := f.entries[targetPath]; !found || !entry.IsDir() {
+		return fmt.Errorf("mount point %s does not exist", targetPath)
+	}
+
+	f.mountPoints[targetPath] = filepath.Clean(sourcePath)
+
+	return nil
+}
+
+func (f *memoryFilesystem) Unmount(path string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	path = filepath.Clean(path)
+
+	if _, found := f.mountPoints[path]; !found {
+		return fmt.Errorf("%s: not mounted", path)
+	}
+
+	delete(f.mountPoints, path)
+
+	return nil
+}
+
+func (f *memoryFilesystem) LazyUnmount(path string) error {
+	return f.Unmount(path)
+}
+
+func (f *memoryFilesystem) ForceUnmount(path string) error {
+	return f.Unmount(path)
+}
+
+// mount marks a directory as a mount point, creating it if needed, as a fuse mount would
+func (f *memoryFilesystem) mount(path string) {
+	f.MkdirAll(path, 0755) // nolint: errcheck
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.mountPoints[filepath.Clean(path)] = "v3io"
+}
+
+type memoryFileInfo struct {
+	name       string
+	mode       os.FileMode
+	linkTarget string
+}
+
+func (i *memoryFileInfo) Name() string       { return i.name }
+func (i *memoryFileInfo) Size() int64        { return 0 }
+func (i *memoryFileInfo) Mode() os.FileMode  { return i.mode }
+func (i *memoryFileInfo) ModTime() time.Time { return time.Time{} }
+func (i *memoryFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memoryFileInfo) Sys() interface{}   { return nil }
+
+func newTestMounter(config *Config, filesystem Filesystem) *Mounter {
+	return &Mounter{
+		Config:     config,
+		filesystem: filesystem,
+	}
+}
+
+func TestCreateDirs(t *testing.T) {
+	for _, testCase := range []struct {
+		name                 string
+		dirsToCreate         string
+		dirCreateFailureMode string
+		expectedDirs         []string
+		expectedWarnings     int
+		expectError          bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:         "nested",
+			dirsToCreate: `[{"name": "a/b", "permissions": 488}, {"name": "c", "permissions": 493}]`,
+			expectedDirs: []string{"/target/a/b", "/target/c"},
+		},
+		{
+			name:         "absolute fails",
+			dirsToCreate: `[{"name": "/a", "permissions": 488}]`,
+			expectError:  true,
+		},
+		{
+			name:                 "absolute warns",
+			dirsToCreate:         `[{"name": "/a", "permissions": 488}, {"name": "b", "permissions": 488}]`,
+			dirCreateFailureMode: DirCreateFailureModeWarn,
+			expectedDirs:         []string{"/target/b"},
+			expectedWarnings:     1,
+		},
+		{
+			name:         "invalid",
+			dirsToCreate: `[{"name": `,
+			expectError:  true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := newMemoryFilesystem()
+			filesystem.MkdirAll("/target", 0755) // nolint: errcheck
+
+			mounter := newTestMounter(&Config{DirCreateFailureMode: testCase.dirCreateFailureMode}, filesystem)
+
+			warnings, err := mounter.createDirs(Spec{DirsToCreate: testCase.dirsToCreate}, "/target")
+			if testCase.expectError {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if len(warnings) != testCase.expectedWarnings {
+				t.Fatalf("Expected %d warnings, got %v", testCase.expectedWarnings, warnings)
+			}
+
+			for _, expectedDir := range testCase.expectedDirs {
+				if info, err := filesystem.Stat(expectedDir); err != nil || !info.IsDir() {
+					t.Fatalf("Expected folder %s to be created", expectedDir)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateDirsInheritsPermissions(t *testing.T) {
+	filesystem := newMemoryFilesystem()
+	filesystem.MkdirAll("/target", 0710) // nolint: errcheck
+
+	mounter := newTestMounter(&Config{InheritDirPermissions: true}, filesystem)
+
+	if _, err := mounter.createDirs(Spec{DirsToCreate: `[{"name": "a"}]`}, "/target"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	info, err := filesystem.Stat("/target/a")
+	if err != nil {
+		t.Fatalf("Expected folder to be created: %s", err)
+	}
+
+	if info.Mode().Perm() != 0710 {
+		t.Fatalf("Expected mode 0710, got %#o", info.Mode().Perm())
+	}
+}
+
+func TestIsEmptyDir(t *testing.T) {
+	filesystem := newMemoryFilesystem()
+	filesystem.MkdirAll("/empty", 0755)    // nolint: errcheck
+	filesystem.MkdirAll("/full/dir", 0755) // nolint: errcheck
+
+	mounter := newTestMounter(&Config{}, filesystem)
+
+	for path, expectedEmpty := range map[string]bool{
+		"/empty":   true,
+		"/full":    false,
+		"/missing": true,
+	} {
+		empty, err := mounter.isEmptyDir(path)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %s", path, err)
+		}
+
+		if empty != expectedEmpty {
+			t.Fatalf("Expected %s to be empty: %t, got %t", path, expectedEmpty, empty)
+		}
+	}
+}
+
+func TestCheckTargetMode(t *testing.T) {
+	filesystem := newMemoryFilesystem()
+	filesystem.MkdirAll("/target", 0750)         // nolint: errcheck
+	filesystem.MkdirAll("/world-writable", 0777) // nolint: errcheck
+
+	for _, testCase := range []struct {
+		name               string
+		targetPath         string
+		requiredTargetMode string
+		expectError        bool
+	}{
+		{name: "matching", targetPath: "/target", requiredTargetMode: "0750"},
+		{name: "matching without leading zero", targetPath: "/target", requiredTargetMode: "750"},
+		{name: "mismatching", targetPath: "/target", requiredTargetMode: "0755", expectError: true},
+		{name: "world writable", targetPath: "/world-writable", requiredTargetMode: "0755", expectError: true},
+		{name: "missing target", targetPath: "/missing", requiredTargetMode: "0750", expectError: true},
+		{name: "not permission bits", targetPath: "/target", requiredTargetMode: "1750", expectError: true},
+		{name: "not octal", targetPath: "/target", requiredTargetMode: "rwx", expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter := newTestMounter(&Config{RequireTargetMode: testCase.requiredTargetMode}, filesystem)
+
+			if err := mounter.checkTargetMode(testCase.targetPath); (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+		})
+	}
+}
+
+func TestUnmountAsLinkRemovesLink(t *testing.T) {
+	filesystem := newMemoryFilesystem()
+	filesystem.MkdirAll("/mnt/v3io/ns/container", 0755)                      // nolint: errcheck
+	filesystem.MkdirAll("/pods/uid/volumes", 0755)                           // nolint: errcheck
+	filesystem.Symlink("/mnt/v3io/ns/container", "/pods/uid/volumes/target") // nolint: errcheck
+
+	mounter := newTestMounter(&Config{Type: "link"}, filesystem)
+
+	if response := mounter.unmountAsLink("/pods/uid/volumes/target"); response.Status != "Success" {
+		t.Fatalf("Expected success, got %s", response.Message)
+	}
+
+	if _, err := filesystem.Stat("/pods/uid/volumes/target"); !os.IsNotExist(err) {
+		t.Fatalf("Expected link to be removed, got %v", err)
+	}
+
+	if _, err := filesystem.Stat("/mnt/v3io/ns/container"); err != nil {
+		t.Fatalf("Expected link target to be left in place, got %v", err)
+	}
+}
+
+func TestExplainCreateError(t *testing.T) {
+	readOnlyErr := &os.PathError{Op: "mkdir", Path: "/mnt/v3io/default", Err: syscall.EROFS}
+
+	for _, testCase := range []struct {
+		name            string
+		err             error
+		redirectConfig  string
+		expectedMessage string
+	}{
+		{
+			name:            "read-only",
+			err:             readOnlyErr,
+			expectedMessage: "read-only filesystem, cannot create /mnt/v3io/default/bigdata as /mnt/v3io is read-only",
+		},
+		{
+			name:           "read-only with redirect",
+			err:            readOnlyErr,
+			redirectConfig: "link_base_path",
+			expectedMessage: "read-only filesystem, cannot create /mnt/v3io/default/bigdata as /mnt/v3io is read-only " +
+				"(set link_base_path to a writable path)",
+		},
+		{
+			name:            "read-only without path",
+			err:             fmt.Errorf("failed: %w", syscall.EROFS),
+			expectedMessage: "read-only filesystem, cannot create /mnt/v3io/default/bigdata as /mnt/v3io/default is read-only",
+		},
+		{
+			name:            "other error",
+			err:             &os.PathError{Op: "mkdir", Path: "/mnt/v3io/default", Err: syscall.EACCES},
+			redirectConfig:  "link_base_path",
+			expectedMessage: "mkdir /mnt/v3io/default: permission denied",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := explainCreateError("/mnt/v3io/default/bigdata", testCase.err, testCase.redirectConfig)
+			if err.Error() != testCase.expectedMessage {
+				t.Fatalf("Expected %q, got %q", testCase.expectedMessage, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package flex
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const hostMountNamespacePath = "/proc/1/ns/mnt"
+
+// ForceClear is the last resort for a wedged target: regardless of the state of its mount and container, it
+// lazily force-unmounts the target in the host's mount namespace, removes its fuse container and deletes it. A
+// shared target releases its reference instead of removing a container, and the shared mount is force cleared
+// along with its last target. It is only ever run when invoked explicitly, and only on targets under the kubelet root
+func (m *Mounter) ForceClear(targetPath string) *Response {
+	journal.Warn("Force clearing target", "target", targetPath)
+
+	// the target is checked lexically, as a wedged fuse mount can't be stat'ed to resolve symlinks
+	targetPath = filepath.Clean(targetPath)
+	if !m.isUnderKubeletRoot(targetPath) {
+		return NewPermanentFailResponse(fmt.Sprintf("Refusing to force clear %s, which is outside of kubelet root %s",
+			targetPath,
+			m.Config.getKubeletRootDir()), nil)
+	}
+
+	unlockTarget, err := m.lockTarget(context.Background(), targetPath)
+	if err != nil {
+		return NewFailResponse("Failed to lock target", err)
+	}
+
+	defer unlockTarget()
+
+	var failures []string
+
+	// a shared target is only bind mounted, and the container behind it is the shared mount's
+	sharedPath, shared := getSharedMountOfTarget(targetPath)
+
+	if !shared {
+		if criInstance, err := m.createCRI(); err != nil {
+			failures = append(failures, fmt.Sprintf("create CRI: %s", err))
+		} else {
+			journal.Warn("Force clear: removing container", "target", targetPath)
+
+			if err := m.removeV3IOFUSEContainer(criInstance, targetPath); err != nil {
+				failures = append(failures, err.Error())
+			}
+
+			criInstance.Close() // nolint: errcheck
+		}
+	}
+
+	journal.Warn("Force clear: lazily force unmounting in host mount namespace", "target", targetPath)
+
+	if response := m.forceUmount(targetPath); response != nil {
+		failures = append(failures, response.Message)
+	}
+
+	// the shared mount is torn down as on unmount once no target references it, forcibly as well
+	if shared {
+		journal.Warn("Force clear: releasing shared mount reference", "target", targetPath, "sharedPath", sharedPath)
+
+		response := m.unmountSharedSubPathWith(targetPath, sharedPath, m.forceClearSharedMount)
+		if response.Status != "Success" {
+			failures = append(failures, response.Message)
+		}
+	}
+
+	removeMountSpec(targetPath)
+	removeStagedV3ioConfig(targetPath)
+	removeRecentMountResult(targetPath)
+
+	journal.Warn("Force clear: removing directory", "target", targetPath)
+
+	if err := m.filesystem.Remove(targetPath); err != nil && !os.IsNotExist(err) {
+		failures = append(failures, fmt.Sprintf("remove directory: %s", err))
+	}
+
+	if len(failures) > 0 {
+		return NewFailResponse(fmt.Sprintf("Failed to force clear %s", targetPath),
+			fmt.Errorf("%s", strings.Join(failures, "; ")))
+	}
+
+	return NewSuccessResponse(fmt.Sprintf("Force cleared %s", targetPath))
+}
+
+// forceUmount lazily force-unmounts a target in the host's mount namespace. It returns nil once the target is
+// unmounted, or a fail response
+func (m *Mounter) forceUmount(targetPath string) *Response {
+	if err := m.filesystem.ForceUnmount(targetPath); err != nil {
+
+		// not being mounted is what we're after
+		if m.filesystem.IsMountPoint(targetPath) {
+			return NewFailResponse("Failed to force unmount", err)
+		}
+	}
+
+	return nil
+}
+
+// forceClearSharedMount tears down a shared mount whose last target was force cleared, removing its container and
+// force-unmounting it
+func (m *Mounter) forceClearSharedMount(sharedPath string) *Response {
+	journal.Warn("Force clear: tearing down shared mount", "sharedPath", sharedPath)
+
+	return m.unmountFUSEWith(sharedPath, m.forceUmount)
+}
+
+// isUnderKubeletRoot checks whether a clean path is under the kubelet root, as configured or as resolved
+func (m *Mounter) isUnderKubeletRoot(targetPath string) bool {
+	kubeletRootDirs := []string{filepath.Clean(m.Config.getKubeletRootDir())}
+	if resolvedKubeletRootDir, err := m.filesystem.EvalSymlinks(m.Config.getKubeletRootDir()); err == nil {
+		kubeletRootDirs = append(kubeletRootDirs, resolvedKubeletRootDir)
+	}
+
+	for _, kubeletRootDir := range kubeletRootDirs {
+		if strings.HasPrefix(targetPath, kubeletRootDir+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
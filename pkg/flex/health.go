@@ -0,0 +1,201 @@
+package flex
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/cri"
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+type mountHealth string
+
+const (
+	mountHealthHealthy    mountHealth = "healthy"
+	mountHealthDead       mountHealth = "dead"
+	mountHealthNotMounted mountHealth = "not-mounted"
+)
+
+// mountpointHealth classifies a target path. A mount that is in the mount table but can't be stat'ed (e.g. ENOTCONN
+// after the fuse process died) is dead
+func (m *Mounter) mountpointHealth(targetPath string) mountHealth {
+	if !m.filesystem.IsMountPoint(targetPath) {
+		return mountHealthNotMounted
+	}
+
+	statErrChan := make(chan error, 1)
+	go func() {
+		_, err := m.filesystem.Stat(targetPath)
+		statErrChan <- err
+	}()
+
+	select {
+	case err := <-statErrChan:
+		if err != nil {
+			journal.Debug("Failed to stat mount point", "target", targetPath, "err", err.Error())
+			return mountHealthDead
+		}
+	case <-time.After(checkTimeout):
+		journal.Debug("Timed out stating mount point", "target", targetPath)
+		return mountHealthDead
+	}
+
+	return mountHealthHealthy
+}
+
+// handleExistingMount decides what to do with a target that is already in the mount table. It returns a response
+// if the mount should be left as is, or nil if it was cleared and should be recreated
+func (m *Mounter) handleExistingMount(targetPath string, spec *Spec) *Response {
+	health := m.mountpointHealth(targetPath)
+	containerState := m.getContainerState(targetPath)
+
+	healthy := health == mountHealthHealthy &&
+		(containerState == cri.ContainerStateRunning || containerState == cri.ContainerStateUnknown)
+
+	journal.Info("Target already mounted",
+		"target", targetPath,
+		"health", health,
+		"containerState", containerState,
+		"healthy", healthy)
+
+	if health == mountHealthDead && m.Config.CleanupDeadMounts {
+		journal.Info("Cleaning up dead mount", "target", targetPath)
+
+		if err := m.cleanupDeadMount(targetPath); err != nil {
+			return NewFailResponse(fmt.Sprintf("Failed to clean up dead mount %s", targetPath), err)
+		}
+
+		return nil
+	}
+
+	if healthy {
+		if !m.specChangeRequiresRecreate(targetPath, spec) {
+			return NewSuccessResponse(fmt.Sprintf("Already mounted: %s (healthy, container state: %s)",
+				targetPath,
+				containerState))
+		}
+
+		journal.Info("Recreating mount with changed spec", "target", targetPath)
+
+		if err := m.clearExistingMount(targetPath); err != nil {
+			return NewFailResponse(fmt.Sprintf("Failed to clear mount %s", targetPath), err)
+		}
+
+		return nil
+	}
+
+	if !m.Config.RecreateUnhealthyMount {
+		return NewSuccessResponse(fmt.Sprintf("Already mounted: %s (unhealthy: mount is %s, container state: %s)",
+			targetPath,
+			health,
+			containerState))
+	}
+
+	journal.Info("Recreating unhealthy mount", "target", targetPath)
+
+	if err := m.clearExistingMount(targetPath); err != nil {
+		return NewFailResponse(fmt.Sprintf("Failed to detach unhealthy mount %s", targetPath), err)
+	}
+
+	return nil
+}
+
+// specChangeRequiresRecreate compares a spec with the one the target was mounted with. Only changes to fields
+// that take effect on container creation require a recreate, and only with RecreateOnSpecChange
+func (m *Mounter) specChangeRequiresRecreate(targetPath string, spec *Spec) bool {
+	if !m.Config.RecreateOnSpecChange {
+		return false
+	}
+
+	mountedSpec, err := loadMountSpec(targetPath)
+	if err != nil {
+		journal.Warn("Failed to load mount spec", "target", targetPath, "err", err.Error())
+		return false
+	}
+
+	if mountedSpec == nil {
+		return false
+	}
+
+	recreateFields, cosmeticFields := diffSpecs(mountedSpec, spec)
+	if len(cosmeticFields) > 0 {
+		journal.Debug("Ignoring cosmetic spec changes", "target", targetPath, "fields", cosmeticFields)
+	}
+
+	if len(recreateFields) == 0 {
+		return false
+	}
+
+	journal.Info("Spec changed", "target", targetPath, "fields", recreateFields)
+
+	return true
+}
+
+// clearExistingMount detaches a target's mount so a new fuse mount doesn't stack on top of it. A shared sub path
+// also releases its reference, so the shared mount isn't leaked if the new spec maps to another one
+func (m *Mounter) clearExistingMount(targetPath string) error {
+	if sharedPath, found := getSharedMountOfTarget(targetPath); found {
+		if response := m.unmountSharedSubPath(targetPath, sharedPath); response.Status != "Success" {
+			return errors.New(response.Message)
+		}
+
+		// unmounting removed the target, which the new mount needs
+		return m.filesystem.MkdirAll(targetPath, 0750)
+	}
+
+	return m.filesystem.LazyUnmount(targetPath)
+}
+
+// cleanupDeadMount detaches a target's dead mount and removes the container that backed it, so the new mount
+// starts clean. A shared sub path's container is the shared mount's, which other targets may still use, so only
+// the target's reference to it is released
+func (m *Mounter) cleanupDeadMount(targetPath string) error {
+	_, shared := getSharedMountOfTarget(targetPath)
+
+	if err := m.clearExistingMount(targetPath); err != nil {
+		return err
+	}
+
+	if shared {
+		return nil
+	}
+
+	criInstance, err := m.createCRI()
+	if err != nil {
+		return err
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	return m.removeV3IOFUSEContainer(criInstance, targetPath)
+}
+
+func (m *Mounter) getContainerState(targetPath string) string {
+
+	// a shared sub path's container is that of the shared mount
+	if sharedPath, found := getSharedMountOfTarget(targetPath); found {
+		targetPath = sharedPath
+	}
+
+	containerName, err := m.getContainerName(targetPath, nil)
+	if err != nil {
+		return cri.ContainerStateUnknown
+	}
+
+	criInstance, err := m.createCRI()
+	if err != nil {
+		journal.Debug("Failed to create CRI", "err", err.Error())
+		return cri.ContainerStateUnknown
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	status, err := criInstance.ContainerStatus(containerName)
+	if err != nil {
+		journal.Debug("Failed to get container status", "containerName", containerName, "err", err.Error())
+		return cri.ContainerStateUnknown
+	}
+
+	return status.State
+}
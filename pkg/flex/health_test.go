@@ -0,0 +1,127 @@
+package flex
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/v3io/flex-fuse/pkg/cri"
+)
+
+// deadMountFilesystem fails stating its mount points with ENOTCONN, as a fuse mount whose process died does
+type deadMountFilesystem struct {
+	*memoryFilesystem
+}
+
+func (f *deadMountFilesystem) Stat(path string) (os.FileInfo, error) {
+	if f.IsMountPoint(path) {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: syscall.ENOTCONN}
+	}
+
+	return f.memoryFilesystem.Stat(path)
+}
+
+func TestHandleExistingMount(t *testing.T) {
+	for _, testCase := range []struct {
+		name                   string
+		dead                   bool
+		shared                 bool
+		cleanupDeadMounts      bool
+		recreateUnhealthyMount bool
+		expectedMessage        string
+		expectUnmounted        bool
+		expectContainerRemoved bool
+	}{
+		{
+			name:            "healthy",
+			expectedMessage: "Already mounted: " + fakeTargetPath + " (healthy, container state: running)",
+		},
+		{
+			name:            "dead",
+			dead:            true,
+			expectedMessage: "Already mounted: " + fakeTargetPath + " (unhealthy: mount is dead, container state: running)",
+		},
+		{
+			name:                   "dead, recreated",
+			dead:                   true,
+			recreateUnhealthyMount: true,
+			expectUnmounted:        true,
+		},
+		{
+			name:                   "dead, cleaned up",
+			dead:                   true,
+			cleanupDeadMounts:      true,
+			expectUnmounted:        true,
+			expectContainerRemoved: true,
+		},
+		{
+			name:              "dead shared sub path, cleaned up",
+			dead:              true,
+			shared:            true,
+			cleanupDeadMounts: true,
+			expectUnmounted:   true,
+		},
+		{
+			name:              "healthy, cleanup enabled",
+			cleanupDeadMounts: true,
+			expectedMessage:   "Already mounted: " + fakeTargetPath + " (healthy, container state: running)",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			useTempSharedMountsStateDir(t)
+
+			mounter, criInstance := newFakeCRIMounter(t, &Config{
+				CleanupDeadMounts:      testCase.cleanupDeadMounts,
+				RecreateUnhealthyMount: testCase.recreateUnhealthyMount,
+			})
+
+			filesystem := mounter.filesystem.(*memoryFilesystem)
+			if testCase.dead {
+				mounter.filesystem = &deadMountFilesystem{filesystem}
+			}
+
+			filesystem.mount(fakeTargetPath)
+
+			containerName, _ := mounter.getContainerName(fakeTargetPath, nil)
+			criInstance.containers[containerName] = &cri.ContainerStatus{State: cri.ContainerStateRunning}
+
+			var sharedContainerName string
+			if testCase.shared {
+				sharedPath := getSharedMountPath(&Spec{Container: "bigdata", OverrideAccessKey: "key"})
+				addSharedMountRef(sharedPath, fakeTargetPath) // nolint: errcheck
+
+				sharedContainerName, _ = mounter.getContainerName(sharedPath, nil)
+				criInstance.containers[sharedContainerName] = &cri.ContainerStatus{State: cri.ContainerStateRunning}
+			}
+
+			response := mounter.handleExistingMount(fakeTargetPath, &Spec{})
+			if testCase.expectedMessage == "" {
+				if response != nil {
+					t.Fatalf("Expected the mount to be cleared for recreation, got %+v", response)
+				}
+			} else if response == nil || response.Status != "Success" || response.Message != testCase.expectedMessage {
+				t.Fatalf("Expected success with message %q, got %+v", testCase.expectedMessage, response)
+			}
+
+			if unmounted := !filesystem.IsMountPoint(fakeTargetPath); unmounted != testCase.expectUnmounted {
+				t.Fatalf("Expected unmounted: %t, got %t", testCase.expectUnmounted, unmounted)
+			}
+
+			_, found := criInstance.containers[containerName]
+			if containerRemoved := !found; containerRemoved != testCase.expectContainerRemoved {
+				t.Fatalf("Expected container removed: %t, got %t", testCase.expectContainerRemoved, containerRemoved)
+			}
+
+			// the shared mount's container may still serve other targets
+			if testCase.shared {
+				if _, found := criInstance.containers[sharedContainerName]; !found {
+					t.Fatal("Expected the shared mount's container to be kept")
+				}
+
+				if _, found := getSharedMountOfTarget(fakeTargetPath); found {
+					t.Fatal("Expected the target's shared mount reference to be released")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package flex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const (
+	fuseDevicePath        = "/dev/fuse"
+	fuseModuleVersionPath = "/sys/module/fuse/version"
+	fuseVersionImageLabel = "io.iguazio.fuse.version"
+)
+
+// HealthCheck runs node-level diagnostics. Checks that can't prevent mounting (e.g. version mismatches) only warn
+func (m *Mounter) HealthCheck() *Response {
+	journal.Debug("Running health check")
+
+	var checks []CheckResult
+
+	checks = append(checks, runCheck("cri", func() (string, error) {
+		criInstance, err := m.createCRI()
+		if err != nil {
+			return "", err
+		}
+
+		criInstance.Close() // nolint: errcheck
+
+		return "CRI is reachable", nil
+	}))
+
+	checks = append(checks, runCheck("fuse-device", func() (string, error) {
+		if _, err := os.Stat(fuseDevicePath); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s exists", fuseDevicePath), nil
+	}))
+
+	fuseVersionCheck := runCheck("fuse-version", m.checkFuseVersion)
+	if !fuseVersionCheck.Success {
+		fuseVersionCheck.Warning = true
+	}
+
+	checks = append(checks, fuseVersionCheck)
+
+	var failedChecks []string
+	for _, check := range checks {
+		if !check.Success && !check.Warning {
+			failedChecks = append(failedChecks, check.Name)
+		}
+	}
+
+	var response *Response
+	if len(failedChecks) > 0 {
+		response = NewFailResponse("Health check failed",
+			fmt.Errorf("Failed checks: %s", strings.Join(failedChecks, ", ")))
+	} else {
+		response = NewSuccessResponse("Health check passed")
+	}
+
+	response.Checks = checks
+
+	return response
+}
+
+// checkFuseVersion compares the node's fuse module version against the version the fuse image expects, as
+// declared by its fuseVersionImageLabel label
+func (m *Mounter) checkFuseVersion() (string, error) {
+	nodeVersion, err := getNodeFuseVersion()
+	if err != nil {
+		return "", fmt.Errorf("Could not determine node fuse version: %s", err)
+	}
+
+	criInstance, err := m.createCRI()
+	if err != nil {
+		return "", err
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	image := m.Config.getImage()
+
+	imageLabels, err := criInstance.ImageLabels(image)
+	if err != nil {
+		return "", fmt.Errorf("Could not get labels of image %s: %s", image, err)
+	}
+
+	imageVersion, found := imageLabels[fuseVersionImageLabel]
+	if !found {
+		return fmt.Sprintf("node fuse version %s, image %s doesn't declare one", nodeVersion, image), nil
+	}
+
+	if majorMinorVersion(nodeVersion) != majorMinorVersion(imageVersion) {
+		return "", fmt.Errorf("Node fuse version %s doesn't match version %s expected by image %s",
+			nodeVersion,
+			imageVersion,
+			image)
+	}
+
+	return fmt.Sprintf("node fuse version %s matches image %s", nodeVersion, image), nil
+}
+
+func getNodeFuseVersion() (string, error) {
+	if version, err := ioutil.ReadFile(fuseModuleVersionPath); err == nil {
+		return strings.TrimSpace(string(version)), nil
+	}
+
+	version, err := exec.Command("modinfo", "-F", "version", "fuse").Output()
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(string(version)) == "" {
+		return "", fmt.Errorf("fuse module has no version")
+	}
+
+	return strings.TrimSpace(string(version)), nil
+}
+
+func majorMinorVersion(version string) string {
+	versionParts := strings.SplitN(version, ".", 3)
+	if len(versionParts) < 2 {
+		return version
+	}
+
+	return versionParts[0] + "." + versionParts[1]
+}
@@ -0,0 +1,205 @@
+package flex
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+// latencyStateFilePath holds the latency histograms. It's a variable so that tests can keep theirs apart from the
+// node's
+var latencyStateFilePath = "/var/run/v3io-fuse/metrics/latency.json"
+
+var defaultLatencyBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// latencyHistogram is the distribution of an operation's durations with an outcome. BucketCounts[i] counts the
+// durations within Buckets[i] (and above the previous bucket), the last one those above all buckets
+type latencyHistogram struct {
+	Operation    string    `json:"operation"`
+	Outcome      string    `json:"outcome"`
+	Buckets      []float64 `json:"buckets"`
+	BucketCounts []uint64  `json:"bucketCounts"`
+	Sum          float64   `json:"sum"`
+	Count        uint64    `json:"count"`
+}
+
+// observeLatency records how long an operation took for the state socket's metrics. Every operation runs in a
+// process of its own, so the histograms are kept in a file, updated under a file lock. Only done when the state
+// socket is configured, as nothing reads them otherwise
+func (m *Mounter) observeLatency(operation string, response *Response, duration time.Duration) {
+	if m.Config.StateSocketPath == "" {
+		return
+	}
+
+	outcome := "success"
+	if response.Status != "Success" {
+		outcome = "failure"
+	}
+
+	if err := updateLatencyHistograms(func(histograms []latencyHistogram) []latencyHistogram {
+		return observeLatencyHistogram(histograms, m.Config.getLatencyBuckets(), operation, outcome, duration)
+	}); err != nil {
+		journal.Warn("Failed to record operation latency", "operation", operation, "err", err.Error())
+	}
+}
+
+func observeLatencyHistogram(histograms []latencyHistogram,
+	buckets []float64,
+	operation string,
+	outcome string,
+	duration time.Duration) []latencyHistogram {
+	histogramIdx := -1
+	for candidateIdx, histogram := range histograms {
+		if histogram.Operation == operation && histogram.Outcome == outcome {
+			histogramIdx = candidateIdx
+		}
+	}
+
+	// observations can't be redistributed into other buckets, so changing them starts the histogram over
+	if histogramIdx == -1 || !reflect.DeepEqual(histograms[histogramIdx].Buckets, buckets) {
+		histogram := latencyHistogram{
+			Operation:    operation,
+			Outcome:      outcome,
+			Buckets:      buckets,
+			BucketCounts: make([]uint64, len(buckets)+1),
+		}
+
+		if histogramIdx == -1 {
+			histograms = append(histograms, histogram)
+			histogramIdx = len(histograms) - 1
+		} else {
+			histograms[histogramIdx] = histogram
+		}
+	}
+
+	histogram := &histograms[histogramIdx]
+	seconds := duration.Seconds()
+
+	bucketIdx := sort.SearchFloat64s(histogram.Buckets, seconds)
+	histogram.BucketCounts[bucketIdx]++
+	histogram.Sum += seconds
+	histogram.Count++
+
+	return histograms
+}
+
+// updateLatencyHistograms applies an update to the recorded histograms while holding the state file's lock
+func updateLatencyHistograms(update func([]latencyHistogram) []latencyHistogram) error {
+	if err := os.MkdirAll(path.Dir(latencyStateFilePath), 0755); err != nil {
+		return fmt.Errorf("Failed to create metrics directory: %s", err)
+	}
+
+	stateFile, err := os.OpenFile(latencyStateFilePath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to open latency state file: %s", err)
+	}
+
+	defer stateFile.Close() // nolint: errcheck
+
+	if err := syscall.Flock(int(stateFile.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("Failed to lock latency state file: %s", err)
+	}
+
+	defer syscall.Flock(int(stateFile.Fd()), syscall.LOCK_UN) // nolint: errcheck
+
+	histograms, err := readLatencyHistograms(stateFile)
+	if err != nil {
+
+		// the histograms are only metrics, so unreadable ones are started over rather than block recording
+		journal.Warn("Discarding unreadable latency histograms", "err", err.Error())
+	}
+
+	stateBytes, err := json.Marshal(update(histograms))
+	if err != nil {
+		return fmt.Errorf("Failed to marshal latency histograms: %s", err)
+	}
+
+	if err := stateFile.Truncate(0); err != nil {
+		return err
+	}
+
+	_, err = stateFile.WriteAt(stateBytes, 0)
+
+	return err
+}
+
+// loadLatencyHistograms returns the recorded histograms, none if nothing was recorded yet
+func loadLatencyHistograms() ([]latencyHistogram, error) {
+	stateFile, err := os.Open(latencyStateFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer stateFile.Close() // nolint: errcheck
+
+	if err := syscall.Flock(int(stateFile.Fd()), syscall.LOCK_SH); err != nil {
+		return nil, err
+	}
+
+	defer syscall.Flock(int(stateFile.Fd()), syscall.LOCK_UN) // nolint: errcheck
+
+	return readLatencyHistograms(stateFile)
+}
+
+func readLatencyHistograms(stateFile *os.File) ([]latencyHistogram, error) {
+	stateBytes, err := ioutil.ReadAll(stateFile)
+	if err != nil || len(stateBytes) == 0 {
+		return nil, err
+	}
+
+	var histograms []latencyHistogram
+	if err := json.Unmarshal(stateBytes, &histograms); err != nil {
+		return nil, err
+	}
+
+	return histograms, nil
+}
+
+// writeLatencyMetrics writes the histograms in the prometheus text format, whose buckets are cumulative
+func writeLatencyMetrics(writer io.Writer, histograms []latencyHistogram) {
+	const metricName = "v3io_fuse_operation_duration_seconds"
+
+	fmt.Fprintf(writer, "# HELP %s Duration of mount and unmount operations by outcome\n", metricName)
+	fmt.Fprintf(writer, "# TYPE %s histogram\n", metricName)
+
+	sort.Slice(histograms, func(i, j int) bool {
+		if histograms[i].Operation != histograms[j].Operation {
+			return histograms[i].Operation < histograms[j].Operation
+		}
+
+		return histograms[i].Outcome < histograms[j].Outcome
+	})
+
+	for _, histogram := range histograms {
+		labels := fmt.Sprintf("operation=%q,outcome=%q", histogram.Operation, histogram.Outcome)
+
+		var cumulativeCount uint64
+		for bucketIdx, bucket := range histogram.Buckets {
+			cumulativeCount += histogram.BucketCounts[bucketIdx]
+
+			fmt.Fprintf(writer, "%s_bucket{%s,le=%q} %d\n",
+				metricName,
+				labels,
+				strconv.FormatFloat(bucket, 'g', -1, 64),
+				cumulativeCount)
+		}
+
+		fmt.Fprintf(writer, "%s_bucket{%s,le=\"+Inf\"} %d\n", metricName, labels, histogram.Count)
+		fmt.Fprintf(writer, "%s_sum{%s} %s\n", metricName, labels, strconv.FormatFloat(histogram.Sum, 'g', -1, 64))
+		fmt.Fprintf(writer, "%s_count{%s} %d\n", metricName, labels, histogram.Count)
+	}
+}
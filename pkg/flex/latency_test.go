@@ -0,0 +1,126 @@
+package flex
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteLatencyMetrics(t *testing.T) {
+	buckets := []float64{0.5, 1, 2.5}
+
+	var histograms []latencyHistogram
+	for _, observation := range []struct {
+		operation string
+		outcome   string
+		duration  time.Duration
+	}{
+		{operation: "mount", outcome: "success", duration: 200 * time.Millisecond},
+		{operation: "mount", outcome: "success", duration: time.Second},
+		{operation: "mount", outcome: "success", duration: 1500 * time.Millisecond},
+		{operation: "mount", outcome: "success", duration: 10 * time.Second},
+		{operation: "mount", outcome: "failure", duration: 3 * time.Second},
+		{operation: "unmount", outcome: "success", duration: 250 * time.Millisecond},
+	} {
+		histograms = observeLatencyHistogram(histograms,
+			buckets,
+			observation.operation,
+			observation.outcome,
+			observation.duration)
+	}
+
+	expectedMetrics := `# HELP v3io_fuse_operation_duration_seconds Duration of mount and unmount operations by outcome
+# TYPE v3io_fuse_operation_duration_seconds histogram
+v3io_fuse_operation_duration_seconds_bucket{operation="mount",outcome="failure",le="0.5"} 0
+v3io_fuse_operation_duration_seconds_bucket{operation="mount",outcome="failure",le="1"} 0
+v3io_fuse_operation_duration_seconds_bucket{operation="mount",outcome="failure",le="2.5"} 0
+v3io_fuse_operation_duration_seconds_bucket{operation="mount",outcome="failure",le="+Inf"} 1
+v3io_fuse_operation_duration_seconds_sum{operation="mount",outcome="failure"} 3
+v3io_fuse_operation_duration_seconds_count{operation="mount",outcome="failure"} 1
+v3io_fuse_operation_duration_seconds_bucket{operation="mount",outcome="success",le="0.5"} 1
+v3io_fuse_operation_duration_seconds_bucket{operation="mount",outcome="success",le="1"} 2
+v3io_fuse_operation_duration_seconds_bucket{operation="mount",outcome="success",le="2.5"} 3
+v3io_fuse_operation_duration_seconds_bucket{operation="mount",outcome="success",le="+Inf"} 4
+v3io_fuse_operation_duration_seconds_sum{operation="mount",outcome="success"} 12.7
+v3io_fuse_operation_duration_seconds_count{operation="mount",outcome="success"} 4
+v3io_fuse_operation_duration_seconds_bucket{operation="unmount",outcome="success",le="0.5"} 1
+v3io_fuse_operation_duration_seconds_bucket{operation="unmount",outcome="success",le="1"} 1
+v3io_fuse_operation_duration_seconds_bucket{operation="unmount",outcome="success",le="2.5"} 1
+v3io_fuse_operation_duration_seconds_bucket{operation="unmount",outcome="success",le="+Inf"} 1
+v3io_fuse_operation_duration_seconds_sum{operation="unmount",outcome="success"} 0.25
+v3io_fuse_operation_duration_seconds_count{operation="unmount",outcome="success"} 1
+`
+
+	metrics := bytes.Buffer{}
+	writeLatencyMetrics(&metrics, histograms)
+
+	if metrics.String() != expectedMetrics {
+		t.Fatalf("Expected metrics:\n%s\ngot:\n%s", expectedMetrics, metrics.String())
+	}
+}
+
+func TestObserveLatency(t *testing.T) {
+	originalLatencyStateFilePath := latencyStateFilePath
+	latencyStateFilePath = filepath.Join(t.TempDir(), "metrics", "latency.json")
+	t.Cleanup(func() { latencyStateFilePath = originalLatencyStateFilePath })
+
+	// the cases share the state file, each observing on top of the ones before it, as processes do
+	for _, testCase := range []struct {
+		name               string
+		config             Config
+		response           *Response
+		expectedHistograms []latencyHistogram
+	}{
+		{
+			name:     "no state socket",
+			response: NewSuccessResponse("Successfully mounted"),
+		},
+		{
+			name:     "success",
+			config:   Config{StateSocketPath: "/run/v3io-fuse.sock", LatencyBuckets: []float64{1, 5}},
+			response: NewSuccessResponse("Successfully mounted"),
+			expectedHistograms: []latencyHistogram{
+				{Operation: "mount", Outcome: "success", Buckets: []float64{1, 5}, BucketCounts: []uint64{0, 1, 0},
+					Sum: 2, Count: 1},
+			},
+		},
+		{
+			name:     "failure",
+			config:   Config{StateSocketPath: "/run/v3io-fuse.sock", LatencyBuckets: []float64{1, 5}},
+			response: NewFailResponse("Failed to mount", nil),
+			expectedHistograms: []latencyHistogram{
+				{Operation: "mount", Outcome: "success", Buckets: []float64{1, 5}, BucketCounts: []uint64{0, 1, 0},
+					Sum: 2, Count: 1},
+				{Operation: "mount", Outcome: "failure", Buckets: []float64{1, 5}, BucketCounts: []uint64{0, 1, 0},
+					Sum: 2, Count: 1},
+			},
+		},
+		{
+			name:     "changed buckets",
+			config:   Config{StateSocketPath: "/run/v3io-fuse.sock", LatencyBuckets: []float64{3}},
+			response: NewSuccessResponse("Successfully mounted"),
+			expectedHistograms: []latencyHistogram{
+				{Operation: "mount", Outcome: "success", Buckets: []float64{3}, BucketCounts: []uint64{1, 0},
+					Sum: 2, Count: 1},
+				{Operation: "mount", Outcome: "failure", Buckets: []float64{1, 5}, BucketCounts: []uint64{0, 1, 0},
+					Sum: 2, Count: 1},
+			},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter := newTestMounter(&testCase.config, newMemoryFilesystem())
+			mounter.observeLatency("mount", testCase.response, 2*time.Second)
+
+			histograms, err := loadLatencyHistograms()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(histograms, testCase.expectedHistograms) {
+				t.Fatalf("Expected histograms %+v, got %+v", testCase.expectedHistograms, histograms)
+			}
+		})
+	}
+}
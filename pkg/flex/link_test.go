@@ -0,0 +1,350 @@
+package flex
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateLinkPaths(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		linkPath    string
+		targetPath  string
+		expectError bool
+	}{
+		{name: "distinct", linkPath: "/mnt/v3io/default/bigdata", targetPath: "/var/lib/kubelet/pods/uid/v3io"},
+		{name: "equal", linkPath: "/mnt/v3io/default/bigdata", targetPath: "/mnt/v3io/default/bigdata",
+			expectError: true},
+		{name: "equal once cleaned", linkPath: "/mnt/v3io/default/bigdata", targetPath: "/mnt/v3io/default/./bigdata/",
+			expectError: true},
+		{name: "target under link", linkPath: "/mnt/v3io/default/bigdata", targetPath: "/mnt/v3io/default/bigdata/a",
+			expectError: true},
+		{name: "link under target", linkPath: "/mnt/v3io/default/bigdata", targetPath: "/mnt/v3io", expectError: true},
+		{name: "shared prefix", linkPath: "/mnt/v3io/default/bigdata", targetPath: "/mnt/v3io/default/bigdata2"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if err := validateLinkPaths(testCase.linkPath, testCase.targetPath); (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+		})
+	}
+}
+
+func TestMountAsLinkRefusesCollidingTarget(t *testing.T) {
+	for _, targetPath := range []string{"/mnt/v3io/default/bigdata", "/mnt/v3io/default/bigdata/a", "/mnt/v3io"} {
+		t.Run(targetPath, func(t *testing.T) {
+			mounter := newTestMounter(&Config{Type: "link"}, newMemoryFilesystem())
+
+			response := mounter.mountAsLink(nil, &Spec{Namespace: "default", Container: "bigdata"}, targetPath)
+			if response.Status != "Failure" || response.Transient {
+				t.Fatalf("Expected a permanent failure, got %+v", response)
+			}
+
+			if !strings.HasPrefix(response.Message, PermanentFailurePrefix+"Invalid link") {
+				t.Fatalf("Unexpected message %s", response.Message)
+			}
+		})
+	}
+}
+
+func TestLinkStrategies(t *testing.T) {
+	const (
+		linkPath   = "/mnt/v3io/default/bigdata"
+		targetPath = "/pods/uid/volumes/v3io"
+	)
+
+	for _, testCase := range []struct {
+		name             string
+		linkUseBindMount bool
+	}{
+		{name: "symlink"},
+		{name: "bind mount", linkUseBindMount: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := newMemoryFilesystem()
+			filesystem.mount(linkPath)
+			filesystem.MkdirAll(targetPath, 0750) // nolint: errcheck
+
+			mounter := newTestMounter(&Config{Type: "link", LinkUseBindMount: testCase.linkUseBindMount}, filesystem)
+			spec := &Spec{Namespace: "default", Container: "bigdata"}
+
+			// a retried mount finds the target linked already
+			for attempt := 0; attempt < 2; attempt++ {
+				if response := mounter.mountAsLink(nil, spec, targetPath); response.Status != "Success" {
+					t.Fatalf("Expected attempt %d to succeed, got %s", attempt, response.Message)
+				}
+			}
+
+			linkTarget, err := filesystem.Readlink(targetPath)
+			if testCase.linkUseBindMount {
+				if filesystem.mountPoints[targetPath] != linkPath {
+					t.Fatalf("Expected %s bind mounted on the target, got %v", linkPath, filesystem.mountPoints)
+				}
+
+				if err == nil {
+					t.Fatalf("Expected a directory rather than a symlink, got a symlink to %s", linkTarget)
+				}
+			} else if err != nil || linkTarget != linkPath {
+				t.Fatalf("Expected a symlink to %s, got %s (%v)", linkPath, linkTarget, err)
+			}
+
+			if response := mounter.unmountAsLink(targetPath); response.Status != "Success" {
+				t.Fatalf("Expected the teardown to succeed, got %s", response.Message)
+			}
+
+			if _, err := filesystem.Lstat(targetPath); !os.IsNotExist(err) {
+				t.Fatalf("Expected the target to be removed, got %v", err)
+			}
+
+			if filesystem.IsMountPoint(targetPath) || !filesystem.IsMountPoint(linkPath) {
+				t.Fatalf("Expected only the link path to stay mounted, got %v", filesystem.mountPoints)
+			}
+		})
+	}
+}
+
+// linkChurnFilesystem counts the removals and links made, which a retried mount shouldn't make
+type linkChurnFilesystem struct {
+	*memoryFilesystem
+	removals int
+	symlinks int
+}
+
+func (f *linkChurnFilesystem) Remove(path string) error {
+	f.removals++
+	return f.memoryFilesystem.Remove(path)
+}
+
+func (f *linkChurnFilesystem) Symlink(oldPath string, newPath string) error {
+	f.symlinks++
+	return f.memoryFilesystem.Symlink(oldPath, newPath)
+}
+
+func TestMountAsLinkExistingTarget(t *testing.T) {
+	const (
+		linkPath   = "/mnt/v3io/default/bigdata"
+		targetPath = "/pods/uid/v3io"
+	)
+
+	for _, testCase := range []struct {
+		name            string
+		createTarget    func(filesystem *memoryFilesystem)
+		expectedMessage string
+		expectReplaced  bool
+	}{
+		{
+			name: "linked to the link path",
+			createTarget: func(filesystem *memoryFilesystem) {
+				filesystem.Symlink(linkPath, targetPath) // nolint: errcheck
+			},
+			expectedMessage: "Already linked: " + targetPath,
+		},
+		{
+			name: "linked to the unclean link path",
+			createTarget: func(filesystem *memoryFilesystem) {
+				filesystem.Symlink(linkPath+"/", targetPath) // nolint: errcheck
+			},
+			expectedMessage: "Already linked: " + targetPath,
+		},
+		{
+			name: "linked elsewhere",
+			createTarget: func(filesystem *memoryFilesystem) {
+				filesystem.mount("/mnt/v3io/default/users")
+				filesystem.Symlink("/mnt/v3io/default/users", targetPath) // nolint: errcheck
+			},
+			expectedMessage: "Successfully mounted as link",
+			expectReplaced:  true,
+		},
+		{
+			name: "directory",
+			createTarget: func(filesystem *memoryFilesystem) {
+				filesystem.MkdirAll(targetPath, 0750) // nolint: errcheck
+			},
+			expectedMessage: "Successfully mounted as link",
+			expectReplaced:  true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := &linkChurnFilesystem{memoryFilesystem: newMemoryFilesystem()}
+			filesystem.mount(linkPath)
+			filesystem.MkdirAll("/pods/uid", 0750) // nolint: errcheck
+			testCase.createTarget(filesystem.memoryFilesystem)
+
+			mounter := newTestMounter(&Config{Type: "link"}, filesystem)
+
+			response := mounter.mountAsLink(nil, &Spec{Namespace: "default", Container: "bigdata"}, targetPath)
+			if response.Status != "Success" || response.Message != testCase.expectedMessage {
+				t.Fatalf("Expected success with message %q, got %+v", testCase.expectedMessage, response)
+			}
+
+			if replaced := filesystem.removals > 0 || filesystem.symlinks > 0; replaced != testCase.expectReplaced {
+				t.Fatalf("Expected replaced: %t, got %d removals and %d links",
+					testCase.expectReplaced,
+					filesystem.removals,
+					filesystem.symlinks)
+			}
+
+			if linkTarget, _ := filesystem.Readlink(targetPath); filepath.Clean(linkTarget) != linkPath {
+				t.Fatalf("Expected a link to %s, got %s", linkPath, linkTarget)
+			}
+		})
+	}
+}
+
+// failingBindFilesystem fails every bind mount
+type failingBindFilesystem struct {
+	*memoryFilesystem
+}
+
+func (f *failingBindFilesystem) BindMount(sourcePath string, targetPath string) error {
+	return errors.New("mount: permission denied")
+}
+
+func TestBindMountLinkFailure(t *testing.T) {
+	filesystem := &failingBindFilesystem{newMemoryFilesystem()}
+	filesystem.mount("/mnt/v3io/default/bigdata")
+
+	mounter := newTestMounter(&Config{Type: "link", LinkUseBindMount: true}, filesystem)
+
+	response := mounter.mountAsLink(nil, &Spec{Namespace: "default", Container: "bigdata"}, "/pods/uid/v3io")
+	if response.Status == "Success" || !strings.Contains(response.Message, "permission denied") {
+		t.Fatalf("Expected the bind mount to fail, got %+v", response)
+	}
+
+	if filesystem.IsMountPoint("/pods/uid/v3io") {
+		t.Fatal("Expected the target not to be mounted")
+	}
+}
+
+func TestMountAsLinkNamespaceAndContainer(t *testing.T) {
+	for _, testCase := range []struct {
+		name                 string
+		spec                 Spec
+		linkDefaultNamespace string
+		expectedLinkPath     string
+	}{
+		{name: "namespace and container", spec: Spec{Namespace: "default", Container: "bigdata"},
+			expectedLinkPath: "/mnt/v3io/default/bigdata"},
+		{name: "empty namespace", spec: Spec{Container: "bigdata"}},
+		{name: "empty container", spec: Spec{Namespace: "default"}},
+		{name: "empty namespace and container"},
+		{name: "default namespace", spec: Spec{Container: "bigdata"}, linkDefaultNamespace: "shared",
+			expectedLinkPath: "/mnt/v3io/shared/bigdata"},
+		{name: "default namespace, empty container", linkDefaultNamespace: "shared"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := newMemoryFilesystem()
+			filesystem.mount("/mnt/v3io/default/bigdata")
+			filesystem.mount("/mnt/v3io/shared/bigdata")
+			filesystem.MkdirAll("/pods/uid/v3io", 0750) // nolint: errcheck
+
+			mounter := newTestMounter(&Config{Type: "link", LinkDefaultNamespace: testCase.linkDefaultNamespace},
+				filesystem)
+
+			response := mounter.mountAsLink(nil, &testCase.spec, "/pods/uid/v3io")
+			if testCase.expectedLinkPath == "" {
+				if !strings.HasPrefix(response.Message, PermanentFailurePrefix+"Invalid link") {
+					t.Fatalf("Expected an invalid link, got %+v", response)
+				}
+
+				return
+			}
+
+			if linkTarget, err := filesystem.Readlink("/pods/uid/v3io"); err != nil || linkTarget != testCase.expectedLinkPath {
+				t.Fatalf("Expected a link to %s, got %s (%v)", testCase.expectedLinkPath, linkTarget, err)
+			}
+		})
+	}
+}
+
+func TestMountAsLinkRefusesTraversal(t *testing.T) {
+	for _, testCase := range []struct {
+		name      string
+		namespace string
+		container string
+	}{
+		{name: "parent traversal container", namespace: "default", container: "../../etc"},
+		{name: "parent container", namespace: "default", container: ".."},
+		{name: "current container", namespace: "default", container: "."},
+		{name: "absolute container", namespace: "default", container: "/etc"},
+		{name: "nested container", namespace: "default", container: "big/data"},
+		{name: "parent traversal namespace", namespace: "../..", container: "bigdata"},
+		{name: "absolute namespace", namespace: "/var/lib", container: "bigdata"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := newMemoryFilesystem()
+			mounter := newTestMounter(&Config{Type: "link"}, filesystem)
+
+			if linkPath, err := mounter.getLinkPath(testCase.namespace, testCase.container); err == nil {
+				t.Fatalf("Expected the link path to be refused, got %s", linkPath)
+			}
+
+			spec := &Spec{Namespace: testCase.namespace, Container: testCase.container, AccessKey: "key"}
+
+			response := mounter.mountAsLink(nil, spec, "/pods/uid/v3io")
+			if !strings.HasPrefix(response.Message, PermanentFailurePrefix+"Invalid link") {
+				t.Fatalf("Expected the mount to be refused, got %+v", response)
+			}
+
+			if entries, _ := filesystem.Readdirnames("/", 0); len(entries) != 0 {
+				t.Fatalf("Expected nothing to be created, got %v", entries)
+			}
+		})
+	}
+}
+
+func TestLinkBasePath(t *testing.T) {
+	for _, testCase := range []struct {
+		name             string
+		linkBasePath     string
+		expectError      bool
+		expectedLinkPath string
+	}{
+		{name: "default", expectedLinkPath: "/mnt/v3io/default/bigdata"},
+		{name: "custom", linkBasePath: "/mnt/v3io-cluster2", expectedLinkPath: "/mnt/v3io-cluster2/default/bigdata"},
+		{name: "custom unclean", linkBasePath: "/mnt//v3io-cluster2/",
+			expectedLinkPath: "/mnt/v3io-cluster2/default/bigdata"},
+		{name: "relative", linkBasePath: "mnt/v3io", expectError: true},
+		{name: "root", linkBasePath: "/", expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := &Config{Type: "link", LinkBasePath: testCase.linkBasePath}
+			if err := config.validate(); (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+
+			if testCase.expectError {
+				return
+			}
+
+			filesystem := newMemoryFilesystem()
+			filesystem.mount(testCase.expectedLinkPath)
+			filesystem.MkdirAll("/pods/uid/v3io", 0750) // nolint: errcheck
+			mounter := newTestMounter(config, filesystem)
+
+			response := mounter.mountAsLink(nil, &Spec{Namespace: "default", Container: "bigdata"}, "/pods/uid/v3io")
+			if response.Status != "Success" {
+				t.Fatalf("Expected success, got %+v", response)
+			}
+
+			if linkTarget, _ := filesystem.Readlink("/pods/uid/v3io"); linkTarget != testCase.expectedLinkPath {
+				t.Fatalf("Expected a link to %s, got %s", testCase.expectedLinkPath, linkTarget)
+			}
+
+			if response := mounter.unmountAsLink("/pods/uid/v3io"); response.Status != "Success" {
+				t.Fatalf("Expected the link to be removed, got %+v", response)
+			}
+
+			if _, err := filesystem.Lstat("/pods/uid/v3io"); !os.IsNotExist(err) {
+				t.Fatalf("Expected the link to be removed, got %v", err)
+			}
+
+			if _, err := filesystem.Stat(testCase.expectedLinkPath); err != nil {
+				t.Fatalf("Expected the link path to remain, got %s", err)
+			}
+		})
+	}
+}
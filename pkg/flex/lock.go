@@ -0,0 +1,154 @@
+package flex
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/common"
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+// targetLocksDir holds the targets' and the reaper's lock files. It's a variable so that tests can keep their locks
+// apart from the node's
+var targetLocksDir = "/var/run/v3io-fuse/locks"
+
+const (
+	targetLockAttempts     = 600
+	targetLockPollInterval = 100 * time.Millisecond
+	reapLockFileName       = "reap.lock"
+)
+
+// targetMutexes serializes operations on the same target within the process (e.g. the drain command's parallel
+// unmounts), keyed by the cleaned target path
+type targetMutexes struct {
+	mapLock sync.Mutex
+	mutexes map[string]chan struct{}
+}
+
+// lock acquires a target's mutex, unless the context is done first. The returned function releases it
+func (t *targetMutexes) lock(ctx context.Context, cleanTargetPath string) (func(), error) {
+	t.mapLock.Lock()
+
+	if t.mutexes == nil {
+		t.mutexes = map[string]chan struct{}{}
+	}
+
+	mutex, found := t.mutexes[cleanTargetPath]
+	if !found {
+		mutex = make(chan struct{}, 1)
+		t.mutexes[cleanTargetPath] = mutex
+	}
+
+	t.mapLock.Unlock()
+
+	select {
+	case mutex <- struct{}{}:
+		return func() { <-mutex }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// lockTarget serializes mount and unmount of the same target path. Kubelet runs every call in a separate driver
+// process, so the lock is a file lock, taken after an in-process mutex for calls within the same process. The
+// returned function releases both
+func (m *Mounter) lockTarget(ctx context.Context, targetPath string) (func(), error) {
+	cleanTargetPath := filepath.Clean(targetPath)
+
+	unlockMutex, err := m.targetMutexes.lock(ctx, cleanTargetPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to lock target %s: %s", cleanTargetPath, err)
+	}
+
+	unlockFile, err := lockTargetFile(ctx, cleanTargetPath)
+	if err != nil {
+		unlockMutex()
+		return nil, err
+	}
+
+	return func() {
+		unlockFile()
+		unlockMutex()
+	}, nil
+}
+
+func lockTargetFile(ctx context.Context, cleanTargetPath string) (func(), error) {
+	if err := os.MkdirAll(targetLocksDir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create locks directory: %s", explainCreateError(targetLocksDir, err, ""))
+	}
+
+	lockFilePath := path.Join(targetLocksDir, sanitizePath(cleanTargetPath)+".lock")
+
+	journal.Debug("Acquiring target lock", "target", cleanTargetPath, "lockFilePath", lockFilePath)
+
+	unlockFile, err := lockFile(ctx, lockFilePath, syscall.LOCK_EX)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to lock target %s: %s", cleanTargetPath, err)
+	}
+
+	journal.Debug("Acquired target lock", "target", cleanTargetPath)
+
+	return func() {
+		unlockFile()
+
+		journal.Debug("Released target lock", "target", cleanTargetPath)
+	}, nil
+}
+
+// lockReap takes the reap lock, which mounts hold shared from creating their fuse container until it mounted, and
+// the reaper holds exclusively, so that a container that is yet to mount isn't taken for an orphan
+func lockReap(ctx context.Context, exclusive bool) (func(), error) {
+	if err := os.MkdirAll(targetLocksDir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create locks directory: %s", explainCreateError(targetLocksDir, err, ""))
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	journal.Debug("Acquiring reap lock", "exclusive", exclusive)
+
+	unlockFile, err := lockFile(ctx, path.Join(targetLocksDir, reapLockFileName), how)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to take reap lock: %s", err)
+	}
+
+	return unlockFile, nil
+}
+
+// lockFile takes a file lock (syscall.LOCK_EX or syscall.LOCK_SH), polling until it's taken or the context is
+// done. The returned function releases it
+func lockFile(ctx context.Context, lockFilePath string, how int) (func(), error) {
+	file, err := os.OpenFile(lockFilePath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open lock file %s: %s", lockFilePath, err)
+	}
+
+	err = common.RetryFunc(ctx,
+		targetLockAttempts,
+		targetLockPollInterval,
+		func(attempt int) (bool, error) {
+			if err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB); err != nil {
+				return err == syscall.EWOULDBLOCK, err
+			}
+
+			return false, nil
+		})
+
+	if err != nil {
+		file.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN) // nolint: errcheck
+		file.Close()                                   // nolint: errcheck
+	}, nil
+}
@@ -0,0 +1,209 @@
+package flex
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/cri"
+)
+
+func TestLockFileSerializesInterleavedMountAndUnmount(t *testing.T) {
+	lockFilePath := filepath.Join(t.TempDir(), "target.lock")
+
+	var (
+		stateLock sync.Mutex
+		mounted   bool
+		lastOp    string
+		holders   int32
+	)
+
+	// an operation reads the target's state, then writes it after a while, as mount and unmount check the mount
+	// table and then change it
+	operate := func(op string) {
+		unlock, err := lockFile(context.Background(), lockFilePath, syscall.LOCK_EX)
+		if err != nil {
+			t.Errorf("Failed to lock: %s", err)
+			return
+		}
+
+		defer unlock()
+
+		if atomic.AddInt32(&holders, 1) != 1 {
+			t.Error("Expected a single holder of the lock")
+		}
+
+		defer atomic.AddInt32(&holders, -1)
+
+		stateLock.Lock()
+		wasMounted := mounted
+		stateLock.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		stateLock.Lock()
+		defer stateLock.Unlock()
+
+		if op == eventTypeMount && wasMounted || op == eventTypeUnmount && !wasMounted {
+			lastOp = op
+			return
+		}
+
+		mounted = op == eventTypeMount
+		lastOp = op
+	}
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		op := eventTypeMount
+		if i%2 == 1 {
+			op = eventTypeUnmount
+		}
+
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			operate(op)
+		}()
+	}
+
+	waitGroup.Wait()
+
+	if mounted != (lastOp == eventTypeMount) {
+		t.Fatalf("Expected the target's state to be that of the last operation (%s), got mounted %t", lastOp, mounted)
+	}
+}
+
+func TestLockFileSharedAndExclusive(t *testing.T) {
+	lockFilePath := filepath.Join(t.TempDir(), "reap.lock")
+
+	unlockShared, err := lockFile(context.Background(), lockFilePath, syscall.LOCK_SH)
+	if err != nil {
+		t.Fatalf("Failed to take shared lock: %s", err)
+	}
+
+	unlockOtherShared, err := lockFile(context.Background(), lockFilePath, syscall.LOCK_SH)
+	if err != nil {
+		t.Fatalf("Expected shared locks to be taken together: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	if _, err := lockFile(ctx, lockFilePath, syscall.LOCK_EX); err == nil {
+		t.Fatal("Expected the exclusive lock to wait for the shared locks")
+	}
+
+	unlockShared()
+	unlockOtherShared()
+
+	unlockExclusive, err := lockFile(context.Background(), lockFilePath, syscall.LOCK_EX)
+	if err != nil {
+		t.Fatalf("Failed to take exclusive lock: %s", err)
+	}
+
+	unlockExclusive()
+}
+
+func TestLockTargetSerializesContainerState(t *testing.T) {
+	mounter, criInstance := newFakeCRIMounter(t, &Config{})
+	containerName, _ := mounter.getContainerName(fakeTargetPath, nil)
+
+	var (
+		stateLock sync.Mutex
+		lastOp    string
+	)
+
+	// a mount removes any existing container and creates it anew, which fails on a name in use if another mount
+	// created it in between
+	operate := func(op string) {
+		unlockTarget, err := mounter.lockTarget(context.Background(), fakeTargetPath+"/")
+		if err != nil {
+			t.Errorf("Failed to lock target: %s", err)
+			return
+		}
+
+		defer unlockTarget()
+
+		if err := mounter.removeV3IOFUSEContainer(criInstance, fakeTargetPath); err != nil {
+			t.Errorf("Failed to remove container: %s", err)
+			return
+		}
+
+		if op == eventTypeMount {
+			time.Sleep(time.Millisecond)
+
+			if err := criInstance.CreateContainer("image", containerName, fakeTargetPath, nil,
+				cri.ContainerOptions{}); err != nil {
+				t.Errorf("Failed to create container: %s", err)
+			}
+		}
+
+		stateLock.Lock()
+		lastOp = op
+		stateLock.Unlock()
+	}
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		op := eventTypeMount
+		if i%3 == 2 {
+			op = eventTypeUnmount
+		}
+
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			operate(op)
+		}()
+	}
+
+	waitGroup.Wait()
+
+	status, _ := criInstance.ContainerStatus(containerName)
+	if exists := status.State != cri.ContainerStateNotFound; exists != (lastOp == eventTypeMount) {
+		t.Fatalf("Expected the container state to be that of the last operation (%s), got %s", lastOp, status.State)
+	}
+}
+
+func TestLockTargetPerPath(t *testing.T) {
+	mounter, _ := newFakeCRIMounter(t, &Config{})
+
+	unlockTarget, err := mounter.lockTarget(context.Background(), "/pods/a/volumes/v3io")
+	if err != nil {
+		t.Fatalf("Failed to lock target: %s", err)
+	}
+
+	lockWithTimeout := func(targetPath string) (func(), error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		return mounter.lockTarget(ctx, targetPath)
+	}
+
+	// another target isn't blocked by the held lock
+	unlockOtherTarget, err := lockWithTimeout("/pods/b/volumes/v3io")
+	if err != nil {
+		t.Fatalf("Expected another target to be locked, got %s", err)
+	}
+
+	unlockOtherTarget()
+
+	// the same target, even spelled differently, is
+	if _, err := lockWithTimeout("/pods/a/volumes/../volumes/v3io"); err == nil {
+		t.Fatal("Expected the held target to stay locked")
+	}
+
+	unlockTarget()
+
+	unlockTarget, err = lockWithTimeout("/pods/a/volumes/v3io")
+	if err != nil {
+		t.Fatalf("Expected the released target to be locked, got %s", err)
+	}
+
+	unlockTarget()
+}
@@ -1,190 +1,1190 @@
 package flex
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/v3io/flex-fuse/pkg/cri"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/v3io/flex-fuse/pkg/common"
 	"github.com/v3io/flex-fuse/pkg/journal"
 )
 
+const (
+	defaultFuseCommand      = "/fuse/mounter.sh"
+	fuseMountPoint          = "/fuse_mount"
+	removeBusyAttempts      = 5
+	removeBusyRetryInterval = 200 * time.Millisecond
+	lazyUnmountPollInterval = 250 * time.Millisecond
+	failureLogTailLines     = 20
+
+	defaultLazyUnmountEscalationWindow = 3 * time.Second
+	defaultUnmountTimeout              = 7 * time.Second
+	defaultUnmountPollInterval         = time.Second
+)
+
+// the runtime paths are variables so tests can point runtime detection at fakes
+var (
+	dockerBinaryPath     = "/usr/bin/docker"
+	dockerSocketPath     = "/var/run/docker.sock"
+	crictlBinaryPath     = "/usr/bin/crictl"
+	crioSocketPath       = "/var/run/crio/crio.sock"
+	containerdSocketPath = "/run/containerd/containerd.sock"
+)
+
+const defaultCRINamespace = "v3io"
+
+const oomKilledHint = "consider raising the fuse container's memory limit"
+
+// createContainerRetryInterval is the first wait before retrying to create a fuse container, doubled on each retry.
+// It's a variable so that tests can retry without waiting it out
+var createContainerRetryInterval = 500 * time.Millisecond
+
+// mountPollIntervals are the waits between checks of whether a new fuse container is serving its mount
+var mountPollIntervals = []time.Duration{
+	1 * time.Second,
+	2 * time.Second,
+	4 * time.Second,
+	2 * time.Second,
+	1 * time.Second,
+}
+
+const (
+	podNameLabel      = "io.iguazio.v3io-fuse/pod-name"
+	podNamespaceLabel = "io.iguazio.v3io-fuse/pod-namespace"
+	podUIDLabel       = "io.iguazio.v3io-fuse/pod-uid"
+	volumeNameLabel   = "io.iguazio.v3io-fuse/volume-name"
+	fuseArgsLabel     = "io.iguazio.v3io-fuse/args"
+
+	driverVersionLabel = "io.iguazio.v3io-fuse/driver-version"
+)
+
+var hostnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?)*$`)
+
+// ErrInvalidMountRequest is returned for a mount that retrying won't fix, as the spec or the configuration it's
+// mounted with is invalid
+var ErrInvalidMountRequest = errors.New("invalid mount request")
+
 type Mounter struct {
-	Config *Config
+	Config            *Config
+	readinessStrategy ReadinessStrategy
+	filesystem        Filesystem
+	targetMutexes     targetMutexes
+
+	// dataURLsResolver resolves clusters' data URLs, from the config's clusters unless set
+	dataURLsResolver DataURLsResolver
+
+	// criFactory creates the CRI fuse containers run in, from the config and the node's runtimes unless set
+	criFactory func() (cri.CRI, error)
+}
+
+func NewMounter() (*Mounter, error) {
+	journal.Debug("Creating configuration")
+	config, err := NewConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	journal.SetOutput(journal.OutputConfig{
+		Output:         config.LogOutput,
+		FilePath:       config.LogFilePath,
+		FileMaxSizeMB:  config.LogFileMaxSizeMB,
+		FileMaxBackups: config.LogFileMaxBackups,
+		SyslogTag:      config.SyslogTag,
+		SyslogFacility: config.SyslogFacility,
+	})
+
+	if config.DisableDebugLogRateLimit {
+		journal.SetDebugRateLimit(0, 0)
+	} else if config.DebugLogRatePerSecond > 0 || config.DebugLogBurst > 0 {
+		journal.SetDebugRateLimit(config.getDebugLogRatePerSecond(), config.getDebugLogBurst())
+	}
+
+	mounter := &Mounter{
+		Config:     config,
+		filesystem: &osFilesystem{},
+	}
+
+	mounter.readinessStrategy, err = newReadinessStrategy(config.ReadinessStrategy, mounter.createCRI)
+	if err != nil {
+		return nil, err
+	}
+
+	return mounter, nil
+}
+
+func (m *Mounter) Mount(targetPath string, specString string) *Response {
+	if m.Config.isDryRun() {
+		return m.planMount(targetPath, specString)
+	}
+
+	startTime := time.Now()
+
+	response := m.mount(targetPath, specString)
+	m.observeLatency(eventTypeMount, response, time.Since(startTime))
+
+	return response
+}
+
+func (m *Mounter) mount(targetPath string, specString string) *Response {
+	journal.Debug("Mounting")
+
+	parsedSpec, err := parseSpec(specString)
+	if err != nil {
+		return NewPermanentFailResponse("Failed to unmarshal spec", err)
+	}
+
+	spec := *parsedSpec
+
+	if err := spec.validate(m.Config.Type == "link"); err != nil {
+		return m.newSpecFailResponse("Mount failed validation", err)
+	}
+
+	if err := m.Config.checkFuseConf(); err != nil {
+		return NewPermanentFailResponse("Access mode isn't permitted by fuse.conf", err)
+	}
+
+	// in link mode the target is replaced by a symlink of our own, so it's never resolved
+	if m.Config.Type != "link" {
+		resolvedTargetPath, err := m.resolveTargetPath(targetPath)
+		if err != nil {
+			if errors.Is(err, ErrTargetOutsideKubeletRoot) {
+				return NewPermanentFailResponse("Invalid target", err)
+			}
+
+			return NewFailResponse("Failed to resolve target", err)
+		}
+
+		targetPath = resolvedTargetPath
+	}
+
+	specHash, err := getSpecHash(&spec)
+	if err != nil {
+		return NewFailResponse("Failed to hash spec", err)
+	}
+
+	// a repeated call is answered without waiting for the target's lock. It's checked again once the target is
+	// locked, as a mount of the target may be in flight
+	if response := m.getRecentMountResult(targetPath, specHash); response != nil {
+		return response
+	}
+
+	ctx, cancel := m.newMountContext()
+	defer cancel()
+
+	// the target's state is only inspected once the lock is held, since an unmount of the same target
+	// may have been in flight until now
+	unlockTarget, err := m.lockTarget(ctx, targetPath)
+	if err != nil {
+		return NewFailResponse("Failed to lock target", err)
+	}
+
+	defer unlockTarget()
+
+	if response := m.getRecentMountResult(targetPath, specHash); response != nil {
+		return response
+	}
+
+	response := m.mountTarget(ctx, spec, targetPath)
+	m.saveRecentMountResult(targetPath, specHash, response)
+	m.sendEvent(eventTypeMount, targetPath, &spec, response)
+
+	return response
+}
+
+// mountTarget mounts a resolved and locked target. The fuse image is only pulled once the target is known to need a
+// container, so that retries of an existing mount neither reach the runtime nor the registry
+func (m *Mounter) mountTarget(ctx context.Context, spec Spec, targetPath string) *Response {
+	if m.Config.Type == "link" {
+		return m.mountAsLink(ctx, &spec, targetPath)
+	}
+
+	if m.isMountPointConfirmed(targetPath) {
+		if response := m.handleExistingMount(targetPath, &spec); response != nil {
+			return response
+		}
+	}
+
+	if m.Config.MaxMountsPerNode > 0 {
+		if response := m.checkNodeMountLimit(); response != nil {
+			return response
+		}
+	}
+
+	if m.Config.RejectNonEmptyTarget {
+		if response := m.checkTargetEmpty(targetPath); response != nil {
+			return response
+		}
+	}
+
+	if m.Config.RequireTargetMode != "" {
+		if err := m.checkTargetMode(targetPath); err != nil {
+			return NewPermanentFailResponse("Target doesn't satisfy the required mode", err)
+		}
+	}
+
+	ctx, cancel, imageDigest, err := m.pullMountImage(ctx, &spec)
+	if err != nil {
+		return NewFailResponse("Failed to pull v3io FUSE image", err)
+	}
+
+	defer cancel()
+
+	// the container may be named by the spec (ContainerNameStrategyLabels), in which case removing it later on
+	// needs the spec, so it's recorded before the container is created
+	if err := m.saveMountSpec(targetPath, &spec, imageDigest); err != nil {
+		return NewFailResponse("Failed to save mount spec", err)
+	}
+
+	if m.Config.ShareSubPathMounts && spec.Container != "" {
+		if err := m.mountSharedSubPath(ctx, &spec, targetPath); err != nil {
+			removeMountSpec(targetPath)
+			return newMountFailResponse("Failed to mount shared sub path", err)
+		}
+	} else if err := m.createV3IOFUSEContainer(ctx, &spec, targetPath); err != nil {
+		removeMountSpec(targetPath)
+		return newMountFailResponse("Failed to create v3io FUSE container", err)
+	}
+
+	if err := checkBudget(ctx, "creating folders"); err != nil {
+		return NewFailResponse("Failed to create folders", err)
+	}
+
+	warnings, err := m.createDirs(spec, targetPath)
+	if err != nil {
+
+		// the mount is useless without its folders, so don't leave it behind
+		m.rollbackMount(targetPath)
+		removeMountSpec(targetPath)
+
+		return newMountFailResponse("Failed to create folders", err)
+	}
+
+	if len(warnings) > 0 {
+		response := NewSuccessResponse(fmt.Sprintf("Successfully mounted, failed to create %d folders", len(warnings)))
+		response.Warnings = warnings
+
+		return response
+	}
+
+	return NewSuccessResponse("Successfully mounted")
+}
+
+// createDirs creates the spec's folders in the mount. With DirCreateFailureModeWarn, folders that fail to be
+// created are returned as warnings rather than failing the mount
+func (m *Mounter) createDirs(spec Spec, targetPath string) ([]string, error) {
+	var dirsToCreate []DirToCreate
+	if err := json.Unmarshal([]byte(spec.DirsToCreate), &dirsToCreate); err != nil {
+		if spec.DirsToCreate != "" {
+			return nil, fmt.Errorf("%w: failed to parse dirsToCreate [%s]: %s",
+				ErrInvalidMountRequest,
+				spec.DirsToCreate,
+				err.Error())
+		}
+		return nil, nil
+	}
+
+	var warnings []string
+	for _, dir := range dirsToCreate {
+		if err := m.createDir(dir, targetPath); err != nil {
+			if m.Config.getDirCreateFailureMode() == DirCreateFailureModeFail {
+				return nil, err
+			}
+
+			journal.Warn("Failed to create folder", "name", dir.Name, "err", err.Error())
+			warnings = append(warnings, err.Error())
+		}
+	}
+	return warnings, nil
+}
+
+func (m *Mounter) createDir(dir DirToCreate, targetPath string) error {
+	if strings.HasPrefix(dir.Name, "/") {
+		return fmt.Errorf("%w: only creation of relative path is supported (%s)", ErrInvalidMountRequest, dir.Name)
+	}
+	dirToCreate := fmt.Sprintf("%s/%s", targetPath, dir.Name)
+
+	_, err := m.filesystem.Stat(dirToCreate)
+	if err == nil {
+		journal.Debug(fmt.Sprintf("Folder already exists: %s", dirToCreate))
+		return nil
+	}
+
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("Stat failed for folder [%s]: %s", dirToCreate, err)
+	}
+
+	permissions := dir.Permissions
+	if permissions == 0 && m.Config.InheritDirPermissions {
+		permissions, err = m.inheritedPermissions(dirToCreate)
+		if err != nil {
+			return fmt.Errorf("Failed to inherit permissions for folder [%s]: %s", dirToCreate, err)
+		}
+
+		journal.Debug("Inherited folder permissions", "path", dirToCreate, "permissions", permissions)
+	}
+
+	if err := m.filesystem.MkdirAll(dirToCreate, permissions); err != nil {
+		return fmt.Errorf("Failed to create folder (path: %s, filemode: %o): %s",
+			dir.Name,
+			permissions,
+			explainCreateError(dirToCreate, err, ""))
+	}
+	journal.Debug(fmt.Sprintf("Created folder: %s", dirToCreate))
+
+	return nil
+}
+
+// checkTargetEmpty fails the mount if the target has data the mount would hide
+func (m *Mounter) checkTargetEmpty(targetPath string) *Response {
+	empty, err := m.isEmptyDir(targetPath)
+	if err != nil {
+		return NewFailResponse(fmt.Sprintf("Failed to check whether target %s is empty", targetPath), err)
+	}
+
+	if !empty {
+		return NewFailResponse(fmt.Sprintf("Target %s is not empty, refusing to mount over its data", targetPath), nil)
+	}
+
+	return nil
+}
+
+// checkNodeMountLimit fails the mount if the node already has MaxMountsPerNode v3io fuse mounts, so the pod is
+// rescheduled rather than overwhelm the node
+func (m *Mounter) checkNodeMountLimit() *Response {
+	fuseMounts, err := m.countV3IOFuseMounts()
+	if err != nil {
+		return NewFailResponse("Failed to count node mounts", err)
+	}
+
+	if fuseMounts >= m.Config.MaxMountsPerNode {
+		return NewFailResponse(fmt.Sprintf("Node mount limit reached (%d of %d mounts)",
+			fuseMounts,
+			m.Config.MaxMountsPerNode), nil)
+	}
+
+	return nil
+}
+
+// countV3IOFuseMounts returns how many fuse mounts serve the node's v3io volumes. A shared or link mode mount is
+// bind mounted to its targets, which share its device in the mount table, so it's counted once. Without the
+// mount table's devices, every v3io mount point is counted
+func (m *Mounter) countV3IOFuseMounts() (int, error) {
+	mountInfoFile, err := os.Open(mountInfoPath)
+	if err != nil {
+		mountPoints, err := m.listV3IOMounts()
+		return len(mountPoints), err
+	}
+
+	defer mountInfoFile.Close() // nolint: errcheck
+
+	entries, err := readMountInfoEntries(mountInfoFile)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to read mount info: %s", err)
+	}
+
+	devices := map[string]bool{}
+	for _, entry := range entries {
+		if m.isV3IOMountPoint(entry.mountPoint) {
+			devices[entry.device] = true
+		}
+	}
+
+	return len(devices), nil
+}
+
+// checkTargetMode verifies that the target's permission bits are exactly RequireTargetMode
+func (m *Mounter) checkTargetMode(targetPath string) error {
+	requiredTargetMode, err := m.Config.getRequiredTargetMode()
+	if err != nil {
+		return err
+	}
+
+	targetInfo, err := m.filesystem.Stat(targetPath)
+	if err != nil {
+		return fmt.Errorf("Failed to stat target %s: %s", targetPath, err)
+	}
+
+	if targetInfo.Mode().Perm() != requiredTargetMode {
+		return fmt.Errorf("Target %s has mode %#o, required %#o",
+			targetPath,
+			targetInfo.Mode().Perm(),
+			requiredTargetMode)
+	}
+
+	return nil
+}
+
+// inheritedPermissions returns the permission bits of the closest existing ancestor of path
+func (m *Mounter) inheritedPermissions(path string) (os.FileMode, error) {
+	for parent := filepath.Dir(path); ; parent = filepath.Dir(parent) {
+		info, err := m.filesystem.Stat(parent)
+		if err == nil {
+			return info.Mode() & os.ModePerm, nil
+		}
+
+		if !os.IsNotExist(err) || parent == filepath.Dir(parent) {
+			return 0, err
+		}
+	}
+}
+
+func (m *Mounter) Unmount(targetPath string) *Response {
+	if m.Config.isDryRun() {
+		return m.planUnmount(targetPath)
+	}
+
+	startTime := time.Now()
+
+	response := m.unmount(targetPath)
+	m.observeLatency(eventTypeUnmount, response, time.Since(startTime))
+
+	return response
+}
+
+func (m *Mounter) unmount(targetPath string) *Response {
+	journal.Debug("Unmounting", "targetPath", targetPath)
+
+	if m.Config.Type != "link" {
+		resolvedTargetPath, err := m.resolveTargetPath(targetPath)
+		if err != nil {
+			if errors.Is(err, ErrTargetOutsideKubeletRoot) {
+				return NewPermanentFailResponse("Invalid target", err)
+			}
+
+			return NewFailResponse("Failed to resolve target", err)
+		}
+
+		targetPath = resolvedTargetPath
+	}
+
+	// the target's state is only inspected once the lock is held, since a mount of the same target
+	// may have been in flight until now
+	unlockTarget, err := m.lockTarget(context.Background(), targetPath)
+	if err != nil {
+		return NewFailResponse("Failed to lock target", err)
+	}
+
+	defer unlockTarget()
+
+	// the spec is only needed for the event, which goes out without it if it can't be loaded
+	var mountedSpec *Spec
+	if m.Config.EventWebhookURL != "" {
+		mountedSpec, _ = loadMountSpec(targetPath)
+	}
+
+	response := m.unmountTarget(targetPath)
+	if response.Status == "Success" {
+		removeMountSpec(targetPath)
+		removeStagedV3ioConfig(targetPath)
+		removeRecentMountResult(targetPath)
+	}
+
+	m.sendEvent(eventTypeUnmount, targetPath, mountedSpec, response)
+
+	return response
+}
+
+func (m *Mounter) unmountTarget(targetPath string) *Response {
+	if m.Config.Type == "link" {
+		return m.unmountAsLink(targetPath)
+	}
+
+	if sharedPath, found := getSharedMountOfTarget(targetPath); found {
+		return m.unmountSharedSubPath(targetPath, sharedPath)
+	}
+
+	if !m.isMountPointConfirmed(targetPath) {
+		return NewSuccessResponse(fmt.Sprintf("%s Not a mountpoint, nothing to do", targetPath))
+	}
+
+	return m.unmountFUSE(targetPath)
+}
+
+// rollbackMount unmounts a target whose mount failed after the fuse mount itself was created
+func (m *Mounter) rollbackMount(targetPath string) {
+	journal.Info("Rolling back mount", "target", targetPath)
+
+	var response *Response
+	if sharedPath, found := getSharedMountOfTarget(targetPath); found {
+		response = m.unmountSharedSubPath(targetPath, sharedPath)
+	} else {
+		response = m.unmountFUSE(targetPath)
+	}
+
+	if response.Status != "Success" {
+		journal.Warn("Failed to roll back mount", "target", targetPath, "message", response.Message)
+	}
+}
+
+// unmountFUSE unmounts a target and removes its fuse container, in the configured UnmountOrder. By default the
+// mount goes first, which terminates the fuse process gracefully, as removing the container of a live mount can
+// leave it dead
+func (m *Mounter) unmountFUSE(targetPath string) *Response {
+	return m.unmountFUSEWith(targetPath, m.umountFUSE)
 }
 
-func NewMounter() (*Mounter, error) {
-	journal.Debug("Creating configuration")
-	config, err := NewConfig()
+// unmountFUSEWith is unmountFUSE with the way the target is unmounted passed in
+func (m *Mounter) unmountFUSEWith(targetPath string, umount func(string) *Response) *Response {
+	criInstance, err := m.createCRI()
+	if err != nil {
+		return NewFailResponse("Failed to create CRI", err)
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	unmountOrder := m.Config.getUnmountOrder()
+
+	if unmountOrder == UnmountOrderContainerFirst {
+		if err := m.removeV3IOFUSEContainer(criInstance, targetPath); err != nil {
+			return NewFailResponse("Failed to remove v3io FUSE container", err)
+		}
+	}
+
+	if response := umount(targetPath); response != nil {
+		return response
+	}
+
+	if unmountOrder == UnmountOrderUmountFirst {
+		if err := m.removeV3IOFUSEContainer(criInstance, targetPath); err != nil {
+			return NewFailResponse("Failed to remove v3io FUSE container", err)
+		}
+	}
+
+	return m.completeUnmount(targetPath)
+}
+
+// umountFUSE runs umount on a target and waits for it to leave the mount table, escalating to a lazy umount if it
+// doesn't in time. It returns nil once the target is unmounted, or a fail response
+func (m *Mounter) umountFUSE(targetPath string) *Response {
+	return m.umountTarget(targetPath, runUmount, isMountPoint)
+}
+
+// umountTarget is umountFUSE with the way umount runs and the mount table is checked passed in
+func (m *Mounter) umountTarget(targetPath string,
+	umount func(args ...string) error,
+	isMounted func(string) bool) *Response {
+	journal.Info("Unmounting target path with umount", "target", targetPath)
+
+	if err := umount(targetPath); err != nil {
+		return NewFailResponse("Failed to call unmount", err)
+	}
+
+	pollInterval := m.Config.getUnmountPollInterval()
+	unmountStartTime := time.Now()
+	attempts := 0
+
+	for deadline := time.Now().Add(m.Config.getUnmountTimeout()); time.Now().Before(deadline); {
+		attempts++
+
+		if !isMounted(targetPath) {
+			return nil
+		}
+
+		time.Sleep(pollInterval)
+	}
+
+	// umount ran but the mount is still in the mount table, so detach it lazily, and then forcibly if allowed,
+	// giving each another, shorter window to go away
+	modes := []string{"lazy"}
+	unmounted, escalationAttempts := m.escalateUmount(targetPath, "lazy", "-l", umount, isMounted)
+	attempts += escalationAttempts
+
+	if !unmounted && m.Config.ForceUnmount {
+		modes = append(modes, "force")
+		unmounted, escalationAttempts = m.escalateUmount(targetPath, "force", "-f", umount, isMounted)
+		attempts += escalationAttempts
+	}
+
+	if unmounted {
+		return nil
+	}
+
+	return NewFailResponse(fmt.Sprintf("Failed to umount %s due to timeout (waited %s over %d attempts, "+
+		"last state: still mounted after %s umount)",
+		targetPath,
+		time.Since(unmountStartTime).Round(time.Millisecond),
+		attempts,
+		strings.Join(modes, " and ")), nil)
+}
+
+// escalateUmount runs umount with the given flag on a target still in the mount table, returning whether it left
+// the mount table within the escalation window and how many times the mount table was checked
+func (m *Mounter) escalateUmount(targetPath string,
+	mode string,
+	flag string,
+	umount func(args ...string) error,
+	isMounted func(string) bool) (bool, int) {
+	escalationWindow := m.Config.getLazyUnmountEscalationWindow()
+
+	journal.Warn("Mount still present after umount, escalating",
+		"target", targetPath,
+		"mode", mode,
+		"window", escalationWindow)
+
+	if err := umount(flag, targetPath); err != nil {
+		journal.Warn("Escalated umount failed",
+			"target", targetPath,
+			"mode", mode,
+			"err", err.Error())
+	}
+
+	attempts := 0
+
+	for deadline := time.Now().Add(escalationWindow); time.Now().Before(deadline); {
+		attempts++
+
+		if !isMounted(targetPath) {
+			journal.Info("Unmounted target by escalating", "target", targetPath, "mode", mode)
+			return true, attempts
+		}
+
+		time.Sleep(lazyUnmountPollInterval)
+	}
+
+	return !isMounted(targetPath), attempts + 1
+}
+
+// runUmount runs umount with the given arguments. A plain umount is only started, as its result is the mount
+// table polled afterwards, while an escalated one is waited for
+func runUmount(args ...string) error {
+	umountCommand := exec.Command("umount", args...)
+	if len(args) == 1 {
+		return umountCommand.Start()
+	}
+
+	if output, err := umountCommand.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// completeUnmount removes a target once it's unmounted
+func (m *Mounter) completeUnmount(targetPath string) *Response {
+	removeStagedV3ioConfig(targetPath)
+
+	if err := m.removeMountDirectory(targetPath); err != nil {
+		return NewFailResponse(fmt.Sprintf("Could not remove directory %s", targetPath), err)
+	}
+
+	return NewSuccessResponse("Successfully unmounted")
+}
+
+// removeMountDirectory removes an unmounted target. Right after umount the directory may still be briefly busy,
+// so EBUSY is retried a bounded number of times. A target kubelet already removed is the desired end state, so
+// it isn't an error
+func (m *Mounter) removeMountDirectory(targetPath string) error {
+	if m.Config.RemoveSettleMilliseconds > 0 {
+		time.Sleep(time.Duration(m.Config.RemoveSettleMilliseconds) * time.Millisecond)
+	}
+
+	return common.RetryFunc(context.Background(),
+		removeBusyAttempts,
+		removeBusyRetryInterval,
+		func(attempt int) (bool, error) {
+			err := m.filesystem.Remove(targetPath)
+			if err != nil && errors.Is(err, syscall.EBUSY) {
+				journal.Debug("Directory is busy, retrying removal", "target", targetPath, "attempt", attempt)
+				return true, err
+			}
+
+			if err != nil && os.IsNotExist(err) {
+				journal.Debug("Directory already removed", "target", targetPath)
+				return false, nil
+			}
+
+			return false, err
+		})
+}
+
+// pullImage pulls a fuse image as the image pull policy requires, returning its digest. Failing to get the
+// digest only loses drift detection, so it's returned empty rather than failing
+func (m *Mounter) pullImage(image string) (string, error) {
+	criInstance, err := m.createCRI()
+	if err != nil {
+		return "", err
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	if err := criInstance.PullImage(image, cri.PullOptions{
+		Timeout:                m.Config.getImagePullTimeout(),
+		Policy:                 m.Config.ImagePullPolicy,
+		RegistryAuthConfigPath: m.Config.RegistryAuthConfigPath,
+	}); err != nil {
+		return "", err
+	}
+
+	imageDigest, err := criInstance.ImageDigest(image)
+	if err != nil {
+		journal.Warn("Failed to get image digest", "image", image, "err", err.Error())
+		return "", nil
+	}
+
+	return imageDigest, nil
+}
+
+// pullMountImage pulls the fuse image of a mount that's about to create its container. A cold node's pull may take
+// longer than the whole mount is allowed to, so it's bounded by its own timeout instead, and the returned context
+// has the mount's budget pushed back by the time the pull took
+func (m *Mounter) pullMountImage(ctx context.Context,
+	spec *Spec) (context.Context, context.CancelFunc, string, error) {
+	pullStartTime := time.Now()
+
+	imageDigest, err := m.pullImage(m.Config.getClusterImage(spec.GetClusterName()))
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	ctx, cancel := excludeFromBudget(ctx, time.Since(pullStartTime))
+
+	return ctx, cancel, imageDigest, nil
+}
+
+func (m *Mounter) createV3IOFUSEContainer(ctx context.Context, spec *Spec, targetPath string) (err error) {
+	journal.Info("Creating v3io-fuse container", "target", targetPath)
+
+	if err := checkBudget(ctx, "creating container"); err != nil {
+		return err
+	}
+
+	unlockReap, err := lockReap(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	defer unlockReap()
+
+	criInstance, err := m.createCRI()
+	if err != nil {
+		return err
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	dataUrls, err := m.getDataURLs(spec.GetClusterName())
+	if err != nil {
+		return fmt.Errorf("Could not get cluster data urls: %s", err.Error())
+	}
+
+	if err := validateDataURLs(spec.GetClusterName(), dataUrls); err != nil {
+		return err
+	}
+
+	image := m.Config.getClusterImage(spec.GetClusterName())
+
+	if m.Config.PreflightBackendCheck {
+		if err := m.checkBackendReachable(dataUrls); err != nil {
+			return err
+		}
+	}
+
+	connectionStrings, err := formatConnectionStrings(m.Config.ConnectionStringTemplate, dataUrls)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("Failed to format connection strings: %s", err)
 	}
 
-	return &Mounter{
-		Config: config,
-	}, nil
-}
+	containerName, err := m.getContainerName(targetPath, spec)
+	if err != nil {
+		return fmt.Errorf("Failed to get container name: %s", err.Error())
+	}
 
-func (m *Mounter) Mount(targetPath string, specString string) *Response {
-	journal.Debug("Mounting")
+	// Ensure the container doesn't already exist
+	// It's ok if the command runs but exits with a failure, this is in the case the container doesn't exist.
+	criInstance.RemoveContainer(containerName) // nolint: errcheck
 
-	spec := Spec{}
-	if err := json.Unmarshal([]byte(specString), &spec); err != nil {
-		return NewFailResponse("Failed to unmarshal spec", err)
+	v3ioConfigPath, err := m.stageV3ioConfig(targetPath)
+	if err != nil {
+		return err
 	}
 
-	if err := spec.validate(); err != nil {
-		return NewFailResponse("Mount failed validation", err)
+	defer func() {
+		if err != nil {
+			removeStagedV3ioConfig(targetPath)
+		}
+	}()
+
+	// Create the new container
+	args, err := m.getFuseArgs(spec, connectionStrings, v3ioConfigPath)
+	if err != nil {
+		return fmt.Errorf("%w: invalid fuse mount options: %s", ErrInvalidMountRequest, err)
 	}
 
-	if m.Config.Type == "link" {
-		return m.mountAsLink(&spec, targetPath)
+	containerOptions, err := m.getContainerOptions(spec, targetPath)
+	if err != nil {
+		return err
 	}
 
-	if isMountPoint(targetPath) {
-		return NewSuccessResponse(fmt.Sprintf("Already mounted: %s", targetPath))
+	// record how the mount was invoked for auditing, without the session key
+	redactedArgs, err := json.Marshal(common.RedactSecrets(args))
+	if err != nil {
+		return fmt.Errorf("Failed to marshal fuse args: %s", err)
 	}
 
-	if err := m.createV3IOFUSEContainer(&spec, targetPath); err != nil {
-		return NewFailResponse("Failed to create v3io FUSE container", err)
+	if containerOptions.Labels == nil {
+		containerOptions.Labels = map[string]string{}
 	}
 
-	if err := m.createDirs(spec, targetPath); err != nil {
-		return NewFailResponse("Failed to create folders", err)
+	containerOptions.Labels[fuseArgsLabel] = string(redactedArgs)
+	containerOptions.Labels[driverVersionLabel] = getDriverVersion()
+
+	if err := m.createContainerWithRetries(ctx,
+		criInstance,
+		image,
+		containerName,
+		targetPath,
+		args,
+		containerOptions); err != nil {
+		return fmt.Errorf("Failed to create container for %s: %s", targetPath, err)
 	}
 
-	return NewSuccessResponse("Successfully mounted")
+	defer func() {
+		if err != nil {
+			m.cleanupFailedContainer(criInstance, containerName)
+		}
+	}()
+
+	return m.waitForMount(ctx, criInstance, image, containerName, targetPath, spec)
 }
 
-func (m *Mounter) createDirs(spec Spec, targetPath string) error {
-	var dirsToCreate []DirToCreate
-	if err := json.Unmarshal([]byte(spec.DirsToCreate), &dirsToCreate); err != nil {
-		if spec.DirsToCreate != "" {
-			return fmt.Errorf("Failed to parse dirsToCreate [%s]: %s", spec.DirsToCreate, err.Error())
+// waitForMount waits for a new fuse container to serve its mount, failing early if the container exited for good
+func (m *Mounter) waitForMount(ctx context.Context,
+	criInstance cri.CRI,
+	image string,
+	containerName string,
+	targetPath string,
+	spec *Spec) error {
+	waitStartTime := time.Now()
+	attempts := 0
+	lastState := "not ready"
+
+	// an image without the mount point would only be found out by waiting out the readiness timeout
+	if m.Config.CheckFuseMountPoint {
+		if err := m.checkFuseMountPoint(criInstance, image, containerName); err != nil {
+			return withContainerLogs(err, criInstance, containerName, spec)
 		}
-		return nil
 	}
-	for _, dir := range dirsToCreate {
-		if strings.HasPrefix(dir.Name, "/") {
-			return fmt.Errorf("Only creation of relative path is supported (%s)", dir.Name)
+
+	for _, interval := range mountPollIntervals {
+		attempts++
+
+		ready, err := m.readinessStrategy.IsReady(targetPath, containerName)
+		if err != nil {
+			journal.Debug("Readiness check failed", "target", targetPath, "err", err.Error())
+			lastState = fmt.Sprintf("readiness check failed: %s", err)
+		} else {
+			lastState = "not ready"
 		}
-		dirToCreate := fmt.Sprintf("%s/%s", targetPath, dir.Name)
 
-		_, err := os.Stat(dirToCreate)
-		if err == nil {
-			journal.Debug(fmt.Sprintf("Folder already exists: %s", dirToCreate))
-			continue
+		if ready {
+			return nil
+		}
+
+		// a container that exited for good won't ever mount, so waiting out the backoff would only delay the failure
+		if status, err := criInstance.ContainerStatus(containerName); err == nil && m.isContainerExitFinal(status) {
+			return withContainerLogs(getContainerExitedError(targetPath, status), criInstance, containerName, spec)
 		}
 
-		if !os.IsNotExist(err) {
-			return fmt.Errorf("Stat failed for folder [%s]: %s", dirToCreate, err)
+		if err := checkBudget(ctx, "waiting for mount"); err != nil {
+			return err
 		}
 
-		if err := os.MkdirAll(dirToCreate, dir.Permissions); err != nil {
-			return fmt.Errorf("Failed to create folder (path: %s, filemode: %o): %s", dir.Name, dir.Permissions, err.Error())
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
 		}
-		journal.Debug(fmt.Sprintf("Created folder: %s", dirToCreate))
 	}
-	return nil
+
+	// a container that died explains the timeout better than the timeout itself
+	if status, err := criInstance.ContainerStatus(containerName); err == nil {
+		if err := getContainerExitedError(targetPath, status); err != nil {
+			return withContainerLogs(err, criInstance, containerName, spec)
+		}
+
+		lastState = fmt.Sprintf("%s, container %s", lastState, status.State)
+	}
+
+	timeoutErr := fmt.Errorf("Failed to mount %s due to timeout (waited %s over %d attempts, last state: %s)",
+		targetPath,
+		time.Since(waitStartTime).Round(time.Millisecond),
+		attempts,
+		lastState)
+
+	return withContainerLogs(timeoutErr, criInstance, containerName, spec)
 }
 
-func (m *Mounter) Unmount(targetPath string) *Response {
-	journal.Debug("Unmounting", "targetPath", targetPath)
+// newMountFailResponse fails a mount, permanently if the request is invalid
+func newMountFailResponse(message string, err error) *Response {
+	if errors.Is(err, ErrInvalidMountRequest) {
+		return NewPermanentFailResponse(message, err)
+	}
 
-	if m.Config.Type == "link" {
-		return m.unmountAsLink(targetPath)
+	return NewFailResponse(message, err)
+}
+
+// newSpecFailResponse fails a mount with an invalid spec, which retrying won't fix, unless the spec only lacks
+// an access key and RetryMissingAccessKey is set
+func (m *Mounter) newSpecFailResponse(message string, err error) *Response {
+	if errors.Is(err, ErrAccessKeySecretNotFound) && m.Config.RetryMissingAccessKey {
+		return NewFailResponse(message, err)
 	}
 
-	if !isMountPoint(targetPath) {
-		return NewSuccessResponse(fmt.Sprintf("%s Not a mountpoint, nothing to do", targetPath))
+	return NewPermanentFailResponse(message, err)
+}
+
+// cleanupFailedContainer removes the fuse container of a failed mount, or with KeepFailedContainers, renames it
+// aside for inspection, which also frees its name for the next mount
+func (m *Mounter) cleanupFailedContainer(criInstance cri.CRI, containerName string) {
+	if m.Config.KeepFailedContainers {
+		failedContainerName, err := keepFailedContainer(criInstance, containerName)
+		if err == nil {
+			journal.Info("Kept failed container", "containerName", failedContainerName)
+			return
+		}
+
+		journal.Warn("Failed to keep failed container, removing it", "containerName", containerName, "err", err.Error())
 	}
 
-	criInstance, err := createCRI()
+	if err := criInstance.RemoveContainer(containerName); err != nil {
+		journal.Warn("Failed to remove failed container", "containerName", containerName, "err", err.Error())
+	}
+}
+
+// keepFailedContainer renames a failed container to <name>-failed-<unix time>, so the reap command can tell its
+// age. Only a container that exited is kept, as a running one may yet mount the target
+func keepFailedContainer(criInstance cri.CRI, containerName string) (string, error) {
+	status, err := criInstance.ContainerStatus(containerName)
 	if err != nil {
-		return NewFailResponse("Failed to create CRI", err)
+		return "", err
 	}
 
-	defer criInstance.Close() // nolint: errcheck
+	if status.State != cri.ContainerStateExited {
+		return "", fmt.Errorf("Container is %s, only exited containers are kept", status.State)
+	}
+
+	failedContainerName := fmt.Sprintf("%s%s%d", containerName, failedContainerNameInfix, time.Now().Unix())
 
-	if err := m.removeV3IOFUSEContainer(criInstance, targetPath); err != nil {
-		return NewFailResponse("Failed to remove v3io FUSE container", err)
+	if err := criInstance.RenameContainer(containerName, failedContainerName); err != nil {
+		return "", err
 	}
 
-	journal.Info("Unmounting target path with umount", "target", targetPath)
+	return failedContainerName, nil
+}
 
-	umountCommand := exec.Command("umount", targetPath)
-	if err := umountCommand.Start(); err != nil {
-		return NewFailResponse("Failed to call unmount", err)
+// withContainerLogs adds the last lines of the fuse container's log to a mount failure, so it can be diagnosed
+// without access to the node. The access key is redacted from them, as the fuse process may log it
+func withContainerLogs(err error, criInstance cri.CRI, containerName string, spec *Spec) error {
+	logs, logsErr := criInstance.ContainerLogs(containerName, failureLogTailLines)
+	if logsErr != nil {
+		journal.Debug("Failed to get container logs", "containerName", containerName, "err", logsErr.Error())
+		return err
 	}
 
-	for _, interval := range []time.Duration{1, 2, 4} {
-		if !isMountPoint(targetPath) {
+	logs = strings.TrimSpace(common.RedactText(logs, spec.GetAccessKey()))
+	if logs == "" {
+		return err
+	}
 
-			// once unmounted, remove it
-			if err := os.Remove(targetPath); err != nil {
-				return NewFailResponse(fmt.Sprintf("Could not remove directory %s", targetPath), err)
-			}
+	return fmt.Errorf("%s, last %d lines of the fuse container log:\n%s", err, failureLogTailLines, logs)
+}
 
-			return NewSuccessResponse("Successfully unmounted")
-		}
+// fuseContainerRestarts returns whether the runtime may restart a fuse container that exited
+func (m *Mounter) fuseContainerRestarts() bool {
+	return m.Config.FuseRestartPolicy == cri.RestartPolicyOnFailure ||
+		m.Config.FuseRestartPolicy == cri.RestartPolicyAlways
+}
+
+// getContainerExitedError returns why a mount failed if its fuse container exited, or nil if it didn't
+func getContainerExitedError(targetPath string, status *cri.ContainerStatus) error {
+	if status.State != cri.ContainerStateExited {
+		return nil
+	}
+
+	if status.OOMKilled {
+		return fmt.Errorf("Failed to mount %s, fuse container was OOM killed (%s)", targetPath, oomKilledHint)
+	}
 
-		time.Sleep(interval * time.Second)
+	if status.ExitCode == 0 {
+		return fmt.Errorf("Failed to mount %s, fuse container exited cleanly without mounting", targetPath)
 	}
 
-	return NewFailResponse(fmt.Sprintf("Failed to umount %s due to timeout", targetPath), nil)
+	return fmt.Errorf("Failed to mount %s, fuse container exited with code %d", targetPath, status.ExitCode)
 }
 
-func (m *Mounter) createV3IOFUSEContainer(spec *Spec, targetPath string) error {
-	journal.Info("Creating v3io-fuse container", "target", targetPath)
+// isContainerExitFinal returns whether a fuse container exited for good. A container the runtime restarts may yet
+// mount, but on-failure doesn't restart a clean exit. A clean exit is only waited out with CleanExitActionWait
+func (m *Mounter) isContainerExitFinal(status *cri.ContainerStatus) bool {
+	if status.State != cri.ContainerStateExited {
+		return false
+	}
 
-	criInstance, err := createCRI()
-	if err != nil {
+	if status.ExitCode == 0 {
+		return m.Config.CleanExitAction != CleanExitActionWait && m.Config.FuseRestartPolicy != cri.RestartPolicyAlways
+	}
+
+	return !m.fuseContainerRestarts()
+}
+
+// getDataURLs resolves a cluster's data URLs, bounded by the configured timeout
+func (m *Mounter) getDataURLs(cluster string) (string, error) {
+	var resolver DataURLsResolver = m.Config
+	if m.dataURLsResolver != nil {
+		resolver = m.dataURLsResolver
+	}
+
+	return resolveDataURLsWithTimeout(resolver, cluster, m.Config.getDataURLsTimeout())
+}
+
+// createContainerWithRetries creates the fuse container, retrying transient runtime errors (e.g. a busy socket)
+// with exponential backoff, within the mount's budget
+func (m *Mounter) createContainerWithRetries(ctx context.Context,
+	criInstance cri.CRI,
+	image string,
+	containerName string,
+	targetPath string,
+	args []string,
+	containerOptions cri.ContainerOptions) error {
+	retries := m.Config.getCreateContainerRetries()
+	retryInterval := createContainerRetryInterval
+
+	for attempt := 0; ; attempt++ {
+		err := m.createContainer(criInstance, image, containerName, targetPath, args, containerOptions)
+		if err == nil || attempt >= retries || errors.Is(err, cri.ErrImageNotFound) {
+			return err
+		}
+
+		journal.Warn("Failed to create container, retrying",
+			"containerName", containerName,
+			"attempt", attempt+1,
+			"retryInterval", retryInterval,
+			"err", err.Error())
+
+		// a container half created by the failed attempt would fail the next one on its name
+		criInstance.RemoveContainer(containerName) // nolint: errcheck
+
+		select {
+		case <-time.After(retryInterval):
+		case <-ctx.Done():
+			return err
+		}
+
+		retryInterval *= 2
+	}
+}
+
+// createContainer creates the fuse container. Another call may create a container of the same name between our
+// removal of the existing one and the creation, in which case the container is either reused, if running, or
+// removed and created once more
+func (m *Mounter) createContainer(criInstance cri.CRI,
+	image string,
+	containerName string,
+	targetPath string,
+	args []string,
+	containerOptions cri.ContainerOptions) error {
+	err := criInstance.CreateContainer(image, containerName, targetPath, args, containerOptions)
+	if !errors.Is(err, cri.ErrContainerNameInUse) {
 		return err
 	}
 
-	defer criInstance.Close() // nolint: errcheck
+	if m.Config.NameConflictPolicy == NameConflictPolicyReuse {
+		status, statusErr := criInstance.ContainerStatus(containerName)
+		if statusErr == nil && status.State == cri.ContainerStateRunning {
+			journal.Info("Container name in use, reusing running container", "containerName", containerName)
+			return nil
+		}
 
-	ImageRepository := m.Config.ImageRepository
-	if ImageRepository == "" {
-		ImageRepository = "iguazio/v3io-fuse"
+		journal.Info("Container name in use by a container that isn't running, recreating it",
+			"containerName", containerName)
+	} else {
+		journal.Info("Container name in use, recreating container", "containerName", containerName)
 	}
 
-	ImageTag := m.Config.ImageTag
-	if ImageTag == "" {
-		ImageTag = "local"
+	if err := criInstance.RemoveContainer(containerName); err != nil {
+		return fmt.Errorf("Could not remove container for %s: %s", targetPath, err)
 	}
 
-	dataUrls, err := m.Config.DataURLs(spec.GetClusterName())
-	if err != nil {
-		return fmt.Errorf("Could not get cluster data urls: %s", err.Error())
+	return criInstance.CreateContainer(image, containerName, targetPath, args, containerOptions)
+}
+
+// checkFuseMountPoint verifies that the container has the directory its target is mounted at, so an image with an
+// unexpected layout fails clearly. A container that isn't running is left for the wait to explain
+func (m *Mounter) checkFuseMountPoint(criInstance cri.CRI, image string, containerName string) error {
+	if _, err := criInstance.ExecInContainer(containerName, []string{"test", "-d", fuseMountPoint}); err != nil {
+		if status, statusErr := criInstance.ContainerStatus(containerName); statusErr == nil &&
+			status.State != cri.ContainerStateRunning {
+			return nil
+		}
+
+		return fmt.Errorf("Mount point %s is missing in container %s of image %s: %s",
+			fuseMountPoint,
+			containerName,
+			image,
+			err)
 	}
 
-	containerName, err := getContainerNameFromTargetPath(targetPath)
-	if err != nil {
-		return fmt.Errorf("Failed to get container name: %s", err.Error())
+	return nil
+}
+
+// getFuseArgs returns the fuse container's command line. The connection and mount arguments are appended to the
+// configured command, unless the command is configured to be passed verbatim
+func (m *Mounter) getFuseArgs(spec *Spec, dataUrls string, v3ioConfigPath string) ([]string, error) {
+	args := []string{defaultFuseCommand}
+	if len(m.Config.FuseCommand) > 0 {
+		args = append([]string{}, m.Config.FuseCommand...)
 	}
 
-	// Ensure the container doesn't already exist
-	// It's ok if the command runs but exits with a failure, this is in the case the container doesn't exist.
-	m.removeV3IOFUSEContainer(criInstance, targetPath) // nolint: errcheck
+	if m.Config.FuseRawArgs {
+		return args, nil
+	}
 
-	// Create the new container
-	args := []string{
-		"/fuse/mounter.sh",
-		"-o", "allow_other",
+	var configOptions []string
+	if accessMode := m.Config.getAccessMode(); accessMode != AccessModeNone {
+		configOptions = append(configOptions, accessMode)
+	}
+
+	configOptions = append(configOptions, m.Config.FuseOptions...)
+
+	if m.Config.SELinuxLabel != "" && m.Config.SELinuxMountContext {
+		configOptions = append(configOptions, fmt.Sprintf("context=\"%s\"", m.Config.SELinuxLabel))
+	}
+
+	options, err := mergeMountOptions(configOptions, spec.GetFuseOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args,
 		"--connection_strings", dataUrls,
-		"--mountpoint", "/fuse_mount",
+		"--mountpoint", fuseMountPoint,
 		"--session_key", spec.GetAccessKey(),
+	)
+
+	if m.Config.BackendRetryCount > 0 {
+		args = append(args, "--retry_count", strconv.Itoa(m.Config.BackendRetryCount))
 	}
 
-	V3ioConfigPath := m.Config.V3ioConfigPath
-	if V3ioConfigPath != "" {
-		args = append(args, "-f", V3ioConfigPath)
+	if m.Config.BackendRetryIntervalSeconds > 0 {
+		args = append(args, "--retry_interval_seconds", strconv.Itoa(m.Config.BackendRetryIntervalSeconds))
+	}
+
+	for _, option := range options {
+		args = append(args, "-o", option)
+	}
+
+	if v3ioConfigPath != "" {
+		args = append(args, "-f", v3ioConfigPath)
 	}
 
 	if spec.Container != "" {
@@ -196,28 +1196,71 @@ func (m *Mounter) createV3IOFUSEContainer(spec *Spec, targetPath string) error {
 		}
 	}
 
-	if err := criInstance.CreateContainer(fmt.Sprintf("%s:%s", ImageRepository, ImageTag),
-		containerName,
-		targetPath,
-		args); err != nil {
-		return fmt.Errorf("Failed to create container for %s: %s", targetPath, err)
+	return args, nil
+}
+
+func (m *Mounter) getContainerOptions(spec *Spec, targetPath string) (cri.ContainerOptions, error) {
+	containerOptions := cri.ContainerOptions{
+		SELinuxLabel:      m.Config.SELinuxLabel,
+		AutoRemove:        m.Config.AutoRemoveContainer,
+		RestartPolicy:     m.Config.FuseRestartPolicy,
+		RestartMaxRetries: m.Config.FuseRestartMaxRetries,
+		LogDriver:         m.Config.FuseLogDriver,
+		LogOptions:        m.Config.FuseLogOptions,
+		Capabilities:      m.Config.getFuseCapabilities(),
+		Devices:           m.Config.getFuseDevices(),
+
+		RegistryAuthConfigPath: m.Config.RegistryAuthConfigPath,
+		OverrideEntrypoint:     len(m.Config.FuseCommand) > 0,
 	}
 
-	for _, interval := range []time.Duration{1, 2, 4, 2, 1} {
-		if isMountPoint(targetPath) {
-			return nil
+	// a shared mount's container serves many pods, so it isn't labeled with the pod that happened to create it
+	if !strings.HasPrefix(targetPath, sharedMountsDir+"/") {
+		containerOptions.Labels = getPodLabels(spec)
+	}
+
+	if m.Config.FuseHostnameTemplate != "" {
+		hostname := strings.NewReplacer(
+			"{podUID}", getPodUIDFromTargetPath(targetPath),
+			"{namespace}", spec.Namespace,
+		).Replace(m.Config.FuseHostnameTemplate)
+
+		if len(hostname) > 63 || !hostnameRegexp.MatchString(hostname) {
+			return containerOptions, fmt.Errorf("%w: hostname %s (from template %s) is not a valid hostname",
+				ErrInvalidMountRequest,
+				hostname,
+				m.Config.FuseHostnameTemplate)
 		}
 
-		time.Sleep(interval * time.Second)
+		containerOptions.Hostname = hostname
+	}
+
+	return containerOptions, nil
+}
+
+// getPodLabels returns container labels correlating the fuse container with the pod it mounts for, from the pod
+// metadata kubelet passes in the spec. Metadata kubelet didn't pass is left out
+func getPodLabels(spec *Spec) map[string]string {
+	podLabels := map[string]string{}
+
+	for labelName, labelValue := range map[string]string{
+		podNameLabel:      spec.PodName,
+		podNamespaceLabel: spec.Namespace,
+		podUIDLabel:       spec.PodUID,
+		volumeNameLabel:   spec.Name,
+	} {
+		if labelValue != "" {
+			podLabels[labelName] = labelValue
+		}
 	}
 
-	return fmt.Errorf("Failed to mount %s due to timeout", targetPath)
+	return podLabels
 }
 
 func (m *Mounter) removeV3IOFUSEContainer(criInstance cri.CRI, targetPath string) error {
 	journal.Info("Removing v3io-fuse container", "target", targetPath)
 
-	containerName, err := getContainerNameFromTargetPath(targetPath)
+	containerName, err := m.getContainerName(targetPath, nil)
 	if err != nil {
 		return fmt.Errorf("Could not get container name: %s", err)
 	}
@@ -231,43 +1274,190 @@ func (m *Mounter) removeV3IOFUSEContainer(criInstance cri.CRI, targetPath string
 	return nil
 }
 
-func (m *Mounter) mountAsLink(spec *Spec, targetPath string) *Response {
+func (m *Mounter) mountAsLink(ctx context.Context, spec *Spec, targetPath string) *Response {
 	journal.Info("Mounting as link", "target", targetPath)
-	linkPath := path.Join("/mnt/v3io", spec.Namespace, spec.Container)
 
-	if !isMountPoint(linkPath) {
+	// the link path identifies the shared mount, so a missing part would collapse it into another's
+	namespace := spec.Namespace
+	if namespace == "" {
+		namespace = m.Config.LinkDefaultNamespace
+	}
+
+	if namespace == "" || spec.Container == "" {
+		return NewPermanentFailResponse("Invalid link",
+			fmt.Errorf("Link mode requires a namespace and a container, got namespace %q and container %q",
+				spec.Namespace,
+				spec.Container))
+	}
+
+	linkPath, err := m.getLinkPath(namespace, spec.Container)
+	if err != nil {
+		return NewPermanentFailResponse("Invalid link", err)
+	}
+
+	// the target is removed and replaced by the link, which must not take the shared mount with it
+	if err := validateLinkPaths(linkPath, targetPath); err != nil {
+		return NewPermanentFailResponse("Invalid link", err)
+	}
+
+	if !m.filesystem.IsMountPoint(linkPath) {
+		if spec.GetAccessKey() == "" {
+			return m.newSpecFailResponse("Invalid link",
+				fmt.Errorf("Link %s isn't mounted yet, which requires an access key: %w",
+					linkPath,
+					spec.getMissingAccessKeyError()))
+		}
+
+		// only a link that isn't mounted yet adds a fuse mount to the node
+		if m.Config.MaxMountsPerNode > 0 {
+			if response := m.checkNodeMountLimit(); response != nil {
+				return response
+			}
+		}
+
 		journal.Debug("Creating folder", "linkPath", linkPath)
-		if err := os.MkdirAll(linkPath, 0755); err != nil {
-			return NewFailResponse(fmt.Sprintf("Failed to create target %s", linkPath), err)
+		if err := m.filesystem.MkdirAll(linkPath, 0755); err != nil {
+			return NewFailResponse(fmt.Sprintf("Failed to create target %s", linkPath),
+				explainCreateError(linkPath, err, "link_base_path"))
+		}
+
+		ctx, cancel, _, err := m.pullMountImage(ctx, spec)
+		if err != nil {
+			return NewFailResponse("Failed to pull v3io FUSE image", err)
 		}
 
-		if err := m.createV3IOFUSEContainer(spec, linkPath); err != nil {
-			return NewFailResponse("Failed to create v3io FUSE container", err)
+		defer cancel()
+
+		if err := m.createV3IOFUSEContainer(ctx, spec, linkPath); err != nil {
+			return newMountFailResponse("Failed to create v3io FUSE container", err)
 		}
 	}
 
-	if err := os.Remove(targetPath); err != nil {
+	if m.Config.LinkUseBindMount {
+		return m.bindMountLink(linkPath, targetPath)
+	}
+
+	// a retried mount finds the target already linked, and replacing it would race with whoever uses it
+	if linkTarget, err := m.filesystem.Readlink(targetPath); err == nil && filepath.Clean(linkTarget) == linkPath {
+		return NewSuccessResponse(fmt.Sprintf("Already linked: %s", targetPath))
+	}
+
+	// kubelet may have removed the target meanwhile, which leaves the way clear for the link all the same
+	if err := m.filesystem.Remove(targetPath); err != nil && !os.IsNotExist(err) {
 		return NewFailResponse(fmt.Sprintf("Failed to remove target %s", targetPath), err)
 	}
 
-	if err := os.Symlink(linkPath, targetPath); err != nil {
+	if err := m.filesystem.Symlink(linkPath, targetPath); err != nil {
 		return NewFailResponse(fmt.Sprintf("Failed to create link %s to target %s", linkPath, targetPath), err)
 	}
 
 	return NewSuccessResponse("Successfully mounted as link")
 }
 
+// bindMountLink bind mounts the link path onto the target, which workloads then see as a real directory
+func (m *Mounter) bindMountLink(linkPath string, targetPath string) *Response {
+	if m.filesystem.IsMountPoint(targetPath) {
+		return NewSuccessResponse(fmt.Sprintf("Already mounted: %s", targetPath))
+	}
+
+	journal.Debug("Bind mounting link", "linkPath", linkPath, "target", targetPath)
+
+	if err := m.filesystem.MkdirAll(targetPath, 0750); err != nil {
+		return NewFailResponse(fmt.Sprintf("Failed to create target %s", targetPath),
+			explainCreateError(targetPath, err, ""))
+	}
+
+	if err := m.filesystem.BindMount(linkPath, targetPath); err != nil {
+		return NewFailResponse(fmt.Sprintf("Failed to bind mount %s to target %s", linkPath, targetPath), err)
+	}
+
+	return NewSuccessResponse("Successfully mounted as bind mounted link")
+}
+
+// getLinkPath returns the path of a namespace's container's link mode mount, refusing namespaces and containers
+// that aren't single path components, which would let the link path escape LinkBasePath
+func (m *Mounter) getLinkPath(namespace string, container string) (string, error) {
+	linkBasePath := m.Config.getLinkBasePath()
+
+	for _, pathComponent := range []string{namespace, container} {
+		if !isSinglePathComponent(pathComponent) {
+			return "", fmt.Errorf("Link path component %q must be a single path component", pathComponent)
+		}
+	}
+
+	linkPath := filepath.Join(linkBasePath, namespace, container)
+	if !isSubPath(linkBasePath, linkPath) {
+		return "", fmt.Errorf("Link path %s escapes %s", linkPath, linkBasePath)
+	}
+
+	return linkPath, nil
+}
+
+// isSinglePathComponent returns whether a name is a single, non-special path component
+func isSinglePathComponent(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// validateLinkPaths checks that a link and its target are distinct, and that neither contains the other
+func validateLinkPaths(linkPath string, targetPath string) error {
+	linkPath = filepath.Clean(linkPath)
+	targetPath = filepath.Clean(targetPath)
+
+	if linkPath == targetPath {
+		return fmt.Errorf("Link path and target are both %s", linkPath)
+	}
+
+	if isSubPath(linkPath, targetPath) || isSubPath(targetPath, linkPath) {
+		return fmt.Errorf("Link path %s and target %s overlap", linkPath, targetPath)
+	}
+
+	return nil
+}
+
+// isSubPath returns whether a clean path is under a clean parent path
+func isSubPath(parentPath string, subPath string) bool {
+	return strings.HasPrefix(subPath, strings.TrimSuffix(parentPath, "/")+"/")
+}
+
 func (m *Mounter) unmountAsLink(targetPath string) *Response {
 	journal.Info("Calling unmountAsLink command", "target", targetPath)
-	if err := os.Remove(targetPath); err != nil {
+
+	// the link may have been bind mounted rather than symlinked, depending on LinkUseBindMount at mount time
+	if m.filesystem.IsMountPoint(targetPath) {
+		if err := m.filesystem.Unmount(targetPath); err != nil {
+			return NewFailResponse(fmt.Sprintf("Failed to unmount link %s", targetPath), err)
+		}
+	}
+
+	if err := m.filesystem.Remove(targetPath); err != nil && !os.IsNotExist(err) {
 		return NewFailResponse("unable to remove link", err)
 	}
 
 	return NewSuccessResponse("link removed")
 }
 
+// getPodUIDFromTargetPath returns the uid of the pod a target path belongs to, or an empty string if the path isn't
+// under a pod's directory
+func getPodUIDFromTargetPath(targetPath string) string {
+	splitTargetPath := strings.Split(targetPath, string(filepath.Separator))
+
+	for targetPathPartIdx, targetPathPart := range splitTargetPath {
+		if targetPathPart == "pods" && targetPathPartIdx+1 < len(splitTargetPath) {
+			return splitTargetPath[targetPathPartIdx+1]
+		}
+	}
+
+	return ""
+}
+
 // /var/lib/kubelet/pods/0c082652-d6c7-11e9-9fd4-a4bf015abcab/volumes/v3io~fuse/v3io-fuse -> "v3io-fuse-0c082652-d6c7-11e9-9fd4-a4bf015abcab-v3io-fuse
 func getContainerNameFromTargetPath(targetPath string) (string, error) {
+
+	// shared mounts aren't under a pod's directory, and are named by their identity hash
+	if strings.HasPrefix(targetPath, sharedMountsDir+"/") {
+		return fmt.Sprintf("v3io-fuse-shared-%s", path.Base(targetPath)), nil
+	}
+
 	splitTargetPath := strings.Split(targetPath, string(filepath.Separator))
 
 	for targetPathPartIdx, targetPathPart := range splitTargetPath {
@@ -289,35 +1479,114 @@ func getContainerNameFromTargetPath(targetPath string) (string, error) {
 	return "", fmt.Errorf("Could not find pod directory in path: %s", targetPath)
 }
 
-func isMountPoint(path string) bool {
-	journal.Debug("Checking if path is a mount point", "target", path)
+// isEmptyDir returns whether path has no entries. A missing path is considered empty
+func (m *Mounter) isEmptyDir(path string) (bool, error) {
+	if _, err := m.filesystem.Readdirnames(path, 1); err != nil {
+		if err == io.EOF || os.IsNotExist(err) {
+			return true, nil
+		}
 
-	cmd := exec.Command("mount")
-	mountList, err := cmd.CombinedOutput()
-	if err != nil {
-		journal.Debug("Path is not a mount point", "target", path)
-		return false
+		return false, err
 	}
 
-	mountListString := string(mountList)
-	result := strings.Contains(mountListString, path+" type")
+	return false, nil
+}
 
-	if result {
-		journal.Debug("Path is a mount point", "target", path)
-	} else {
-		journal.Debug("Path is not a mount point", "target", path)
+// createCRI creates the runtime of CRIType, or auto-detects it if CRIType is auto, unless criFactory is set
+func (m *Mounter) createCRI() (cri.CRI, error) {
+	if m.criFactory != nil {
+		return m.criFactory()
 	}
 
-	return result
+	criType := m.Config.CRIType
+	if criType == "" || criType == CRITypeAuto {
+		return m.detectCRI()
+	}
+
+	socketPath := m.Config.getCRISocketPath(criType)
+	if _, err := os.Stat(socketPath); err != nil {
+		return nil, fmt.Errorf("Socket %s of CRI %s is unavailable: %s", socketPath, criType, err)
+	}
+
+	switch criType {
+	case CRIDocker:
+		return cri.NewDocker(dockerBinaryPath, "unix://"+socketPath, m.Config.getCRITimeouts())
+	case CRICRIO:
+		return cri.NewCRIO(crictlBinaryPath, socketPath, m.Config.getCRINamespace(), m.Config.getCRITimeouts())
+	default:
+		return cri.NewContainerd(socketPath, m.Config.getCRINamespace(), m.Config.getCRITimeouts())
+	}
 }
 
-func createCRI() (cri.CRI, error) {
-	dockerBinaryPath := "/usr/bin/docker"
+// detectCRI creates the first runtime of CRIDetectionOrder that's found on the node: docker by its CLI, CRI-O and
+// containerd by their sockets. Containerd is the default if none is found
+func (m *Mounter) detectCRI() (cri.CRI, error) {
+	detectionOrder := m.Config.getCRIDetectionOrder()
+
+	var presentRuntimes []string
+	for _, runtimeName := range detectionOrder {
+		if isRuntimePresent(runtimeName) {
+			presentRuntimes = append(presentRuntimes, runtimeName)
+		}
+	}
+
+	// kubelet can't see containers of a runtime other than its own, so a wrong choice goes unnoticed
+	if len(presentRuntimes) > 1 {
+		journal.Warn("Multiple CRI runtimes found on node, set preferred_runtime to the one kubelet uses",
+			"runtimes", presentRuntimes,
+			"preferredRuntime", m.Config.PreferredRuntime)
+	}
+
+	for _, runtimeName := range presentRuntimes {
+		switch runtimeName {
+		case CRIDocker:
+			docker, err := cri.NewDocker(dockerBinaryPath, "", m.Config.getCRITimeouts())
+			if err != nil {
+				return nil, err
+			}
+
+			// the docker CLI may linger on nodes where another runtime is the actual one
+			if !m.Config.DisableDockerFallback {
+				if err := docker.Ping(); err != nil {
+					journal.Warn("Docker daemon is unreachable, falling back to the next runtime", "err", err.Error())
+					continue
+				}
+			}
+
+			journal.Debug("Detected CRI", "runtime", runtimeName)
+
+			return docker, nil
+		case CRICRIO:
+			journal.Debug("Detected CRI", "runtime", runtimeName)
 
-	// if docker binary exists, create docker. otherwise containerd
-	if _, err := os.Stat(dockerBinaryPath); os.IsNotExist(err) {
-		return cri.NewContainerd("/run/containerd/containerd.sock", "v3io")
+			return cri.NewCRIO(crictlBinaryPath, crioSocketPath, m.Config.getCRINamespace(), m.Config.getCRITimeouts())
+		case CRIContainerd:
+			journal.Debug("Detected CRI", "runtime", runtimeName)
+
+			return cri.NewContainerd(containerdSocketPath, m.Config.getCRINamespace(), m.Config.getCRITimeouts())
+		}
+	}
+
+	return cri.NewContainerd(containerdSocketPath, m.Config.getCRINamespace(), m.Config.getCRITimeouts())
+}
+
+// isRuntimePresent returns whether a runtime is installed on the node: docker by its CLI, CRI-O and containerd by
+// their sockets
+func isRuntimePresent(runtimeName string) bool {
+	var runtimePath string
+
+	switch runtimeName {
+	case CRIDocker:
+		runtimePath = dockerBinaryPath
+	case CRICRIO:
+		runtimePath = crioSocketPath
+	case CRIContainerd:
+		runtimePath = containerdSocketPath
+	default:
+		return false
 	}
 
-	return cri.NewDocker(dockerBinaryPath)
+	_, err := os.Stat(runtimePath)
+
+	return err == nil
 }
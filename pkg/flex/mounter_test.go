@@ -0,0 +1,1740 @@
+package flex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/common"
+	"github.com/v3io/flex-fuse/pkg/cri"
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+func TestNewMountFailResponse(t *testing.T) {
+	for _, testCase := range []struct {
+		name            string
+		err             error
+		expectTransient bool
+	}{
+		{name: "transient", err: errors.New("container exited"), expectTransient: true},
+		{name: "invalid", err: fmt.Errorf("%w: invalid fuse mount options", ErrInvalidMountRequest)},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			response := newMountFailResponse("Failed to create v3io FUSE container", testCase.err)
+			if response.Transient != testCase.expectTransient {
+				t.Fatalf("Expected transient %t, got %t", testCase.expectTransient, response.Transient)
+			}
+
+			if strings.HasPrefix(response.Message, PermanentFailurePrefix) == testCase.expectTransient {
+				t.Fatalf("Unexpected message %s", response.Message)
+			}
+		})
+	}
+}
+
+func TestCreateDirsInvalidRequest(t *testing.T) {
+	for _, testCase := range []struct {
+		name         string
+		dirsToCreate string
+	}{
+		{name: "invalid json", dirsToCreate: "[{"},
+		{name: "absolute path", dirsToCreate: `[{"name": "/etc", "permissions": 493}]`},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := newMemoryFilesystem()
+			filesystem.MkdirAll("/target", 0755) // nolint: errcheck
+
+			mounter := newTestMounter(&Config{DirCreateFailureMode: DirCreateFailureModeFail}, filesystem)
+
+			_, err := mounter.createDirs(Spec{DirsToCreate: testCase.dirsToCreate}, "/target")
+			if !errors.Is(err, ErrInvalidMountRequest) {
+				t.Fatalf("Expected ErrInvalidMountRequest, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGetContainerOptionsInvalidHostname(t *testing.T) {
+	mounter := newTestMounter(&Config{FuseHostnameTemplate: "fuse_{namespace}"}, newMemoryFilesystem())
+
+	_, err := mounter.getContainerOptions(&Spec{Namespace: "default"}, "/var/lib/kubelet/pods/uid/volumes/v3io~fuse/v")
+	if !errors.Is(err, ErrInvalidMountRequest) {
+		t.Fatalf("Expected ErrInvalidMountRequest, got %v", err)
+	}
+}
+
+func TestCreateDirsUnsetPermissions(t *testing.T) {
+	for _, testCase := range []struct {
+		name                  string
+		dirsToCreate          string
+		inheritDirPermissions bool
+		expectedModes         map[string]os.FileMode
+	}{
+		{
+			name:                  "unset inherits the target's",
+			dirsToCreate:          `[{"name": "a"}]`,
+			inheritDirPermissions: true,
+			expectedModes:         map[string]os.FileMode{"/target/a": 0710},
+		},
+		{
+			name:                  "unset nested inherits the nearest existing parent's",
+			dirsToCreate:          `[{"name": "a/b"}]`,
+			inheritDirPermissions: true,
+			expectedModes:         map[string]os.FileMode{"/target/a": 0710, "/target/a/b": 0710},
+		},
+		{
+			name:                  "set isn't inherited",
+			dirsToCreate:          `[{"name": "a", "permissions": 488}, {"name": "b"}]`,
+			inheritDirPermissions: true,
+			expectedModes:         map[string]os.FileMode{"/target/a": 0750, "/target/b": 0710},
+		},
+		{
+			name:          "unset without inheritance",
+			dirsToCreate:  `[{"name": "a"}]`,
+			expectedModes: map[string]os.FileMode{"/target/a": 0},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := newMemoryFilesystem()
+			filesystem.MkdirAll("/target", 0710) // nolint: errcheck
+
+			mounter := newTestMounter(&Config{InheritDirPermissions: testCase.inheritDirPermissions}, filesystem)
+
+			if _, err := mounter.createDirs(Spec{DirsToCreate: testCase.dirsToCreate}, "/target"); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			for path, expectedMode := range testCase.expectedModes {
+				info, err := filesystem.Stat(path)
+				if err != nil {
+					t.Fatalf("Expected folder %s to be created: %s", path, err)
+				}
+
+				if info.Mode().Perm() != expectedMode {
+					t.Fatalf("Expected folder %s mode %#o, got %#o", path, expectedMode, info.Mode().Perm())
+				}
+			}
+		})
+	}
+}
+
+func TestCheckTargetEmpty(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		targetPath  string
+		expectEmpty bool
+	}{
+		{name: "empty", targetPath: "/targets/empty", expectEmpty: true},
+		{name: "missing", targetPath: "/targets/missing", expectEmpty: true},
+		{name: "with a folder", targetPath: "/targets/folder"},
+		{name: "with a link", targetPath: "/targets/link"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := newMemoryFilesystem()
+			filesystem.MkdirAll("/targets/empty", 0755)       // nolint: errcheck
+			filesystem.MkdirAll("/targets/folder/data", 0755) // nolint: errcheck
+			filesystem.MkdirAll("/targets/link", 0755)        // nolint: errcheck
+			filesystem.Symlink("/data", "/targets/link/data") // nolint: errcheck
+
+			mounter := newTestMounter(&Config{RejectNonEmptyTarget: true}, filesystem)
+
+			response := mounter.checkTargetEmpty(testCase.targetPath)
+			if testCase.expectEmpty {
+				if response != nil {
+					t.Fatalf("Expected target to be accepted, got %s", response.Message)
+				}
+
+				return
+			}
+
+			if response == nil || response.Status != "Failure" {
+				t.Fatal("Expected non-empty target to be rejected")
+			}
+		})
+	}
+}
+
+func TestGetFuseArgsAccessMode(t *testing.T) {
+	for _, testCase := range []struct {
+		accessMode      string
+		expectedOptions []string
+	}{
+		{accessMode: "", expectedOptions: []string{"allow_other"}},
+		{accessMode: AccessModeAllowOther, expectedOptions: []string{"allow_other"}},
+		{accessMode: AccessModeAllowRoot, expectedOptions: []string{"allow_root"}},
+		{accessMode: AccessModeNone},
+	} {
+		t.Run(testCase.accessMode, func(t *testing.T) {
+			mounter := newTestMounter(&Config{AccessMode: testCase.accessMode}, newMemoryFilesystem())
+
+			args, err := mounter.getFuseArgs(&Spec{}, "tcp://10.0.0.1:1234", "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if options := getOptionArgs(args); !reflect.DeepEqual(options, testCase.expectedOptions) {
+				t.Fatalf("Expected options %v, got %v", testCase.expectedOptions, options)
+			}
+		})
+	}
+}
+
+// getOptionArgs returns the values of a fuse command line's -o arguments
+func getOptionArgs(args []string) []string {
+	var options []string
+	for argIdx := 0; argIdx+1 < len(args); argIdx++ {
+		if args[argIdx] == "-o" {
+			options = append(options, args[argIdx+1])
+		}
+	}
+
+	return options
+}
+
+// busyFilesystem fails the first removals with EBUSY, as removing a mount point does while the kernel is still
+// releasing it
+type busyFilesystem struct {
+	*memoryFilesystem
+	busyRemoves int
+	removes     int
+}
+
+func (f *busyFilesystem) Remove(path string) error {
+	f.removes++
+	if f.removes <= f.busyRemoves {
+		return &os.PathError{Op: "remove", Path: path, Err: syscall.EBUSY}
+	}
+
+	return f.memoryFilesystem.Remove(path)
+}
+
+func TestRemoveMountDirectoryRetriesBusy(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		busyRemoves   int
+		targetMissing bool
+		expectError   bool
+	}{
+		{name: "not busy"},
+		{name: "transiently busy", busyRemoves: 2},
+		{name: "busy", busyRemoves: removeBusyAttempts, expectError: true},
+		{name: "already removed", targetMissing: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := &busyFilesystem{memoryFilesystem: newMemoryFilesystem(), busyRemoves: testCase.busyRemoves}
+			if !testCase.targetMissing {
+				filesystem.MkdirAll("/target", 0755) // nolint: errcheck
+			}
+
+			mounter := newTestMounter(&Config{}, filesystem)
+
+			err := mounter.removeMountDirectory("/target")
+			if testCase.expectError {
+				if !errors.Is(err, syscall.EBUSY) {
+					t.Fatalf("Expected EBUSY, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if _, err := filesystem.Stat("/target"); !os.IsNotExist(err) {
+				t.Fatal("Expected target to be removed")
+			}
+		})
+	}
+}
+
+// readOnlyFilesystem fails creating folders under a read-only path, on the first folder that had to be created as
+// os.MkdirAll does
+type readOnlyFilesystem struct {
+	*memoryFilesystem
+	readOnlyPath string
+}
+
+func (f *readOnlyFilesystem) MkdirAll(path string, permissions os.FileMode) error {
+	if isSubPath(f.readOnlyPath, path) {
+		relativePath, _ := filepath.Rel(f.readOnlyPath, path)
+		failedPath := filepath.Join(f.readOnlyPath, strings.Split(relativePath, string(filepath.Separator))[0])
+
+		return &os.PathError{Op: "mkdir", Path: failedPath, Err: syscall.EROFS}
+	}
+
+	if path == f.readOnlyPath {
+		return &os.PathError{Op: "mkdir", Path: path, Err: syscall.EROFS}
+	}
+
+	return f.memoryFilesystem.MkdirAll(path, permissions)
+}
+
+func TestReadOnlyFilesystemErrors(t *testing.T) {
+	for _, testCase := range []struct {
+		name            string
+		readOnlyPath    string
+		create          func(mounter *Mounter) error
+		expectedMessage string
+	}{
+		{
+			name:         "dirs to create",
+			readOnlyPath: "/target/ro",
+			create: func(mounter *Mounter) error {
+				_, err := mounter.createDirs(Spec{DirsToCreate: `[{"name": "ro/b", "permissions": 493}]`}, "/target")
+				return err
+			},
+			expectedMessage: "read-only filesystem, cannot create /target/ro/b as /target/ro is read-only",
+		},
+		{
+			name:         "link path",
+			readOnlyPath: "/mnt/v3io",
+			create: func(mounter *Mounter) error {
+				response := mounter.mountAsLink(context.Background(),
+					&Spec{Namespace: "default", Container: "bigdata", OverrideAccessKey: "key"},
+					"/pods/uid/v3io")
+				if response.Status == "Success" {
+					return nil
+				}
+
+				return fmt.Errorf("%s", response.Message)
+			},
+			expectedMessage: "read-only filesystem, cannot create /mnt/v3io/default/bigdata as /mnt/v3io is read-only " +
+				"(set link_base_path to a writable path)",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := &readOnlyFilesystem{memoryFilesystem: newMemoryFilesystem(), readOnlyPath: testCase.readOnlyPath}
+			filesystem.MkdirAll("/target", 0755)        // nolint: errcheck
+			filesystem.MkdirAll("/pods/uid/v3io", 0750) // nolint: errcheck
+
+			err := testCase.create(newTestMounter(&Config{Type: "link"}, filesystem))
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedMessage) {
+				t.Fatalf("Expected an error containing %q, got %v", testCase.expectedMessage, err)
+			}
+		})
+	}
+}
+
+func TestCreateDirsPartialFailure(t *testing.T) {
+	const dirsToCreate = `[{"name": "a", "permissions": 493}, {"name": "ro/b", "permissions": 493}, ` +
+		`{"name": "c", "permissions": 493}]`
+
+	for _, testCase := range []struct {
+		dirCreateFailureMode string
+		expectError          bool
+		expectedWarnings     int
+		expectedDirs         []string
+		expectedMissingDirs  []string
+	}{
+		{
+			dirCreateFailureMode: DirCreateFailureModeFail,
+			expectError:          true,
+			expectedDirs:         []string{"/target/a"},
+			expectedMissingDirs:  []string{"/target/ro/b", "/target/c"},
+		},
+		{
+			dirCreateFailureMode: DirCreateFailureModeWarn,
+			expectedWarnings:     1,
+			expectedDirs:         []string{"/target/a", "/target/c"},
+			expectedMissingDirs:  []string{"/target/ro/b"},
+		},
+	} {
+		t.Run(testCase.dirCreateFailureMode, func(t *testing.T) {
+			filesystem := &readOnlyFilesystem{memoryFilesystem: newMemoryFilesystem(), readOnlyPath: "/target/ro"}
+			filesystem.memoryFilesystem.MkdirAll("/target", 0755) // nolint: errcheck
+
+			mounter := newTestMounter(&Config{DirCreateFailureMode: testCase.dirCreateFailureMode}, filesystem)
+
+			warnings, err := mounter.createDirs(Spec{DirsToCreate: dirsToCreate}, "/target")
+			if (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+
+			if len(warnings) != testCase.expectedWarnings {
+				t.Fatalf("Expected %d warnings, got %v", testCase.expectedWarnings, warnings)
+			}
+
+			for _, expectedDir := range testCase.expectedDirs {
+				if _, err := filesystem.Stat(expectedDir); err != nil {
+					t.Fatalf("Expected folder %s to be created", expectedDir)
+				}
+			}
+
+			for _, expectedMissingDir := range testCase.expectedMissingDirs {
+				if _, err := filesystem.Stat(expectedMissingDir); err == nil {
+					t.Fatalf("Expected folder %s not to be created", expectedMissingDir)
+				}
+			}
+		})
+	}
+}
+
+func TestGetContainerOptionsPodLabels(t *testing.T) {
+	const podTargetPath = "/var/lib/kubelet/pods/uid/volumes/v3io~fuse/v3io"
+
+	for _, testCase := range []struct {
+		name           string
+		options        string
+		targetPath     string
+		expectedLabels map[string]string
+	}{
+		{
+			name: "all",
+			options: `{"accessKey": "key", "kubernetes.io/pod.name": "jupyter", ` +
+				`"kubernetes.io/pod.namespace": "default-tenant", "kubernetes.io/pod.uid": "uid", ` +
+				`"kubernetes.io/pvOrVolumeName": "v3io", "kubernetes.io/serviceAccount.name": "default"}`,
+			targetPath: podTargetPath,
+			expectedLabels: map[string]string{
+				podNameLabel:      "jupyter",
+				podNamespaceLabel: "default-tenant",
+				podUIDLabel:       "uid",
+				volumeNameLabel:   "v3io",
+			},
+		},
+		{
+			name:       "partial",
+			options:    `{"accessKey": "key", "kubernetes.io/pod.name": "jupyter"}`,
+			targetPath: podTargetPath,
+			expectedLabels: map[string]string{
+				podNameLabel: "jupyter",
+			},
+		},
+		{
+			name:           "none",
+			options:        `{"accessKey": "key"}`,
+			targetPath:     podTargetPath,
+			expectedLabels: map[string]string{},
+		},
+		{
+			name:       "shared mount",
+			options:    `{"accessKey": "key", "kubernetes.io/pod.name": "jupyter"}`,
+			targetPath: sharedMountsDir + "/abc",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			spec, err := parseSpec(testCase.options)
+			if err != nil {
+				t.Fatalf("Failed to parse spec: %s", err)
+			}
+
+			mounter := newTestMounter(&Config{}, newMemoryFilesystem())
+
+			containerOptions, err := mounter.getContainerOptions(spec, testCase.targetPath)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(containerOptions.Labels, testCase.expectedLabels) {
+				t.Fatalf("Expected labels %v, got %v", testCase.expectedLabels, containerOptions.Labels)
+			}
+		})
+	}
+}
+
+func TestWaitForMountFailsOnOOMKilledContainer(t *testing.T) {
+	const targetPath = "/var/lib/kubelet/pods/uid/volumes/v3io~fuse/v3io"
+
+	criInstance := newFakeCRI()
+	criInstance.containers["v3io-fuse"] = &cri.ContainerStatus{
+		State:     cri.ContainerStateExited,
+		ExitCode:  137,
+		OOMKilled: true,
+	}
+	criInstance.logs = "allocating read cache\n"
+
+	mounter := newTestMounter(&Config{}, newMemoryFilesystem())
+	mounter.readinessStrategy = &staticReadiness{}
+
+	startTime := time.Now()
+
+	err := mounter.waitForMount(context.Background(), criInstance, "fuse:latest", "v3io-fuse", targetPath, &Spec{})
+	if err == nil {
+		t.Fatal("Expected the mount to fail")
+	}
+
+	for _, expectedText := range []string{"OOM killed", oomKilledHint, "allocating read cache"} {
+		if !strings.Contains(err.Error(), expectedText) {
+			t.Fatalf("Expected %q in %s", expectedText, err)
+		}
+	}
+
+	// the container won't ever mount, so the mount fails without waiting
+	if elapsed := time.Since(startTime); elapsed >= mountPollIntervals[0] {
+		t.Fatalf("Expected the mount to fail fast, took %s", elapsed)
+	}
+}
+
+func TestWaitForMountChecksFuseMountPoint(t *testing.T) {
+	originalMountPollIntervals := mountPollIntervals
+	mountPollIntervals = []time.Duration{time.Millisecond}
+	t.Cleanup(func() { mountPollIntervals = originalMountPollIntervals })
+
+	for _, testCase := range []struct {
+		name         string
+		execErr      error
+		expectedText string
+	}{
+		{name: "present"},
+		{name: "missing", execErr: errors.New("command exited with code 1"),
+			expectedText: "Mount point /fuse_mount is missing in container v3io-fuse of image fuse:latest"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			criInstance := newFakeCRI()
+			criInstance.containers["v3io-fuse"] = &cri.ContainerStatus{State: cri.ContainerStateRunning}
+			criInstance.execErr = testCase.execErr
+
+			mounter := newTestMounter(&Config{CheckFuseMountPoint: true}, newMemoryFilesystem())
+
+			// the mount never gets ready, so only checking before waiting for it names the missing directory
+			mounter.readinessStrategy = &staticReadiness{ready: testCase.execErr == nil}
+
+			err := mounter.waitForMount(context.Background(),
+				criInstance,
+				"fuse:latest",
+				"v3io-fuse",
+				fakeTargetPath,
+				&Spec{})
+
+			if testCase.expectedText == "" {
+				if err != nil {
+					t.Fatalf("Expected the mount to succeed, got %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), testCase.expectedText) {
+				t.Fatalf("Expected %q, got %v", testCase.expectedText, err)
+			}
+
+			expectedCommands := [][]string{{"test", "-d", "/fuse_mount"}}
+			if !reflect.DeepEqual(criInstance.execCommands, expectedCommands) {
+				t.Fatalf("Expected commands %v, got %v", expectedCommands, criInstance.execCommands)
+			}
+		})
+	}
+}
+
+func TestCreateV3IOFUSEContainerExitedContainer(t *testing.T) {
+	originalMountPollIntervals := mountPollIntervals
+	mountPollIntervals = []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}
+	t.Cleanup(func() { mountPollIntervals = originalMountPollIntervals })
+
+	for _, testCase := range []struct {
+		name                 string
+		status               cri.ContainerStatus
+		fuseRestartPolicy    string
+		expectedText         string
+		expectedStatusChecks int
+	}{
+		{
+			name:                 "failed",
+			status:               cri.ContainerStatus{State: cri.ContainerStateExited, ExitCode: 1},
+			expectedText:         "fuse container exited with code 1",
+			expectedStatusChecks: 1,
+		},
+		{
+			name:                 "exited cleanly",
+			status:               cri.ContainerStatus{State: cri.ContainerStateExited},
+			expectedText:         "fuse container exited cleanly without mounting",
+			expectedStatusChecks: 1,
+		},
+		{
+			name:                 "failed and restarted",
+			status:               cri.ContainerStatus{State: cri.ContainerStateExited, ExitCode: 1},
+			fuseRestartPolicy:    cri.RestartPolicyOnFailure,
+			expectedText:         "fuse container exited with code 1",
+			expectedStatusChecks: len(mountPollIntervals) + 1,
+		},
+		{
+			name:                 "running",
+			status:               cri.ContainerStatus{State: cri.ContainerStateRunning},
+			expectedText:         "due to timeout",
+			expectedStatusChecks: len(mountPollIntervals) + 1,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter, criInstance := newFakeCRIMounter(t, &Config{
+				Clusters:          []ClusterConfig{{Name: "default", DataUrls: []string{"tcp://10.0.0.1:1234"}}},
+				FuseRestartPolicy: testCase.fuseRestartPolicy,
+			})
+			mounter.readinessStrategy = &staticReadiness{}
+			criInstance.createdStatus = &testCase.status
+			criInstance.logs = "failed to connect to data url\n"
+
+			err := mounter.createV3IOFUSEContainer(context.Background(),
+				&Spec{Container: "bigdata", AccessKey: "key"},
+				fakeTargetPath)
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedText) {
+				t.Fatalf("Expected an error containing %q, got %v", testCase.expectedText, err)
+			}
+
+			if !strings.Contains(err.Error(), "failed to connect to data url") {
+				t.Fatalf("Expected the container logs in %s", err)
+			}
+
+			statusChecks := 0
+			for _, call := range criInstance.getCalls() {
+				if call == "ContainerStatus" {
+					statusChecks++
+				}
+			}
+
+			if statusChecks != testCase.expectedStatusChecks {
+				t.Fatalf("Expected %d status checks, got %d", testCase.expectedStatusChecks, statusChecks)
+			}
+
+			if len(criInstance.removed) != 1 {
+				t.Fatalf("Expected the failed container to be removed, got %v", criInstance.removed)
+			}
+		})
+	}
+}
+
+func TestCreateV3IOFUSEContainerCleanExit(t *testing.T) {
+	originalMountPollIntervals := mountPollIntervals
+	mountPollIntervals = []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}
+	t.Cleanup(func() { mountPollIntervals = originalMountPollIntervals })
+
+	for _, testCase := range []struct {
+		name                 string
+		cleanExitAction      string
+		fuseRestartPolicy    string
+		expectedStatusChecks int
+		expectConfigError    bool
+	}{
+		{name: "default", expectedStatusChecks: 1},
+		{name: "fail", cleanExitAction: CleanExitActionFail, expectedStatusChecks: 1},
+		{name: "fail, restarted on failure", cleanExitAction: CleanExitActionFail,
+			fuseRestartPolicy: cri.RestartPolicyOnFailure, expectedStatusChecks: 1},
+		{name: "fail, always restarted", cleanExitAction: CleanExitActionFail,
+			fuseRestartPolicy: cri.RestartPolicyAlways, expectedStatusChecks: len(mountPollIntervals) + 1},
+		{name: "wait", cleanExitAction: CleanExitActionWait, expectedStatusChecks: len(mountPollIntervals) + 1},
+		{name: "invalid", cleanExitAction: "retry", expectConfigError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			config := &Config{
+				Clusters:          []ClusterConfig{{Name: "default", DataUrls: []string{"tcp://10.0.0.1:1234"}}},
+				FuseRestartPolicy: testCase.fuseRestartPolicy,
+				CleanExitAction:   testCase.cleanExitAction,
+			}
+
+			if err := config.validate(); (err != nil) != testCase.expectConfigError {
+				t.Fatalf("Expected config error: %t, got %v", testCase.expectConfigError, err)
+			}
+
+			if testCase.expectConfigError {
+				return
+			}
+
+			// the container exits 0 right away, without mounting
+			mounter, criInstance := newFakeCRIMounter(t, config)
+			mounter.readinessStrategy = &staticReadiness{}
+			criInstance.createdStatus = &cri.ContainerStatus{State: cri.ContainerStateExited}
+			criInstance.logs = "no data url configured\n"
+
+			err := mounter.createV3IOFUSEContainer(context.Background(),
+				&Spec{Container: "bigdata", AccessKey: "key"},
+				fakeTargetPath)
+
+			expectedText := "fuse container exited cleanly without mounting"
+			if err == nil || !strings.Contains(err.Error(), expectedText) {
+				t.Fatalf("Expected an error containing %q, got %v", expectedText, err)
+			}
+
+			if !strings.Contains(err.Error(), "no data url configured") {
+				t.Fatalf("Expected the container logs in %s", err)
+			}
+
+			statusChecks := 0
+			for _, call := range criInstance.getCalls() {
+				if call == "ContainerStatus" {
+					statusChecks++
+				}
+			}
+
+			if statusChecks != testCase.expectedStatusChecks {
+				t.Fatalf("Expected %d status checks, got %d", testCase.expectedStatusChecks, statusChecks)
+			}
+		})
+	}
+}
+
+func TestMountMissingAccessKeySecret(t *testing.T) {
+	for _, testCase := range []struct {
+		name            string
+		config          Config
+		specString      string
+		expectedMessage string
+		expectTransient bool
+	}{
+		{
+			name: "namespace terminating",
+			specString: `{"container": "bigdata", "kubernetes.io/pod.name": "jupyter",
+				"kubernetes.io/pod.namespace": "default-tenant", "kubernetes.io/pod.uid": "uid"}`,
+			expectedMessage: "access key secret not found, namespace default-tenant may be terminating",
+		},
+		{
+			name:            "no namespace",
+			specString:      `{"container": "bigdata"}`,
+			expectedMessage: "access key secret not found (accessKey or the kubernetes.io/secret/accessKey",
+		},
+		{
+			name:            "empty secret",
+			specString:      `{"container": "bigdata", "kubernetes.io/secret/accessKey": ""}`,
+			expectedMessage: "access key secret not found",
+		},
+		{
+			name:   "retried",
+			config: Config{RetryMissingAccessKey: true},
+			specString: `{"container": "bigdata", "kubernetes.io/pod.name": "jupyter",
+				"kubernetes.io/pod.namespace": "default-tenant", "kubernetes.io/pod.uid": "uid"}`,
+			expectedMessage: "access key secret not found, namespace default-tenant may be terminating",
+			expectTransient: true,
+		},
+		{
+			name:   "link not mounted yet",
+			config: Config{Type: "link"},
+			specString: `{"container": "bigdata", "kubernetes.io/pod.name": "jupyter",
+				"kubernetes.io/pod.namespace": "default-tenant", "kubernetes.io/pod.uid": "uid"}`,
+			expectedMessage: "access key secret not found, namespace default-tenant may be terminating",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter, criInstance := newFakeCRIMounter(t, &testCase.config)
+
+			response := mounter.Mount(fakeTargetPath, testCase.specString)
+			if response.Status != "Failure" || !strings.Contains(response.Message, testCase.expectedMessage) {
+				t.Fatalf("Expected a failure containing %q, got %+v", testCase.expectedMessage, response)
+			}
+
+			// a namespace going away isn't retried, unless the secret may yet be created
+			if response.Transient != testCase.expectTransient {
+				t.Fatalf("Expected transient: %t, got %t", testCase.expectTransient, response.Transient)
+			}
+
+			if isPermanent := strings.HasPrefix(response.Message, PermanentFailurePrefix); isPermanent ==
+				testCase.expectTransient {
+				t.Fatalf("Expected permanent: %t, got %s", !testCase.expectTransient, response.Message)
+			}
+
+			if calls := criInstance.getCalls(); len(calls) != 0 {
+				t.Fatalf("Expected no CRI calls, got %v", calls)
+			}
+		})
+	}
+}
+
+func TestWithContainerLogs(t *testing.T) {
+	const accessKey = "secret-access-key"
+
+	mountErr := errors.New("Failed to mount /target due to timeout")
+
+	for _, testCase := range []struct {
+		name            string
+		logs            string
+		logsErr         error
+		expectedMessage string
+	}{
+		{
+			name: "logs",
+			logs: "connecting to tcp://10.0.0.1:1234\nconnection refused\n",
+			expectedMessage: fmt.Sprintf("%s, last %d lines of the fuse container log:\n"+
+				"connecting to tcp://10.0.0.1:1234\nconnection refused", mountErr, failureLogTailLines),
+		},
+		{
+			name: "logs with the access key",
+			logs: "session key " + accessKey + " rejected\n",
+			expectedMessage: fmt.Sprintf("%s, last %d lines of the fuse container log:\nsession key %s rejected",
+				mountErr,
+				failureLogTailLines,
+				common.RedactedValue),
+		},
+		{
+			name:            "empty logs",
+			logs:            " \n",
+			expectedMessage: mountErr.Error(),
+		},
+		{
+			name:            "logs unavailable",
+			logsErr:         errors.New("No such container"),
+			expectedMessage: mountErr.Error(),
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			criInstance := newFakeCRI()
+			criInstance.logs = testCase.logs
+			criInstance.logsErr = testCase.logsErr
+
+			err := withContainerLogs(mountErr, criInstance, "v3io-fuse", &Spec{OverrideAccessKey: accessKey})
+			if err.Error() != testCase.expectedMessage {
+				t.Fatalf("Expected message %q, got %q", testCase.expectedMessage, err.Error())
+			}
+
+			if !reflect.DeepEqual(criInstance.logsTailLines, []int{failureLogTailLines}) {
+				t.Fatalf("Expected the last %d lines to be asked for, got %v",
+					failureLogTailLines,
+					criInstance.logsTailLines)
+			}
+		})
+	}
+}
+
+func TestGetContainerExitedError(t *testing.T) {
+	for _, testCase := range []struct {
+		name         string
+		status       cri.ContainerStatus
+		expectedText string
+	}{
+		{name: "running", status: cri.ContainerStatus{State: cri.ContainerStateRunning}},
+		{name: "oom killed", status: cri.ContainerStatus{State: cri.ContainerStateExited, ExitCode: 137,
+			OOMKilled: true}, expectedText: "OOM killed"},
+		{name: "clean exit", status: cri.ContainerStatus{State: cri.ContainerStateExited},
+			expectedText: "exited cleanly"},
+		{name: "failed", status: cri.ContainerStatus{State: cri.ContainerStateExited, ExitCode: 2},
+			expectedText: "exited with code 2"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := getContainerExitedError("/target", &testCase.status)
+			if testCase.expectedText == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedText) {
+				t.Fatalf("Expected %q, got %v", testCase.expectedText, err)
+			}
+		})
+	}
+}
+
+// slowReleaseMount is a mount that outlives a plain umount, leaving the mount table only once umount ran with
+// releasingFlag, if at all
+type slowReleaseMount struct {
+	releasingFlag string
+	released      bool
+	calls         [][]string
+}
+
+func (s *slowReleaseMount) umount(args ...string) error {
+	s.calls = append(s.calls, args)
+	if len(args) == 2 && args[0] == s.releasingFlag {
+		s.released = true
+	}
+
+	return nil
+}
+
+func (s *slowReleaseMount) isMounted(string) bool {
+	return !s.released
+}
+
+func TestUmountTargetSlowRelease(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		releasingFlag string
+		forceUnmount  bool
+		expectedCalls [][]string
+		expectSuccess bool
+	}{
+		{name: "released by lazy umount", releasingFlag: "-l",
+			expectedCalls: [][]string{{"/target"}, {"-l", "/target"}}, expectSuccess: true},
+		{name: "never released", expectedCalls: [][]string{{"/target"}, {"-l", "/target"}}},
+		{name: "released by forced umount", releasingFlag: "-f", forceUnmount: true,
+			expectedCalls: [][]string{{"/target"}, {"-l", "/target"}, {"-f", "/target"}}, expectSuccess: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter := newTestMounter(&Config{
+				UnmountTimeoutSeconds:           1,
+				UnmountPollIntervalMilliseconds: 100,
+				LazyUnmountEscalationSeconds:    1,
+				ForceUnmount:                    testCase.forceUnmount,
+			}, newMemoryFilesystem())
+			mount := &slowReleaseMount{releasingFlag: testCase.releasingFlag}
+
+			response := mounter.umountTarget("/target", mount.umount, mount.isMounted)
+			if testCase.expectSuccess != (response == nil) {
+				t.Fatalf("Expected success: %t, got %+v", testCase.expectSuccess, response)
+			}
+
+			if response != nil && !strings.Contains(response.Message, "still mounted after lazy umount") {
+				t.Fatalf("Unexpected message %s", response.Message)
+			}
+
+			if !reflect.DeepEqual(mount.calls, testCase.expectedCalls) {
+				t.Fatalf("Expected umount calls %v, got %v", testCase.expectedCalls, mount.calls)
+			}
+		})
+	}
+}
+
+// useFakeRuntimes points the runtime paths at a temporary directory holding the given runtimes: docker as a CLI
+// whose daemon is reachable as dockerReachable says, and CRI-O and containerd as sockets
+func useFakeRuntimes(t *testing.T, dockerReachable bool, presentRuntimes ...string) {
+	originalPaths := []string{dockerBinaryPath, dockerSocketPath, crioSocketPath, containerdSocketPath}
+	t.Cleanup(func() {
+		dockerBinaryPath, dockerSocketPath, crioSocketPath, containerdSocketPath =
+			originalPaths[0], originalPaths[1], originalPaths[2], originalPaths[3]
+	})
+
+	runtimesDir := t.TempDir()
+	dockerBinaryPath = filepath.Join(runtimesDir, "docker")
+	dockerSocketPath = filepath.Join(runtimesDir, "docker.sock")
+	crioSocketPath = filepath.Join(runtimesDir, "crio.sock")
+	containerdSocketPath = filepath.Join(runtimesDir, "containerd.sock")
+
+	for _, runtimeName := range presentRuntimes {
+		switch runtimeName {
+		case CRIDocker:
+			exitCode := "1"
+			if dockerReachable {
+				exitCode = "0"
+			}
+
+			os.WriteFile(dockerBinaryPath, []byte("#!/bin/sh\nexit "+exitCode+"\n"), 0755) // nolint: errcheck
+			os.WriteFile(dockerSocketPath, nil, 0600)                                      // nolint: errcheck
+		case CRICRIO:
+			os.WriteFile(crioSocketPath, nil, 0600) // nolint: errcheck
+		case CRIContainerd:
+			os.WriteFile(containerdSocketPath, nil, 0600) // nolint: errcheck
+		}
+	}
+}
+
+func TestDetectCRIDockerFallback(t *testing.T) {
+	for _, testCase := range []struct {
+		name                  string
+		dockerReachable       bool
+		disableDockerFallback bool
+		expectDocker          bool
+	}{
+		{name: "docker reachable", dockerReachable: true, expectDocker: true},
+		{name: "docker unreachable"},
+		{name: "docker unreachable without fallback", disableDockerFallback: true, expectDocker: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			useFakeRuntimes(t, testCase.dockerReachable, CRIDocker, CRICRIO)
+			mounter := newTestMounter(&Config{DisableDockerFallback: testCase.disableDockerFallback},
+				newMemoryFilesystem())
+
+			criInstance, err := mounter.createCRI()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if _, isDocker := criInstance.(*cri.Docker); isDocker != testCase.expectDocker {
+				t.Fatalf("Expected docker: %t, got %T", testCase.expectDocker, criInstance)
+			}
+
+			if _, isCRIO := criInstance.(*cri.CRIO); !testCase.expectDocker && !isCRIO {
+				t.Fatalf("Expected a fallback to CRI-O, got %T", criInstance)
+			}
+		})
+	}
+}
+
+func TestCreateV3IOFUSEContainerRecordsRedactedArgs(t *testing.T) {
+	mounter, criInstance := newFakeCRIMounter(t, &Config{
+		Clusters: []ClusterConfig{{Name: "default", DataUrls: []string{"tcp://10.0.0.1:1234"}}},
+	})
+	spec := &Spec{Container: "bigdata", SubPath: "/a", AccessKey: "secret-key"}
+
+	if err := mounter.createV3IOFUSEContainer(context.Background(), spec, fakeTargetPath); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(criInstance.createArgs) != 1 {
+		t.Fatalf("Expected one container, got %d", len(criInstance.createArgs))
+	}
+
+	for containerName, args := range criInstance.createArgs {
+		var recordedArgs []string
+		if err := json.Unmarshal([]byte(criInstance.createOptions[containerName].Labels[fuseArgsLabel]),
+			&recordedArgs); err != nil {
+			t.Fatalf("Failed to unmarshal the recorded args: %s", err)
+		}
+
+		if strings.Contains(strings.Join(recordedArgs, " "), "secret-key") {
+			t.Fatalf("Recorded args hold the session key: %v", recordedArgs)
+		}
+
+		if len(recordedArgs) != len(args) {
+			t.Fatalf("Expected %d recorded args, got %v", len(args), recordedArgs)
+		}
+
+		for argIdx, arg := range args {
+			expectedArg := arg
+			if argIdx > 0 && args[argIdx-1] == "--session_key" {
+				expectedArg = common.RedactedValue
+			}
+
+			if recordedArgs[argIdx] != expectedArg {
+				t.Fatalf("Expected recorded arg %d to be %s, got %s", argIdx, expectedArg, recordedArgs[argIdx])
+			}
+		}
+
+		if !strings.Contains(strings.Join(recordedArgs, " "), "-a \\b\\i\\g\\d\\a\\t\\a -p \\/\\a") {
+			t.Fatalf("Expected the encoded container and sub path in %v", recordedArgs)
+		}
+	}
+}
+
+func TestCreateV3IOFUSEContainerCapabilities(t *testing.T) {
+	for _, testCase := range []struct {
+		name                 string
+		capabilities         []string
+		expectedCapabilities []string
+		expectedDevices      []string
+	}{
+		{name: "privileged"},
+		{name: "scoped", capabilities: []string{"CAP_SYS_ADMIN"},
+			expectedCapabilities: []string{"SYS_ADMIN"}, expectedDevices: []string{"/dev/fuse"}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter, criInstance := newFakeCRIMounter(t, &Config{
+				Clusters:         []ClusterConfig{{Name: "default", DataUrls: []string{"tcp://10.0.0.1:1234"}}},
+				FuseCapabilities: testCase.capabilities,
+			})
+
+			if err := mounter.createV3IOFUSEContainer(context.Background(),
+				&Spec{Container: "bigdata", AccessKey: "key"},
+				fakeTargetPath); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if len(criInstance.createOptions) != 1 {
+				t.Fatalf("Expected one container, got %d", len(criInstance.createOptions))
+			}
+
+			for _, options := range criInstance.createOptions {
+
+				// no capabilities has the runtime run the container privileged
+				if !reflect.DeepEqual(options.Capabilities, testCase.expectedCapabilities) {
+					t.Fatalf("Expected capabilities %v, got %v", testCase.expectedCapabilities, options.Capabilities)
+				}
+
+				if !reflect.DeepEqual(options.Devices, testCase.expectedDevices) {
+					t.Fatalf("Expected devices %v, got %v", testCase.expectedDevices, options.Devices)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateContainerWithRetries(t *testing.T) {
+	originalCreateContainerRetryInterval := createContainerRetryInterval
+	createContainerRetryInterval = time.Millisecond
+	t.Cleanup(func() { createContainerRetryInterval = originalCreateContainerRetryInterval })
+
+	socketBusyErr := errors.New("Cannot connect to the Docker daemon, is the docker daemon running?")
+	imageNotFoundErr := fmt.Errorf("%w: iguazio/v3io-fuse:local", cri.ErrImageNotFound)
+
+	for _, testCase := range []struct {
+		name            string
+		retries         int
+		createErrs      []error
+		expectedCreates int
+		expectedErr     error
+	}{
+		{name: "succeeds", expectedCreates: 1},
+		{name: "fails twice then succeeds", createErrs: []error{socketBusyErr, socketBusyErr}, expectedCreates: 3},
+		{name: "fails past the retries", retries: 2,
+			createErrs: []error{socketBusyErr, socketBusyErr, socketBusyErr}, expectedCreates: 3,
+			expectedErr: socketBusyErr},
+		{name: "fatal error", createErrs: []error{imageNotFoundErr}, expectedCreates: 1,
+			expectedErr: imageNotFoundErr},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter := newTestMounter(&Config{CreateContainerRetries: testCase.retries}, newMemoryFilesystem())
+			criInstance := newFakeCRI()
+			criInstance.createErrs = testCase.createErrs
+
+			err := mounter.createContainerWithRetries(context.Background(),
+				criInstance,
+				"iguazio/v3io-fuse:local",
+				"v3io-fuse",
+				fakeTargetPath,
+				nil,
+				cri.ContainerOptions{})
+			if err != testCase.expectedErr {
+				t.Fatalf("Expected error %v, got %v", testCase.expectedErr, err)
+			}
+
+			creates := 0
+			for _, call := range criInstance.getCalls() {
+				if call == "CreateContainer" {
+					creates++
+				}
+			}
+
+			if creates != testCase.expectedCreates {
+				t.Fatalf("Expected %d creates, got %d (calls: %v)", testCase.expectedCreates, creates, criInstance.getCalls())
+			}
+
+			if _, found := criInstance.containers["v3io-fuse"]; found != (testCase.expectedErr == nil) {
+				t.Fatalf("Expected container created: %t, got %t", testCase.expectedErr == nil, found)
+			}
+		})
+	}
+}
+
+func TestPullImage(t *testing.T) {
+	const image = "iguazio/v3io-fuse:3.5.0"
+
+	pullErr := errors.New("pull access denied")
+
+	for _, testCase := range []struct {
+		name           string
+		config         Config
+		pullErr        error
+		expectedPolicy string
+		expectedDigest string
+		expectedErr    error
+	}{
+		{name: "default policy", expectedDigest: "sha256:0123"},
+		{name: "if not present", config: Config{ImagePullPolicy: cri.PullPolicyIfNotPresent},
+			expectedPolicy: cri.PullPolicyIfNotPresent, expectedDigest: "sha256:0123"},
+		{name: "always", config: Config{ImagePullPolicy: cri.PullPolicyAlways, ImagePullTimeoutSeconds: 30},
+			expectedPolicy: cri.PullPolicyAlways, expectedDigest: "sha256:0123"},
+		{name: "pull fails", config: Config{ImagePullPolicy: cri.PullPolicyAlways}, pullErr: pullErr,
+			expectedPolicy: cri.PullPolicyAlways, expectedErr: pullErr},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter, criInstance := newFakeCRIMounter(t, &testCase.config)
+			criInstance.imageDigest = "sha256:0123"
+			criInstance.pullErr = testCase.pullErr
+
+			imageDigest, err := mounter.pullImage(image)
+			if err != testCase.expectedErr {
+				t.Fatalf("Expected error %v, got %v", testCase.expectedErr, err)
+			}
+
+			if imageDigest != testCase.expectedDigest {
+				t.Fatalf("Expected digest %q, got %q", testCase.expectedDigest, imageDigest)
+			}
+
+			if len(criInstance.pulls) != 1 {
+				t.Fatalf("Expected one pull, got %d", len(criInstance.pulls))
+			}
+
+			if policy := criInstance.pulls[0].Policy; policy != testCase.expectedPolicy {
+				t.Fatalf("Expected policy %q, got %q", testCase.expectedPolicy, policy)
+			}
+
+			if timeout := criInstance.pulls[0].Timeout; timeout != testCase.config.getImagePullTimeout() {
+				t.Fatalf("Expected timeout %s, got %s", testCase.config.getImagePullTimeout(), timeout)
+			}
+		})
+	}
+}
+
+func TestMountPullsImageOnlyToCreateContainer(t *testing.T) {
+	const specString = `{"container": "bigdata", "accessKey": "key", "kubernetes.io/pod.namespace": "default-tenant"}`
+
+	const linkPath = "/mnt/v3io/default-tenant/bigdata"
+
+	pullErr := errors.New("registry unavailable")
+
+	for _, testCase := range []struct {
+		name           string
+		config         Config
+		mountedPaths   []string
+		pullErr        error
+		expectedPulls  int
+		expectedStatus string
+	}{
+		{name: "not mounted", expectedPulls: 1, expectedStatus: "Success"},
+		{name: "not mounted, pull fails", pullErr: pullErr, expectedPulls: 1, expectedStatus: "Failure"},
+		{name: "already mounted", mountedPaths: []string{fakeTargetPath}, expectedStatus: "Success"},
+		{name: "already mounted, registry unavailable", mountedPaths: []string{fakeTargetPath}, pullErr: pullErr,
+			expectedStatus: "Success"},
+		{name: "link not mounted", config: Config{Type: "link", ContainerNameStrategy: ContainerNameStrategyHash},
+			expectedPulls: 1, expectedStatus: "Success"},
+		{name: "link mounted", config: Config{Type: "link"}, mountedPaths: []string{linkPath}, pullErr: pullErr,
+			expectedStatus: "Success"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			useMountInfo(t, testCase.mountedPaths...)
+
+			originalMountSpecsDir := mountSpecsDir
+			mountSpecsDir = t.TempDir()
+			t.Cleanup(func() { mountSpecsDir = originalMountSpecsDir })
+
+			config := testCase.config
+			config.Clusters = []ClusterConfig{{Name: "default", DataUrls: []string{"tcp://10.0.0.1:1234"}}}
+
+			mounter, criInstance := newFakeCRIMounter(t, &config)
+			criInstance.pullErr = testCase.pullErr
+
+			// kubelet creates the target before mounting it
+			filesystem := newMemoryFilesystem()
+			filesystem.MkdirAll(fakeTargetPath, 0750) // nolint: errcheck
+			mounter.filesystem = filesystem
+
+			for _, mountedPath := range testCase.mountedPaths {
+				filesystem.mount(mountedPath)
+			}
+
+			if len(testCase.mountedPaths) != 0 && config.Type != "link" {
+				containerName, _ := getContainerNameFromTargetPath(fakeTargetPath)
+				criInstance.containers[containerName] = &cri.ContainerStatus{State: cri.ContainerStateRunning}
+			}
+
+			response := mounter.Mount(fakeTargetPath, specString)
+			if response.Status != testCase.expectedStatus {
+				t.Fatalf("Expected status %s, got %+v", testCase.expectedStatus, response)
+			}
+
+			// an existing mount is answered without reaching the runtime's image store or the registry
+			if len(criInstance.pulls) != testCase.expectedPulls {
+				t.Fatalf("Expected %d pulls, got calls %v", testCase.expectedPulls, criInstance.getCalls())
+			}
+		})
+	}
+}
+
+func TestCreateContainerNameConflict(t *testing.T) {
+	nameInUseErr := fmt.Errorf("%w: v3io-fuse", cri.ErrContainerNameInUse)
+
+	for _, testCase := range []struct {
+		name               string
+		nameConflictPolicy string
+		existingState      string
+		createErrs         []error
+		expectedCalls      []string
+		expectError        bool
+	}{
+		{name: "no conflict", expectedCalls: []string{"CreateContainer"}},
+		{name: "retry", existingState: cri.ContainerStateRunning,
+			expectedCalls: []string{"CreateContainer", "RemoveContainer", "CreateContainer"}},
+		{name: "retry conflicts again", createErrs: []error{nameInUseErr, nameInUseErr},
+			expectedCalls: []string{"CreateContainer", "RemoveContainer", "CreateContainer"}, expectError: true},
+		{name: "reuse running", nameConflictPolicy: NameConflictPolicyReuse, existingState: cri.ContainerStateRunning,
+			expectedCalls: []string{"CreateContainer", "ContainerStatus"}},
+		{name: "reuse exited", nameConflictPolicy: NameConflictPolicyReuse, existingState: cri.ContainerStateExited,
+			expectedCalls: []string{"CreateContainer", "ContainerStatus", "RemoveContainer", "CreateContainer"}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter := newTestMounter(&Config{NameConflictPolicy: testCase.nameConflictPolicy}, newMemoryFilesystem())
+			criInstance := newFakeCRI()
+			criInstance.createErrs = testCase.createErrs
+
+			if testCase.existingState != "" {
+				criInstance.containers["v3io-fuse"] = &cri.ContainerStatus{State: testCase.existingState}
+			}
+
+			err := mounter.createContainer(criInstance, "image", "v3io-fuse", fakeTargetPath, nil, cri.ContainerOptions{})
+			if (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+
+			if !reflect.DeepEqual(criInstance.getCalls(), testCase.expectedCalls) {
+				t.Fatalf("Expected calls %v, got %v", testCase.expectedCalls, criInstance.getCalls())
+			}
+		})
+	}
+}
+
+func TestUmountTargetSlowUnmountWithinTimeout(t *testing.T) {
+	mounter := newTestMounter(&Config{UnmountTimeoutSeconds: 2, UnmountPollIntervalMilliseconds: 50},
+		newMemoryFilesystem())
+
+	// the mount goes away only after many polls, but within the configured timeout
+	unmountedTime := time.Now().Add(1500 * time.Millisecond)
+	var umountCalls [][]string
+
+	response := mounter.umountTarget(fakeTargetPath,
+		func(args ...string) error {
+			umountCalls = append(umountCalls, args)
+			return nil
+		},
+		func(string) bool {
+			return time.Now().Before(unmountedTime)
+		})
+
+	if response != nil {
+		t.Fatalf("Expected success, got %+v", response)
+	}
+
+	if len(umountCalls) != 1 {
+		t.Fatalf("Expected a single umount, got %v", umountCalls)
+	}
+}
+
+func TestUnmountFUSEOrder(t *testing.T) {
+	for _, testCase := range []struct {
+		name                  string
+		unmountOrder          string
+		umountFails           bool
+		expectRemovedAtUmount bool
+		expectRemoved         bool
+		expectSuccess         bool
+	}{
+		{name: "default", expectRemoved: true, expectSuccess: true},
+		{name: "umount first", unmountOrder: UnmountOrderUmountFirst, expectRemoved: true, expectSuccess: true},
+		{name: "umount first, umount fails", unmountOrder: UnmountOrderUmountFirst, umountFails: true},
+		{name: "container first", unmountOrder: UnmountOrderContainerFirst, expectRemovedAtUmount: true,
+			expectRemoved: true, expectSuccess: true},
+		{name: "container first, umount fails", unmountOrder: UnmountOrderContainerFirst, umountFails: true,
+			expectRemovedAtUmount: true, expectRemoved: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter, criInstance := newFakeCRIMounter(t, &Config{UnmountOrder: testCase.unmountOrder})
+			mounter.filesystem.MkdirAll(fakeTargetPath, 0755) // nolint: errcheck
+
+			containerName, _ := mounter.getContainerName(fakeTargetPath, nil)
+			criInstance.containers[containerName] = &cri.ContainerStatus{State: cri.ContainerStateRunning}
+
+			removedAtUmount := false
+			response := mounter.unmountFUSEWith(fakeTargetPath, func(string) *Response {
+				_, found := criInstance.containers[containerName]
+				removedAtUmount = !found
+
+				if testCase.umountFails {
+					return NewFailResponse("Failed to umount", nil)
+				}
+
+				return nil
+			})
+
+			if (response.Status == "Success") != testCase.expectSuccess {
+				t.Fatalf("Expected success: %t, got %+v", testCase.expectSuccess, response)
+			}
+
+			if removedAtUmount != testCase.expectRemovedAtUmount {
+				t.Fatalf("Expected the container removed at umount: %t", testCase.expectRemovedAtUmount)
+			}
+
+			if _, found := criInstance.containers[containerName]; found == testCase.expectRemoved {
+				t.Fatalf("Expected the container removed: %t", testCase.expectRemoved)
+			}
+		})
+	}
+}
+
+func TestUnmountFUSELazyFallback(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		releasingFlag string
+		expectSuccess bool
+	}{
+		{name: "released by lazy umount", releasingFlag: "-l", expectSuccess: true},
+		{name: "never released"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounter, _ := newFakeCRIMounter(t, &Config{
+				UnmountTimeoutSeconds:           1,
+				UnmountPollIntervalMilliseconds: 100,
+				LazyUnmountEscalationSeconds:    1,
+			})
+			mounter.filesystem.MkdirAll(fakeTargetPath, 0755) // nolint: errcheck
+			mount := &slowReleaseMount{releasingFlag: testCase.releasingFlag}
+
+			response := mounter.unmountFUSEWith(fakeTargetPath, func(targetPath string) *Response {
+				return mounter.umountTarget(targetPath, mount.umount, mount.isMounted)
+			})
+
+			if (response.Status == "Success") != testCase.expectSuccess {
+				t.Fatalf("Expected success: %t, got %+v", testCase.expectSuccess, response)
+			}
+
+			// the target may only be removed once it's no longer mounted
+			_, err := mounter.filesystem.Stat(fakeTargetPath)
+			if targetRemoved := os.IsNotExist(err); targetRemoved != testCase.expectSuccess {
+				t.Fatalf("Expected the target removed: %t, got %v", testCase.expectSuccess, err)
+			}
+		})
+	}
+}
+
+func TestDetectCRIOrder(t *testing.T) {
+	for _, testCase := range []struct {
+		name             string
+		presentRuntimes  []string
+		detectionOrder   []string
+		preferredRuntime string
+		expectedRuntime  string
+	}{
+		{name: "only CRI-O", presentRuntimes: []string{CRICRIO}, expectedRuntime: CRICRIO},
+		{name: "docker before CRI-O", presentRuntimes: []string{CRIDocker, CRICRIO}, expectedRuntime: CRIDocker},
+		{name: "CRI-O first in order", presentRuntimes: []string{CRIDocker, CRICRIO},
+			detectionOrder: []string{CRICRIO, CRIDocker}, expectedRuntime: CRICRIO},
+		{name: "CRI-O preferred", presentRuntimes: []string{CRIDocker, CRICRIO}, preferredRuntime: CRICRIO,
+			expectedRuntime: CRICRIO},
+		{name: "absent runtime skipped", presentRuntimes: []string{CRIDocker},
+			detectionOrder: []string{CRICRIO, CRIDocker}, expectedRuntime: CRIDocker},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			useFakeRuntimes(t, true, testCase.presentRuntimes...)
+			mounter := newTestMounter(&Config{
+				CRIDetectionOrder: testCase.detectionOrder,
+				PreferredRuntime:  testCase.preferredRuntime,
+			}, newMemoryFilesystem())
+
+			criInstance, err := mounter.createCRI()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if runtimeName := getCRIRuntimeName(criInstance); runtimeName != testCase.expectedRuntime {
+				t.Fatalf("Expected %s, got %T", testCase.expectedRuntime, criInstance)
+			}
+		})
+	}
+}
+
+func TestDetectCRIMultipleRuntimes(t *testing.T) {
+	for _, testCase := range []struct {
+		name             string
+		presentRuntimes  []string
+		preferredRuntime string
+		expectedRuntime  string
+		expectWarning    bool
+	}{
+		{name: "both, docker first by default", presentRuntimes: []string{CRIDocker, CRICRIO},
+			expectedRuntime: CRIDocker, expectWarning: true},
+		{name: "both, docker preferred", presentRuntimes: []string{CRIDocker, CRICRIO}, preferredRuntime: CRIDocker,
+			expectedRuntime: CRIDocker, expectWarning: true},
+		{name: "both, CRI-O preferred", presentRuntimes: []string{CRIDocker, CRICRIO}, preferredRuntime: CRICRIO,
+			expectedRuntime: CRICRIO, expectWarning: true},
+		{name: "preferred runtime absent", presentRuntimes: []string{CRICRIO}, preferredRuntime: CRIDocker,
+			expectedRuntime: CRICRIO},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			getLogs := captureJournal(t)
+			useFakeRuntimes(t, true, testCase.presentRuntimes...)
+			mounter := newTestMounter(&Config{PreferredRuntime: testCase.preferredRuntime}, newMemoryFilesystem())
+
+			criInstance, err := mounter.createCRI()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if runtimeName := getCRIRuntimeName(criInstance); runtimeName != testCase.expectedRuntime {
+				t.Fatalf("Expected %s, got %s", testCase.expectedRuntime, runtimeName)
+			}
+
+			if warned := strings.Contains(getLogs(), "Multiple CRI runtimes found"); warned != testCase.expectWarning {
+				t.Fatalf("Expected a multiple runtimes warning: %t, got %t", testCase.expectWarning, warned)
+			}
+		})
+	}
+}
+
+// getCRIRuntimeName returns the name of the runtime a CRI talks to
+func getCRIRuntimeName(criInstance cri.CRI) string {
+	switch criInstance.(type) {
+	case *cri.Docker:
+		return CRIDocker
+	case *cri.CRIO:
+		return CRICRIO
+	case *cri.Containerd:
+		return CRIContainerd
+	default:
+		return ""
+	}
+}
+
+func TestTimeoutMessages(t *testing.T) {
+	originalMountPollIntervals := mountPollIntervals
+	mountPollIntervals = []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond}
+
+	t.Cleanup(func() { mountPollIntervals = originalMountPollIntervals })
+
+	t.Run("mount", func(t *testing.T) {
+		mounter := newTestMounter(&Config{}, newMemoryFilesystem())
+		mounter.readinessStrategy = &staticReadiness{err: errors.New("no mount yet")}
+		criInstance := newFakeCRI()
+		criInstance.containers["v3io-fuse"] = &cri.ContainerStatus{State: cri.ContainerStateRunning}
+
+		err := mounter.waitForMount(context.Background(), criInstance, "image", "v3io-fuse", fakeTargetPath, &Spec{})
+		if err == nil {
+			t.Fatal("Expected a timeout")
+		}
+
+		expectedMessage := regexp.MustCompile(`^Failed to mount \S+ due to timeout \(waited [\d.]+m?s over 3 attempts, ` +
+			`last state: readiness check failed: no mount yet, container running\)`)
+		if !expectedMessage.MatchString(err.Error()) {
+			t.Fatalf("Unexpected message %s", err)
+		}
+	})
+
+	t.Run("unmount", func(t *testing.T) {
+		mounter := newTestMounter(&Config{
+			UnmountTimeoutSeconds:           1,
+			UnmountPollIntervalMilliseconds: 250,
+			LazyUnmountEscalationSeconds:    1,
+		}, newMemoryFilesystem())
+		mount := &slowReleaseMount{}
+
+		response := mounter.umountTarget(fakeTargetPath, mount.umount, mount.isMounted)
+		if response == nil {
+			t.Fatal("Expected a timeout")
+		}
+
+		expectedMessage := regexp.MustCompile(`^Failed to umount \S+ due to timeout \(waited [\d.]+m?s over \d+ attempts, ` +
+			`last state: still mounted after lazy umount\)`)
+		if !expectedMessage.MatchString(response.Message) {
+			t.Fatalf("Unexpected message %s", response.Message)
+		}
+	})
+}
+
+func TestCreateCRIExplicitType(t *testing.T) {
+	for _, testCase := range []struct {
+		name            string
+		criType         string
+		presentRuntimes []string
+		criSocketPath   string
+		expectedRuntime string
+		expectError     bool
+	}{
+		{name: "docker", criType: CRIDocker, presentRuntimes: []string{CRIDocker}, expectedRuntime: CRIDocker},
+		{name: "crio", criType: CRICRIO, presentRuntimes: []string{CRICRIO}, expectedRuntime: CRICRIO},
+		{name: "explicit despite other runtimes", criType: CRICRIO, presentRuntimes: []string{CRIDocker, CRICRIO},
+			expectedRuntime: CRICRIO},
+		{name: "docker socket missing", criType: CRIDocker, presentRuntimes: []string{CRICRIO}, expectError: true},
+		{name: "crio socket missing", criType: CRICRIO, presentRuntimes: []string{CRIDocker}, expectError: true},
+		{name: "containerd socket missing", criType: CRIContainerd, presentRuntimes: []string{CRIDocker},
+			expectError: true},
+		{name: "custom socket missing", criType: CRICRIO, presentRuntimes: []string{CRICRIO},
+			criSocketPath: "/missing/crio.sock", expectError: true},
+		{name: "auto", criType: CRITypeAuto, presentRuntimes: []string{CRICRIO}, expectedRuntime: CRICRIO},
+		{name: "unset", presentRuntimes: []string{CRIDocker}, expectedRuntime: CRIDocker},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			useFakeRuntimes(t, true, testCase.presentRuntimes...)
+			mounter := newTestMounter(&Config{CRIType: testCase.criType, CRISocketPath: testCase.criSocketPath},
+				newMemoryFilesystem())
+
+			criInstance, err := mounter.createCRI()
+			if testCase.expectError {
+				if err == nil || !strings.Contains(err.Error(), "is unavailable") {
+					t.Fatalf("Expected an unavailable socket error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if runtimeName := getCRIRuntimeName(criInstance); runtimeName != testCase.expectedRuntime {
+				t.Fatalf("Expected %s, got %T", testCase.expectedRuntime, criInstance)
+			}
+		})
+	}
+}
+
+// captureJournal sends the journal's output, debug messages included, to a file until the test ends, returning
+// a function that reads what was logged
+func captureJournal(t *testing.T) func() string {
+	logFilePath := filepath.Join(t.TempDir(), "journal.log")
+
+	journal.SetOutput(journal.OutputConfig{Output: journal.OutputFile, FilePath: logFilePath})
+	journal.SetLevel("debug") // nolint: errcheck
+	journal.SetDebugRateLimit(0, 0)
+
+	t.Cleanup(func() {
+		journal.SetOutput(journal.OutputConfig{})
+		journal.SetDebugRateLimit(journal.DefaultDebugRatePerSecond, journal.DefaultDebugBurst)
+	})
+
+	return func() string {
+		logs, _ := ioutil.ReadFile(logFilePath)
+		return string(logs)
+	}
+}
+
+func TestAccessKeyNeverLogged(t *testing.T) {
+	const accessKey = "raw-access-key-0123456789"
+
+	getLogs := captureJournal(t)
+	useFakeRuntimes(t, true, CRIDocker)
+
+	mounter, fakeCRIInstance := newFakeCRIMounter(t, &Config{
+		Clusters: []ClusterConfig{{Name: "default", DataUrls: []string{"tcp://10.0.0.1:1234"}}},
+	})
+	spec := &Spec{Container: "bigdata", AccessKey: accessKey}
+
+	// the docker CLI logs the command line it runs
+	mounter.criFactory = nil
+
+	if err := mounter.createV3IOFUSEContainer(context.Background(), spec, fakeTargetPath); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// a failing fuse process may echo its command line, which ends up in the mount's error
+	originalMountPollIntervals := mountPollIntervals
+	mountPollIntervals = []time.Duration{time.Millisecond}
+	t.Cleanup(func() { mountPollIntervals = originalMountPollIntervals })
+
+	mounter.readinessStrategy = &staticReadiness{}
+	fakeCRIInstance.logs = "failed to connect: v3io-fuse --session_key " + accessKey
+	fakeCRIInstance.containers["v3io-fuse"] = &cri.ContainerStatus{State: cri.ContainerStateExited, ExitCode: 1}
+
+	err := mounter.waitForMount(context.Background(), fakeCRIInstance, "image", "v3io-fuse", fakeTargetPath, spec)
+	if err == nil {
+		t.Fatal("Expected the mount to fail")
+	}
+
+	journal.Info("Mount failed", "err", err.Error())
+
+	logs := getLogs()
+	if !strings.Contains(logs, "Executing docker run command") || !strings.Contains(logs, "failed to connect") {
+		t.Fatalf("Expected the command line and the fuse logs to be logged, got %s", logs)
+	}
+
+	if strings.Contains(logs, accessKey) {
+		t.Fatalf("Expected the access key to be redacted, got %s", logs)
+	}
+}
+
+func TestCheckNodeMountLimit(t *testing.T) {
+	v3ioMounts := []mountInfoEntry{
+		{device: "0:40", mountPoint: "/var/lib/kubelet/pods/a/volumes/v3io~fuse/v3io"},
+		{device: "0:41", mountPoint: "/var/lib/kubelet/pods/b/volumes/v3io~fuse/v3io"},
+		{device: "0:42", mountPoint: "/mnt/v3io/default/bigdata"},
+
+		// a shared mount and its targets are a single fuse mount
+		{device: "0:43", mountPoint: "/mnt/v3io-shared/0123456789abcdef"},
+		{device: "0:43", mountPoint: "/var/lib/kubelet/pods/c/volumes/v3io~fuse/v3io"},
+		{device: "0:43", mountPoint: "/var/lib/kubelet/pods/d/volumes/v3io~fuse/v3io"},
+		{device: "0:43", mountPoint: "/var/lib/kubelet/pods/e/volumes/v3io~fuse/v3io"},
+	}
+
+	for _, testCase := range []struct {
+		name             string
+		maxMountsPerNode int
+		expectFailure    bool
+	}{
+		{name: "under the limit", maxMountsPerNode: 5},
+		{name: "at the limit", maxMountsPerNode: 4, expectFailure: true},
+		{name: "over the limit", maxMountsPerNode: 3, expectFailure: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+
+			// mounts other than v3io's don't count
+			useMountInfoEntries(t, append([]mountInfoEntry{
+				{device: "8:1", mountPoint: "/"},
+				{device: "0:5", mountPoint: "/proc"},
+				{device: "0:30", mountPoint: "/var/lib/kubelet/pods/c/volumes/kubernetes.io~secret/s"},
+			}, v3ioMounts...)...)
+			mounter := newTestMounter(&Config{MaxMountsPerNode: testCase.maxMountsPerNode}, newMemoryFilesystem())
+
+			response := mounter.checkNodeMountLimit()
+			if (response != nil) != testCase.expectFailure {
+				t.Fatalf("Expected failure: %t, got %+v", testCase.expectFailure, response)
+			}
+
+			expectedMessage := fmt.Sprintf("Node mount limit reached (4 of %d mounts)", testCase.maxMountsPerNode)
+			if response != nil && (!response.Transient || !strings.Contains(response.Message, expectedMessage)) {
+				t.Fatalf("Expected a transient failure with %q, got %+v", expectedMessage, response)
+			}
+		})
+	}
+}
+
+func TestNodeMountLimitInLinkMode(t *testing.T) {
+	const linkPath = "/mnt/v3io/default-tenant/bigdata"
+
+	for _, testCase := range []struct {
+		name           string
+		mountedPaths   []string
+		expectedStatus string
+	}{
+		{name: "new link", mountedPaths: []string{"/mnt/v3io/default-tenant/users"}, expectedStatus: "Failure"},
+
+		// the link's fuse mount is already counted
+		{name: "existing link", mountedPaths: []string{linkPath}, expectedStatus: "Success"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			useMountInfo(t, testCase.mountedPaths...)
+
+			mounter, criInstance := newFakeCRIMounter(t, &Config{
+				Type:                  "link",
+				ContainerNameStrategy: ContainerNameStrategyHash,
+				MaxMountsPerNode:      1,
+			})
+
+			filesystem := newMemoryFilesystem()
+			filesystem.MkdirAll(fakeTargetPath, 0750) // nolint: errcheck
+			mounter.filesystem = filesystem
+
+			for _, mountedPath := range testCase.mountedPaths {
+				filesystem.mount(mountedPath)
+			}
+
+			response := mounter.mountAsLink(context.Background(),
+				&Spec{Namespace: "default-tenant", Container: "bigdata", OverrideAccessKey: "key"},
+				fakeTargetPath)
+			if response.Status != testCase.expectedStatus {
+				t.Fatalf("Expected status %s, got %+v", testCase.expectedStatus, response)
+			}
+
+			if response.Status == "Failure" && !strings.Contains(response.Message, "Node mount limit reached") {
+				t.Fatalf("Expected the node mount limit to be reached, got %s", response.Message)
+			}
+
+			if calls := criInstance.getCalls(); len(calls) != 0 {
+				t.Fatalf("Expected no CRI calls, got %v", calls)
+			}
+		})
+	}
+}
+
+// vanishingFilesystem has kubelet remove a target just as the mounter is about to remove it itself
+type vanishingFilesystem struct {
+	*memoryFilesystem
+	vanishingPath string
+}
+
+func (f *vanishingFilesystem) Remove(path string) error {
+	if path == f.vanishingPath {
+		f.memoryFilesystem.Remove(path) // nolint: errcheck
+	}
+
+	return f.memoryFilesystem.Remove(path)
+}
+
+func TestTargetRemovedMidOperation(t *testing.T) {
+	const targetPath = "/pods/uid/volumes/v3io"
+
+	for _, testCase := range []struct {
+		name    string
+		operate func(mounter *Mounter) *Response
+	}{
+		{name: "unmount", operate: func(mounter *Mounter) *Response {
+			return mounter.completeUnmount(targetPath)
+		}},
+		{name: "link mount", operate: func(mounter *Mounter) *Response {
+			return mounter.mountAsLink(nil, &Spec{Namespace: "default", Container: "bigdata"}, targetPath)
+		}},
+		{name: "link unmount", operate: func(mounter *Mounter) *Response {
+			return mounter.unmountAsLink(targetPath)
+		}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := &vanishingFilesystem{memoryFilesystem: newMemoryFilesystem(), vanishingPath: targetPath}
+			filesystem.mount("/mnt/v3io/default/bigdata")
+			filesystem.MkdirAll(targetPath, 0750) // nolint: errcheck
+
+			mounter := newTestMounter(&Config{Type: "link"}, filesystem)
+
+			if response := testCase.operate(mounter); response.Status != "Success" {
+				t.Fatalf("Expected success, got %+v", response)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package flex
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+// mountInfoPath is the mount table. It's a variable so that tests can feed a synthetic one
+var mountInfoPath = "/proc/self/mountinfo"
+
+func isMountPoint(path string) bool {
+	journal.Debug("Checking if path is a mount point", "target", path)
+
+	mountInfoFile, err := os.Open(mountInfoPath)
+	if err != nil {
+		journal.Debug("Failed to open mount info, falling back to mount", "err", err.Error())
+		return isMountPointByMountCommand(path)
+	}
+
+	defer mountInfoFile.Close() // nolint: errcheck
+
+	mountPoints, err := readMountInfoMountPoints(mountInfoFile)
+	if err != nil {
+		journal.Debug("Failed to read mount info, falling back to mount", "err", err.Error())
+		return isMountPointByMountCommand(path)
+	}
+
+	result := containsMountPoint(mountPoints, resolveMountPointPath(path))
+
+	if result {
+		journal.Debug("Path is a mount point", "target", path)
+	} else {
+		journal.Debug("Path is not a mount point", "target", path)
+	}
+
+	return result
+}
+
+// mountInfoEntry is a mount of a mountinfo file. Bind mounts of the same filesystem share its device
+type mountInfoEntry struct {
+	device     string
+	mountPoint string
+}
+
+// readMountInfoMountPoints returns the mount point field of every line of a mountinfo file
+func readMountInfoMountPoints(reader io.Reader) ([]string, error) {
+	entries, err := readMountInfoEntries(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var mountPoints []string
+	for _, entry := range entries {
+		mountPoints = append(mountPoints, entry.mountPoint)
+	}
+
+	return mountPoints, nil
+}
+
+// readMountInfoEntries returns the device and mount point fields of every line of a mountinfo file:
+// <id> <parent id> <major:minor> <root> <mount point> <options> [<optional fields>...] - <type> <source> <options>
+func readMountInfoEntries(reader io.Reader) ([]mountInfoEntry, error) {
+	var entries []mountInfoEntry
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		entries = append(entries, mountInfoEntry{device: fields[2], mountPoint: unescapeMountInfoField(fields[4])})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// unescapeMountInfoField decodes the octal escapes (e.g. \040 for space) the kernel uses for whitespace and
+// backslashes in mountinfo fields
+func unescapeMountInfoField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var unescaped strings.Builder
+	for idx := 0; idx < len(field); idx++ {
+		if field[idx] == '\\' && idx+3 < len(field) {
+			if value, err := strconv.ParseUint(field[idx+1:idx+4], 8, 8); err == nil {
+				unescaped.WriteByte(byte(value))
+				idx += 3
+				continue
+			}
+		}
+
+		unescaped.WriteByte(field[idx])
+	}
+
+	return unescaped.String()
+}
+
+func containsMountPoint(mountPoints []string, path string) bool {
+	for _, mountPoint := range mountPoints {
+		if mountPoint == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveMountPointPath returns the path as the mount table would show it. Only the parent is resolved, as
+// stating the path itself would hang or fail on a dead fuse mount
+func resolveMountPointPath(path string) string {
+	cleanPath, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+
+	resolvedParentPath, err := filepath.EvalSymlinks(filepath.Dir(cleanPath))
+	if err != nil {
+		return cleanPath
+	}
+
+	return filepath.Join(resolvedParentPath, filepath.Base(cleanPath))
+}
+
+// isMountPointByMountCommand looks the path up in the output of mount, for when /proc is unavailable
+func isMountPointByMountCommand(path string) bool {
+	mountList, err := exec.Command("mount").CombinedOutput()
+	if err != nil {
+		journal.Debug("Path is not a mount point", "target", path)
+		return false
+	}
+
+	result := strings.Contains(string(mountList), path+" type")
+
+	if result {
+		journal.Debug("Path is a mount point", "target", path)
+	} else {
+		journal.Debug("Path is not a mount point", "target", path)
+	}
+
+	return result
+}
@@ -0,0 +1,102 @@
+package flex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testMountInfo = `22 1 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:5 - proc proc rw
+40 22 0:35 / /data-backup rw,relatime shared:20 - fuse v3io rw,user_id=0,group_id=0
+41 22 0:36 / /mnt/with\040space rw,relatime - fuse v3io rw
+short line
+`
+
+func TestReadMountInfoMountPoints(t *testing.T) {
+	mountPoints, err := readMountInfoMountPoints(strings.NewReader(testMountInfo))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	for _, testCase := range []struct {
+		path          string
+		expectMounted bool
+	}{
+		{path: "/data-backup", expectMounted: true},
+		{path: "/data"},
+		{path: "/data-backup/sub"},
+		{path: "/mnt/with space", expectMounted: true},
+		{path: `/mnt/with\040space`},
+		{path: "/proc", expectMounted: true},
+	} {
+		t.Run(testCase.path, func(t *testing.T) {
+			if mounted := containsMountPoint(mountPoints, testCase.path); mounted != testCase.expectMounted {
+				t.Fatalf("Expected mounted: %t, got %t", testCase.expectMounted, mounted)
+			}
+		})
+	}
+}
+
+func TestResolveMountPointPathSymlinkedParent(t *testing.T) {
+	baseDir := t.TempDir()
+
+	// the base may itself be under a symlink (e.g. /tmp on some systems)
+	resolvedBaseDir, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		t.Fatalf("Failed to resolve %s: %s", baseDir, err)
+	}
+
+	os.Mkdir(filepath.Join(baseDir, "pods"), 0755)                                  // nolint: errcheck
+	os.Symlink(filepath.Join(baseDir, "pods"), filepath.Join(baseDir, "pods-link")) // nolint: errcheck
+	mountPoints := []string{filepath.Join(resolvedBaseDir, "pods", "v3io")}
+
+	for _, testCase := range []struct {
+		name          string
+		path          string
+		expectMounted bool
+	}{
+		{name: "direct", path: filepath.Join(baseDir, "pods", "v3io"), expectMounted: true},
+		{name: "through symlink", path: filepath.Join(baseDir, "pods-link", "v3io"), expectMounted: true},
+		{name: "unclean", path: filepath.Join(baseDir, "pods-link") + "/./v3io/", expectMounted: true},
+		{name: "sibling", path: filepath.Join(baseDir, "pods-link", "v3io2")},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mounted := containsMountPoint(mountPoints, resolveMountPointPath(testCase.path))
+			if mounted != testCase.expectMounted {
+				t.Fatalf("Expected mounted: %t, got %t", testCase.expectMounted, mounted)
+			}
+		})
+	}
+}
+
+// useMountInfo points the mount table at a synthetic one holding the given mount points
+func useMountInfo(t *testing.T, mountPoints ...string) {
+	var entries []mountInfoEntry
+	for mountPointIdx, mountPoint := range mountPoints {
+		entries = append(entries, mountInfoEntry{device: fmt.Sprintf("0:%d", mountPointIdx+40), mountPoint: mountPoint})
+	}
+
+	useMountInfoEntries(t, entries...)
+}
+
+// useMountInfoEntries is useMountInfo with the mounts' devices given, so that bind mounts can share them
+func useMountInfoEntries(t *testing.T, entries ...mountInfoEntry) {
+	var mountInfo strings.Builder
+	for entryIdx, entry := range entries {
+		fmt.Fprintf(&mountInfo, "%d 22 %s / %s rw,relatime - fuse v3io rw\n",
+			entryIdx+40,
+			entry.device,
+			strings.Replace(entry.mountPoint, " ", `\040`, -1))
+	}
+
+	mountInfoFilePath := filepath.Join(t.TempDir(), "mountinfo")
+	ioutil.WriteFile(mountInfoFilePath, []byte(mountInfo.String()), 0644) // nolint: errcheck
+
+	originalMountInfoPath := mountInfoPath
+	mountInfoPath = mountInfoFilePath
+
+	t.Cleanup(func() { mountInfoPath = originalMountInfoPath })
+}
@@ -0,0 +1,90 @@
+package flex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// exclusiveMountOptions groups flags of which at most one may be set, keyed by flag
+var exclusiveMountOptions = map[string]string{
+	"ro":          "ro/rw",
+	"rw":          "ro/rw",
+	"allow_other": "allow_other/allow_root",
+	"allow_root":  "allow_other/allow_root",
+	"suid":        "suid/nosuid",
+	"nosuid":      "suid/nosuid",
+	"dev":         "dev/nodev",
+	"nodev":       "dev/nodev",
+	"exec":        "exec/noexec",
+	"noexec":      "exec/noexec",
+}
+
+// mergeMountOptions merges the fuse mount options of the config with those of the spec. Duplicates are dropped,
+// and a spec option overrides a config option it conflicts with (e.g. rw and ro, or two uid= values). Conflicting
+// options from the same source are an error
+func mergeMountOptions(configOptions []string, specOptions []string) ([]string, error) {
+	mergedOptions, err := dedupMountOptions(configOptions, "config")
+	if err != nil {
+		return nil, err
+	}
+
+	specOptions, err = dedupMountOptions(specOptions, "spec")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, specOption := range specOptions {
+		specOptionKey := getMountOptionKey(specOption)
+
+		overridden := false
+		for mergedOptionIdx, mergedOption := range mergedOptions {
+			if getMountOptionKey(mergedOption) == specOptionKey {
+				mergedOptions[mergedOptionIdx] = specOption
+				overridden = true
+				break
+			}
+		}
+
+		if !overridden {
+			mergedOptions = append(mergedOptions, specOption)
+		}
+	}
+
+	return mergedOptions, nil
+}
+
+// dedupMountOptions drops duplicate options, failing on options that conflict
+func dedupMountOptions(options []string, source string) ([]string, error) {
+	var dedupedOptions []string
+	optionsByKey := map[string]string{}
+
+	for _, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+
+		optionKey := getMountOptionKey(option)
+		if existingOption, found := optionsByKey[optionKey]; found {
+			if existingOption != option {
+				return nil, fmt.Errorf("Conflicting %s mount options %s and %s", source, existingOption, option)
+			}
+
+			continue
+		}
+
+		optionsByKey[optionKey] = option
+		dedupedOptions = append(dedupedOptions, option)
+	}
+
+	return dedupedOptions, nil
+}
+
+// getMountOptionKey returns what an option sets, such that options with the same key conflict unless equal
+func getMountOptionKey(option string) string {
+	if exclusiveGroup, found := exclusiveMountOptions[option]; found {
+		return exclusiveGroup
+	}
+
+	return strings.SplitN(option, "=", 2)[0]
+}
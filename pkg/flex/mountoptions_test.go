@@ -0,0 +1,40 @@
+package flex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeMountOptions(t *testing.T) {
+	for _, testCase := range []struct {
+		name            string
+		configOptions   []string
+		specOptions     []string
+		expectedOptions []string
+		expectError     bool
+	}{
+		{name: "no options"},
+		{name: "distinct", configOptions: []string{"allow_other"}, specOptions: []string{"ro"},
+			expectedOptions: []string{"allow_other", "ro"}},
+		{name: "duplicates", configOptions: []string{"ro", " ro", "uid=1000", ""}, specOptions: []string{"ro", "ro"},
+			expectedOptions: []string{"ro", "uid=1000"}},
+		{name: "spec overrides flag", configOptions: []string{"rw", "nodev"}, specOptions: []string{"ro"},
+			expectedOptions: []string{"ro", "nodev"}},
+		{name: "spec overrides value", configOptions: []string{"uid=1000"}, specOptions: []string{"uid=2000"},
+			expectedOptions: []string{"uid=2000"}},
+		{name: "config conflict", configOptions: []string{"ro", "rw"}, expectError: true},
+		{name: "spec conflict", specOptions: []string{"uid=1000", "uid=2000"}, expectError: true},
+		{name: "spec exclusive conflict", specOptions: []string{"allow_other", "allow_root"}, expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			mergedOptions, err := mergeMountOptions(testCase.configOptions, testCase.specOptions)
+			if (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+
+			if !reflect.DeepEqual(mergedOptions, testCase.expectedOptions) {
+				t.Fatalf("Expected %v, got %v", testCase.expectedOptions, mergedOptions)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package flex
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const defaultPreflightTimeout = 3 * time.Second
+
+var ErrBackendUnreachable = errors.New("backend unreachable")
+
+// checkBackendReachable TCP-probes the cluster's data URLs, failing with ErrBackendUnreachable if none of them
+// accepts a connection
+func (m *Mounter) checkBackendReachable(dataURLs string) error {
+	timeout := defaultPreflightTimeout
+	if m.Config.PreflightTimeoutSeconds > 0 {
+		timeout = time.Duration(m.Config.PreflightTimeoutSeconds) * time.Second
+	}
+
+	var probeErrors []string
+	for _, dataURL := range strings.Split(dataURLs, ",") {
+		address, err := getDataURLAddress(dataURL)
+		if err != nil {
+			probeErrors = append(probeErrors, err.Error())
+			continue
+		}
+
+		connection, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			journal.Debug("Backend endpoint is unreachable", "address", address, "err", err.Error())
+			probeErrors = append(probeErrors, err.Error())
+			continue
+		}
+
+		connection.Close() // nolint: errcheck
+
+		journal.Debug("Backend endpoint is reachable", "address", address)
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrBackendUnreachable, strings.Join(probeErrors, "; "))
+}
+
+// getDataURLAddress returns the host:port of a data URL, which may be a URL (tcp://10.0.0.1:1234) or an address
+func getDataURLAddress(dataURL string) (string, error) {
+	dataURL = strings.TrimSpace(dataURL)
+
+	parsedURL, err := url.Parse(dataURL)
+	if err != nil || parsedURL.Host == "" {
+		if _, _, err := net.SplitHostPort(dataURL); err != nil {
+			return "", fmt.Errorf("Invalid data URL %s: %s", dataURL, err)
+		}
+
+		return dataURL, nil
+	}
+
+	if parsedURL.Port() != "" {
+		return parsedURL.Host, nil
+	}
+
+	switch parsedURL.Scheme {
+	case "http":
+		return net.JoinHostPort(parsedURL.Hostname(), "80"), nil
+	case "https":
+		return net.JoinHostPort(parsedURL.Hostname(), "443"), nil
+	default:
+		return "", fmt.Errorf("Data URL %s has no port", dataURL)
+	}
+}
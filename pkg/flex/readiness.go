@@ -0,0 +1,153 @@
+package flex
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/cri"
+)
+
+const (
+	ReadinessStrategyMountTable     = "mount-table"
+	ReadinessStrategyStat           = "stat"
+	ReadinessStrategyList           = "list"
+	ReadinessStrategyContainerProbe = "container-probe"
+)
+
+// ReadinessStrategy decides whether a freshly created v3io-fuse container is serving its mount
+type ReadinessStrategy interface {
+	IsReady(targetPath string, containerName string) (bool, error)
+}
+
+// newReadinessStrategy returns a strategy by name. The container probe reaches the container through CRIs
+// created by createCRI
+func newReadinessStrategy(name string, createCRI func() (cri.CRI, error)) (ReadinessStrategy, error) {
+	switch name {
+	case "", ReadinessStrategyMountTable:
+		return &mountTableReadiness{}, nil
+	case ReadinessStrategyStat:
+		return &statReadiness{}, nil
+	case ReadinessStrategyList:
+		return &listReadiness{}, nil
+	case ReadinessStrategyContainerProbe:
+		return &containerProbeReadiness{createCRI: createCRI}, nil
+	default:
+		return nil, fmt.Errorf("Unknown readiness strategy: %s", name)
+	}
+}
+
+// mountTableReadiness considers the target ready once it shows up in the mount table
+type mountTableReadiness struct{}
+
+func (r *mountTableReadiness) IsReady(targetPath string, containerName string) (bool, error) {
+	return isMountPoint(targetPath), nil
+}
+
+// statReadiness considers the target ready once it is mounted and its root can be stat'ed
+type statReadiness struct{}
+
+func (r *statReadiness) IsReady(targetPath string, containerName string) (bool, error) {
+	if !isMountPoint(targetPath) {
+		return false, nil
+	}
+
+	if err := probeWithTimeout(checkTimeout, func() error {
+		_, err := os.Stat(targetPath)
+		return err
+	}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// listReadiness considers the target ready once it is mounted and its root can be listed
+type listReadiness struct{}
+
+func (r *listReadiness) IsReady(targetPath string, containerName string) (bool, error) {
+	if !isMountPoint(targetPath) {
+		return false, nil
+	}
+
+	if err := probeWithTimeout(checkTimeout, func() error {
+		dir, err := os.Open(targetPath)
+		if err != nil {
+			return err
+		}
+
+		defer dir.Close() // nolint: errcheck
+
+		if _, err := dir.Readdirnames(1); err != nil && err != io.EOF {
+			return err
+		}
+
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// probeWithTimeout runs a probe of a mount, which blocks for as long as a hung fuse process doesn't answer, failing
+// it once the timeout passes. A probe that timed out is left to complete in the background
+func probeWithTimeout(timeout time.Duration, probe func() error) error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- probe()
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("Timed out after %s", timeout)
+	}
+}
+
+// containerProbeReadiness considers the target ready once the container's own mount table shows a fuse mount at
+// its mount point, for nodes where the target's mount table entry can't be relied on
+type containerProbeReadiness struct {
+	createCRI func() (cri.CRI, error)
+}
+
+func (r *containerProbeReadiness) IsReady(targetPath string, containerName string) (bool, error) {
+	criInstance, err := r.createCRI()
+	if err != nil {
+		return false, err
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	return isFuseMountedInContainer(criInstance, containerName)
+}
+
+// isFuseMountedInContainer returns whether a fuse filesystem is mounted at fuseMountPoint, per the container's
+// mount table. The mount point itself is a bind mount of the target, which the fuse mount is stacked on
+func isFuseMountedInContainer(criInstance cri.CRI, containerName string) (bool, error) {
+	mounts, err := criInstance.ExecInContainer(containerName, []string{"cat", "/proc/mounts"})
+	if err != nil {
+		return false, err
+	}
+
+	return hasFuseMount(mounts, fuseMountPoint), nil
+}
+
+// hasFuseMount returns whether a mount table in the /proc/mounts format has a fuse mount at a mount point
+func hasFuseMount(mounts string, mountPoint string) bool {
+	for _, mountLine := range strings.Split(mounts, "\n") {
+		mountFields := strings.Fields(mountLine)
+		if len(mountFields) < 3 || mountFields[1] != mountPoint {
+			continue
+		}
+
+		if mountFields[2] == "fuse" || strings.HasPrefix(mountFields[2], "fuse.") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,81 @@
+package flex
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHasFuseMount(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		mounts      string
+		expectMount bool
+	}{
+		{
+			name:   "bind mount only",
+			mounts: "overlay / overlay rw 0 0\n/dev/sda1 /fuse_mount ext4 rw 0 0\n",
+		},
+		{
+			name:        "fuse",
+			mounts:      "/dev/sda1 /fuse_mount ext4 rw 0 0\nv3io /fuse_mount fuse rw 0 0\n",
+			expectMount: true,
+		},
+		{
+			name:        "fuse subtype",
+			mounts:      "v3io /fuse_mount fuse.v3fs rw 0 0\n",
+			expectMount: true,
+		},
+		{
+			name:   "fuse elsewhere",
+			mounts: "v3io /mnt fuse rw 0 0\n",
+		},
+		{
+			name:   "fuseblk",
+			mounts: "/dev/sdb1 /fuse_mount fuseblk rw 0 0\n",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if mounted := hasFuseMount(testCase.mounts, fuseMountPoint); mounted != testCase.expectMount {
+				t.Fatalf("Expected %t, got %t", testCase.expectMount, mounted)
+			}
+		})
+	}
+}
+
+func TestProbeWithTimeout(t *testing.T) {
+	probeErr := errors.New("transport endpoint is not connected")
+
+	for _, testCase := range []struct {
+		name         string
+		probe        func() error
+		expectedText string
+	}{
+		{name: "answered", probe: func() error { return nil }},
+		{name: "failed", probe: func() error { return probeErr }, expectedText: probeErr.Error()},
+
+		// a hung fuse process blocks the probe
+		{name: "hung", probe: func() error {
+			time.Sleep(time.Second)
+			return nil
+		}, expectedText: "Timed out after 50ms"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			startTime := time.Now()
+
+			err := probeWithTimeout(50*time.Millisecond, testCase.probe)
+			if testCase.expectedText == "" {
+				if err != nil {
+					t.Fatalf("Expected the probe to succeed, got %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), testCase.expectedText) {
+				t.Fatalf("Expected %q, got %v", testCase.expectedText, err)
+			}
+
+			if elapsed := time.Since(startTime); elapsed >= time.Second {
+				t.Fatalf("Expected the probe to be bounded by the timeout, took %s", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package flex
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const (
+	fuseContainerNamePrefix  = "v3io-fuse-"
+	failedContainerNameInfix = "-failed-"
+)
+
+// Reap removes fuse containers left without a mount, e.g. by a node crash mid-mount. A container is an orphan if
+// no v3io mount point maps to it. Failed containers kept by KeepFailedContainers are removed once they're older
+// than their retention. Mounts hold the reap lock shared while their container is yet to mount, so
+// taking it exclusively makes reaping safe to run alongside them
+func (m *Mounter) Reap() *Response {
+	journal.Info("Reaping orphaned containers")
+
+	unlockReap, err := lockReap(context.Background(), true)
+	if err != nil {
+		return NewFailResponse("Failed to lock reap", err)
+	}
+
+	defer unlockReap()
+
+	criInstance, err := m.createCRI()
+	if err != nil {
+		return NewFailResponse("Failed to create CRI", err)
+	}
+
+	defer criInstance.Close() // nolint: errcheck
+
+	containerNames, err := criInstance.ListContainers(fuseContainerNamePrefix)
+	if err != nil {
+		return NewFailResponse("Failed to list containers", err)
+	}
+
+	mountedContainerNames, err := m.getMountedContainerNames()
+	if err != nil {
+		return NewFailResponse("Failed to list mounts", err)
+	}
+
+	var reapedContainerNames, failedContainerNames []string
+	for _, containerName := range containerNames {
+		if mountedContainerNames[containerName] {
+			continue
+		}
+
+		if failedAt, failed := getFailedContainerTime(containerName); failed &&
+			time.Since(failedAt) < m.Config.getFailedContainerRetention() {
+			journal.Debug("Keeping failed container", "containerName", containerName, "failedAt", failedAt)
+			continue
+		}
+
+		journal.Info("Removing orphaned container", "containerName", containerName)
+
+		if err := criInstance.RemoveContainer(containerName); err != nil {
+			journal.Warn("Failed to remove orphaned container", "containerName", containerName, "err", err.Error())
+			failedContainerNames = append(failedContainerNames, containerName)
+
+			continue
+		}
+
+		reapedContainerNames = append(reapedContainerNames, containerName)
+	}
+
+	var response *Response
+	if len(failedContainerNames) > 0 {
+		response = NewFailResponse(fmt.Sprintf("Failed to remove %d of %d orphaned containers",
+			len(failedContainerNames),
+			len(failedContainerNames)+len(reapedContainerNames)),
+			fmt.Errorf("Failed containers: %s", strings.Join(failedContainerNames, ", ")))
+	} else {
+		response = NewSuccessResponse(fmt.Sprintf("Removed %d orphaned containers", len(reapedContainerNames)))
+	}
+
+	response.Reaped = reapedContainerNames
+
+	return response
+}
+
+// getMountedContainerNames returns the names of the fuse containers of the node's v3io mount points
+func (m *Mounter) getMountedContainerNames() (map[string]bool, error) {
+	mountPoints, err := m.listV3IOMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	mountedContainerNames := map[string]bool{}
+	for _, mountPoint := range mountPoints {
+		containerName, err := m.getContainerName(mountPoint, nil)
+		if err != nil {
+			journal.Debug("Failed to get container name of mount point", "target", mountPoint, "err", err.Error())
+			continue
+		}
+
+		mountedContainerNames[containerName] = true
+	}
+
+	return mountedContainerNames, nil
+}
+
+// getFailedContainerTime returns when a failed container kept by KeepFailedContainers failed, by its name
+func getFailedContainerTime(containerName string) (time.Time, bool) {
+	infixIdx := strings.LastIndex(containerName, failedContainerNameInfix)
+	if infixIdx == -1 {
+		return time.Time{}, false
+	}
+
+	failedAtUnix, err := strconv.ParseInt(containerName[infixIdx+len(failedContainerNameInfix):], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(failedAtUnix, 0), true
+}
@@ -0,0 +1,129 @@
+package flex
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/cri"
+)
+
+func TestReap(t *testing.T) {
+	mountedTargetPaths := []string{
+		"/var/lib/kubelet/pods/uid1/volumes/v3io~fuse/v3io",
+		"/var/lib/kubelet/pods/uid2/volumes/v3io~fuse/v3io",
+	}
+
+	orphanedTargetPaths := []string{
+		"/var/lib/kubelet/pods/uid3/volumes/v3io~fuse/v3io",
+		"/var/lib/kubelet/pods/uid4/volumes/v3io~fuse/v3io",
+	}
+
+	useMountInfo(t, mountedTargetPaths...)
+
+	mounter, fakeCRIInstance := newFakeCRIMounter(t, &Config{})
+
+	var mountedContainerNames, orphanedContainerNames []string
+	for _, targetPath := range mountedTargetPaths {
+		containerName, _ := getContainerNameFromTargetPath(targetPath)
+		mountedContainerNames = append(mountedContainerNames, containerName)
+	}
+
+	for _, targetPath := range orphanedTargetPaths {
+		containerName, _ := getContainerNameFromTargetPath(targetPath)
+		orphanedContainerNames = append(orphanedContainerNames, containerName)
+	}
+
+	// failed containers are kept for a day
+	recentFailedContainerName := fmt.Sprintf("%s%s%d",
+		orphanedContainerNames[0],
+		failedContainerNameInfix,
+		time.Now().Add(-time.Hour).Unix())
+
+	expiredFailedContainerName := fmt.Sprintf("%s%s%d",
+		orphanedContainerNames[0],
+		failedContainerNameInfix,
+		time.Now().Add(-48*time.Hour).Unix())
+
+	containerNames := append(append([]string{}, mountedContainerNames...), orphanedContainerNames...)
+	containerNames = append(containerNames, recentFailedContainerName, expiredFailedContainerName, "k8s_jupyter")
+
+	for _, containerName := range containerNames {
+		fakeCRIInstance.containers[containerName] = &cri.ContainerStatus{State: cri.ContainerStateRunning}
+	}
+
+	response := mounter.Reap()
+	if response.Status != "Success" {
+		t.Fatalf("Expected reap to succeed, got %s", response.Message)
+	}
+
+	expectedReaped := append([]string{expiredFailedContainerName}, orphanedContainerNames...)
+	sort.Strings(expectedReaped)
+
+	if !reflect.DeepEqual(response.Reaped, expectedReaped) {
+		t.Fatalf("Expected reaped containers %v, got %v", expectedReaped, response.Reaped)
+	}
+
+	removed := append([]string{}, fakeCRIInstance.removed...)
+	sort.Strings(removed)
+
+	if !reflect.DeepEqual(removed, expectedReaped) {
+		t.Fatalf("Expected removed containers %v, got %v", expectedReaped, removed)
+	}
+
+	for _, containerName := range append(mountedContainerNames, recentFailedContainerName, "k8s_jupyter") {
+		if _, found := fakeCRIInstance.containers[containerName]; !found {
+			t.Fatalf("Expected container %s to be kept", containerName)
+		}
+	}
+}
+
+func TestReapWaitsForMounts(t *testing.T) {
+	useMountInfo(t)
+
+	mounter, fakeCRIInstance := newFakeCRIMounter(t, &Config{})
+
+	// a mount holds the reap lock from creating its container until it mounted
+	unlockReap, err := lockReap(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Failed to lock reap: %s", err)
+	}
+
+	containerName, _ := getContainerNameFromTargetPath(fakeTargetPath)
+	fakeCRIInstance.containers[containerName] = &cri.ContainerStatus{State: cri.ContainerStateRunning}
+
+	reapResponses := make(chan *Response)
+	go func() {
+		reapResponses <- mounter.Reap()
+	}()
+
+	select {
+	case response := <-reapResponses:
+		t.Fatalf("Expected reap to wait for the mount, got %s", response.Message)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// the container mounted
+	ioutil.WriteFile(mountInfoPath, // nolint: errcheck
+		[]byte(fmt.Sprintf("40 22 0:40 / %s rw,relatime - fuse v3io rw\n", fakeTargetPath)),
+		0644)
+
+	unlockReap()
+
+	response := <-reapResponses
+	if response.Status != "Success" {
+		t.Fatalf("Expected reap to succeed, got %s", response.Message)
+	}
+
+	if len(response.Reaped) != 0 {
+		t.Fatalf("Expected no containers to be reaped, got %v", response.Reaped)
+	}
+
+	if _, found := fakeCRIInstance.containers[containerName]; !found {
+		t.Fatalf("Expected container %s to be kept", containerName)
+	}
+}
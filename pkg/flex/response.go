@@ -7,10 +7,34 @@ import (
 	"github.com/v3io/flex-fuse/pkg/journal"
 )
 
+// PermanentFailurePrefix starts the message of failures that will fail the same way however many times they are
+// retried (e.g. an invalid spec), so tooling can stop retrying them
+const PermanentFailurePrefix = "Permanent failure: "
+
+// Response is the result of a driver call. Transient is set on failures that may succeed when retried
 type Response struct {
 	Status       string                 `json:"status"`
 	Message      string                 `json:"message"`
-	Capabilities map[string]interface{} `json:"capabilities"`
+	Transient    bool                   `json:"transient,omitempty"`
+	Capabilities *Capabilities          `json:"capabilities,omitempty"`
+	Checks       []CheckResult          `json:"checks,omitempty"`
+	Schema       map[string]interface{} `json:"schema,omitempty"`
+	Mounts       []MountInfo            `json:"mounts,omitempty"`
+	Warnings     []string               `json:"warnings,omitempty"`
+	Drained      []DrainResult          `json:"drained,omitempty"`
+	Drift        []DriftResult          `json:"drift,omitempty"`
+	Reaped       []string               `json:"reaped,omitempty"`
+	VolumeName   string                 `json:"volumeName,omitempty"`
+	Plan         []string               `json:"plan,omitempty"`
+
+	DriverCapabilities *DriverCapabilities `json:"driverCapabilities,omitempty"`
+}
+
+// Capabilities are the FlexVolume capabilities reported to kubelet on init
+type Capabilities struct {
+	Attach         bool `json:"attach"`
+	SELinuxRelabel bool `json:"selinuxRelabel"`
+	FSGroup        bool `json:"fsGroup"`
 }
 
 func newResponse(status, message string) *Response {
@@ -26,7 +50,34 @@ func NewSuccessResponse(message string) *Response {
 	return newResponse("Success", message)
 }
 
+// NewCapabilitiesResponse returns a successful init response reporting the driver's capabilities
+func NewCapabilitiesResponse(capabilities Capabilities) *Response {
+	response := NewSuccessResponse("No initialization required")
+	response.Capabilities = &capabilities
+
+	return response
+}
+
+// NewNotSupportedResponse tells kubelet the driver doesn't support a call, which kubelet then handles itself
+func NewNotSupportedResponse(message string) *Response {
+	journal.Info("Not supported", "message", message)
+
+	return newResponse("Not supported", message)
+}
+
 func NewFailResponse(message string, err error) *Response {
+	response := newFailResponse(message, err)
+	response.Transient = true
+
+	return response
+}
+
+// NewPermanentFailResponse returns a failure that retrying won't fix
+func NewPermanentFailResponse(message string, err error) *Response {
+	return newFailResponse(PermanentFailurePrefix+message, err)
+}
+
+func newFailResponse(message string, err error) *Response {
 	if err != nil {
 		journal.Warn("Failed", "message", message, "err", err.Error())
 		return newResponse("Failure", fmt.Sprintf("%s. %s", message, err))
@@ -36,8 +87,8 @@ func NewFailResponse(message string, err error) *Response {
 }
 
 func (r *Response) String() string {
-	if len(r.Capabilities) > 0 {
-		return fmt.Sprintf("Response[Status=%s, Message=%s, Capabilities=%s]", r.Status, r.Message, r.Capabilities)
+	if r.Capabilities != nil {
+		return fmt.Sprintf("Response[Status=%s, Message=%s, Capabilities=%+v]", r.Status, r.Message, *r.Capabilities)
 	}
 
 	return fmt.Sprintf("Response[Status=%s, Message=%s]", r.Status, r.Message)
@@ -0,0 +1,44 @@
+package flex
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestResponseJSONRoundTrip(t *testing.T) {
+	for _, testCase := range []struct {
+		name         string
+		response     *Response
+		expectedJSON string
+	}{
+		{name: "success", response: NewSuccessResponse("Successfully mounted"),
+			expectedJSON: `{"status":"Success","message":"Successfully mounted"}`},
+		{name: "transient failure", response: NewFailResponse("Failed to mount", errors.New("busy")),
+			expectedJSON: `{"status":"Failure","message":"Failed to mount. busy","transient":true}`},
+		{name: "permanent failure", response: NewPermanentFailResponse("Invalid spec", nil),
+			expectedJSON: `{"status":"Failure","message":"Permanent failure: Invalid spec"}`},
+		{name: "not supported", response: NewNotSupportedResponse("attach"),
+			expectedJSON: `{"status":"Not supported","message":"attach"}`},
+		{name: "capabilities", response: NewCapabilitiesResponse(Capabilities{SELinuxRelabel: true}),
+			expectedJSON: `{"status":"Success","message":"No initialization required",` +
+				`"capabilities":{"attach":false,"selinuxRelabel":true,"fsGroup":false}}`},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			responseJSON := testCase.response.ToJSON()
+			if responseJSON != testCase.expectedJSON {
+				t.Fatalf("Expected %s, got %s", testCase.expectedJSON, responseJSON)
+			}
+
+			unmarshalledResponse := Response{}
+			if err := json.Unmarshal([]byte(responseJSON), &unmarshalledResponse); err != nil {
+				t.Fatalf("Failed to unmarshal: %s", err)
+			}
+
+			if !reflect.DeepEqual(&unmarshalledResponse, testCase.response) {
+				t.Fatalf("Expected %+v, got %+v", testCase.response, unmarshalledResponse)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package flex
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SpecSchema returns a JSON schema describing Spec. It is generated from the json struct tags so it can't drift
+// from what the driver actually accepts. Fields may list their allowed values with an enum:"a,b" tag, and be
+// marked as required with a schema:"required" tag
+func SpecSchema() map[string]interface{} {
+	schema := structSchema(reflect.TypeOf(Spec{}))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "v3io/fuse volume options"
+
+	return schema
+}
+
+func structSchema(structType reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for fieldIdx := 0; fieldIdx < structType.NumField(); fieldIdx++ {
+		field := structType.Field(fieldIdx)
+
+		name := parseJSONTag(field)
+		if name == "" {
+			continue
+		}
+
+		property := typeSchema(field.Type)
+		if enum, found := field.Tag.Lookup("enum"); found {
+			var values []interface{}
+			for _, value := range strings.Split(enum, ",") {
+				values = append(values, value)
+			}
+
+			property["enum"] = values
+		}
+
+		if field.Tag.Get("schema") == "required" {
+			required = append(required, name)
+		}
+
+		properties[name] = property
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+func typeSchema(fieldType reflect.Type) map[string]interface{} {
+	switch fieldType.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(fieldType.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(fieldType.Elem())}
+	case reflect.Struct:
+		return structSchema(fieldType)
+	case reflect.Ptr:
+		return typeSchema(fieldType.Elem())
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func parseJSONTag(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+
+	return name
+}
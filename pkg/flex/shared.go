@@ -0,0 +1,324 @@
+package flex
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const sharedMountsDir = "/mnt/v3io-shared"
+
+// sharedMountsStateDir holds the shared mounts' references and owners. It's a variable so that tests can keep
+// their state apart from the node's
+var sharedMountsStateDir = "/var/run/v3io-fuse/shared"
+
+// mountSharedSubPath bind mounts the spec's sub path from a fuse mount of the whole container, which is shared by
+// all targets of the same cluster, container, access key and fuse options. The shared mount is reference counted
+// by target, and is created by the first target to need it
+func (m *Mounter) mountSharedSubPath(ctx context.Context, spec *Spec, targetPath string) error {
+	sharedPath := getSharedMountPath(spec)
+
+	journal.Info("Mounting shared sub path", "target", targetPath, "sharedPath", sharedPath, "subPath", spec.SubPath)
+
+	unlockShared, err := m.lockTarget(ctx, sharedPath)
+	if err != nil {
+		return err
+	}
+
+	defer unlockShared()
+
+	created := false
+
+	if !m.filesystem.IsMountPoint(sharedPath) {
+		if err := m.filesystem.MkdirAll(sharedPath, 0755); err != nil {
+			return fmt.Errorf("Failed to create shared mount directory %s: %s",
+				sharedPath,
+				explainCreateError(sharedPath, err, ""))
+		}
+
+		sharedSpec := *spec
+		sharedSpec.SubPath = ""
+
+		if err := m.createV3IOFUSEContainer(ctx, &sharedSpec, sharedPath); err != nil {
+			return err
+		}
+
+		created = true
+	}
+
+	if err := m.bindSharedSubPath(spec, sharedPath, targetPath); err != nil {
+
+		// a shared mount no target references would never be torn down
+		if created {
+			if response := m.unmountFUSE(sharedPath); response.Status != "Success" {
+				journal.Warn("Failed to tear down unused shared mount", "sharedPath", sharedPath, "message", response.Message)
+			}
+		}
+
+		return err
+	}
+
+	// the owner is only recorded once it holds a reference, as the shared mount is left in place when its last
+	// reference isn't the owner's. An owner left without references (e.g. by a crash) passes the ownership on
+	podUID := getPodUIDFromTargetPath(targetPath)
+	owner, ownerFound := getSharedMountOwner(sharedPath)
+	if !ownerFound || (owner != podUID && !sharedMountOwnerHasRefs(sharedPath, owner)) {
+		if err := setSharedMountOwner(sharedPath, podUID); err != nil {
+			journal.Warn("Failed to record shared mount owner", "sharedPath", sharedPath, "err", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// bindSharedSubPath references a shared mount from a target, and bind mounts the spec's sub path of it there
+func (m *Mounter) bindSharedSubPath(spec *Spec, sharedPath string, targetPath string) error {
+	sourcePath := filepath.Join(sharedPath, spec.SubPath)
+	if sourcePath != sharedPath && !isSubPath(sharedPath, sourcePath) {
+		return fmt.Errorf("Sub path %s escapes the shared mount", spec.SubPath)
+	}
+
+	if _, err := m.filesystem.Stat(sourcePath); err != nil {
+		return fmt.Errorf("Failed to find sub path %s: %s", spec.SubPath, err)
+	}
+
+	if err := addSharedMountRef(sharedPath, targetPath); err != nil {
+		return err
+	}
+
+	journal.Debug("Bind mounting sub path", "sourcePath", sourcePath, "target", targetPath)
+
+	if err := m.filesystem.BindMount(sourcePath, targetPath); err != nil {
+		removeSharedMountRef(sharedPath, targetPath) // nolint: errcheck
+
+		return fmt.Errorf("Failed to bind mount %s to %s: %s", sourcePath, targetPath, err)
+	}
+
+	return nil
+}
+
+// unmountSharedSubPath removes a target's bind mount, tearing down the shared mount behind it if it was the last
+// target using it
+func (m *Mounter) unmountSharedSubPath(targetPath string, sharedPath string) *Response {
+	return m.unmountSharedSubPathWith(targetPath, sharedPath, m.unmountFUSE)
+}
+
+// unmountSharedSubPathWith is unmountSharedSubPath with the way the shared mount is torn down passed in
+func (m *Mounter) unmountSharedSubPathWith(targetPath string,
+	sharedPath string,
+	teardown func(string) *Response) *Response {
+	journal.Info("Unmounting shared sub path", "target", targetPath, "sharedPath", sharedPath)
+
+	if m.filesystem.IsMountPoint(targetPath) {
+		if err := m.filesystem.Unmount(targetPath); err != nil {
+			return NewFailResponse(fmt.Sprintf("Failed to unmount %s", targetPath), err)
+		}
+	}
+
+	if err := m.removeMountDirectory(targetPath); err != nil && !os.IsNotExist(err) {
+		return NewFailResponse(fmt.Sprintf("Could not remove directory %s", targetPath), err)
+	}
+
+	unlockShared, err := m.lockTarget(context.Background(), sharedPath)
+	if err != nil {
+		return NewFailResponse("Failed to lock shared mount", err)
+	}
+
+	defer unlockShared()
+
+	remainingRefs, err := removeSharedMountRef(sharedPath, targetPath)
+	if err != nil {
+		return NewFailResponse("Failed to release shared mount", err)
+	}
+
+	podUID := getPodUIDFromTargetPath(targetPath)
+
+	owner, ownerFound := getSharedMountOwner(sharedPath)
+
+	if remainingRefs > 0 {
+		if ownerFound && owner == podUID {
+			transferSharedMountOwnership(sharedPath)
+		}
+
+		return NewSuccessResponse(fmt.Sprintf("Successfully unmounted, shared mount still used by %d targets",
+			remainingRefs))
+	}
+
+	// ownership passes on to the remaining targets, so a mismatch here means references were lost, and another
+	// pod may still be using the shared mount
+	if ownerFound && owner != podUID {
+		journal.Warn("Last target of shared mount isn't of its owner, leaving it in place",
+			"sharedPath", sharedPath,
+			"owner", owner,
+			"podUID", podUID)
+
+		return NewSuccessResponse(fmt.Sprintf("Successfully unmounted, shared mount is owned by pod %s", owner))
+	}
+
+	journal.Info("Last target of shared mount unmounted, tearing it down", "sharedPath", sharedPath)
+
+	removeSharedMountOwner(sharedPath)
+
+	if !m.filesystem.IsMountPoint(sharedPath) {
+		return NewSuccessResponse("Successfully unmounted")
+	}
+
+	return teardown(sharedPath)
+}
+
+// getSharedMountPath returns where the shared mount of a spec's cluster, container, access key and fuse options
+// lives. The access key is part of the identity, as it determines what the mount may access, and so are the fuse
+// options, as the shared container is created with those of the first target's spec
+func getSharedMountPath(spec *Spec) string {
+	identity := strings.Join(append([]string{spec.GetClusterName(), spec.Container, spec.GetAccessKey()},
+		spec.GetFuseOptions()...), "\x00")
+
+	return path.Join(sharedMountsDir, fmt.Sprintf("%x", sha256.Sum256([]byte(identity)))[:16])
+}
+
+// getSharedMountOfTarget returns the shared mount a target is bind mounted from, if any
+func getSharedMountOfTarget(targetPath string) (string, bool) {
+	sharedPath, err := ioutil.ReadFile(getSharedMountTargetFilePath(targetPath))
+	if err != nil {
+		return "", false
+	}
+
+	return string(sharedPath), true
+}
+
+func addSharedMountRef(sharedPath string, targetPath string) error {
+	refsDir := getSharedMountRefsDir(sharedPath)
+
+	for _, dir := range []string{refsDir, path.Dir(getSharedMountTargetFilePath(targetPath))} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("Failed to create shared mount state directory %s: %s", dir, err)
+		}
+	}
+
+	if err := ioutil.WriteFile(path.Join(refsDir, sanitizePath(targetPath)), []byte(targetPath), 0644); err != nil {
+		return fmt.Errorf("Failed to add shared mount reference: %s", err)
+	}
+
+	if err := ioutil.WriteFile(getSharedMountTargetFilePath(targetPath), []byte(sharedPath), 0644); err != nil {
+		return fmt.Errorf("Failed to record shared mount of target: %s", err)
+	}
+
+	return nil
+}
+
+// removeSharedMountRef removes a target's reference to a shared mount, returning how many references remain
+func removeSharedMountRef(sharedPath string, targetPath string) (int, error) {
+	refsDir := getSharedMountRefsDir(sharedPath)
+
+	for _, filePath := range []string{
+		path.Join(refsDir, sanitizePath(targetPath)),
+		getSharedMountTargetFilePath(targetPath),
+	} {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("Failed to remove shared mount reference: %s", err)
+		}
+	}
+
+	refs, err := ioutil.ReadDir(refsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("Failed to read shared mount references: %s", err)
+	}
+
+	return len(refs), nil
+}
+
+// transferSharedMountOwnership passes a shared mount's ownership on to the pod of one of its remaining targets,
+// once its owner unmounted all of its targets
+func transferSharedMountOwnership(sharedPath string) {
+	refs, err := ioutil.ReadDir(getSharedMountRefsDir(sharedPath))
+	if err != nil || len(refs) == 0 {
+		return
+	}
+
+	targetPath, err := ioutil.ReadFile(path.Join(getSharedMountRefsDir(sharedPath), refs[0].Name()))
+	if err != nil {
+		journal.Warn("Failed to read shared mount reference", "sharedPath", sharedPath, "err", err.Error())
+		return
+	}
+
+	newOwner := getPodUIDFromTargetPath(string(targetPath))
+
+	journal.Debug("Transferring shared mount ownership", "sharedPath", sharedPath, "owner", newOwner)
+
+	if err := setSharedMountOwner(sharedPath, newOwner); err != nil {
+		journal.Warn("Failed to transfer shared mount ownership", "sharedPath", sharedPath, "err", err.Error())
+	}
+}
+
+// sharedMountOwnerHasRefs returns whether any of a shared mount's references is of a target of the owner pod
+func sharedMountOwnerHasRefs(sharedPath string, owner string) bool {
+	refs, err := ioutil.ReadDir(getSharedMountRefsDir(sharedPath))
+	if err != nil {
+		return false
+	}
+
+	for _, ref := range refs {
+		targetPath, err := ioutil.ReadFile(path.Join(getSharedMountRefsDir(sharedPath), ref.Name()))
+		if err == nil && getPodUIDFromTargetPath(string(targetPath)) == owner {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setSharedMountOwner records the pod owning a shared mount, which is the only one that may tear it down
+func setSharedMountOwner(sharedPath string, podUID string) error {
+	ownerFilePath := getSharedMountOwnerFilePath(sharedPath)
+
+	if err := os.MkdirAll(path.Dir(ownerFilePath), 0755); err != nil {
+		return fmt.Errorf("Failed to create shared mount owners directory: %s", err)
+	}
+
+	if err := ioutil.WriteFile(ownerFilePath, []byte(podUID), 0644); err != nil {
+		return fmt.Errorf("Failed to record shared mount owner: %s", err)
+	}
+
+	return nil
+}
+
+// getSharedMountOwner returns the pod owning a shared mount. Shared mounts created before owners were recorded
+// have none
+func getSharedMountOwner(sharedPath string) (string, bool) {
+	owner, err := ioutil.ReadFile(getSharedMountOwnerFilePath(sharedPath))
+	if err != nil {
+		return "", false
+	}
+
+	return string(owner), true
+}
+
+func removeSharedMountOwner(sharedPath string) {
+	if err := os.Remove(getSharedMountOwnerFilePath(sharedPath)); err != nil && !os.IsNotExist(err) {
+		journal.Warn("Failed to remove shared mount owner", "sharedPath", sharedPath, "err", err.Error())
+	}
+}
+
+func getSharedMountOwnerFilePath(sharedPath string) string {
+	return path.Join(sharedMountsStateDir, "owners", path.Base(sharedPath))
+}
+
+func getSharedMountRefsDir(sharedPath string) string {
+	return path.Join(sharedMountsStateDir, path.Base(sharedPath))
+}
+
+func getSharedMountTargetFilePath(targetPath string) string {
+	return path.Join(sharedMountsStateDir, "targets", sanitizePath(targetPath))
+}
+
+// sanitizePath turns a path into a single file name
+func sanitizePath(targetPath string) string {
+	return strings.Replace(filepath.Clean(targetPath), "/", "-", -1)
+}
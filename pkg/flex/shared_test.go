@@ -0,0 +1,304 @@
+package flex
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/v3io/flex-fuse/pkg/cri"
+)
+
+func TestGetSharedMountPath(t *testing.T) {
+	baseSpec := Spec{Container: "bigdata", OverrideAccessKey: "key", SubPath: "a"}
+
+	for _, testCase := range []struct {
+		name         string
+		modify       func(spec *Spec)
+		expectShared bool
+	}{
+		{name: "other sub path", modify: func(spec *Spec) { spec.SubPath = "b/c" }, expectShared: true},
+		{name: "no sub path", modify: func(spec *Spec) { spec.SubPath = "" }, expectShared: true},
+		{name: "other container", modify: func(spec *Spec) { spec.Container = "users" }},
+		{name: "other cluster", modify: func(spec *Spec) { spec.Cluster = "dr" }},
+		{name: "other access key", modify: func(spec *Spec) { spec.OverrideAccessKey = "other" }},
+		{name: "other fuse options", modify: func(spec *Spec) { spec.MaxRead = "128Ki" }},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			spec := baseSpec
+			testCase.modify(&spec)
+
+			if shared := getSharedMountPath(&spec) == getSharedMountPath(&baseSpec); shared != testCase.expectShared {
+				t.Fatalf("Expected shared: %t, got %t", testCase.expectShared, shared)
+			}
+		})
+	}
+}
+
+func TestSharedMountRefsWithMultipleSubPaths(t *testing.T) {
+	useTempSharedMountsStateDir(t)
+
+	sharedPath := getSharedMountPath(&Spec{Container: "bigdata", OverrideAccessKey: "key"})
+	targetPaths := []string{
+		"/var/lib/kubelet/pods/pod-a/volumes/v3io~fuse/a",
+		"/var/lib/kubelet/pods/pod-b/volumes/v3io~fuse/b",
+		"/var/lib/kubelet/pods/pod-c/volumes/v3io~fuse/c",
+	}
+
+	for _, targetPath := range targetPaths {
+		if err := addSharedMountRef(sharedPath, targetPath); err != nil {
+			t.Fatalf("Failed to add reference of %s: %s", targetPath, err)
+		}
+
+		if targetSharedPath, found := getSharedMountOfTarget(targetPath); !found || targetSharedPath != sharedPath {
+			t.Fatalf("Expected %s to be recorded as mounted from %s", targetPath, sharedPath)
+		}
+	}
+
+	if err := setSharedMountOwner(sharedPath, "pod-a"); err != nil {
+		t.Fatalf("Failed to set owner: %s", err)
+	}
+
+	// the owner's target is unmounted first, so the ownership passes on, and the shared mount is only torn down
+	// once the last target is unmounted
+	for targetIdx, targetPath := range targetPaths {
+		remainingRefs, err := removeSharedMountRef(sharedPath, targetPath)
+		if err != nil {
+			t.Fatalf("Failed to remove reference of %s: %s", targetPath, err)
+		}
+
+		if expectedRefs := len(targetPaths) - targetIdx - 1; remainingRefs != expectedRefs {
+			t.Fatalf("Expected %d remaining references, got %d", expectedRefs, remainingRefs)
+		}
+
+		if _, found := getSharedMountOfTarget(targetPath); found {
+			t.Fatalf("Expected the shared mount of %s to be forgotten", targetPath)
+		}
+
+		if remainingRefs == 0 {
+			break
+		}
+
+		if owner, _ := getSharedMountOwner(sharedPath); owner == getPodUIDFromTargetPath(targetPath) {
+			transferSharedMountOwnership(sharedPath)
+		}
+
+		owner, _ := getSharedMountOwner(sharedPath)
+		if !sharedMountOwnerHasRefs(sharedPath, owner) {
+			t.Fatalf("Expected owner %s to hold a reference after %s was unmounted", owner, targetPath)
+		}
+	}
+
+	// removing a reference that is already gone is harmless
+	if remainingRefs, err := removeSharedMountRef(sharedPath, targetPaths[0]); err != nil || remainingRefs != 0 {
+		t.Fatalf("Expected no references, got %d (err: %v)", remainingRefs, err)
+	}
+}
+
+func TestBindSharedSubPathRejectsEscape(t *testing.T) {
+	useTempSharedMountsStateDir(t)
+
+	filesystem := newMemoryFilesystem()
+	filesystem.MkdirAll(sharedMountsDir+"/abc/data", 0755)    // nolint: errcheck
+	filesystem.MkdirAll(sharedMountsDir+"/abcdef/data", 0755) // nolint: errcheck
+
+	mounter := newTestMounter(&Config{}, filesystem)
+
+	for _, subPath := range []string{"..", "../abcdef/data", "data/../../abcdef"} {
+		err := mounter.bindSharedSubPath(&Spec{SubPath: subPath}, sharedMountsDir+"/abc", "/target")
+		if err == nil {
+			t.Fatalf("Expected sub path %s to be rejected", subPath)
+		}
+
+		if _, found := getSharedMountOfTarget("/target"); found {
+			t.Fatalf("Expected sub path %s to be rejected before it's referenced", subPath)
+		}
+	}
+}
+
+func TestUnmountSharedSubPathOwnership(t *testing.T) {
+	for _, testCase := range []struct {
+		name            string
+		mountPods       []string
+		lostRefPods     []string
+		unmountPods     []string
+		expectTeardown  bool
+		expectedOwner   string
+		expectedMessage string
+	}{
+		{
+			name:            "owner unmounts its only target",
+			mountPods:       []string{"pod-a"},
+			unmountPods:     []string{"pod-a"},
+			expectTeardown:  true,
+			expectedMessage: "torn down",
+		},
+		{
+			name:            "non-owner unmounts while owner uses it",
+			mountPods:       []string{"pod-a", "pod-b"},
+			unmountPods:     []string{"pod-b"},
+			expectedOwner:   "pod-a",
+			expectedMessage: "still used by 1 targets",
+		},
+		{
+			name:            "owner unmounts while non-owner uses it",
+			mountPods:       []string{"pod-a", "pod-b"},
+			unmountPods:     []string{"pod-a"},
+			expectedOwner:   "pod-b",
+			expectedMessage: "still used by 1 targets",
+		},
+		{
+			name:            "non-owner unmounts the last target",
+			mountPods:       []string{"pod-a", "pod-b"},
+			lostRefPods:     []string{"pod-a"},
+			unmountPods:     []string{"pod-b"},
+			expectedOwner:   "pod-a",
+			expectedMessage: "owned by pod pod-a",
+		},
+		{
+			name:            "owner then non-owner unmount",
+			mountPods:       []string{"pod-a", "pod-b"},
+			unmountPods:     []string{"pod-a", "pod-b"},
+			expectTeardown:  true,
+			expectedMessage: "torn down",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			useTempSharedMountsStateDir(t)
+
+			mounter, _ := newFakeCRIMounter(t, &Config{})
+			filesystem := mounter.filesystem.(*memoryFilesystem)
+
+			spec := &Spec{Container: "bigdata", OverrideAccessKey: "key", SubPath: "data"}
+			sharedPath := getSharedMountPath(spec)
+
+			// the shared mount already runs, so mounting only references it
+			filesystem.mount(sharedPath)
+			filesystem.MkdirAll(sharedPath+"/data", 0755) // nolint: errcheck
+
+			for _, podUID := range testCase.mountPods {
+				targetPath := getSharedTestTargetPath(podUID)
+				filesystem.MkdirAll(targetPath, 0755) // nolint: errcheck
+
+				if err := mounter.mountSharedSubPath(context.Background(), spec, targetPath); err != nil {
+					t.Fatalf("Expected %s to be mounted, got %s", targetPath, err.Error())
+				}
+			}
+
+			if owner, _ := getSharedMountOwner(sharedPath); owner != testCase.mountPods[0] {
+				t.Fatalf("Expected the first pod to mount, %s, to own the shared mount, got %s",
+					testCase.mountPods[0],
+					owner)
+			}
+
+			for _, podUID := range testCase.lostRefPods {
+				removeSharedMountRef(sharedPath, getSharedTestTargetPath(podUID)) // nolint: errcheck
+			}
+
+			teardowns := 0
+			teardown := func(string) *Response {
+				teardowns++
+				return NewSuccessResponse("torn down")
+			}
+
+			var response *Response
+			for _, podUID := range testCase.unmountPods {
+				targetPath := getSharedTestTargetPath(podUID)
+
+				response = mounter.unmountSharedSubPathWith(targetPath, sharedPath, teardown)
+				if response.Status != "Success" {
+					t.Fatalf("Expected %s to be unmounted, got %s", targetPath, response.Message)
+				}
+
+				if _, err := filesystem.Lstat(targetPath); filesystem.IsMountPoint(targetPath) || err == nil {
+					t.Fatalf("Expected %s to be unmounted and removed", targetPath)
+				}
+			}
+
+			if !strings.Contains(response.Message, testCase.expectedMessage) {
+				t.Fatalf("Expected message to contain %q, got %q", testCase.expectedMessage, response.Message)
+			}
+
+			if tornDown := teardowns > 0; tornDown != testCase.expectTeardown || teardowns > 1 {
+				t.Fatalf("Expected torn down: %t, got %d teardowns", testCase.expectTeardown, teardowns)
+			}
+
+			if owner, _ := getSharedMountOwner(sharedPath); owner != testCase.expectedOwner {
+				t.Fatalf("Expected owner %q, got %q", testCase.expectedOwner, owner)
+			}
+		})
+	}
+}
+
+func TestForceClearSharedTarget(t *testing.T) {
+	useTempSharedMountsStateDir(t)
+
+	mounter, criInstance := newFakeCRIMounter(t, &Config{})
+	filesystem := mounter.filesystem.(*memoryFilesystem)
+
+	// the whole container is mounted, as the shared mount's contents don't go away with it in memory
+	spec := &Spec{Container: "bigdata", OverrideAccessKey: "key"}
+	sharedPath := getSharedMountPath(spec)
+
+	sharedContainerName, _ := mounter.getContainerName(sharedPath, nil)
+	criInstance.containers[sharedContainerName] = &cri.ContainerStatus{State: cri.ContainerStateRunning}
+
+	filesystem.mount(sharedPath)
+
+	for _, podUID := range []string{"pod-a", "pod-b"} {
+		targetPath := getSharedTestTargetPath(podUID)
+		filesystem.MkdirAll(targetPath, 0755) // nolint: errcheck
+
+		if err := mounter.mountSharedSubPath(context.Background(), spec, targetPath); err != nil {
+			t.Fatalf("Expected %s to be mounted, got %s", targetPath, err.Error())
+		}
+	}
+
+	for _, testCase := range []struct {
+		podUID         string
+		expectTeardown bool
+	}{
+		{podUID: "pod-a"},
+		{podUID: "pod-b", expectTeardown: true},
+	} {
+		targetPath := getSharedTestTargetPath(testCase.podUID)
+
+		if response := mounter.ForceClear(targetPath); response.Status != "Success" {
+			t.Fatalf("Expected %s to be force cleared, got %s", targetPath, response.Message)
+		}
+
+		if _, err := filesystem.Lstat(targetPath); filesystem.IsMountPoint(targetPath) || err == nil {
+			t.Fatalf("Expected %s to be unmounted and removed", targetPath)
+		}
+
+		if _, found := getSharedMountOfTarget(targetPath); found {
+			t.Fatalf("Expected the shared mount reference of %s to be released", targetPath)
+		}
+
+		// the shared container serves the targets, which have none of their own
+		_, containerFound := criInstance.containers[sharedContainerName]
+		if tornDown := !filesystem.IsMountPoint(sharedPath); tornDown != testCase.expectTeardown ||
+			containerFound == testCase.expectTeardown {
+			t.Fatalf("Expected the shared mount to be torn down after %s: %t, got mounted: %t, container found: %t",
+				testCase.podUID,
+				testCase.expectTeardown,
+				!tornDown,
+				containerFound)
+		}
+	}
+
+	if len(criInstance.removed) != 1 {
+		t.Fatalf("Expected only the shared container to be removed, got %v", criInstance.removed)
+	}
+}
+
+func getSharedTestTargetPath(podUID string) string {
+	return "/var/lib/kubelet/pods/" + podUID + "/volumes/v3io~fuse/v3io"
+}
+
+// useTempSharedMountsStateDir keeps a test's shared mount state in a temporary directory
+func useTempSharedMountsStateDir(t *testing.T) {
+	originalSharedMountsStateDir := sharedMountsStateDir
+	sharedMountsStateDir = t.TempDir()
+
+	t.Cleanup(func() { sharedMountsStateDir = originalSharedMountsStateDir })
+}
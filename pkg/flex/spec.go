@@ -1,26 +1,250 @@
 package flex
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
 )
 
+const (
+	minTransferSize = 4 << 10
+	maxTransferSize = 16 << 20
+
+	// kubernetesOptionPrefix prefixes the options kubelet adds to every spec (e.g. kubernetes.io/fsType)
+	kubernetesOptionPrefix = "kubernetes.io/"
+
+	// maxOptionTypoDistance is how many edits away from a known option an unknown one is taken for a typo of it
+	maxOptionTypoDistance = 2
+)
+
+// specFieldAliases maps legacy option names, still found in older PV specs, to the current ones. Names differing
+// only in case need no alias, as option names are matched case insensitively
+var specFieldAliases = map[string]string{
+	"sub_path":       "subPath",
+	"containerName":  "container",
+	"clusterName":    "cluster",
+	"access_key":     "accessKey",
+	"dirs_to_create": "dirsToCreate",
+	"max_read":       "maxRead",
+	"max_write":      "maxWrite",
+}
+
+// ErrAccessKeySecretNotFound is returned for a spec without an access key
+var ErrAccessKeySecretNotFound = errors.New("access key secret not found")
+
 type DirToCreate struct {
 	Name        string      `json:"name"`
 	Permissions os.FileMode `json:"permissions"`
 }
 
+// Spec fields tagged recreate:"true" only take effect when the fuse container is created
 type Spec struct {
-	SubPath           string `json:"subPath"`
-	Container         string `json:"container"`
-	Cluster           string `json:"cluster"`
-	OverrideAccessKey string `json:"accessKey"`
-	AccessKey         string `json:"kubernetes.io/secret/accessKey"`
+	SubPath           string `json:"subPath" recreate:"true"`
+	Container         string `json:"container" recreate:"true"`
+	Cluster           string `json:"cluster" recreate:"true"`
+	OverrideAccessKey string `json:"accessKey" recreate:"true"`
+	AccessKey         string `json:"kubernetes.io/secret/accessKey" recreate:"true"`
 	PodName           string `json:"kubernetes.io/pod.name"`
 	Namespace         string `json:"kubernetes.io/pod.namespace"`
+	PodUID            string `json:"kubernetes.io/pod.uid"`
 	Name              string `json:"kubernetes.io/pvOrVolumeName"`
 	DirsToCreate      string `json:"dirsToCreate"`
+
+	// MaxRead and MaxWrite set the FUSE transfer sizes in bytes (e.g. 131072, 128Ki, 1Mi). The kernel caps
+	// them at its own maximum, so larger values may be silently reduced
+	MaxRead  string `json:"maxRead" recreate:"true"`
+	MaxWrite string `json:"maxWrite" recreate:"true"`
+}
+
+// parseSpec unmarshals a spec, accepting the legacy option names of specFieldAliases. Where both a legacy and a
+// current name are set, the current one wins
+func parseSpec(specString string) (*Spec, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(specString), &fields); err != nil {
+		return nil, err
+	}
+
+	for alias, fieldName := range specFieldAliases {
+		value, found := fields[alias]
+		if !found {
+			continue
+		}
+
+		delete(fields, alias)
+
+		if _, found := fields[fieldName]; found {
+			journal.Warn("Ignoring deprecated option, current option is also set", "option", alias, "current", fieldName)
+			continue
+		}
+
+		journal.Warn("Option is deprecated", "option", alias, "current", fieldName)
+		fields[fieldName] = value
+	}
+
+	if err := checkSpecOptions(fields); err != nil {
+		return nil, err
+	}
+
+	fieldsBytes, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := Spec{}
+	if err := json.Unmarshal(fieldsBytes, &spec); err != nil {
+		return nil, err
+	}
+
+	return &spec, nil
+}
+
+// checkSpecOptions checks the options kubelet passed. Kubelet passes all options as strings, and adds
+// informational kubernetes.io/ options of its own, which are ignored unless the spec uses them. Unknown options
+// are ignored with a warning, as they're probably misspelled
+func checkSpecOptions(fields map[string]json.RawMessage) error {
+	specOptionNames := getSpecOptionNames()
+
+	optionNames := make([]string, 0, len(fields))
+	for optionName := range fields {
+		optionNames = append(optionNames, optionName)
+	}
+
+	sort.Strings(optionNames)
+
+	for _, optionName := range optionNames {
+		if _, found := specOptionNames[strings.ToLower(optionName)]; found {
+			var value string
+
+			// the value is left out of the error, as it may be a secret
+			if err := json.Unmarshal(fields[optionName], &value); err != nil {
+				return fmt.Errorf("option %s must be a string", optionName)
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(optionName, kubernetesOptionPrefix) {
+			journal.Debug("Ignoring kubernetes option", "option", optionName)
+			continue
+		}
+
+		if similarOptionName := getSimilarOptionName(optionName, specOptionNames); similarOptionName != "" {
+			journal.Warn("Ignoring unknown option, it may be a misspelling",
+				"option", optionName,
+				"similarOption", similarOptionName)
+
+			continue
+		}
+
+		journal.Warn("Ignoring unknown option", "option", optionName)
+	}
+
+	return nil
+}
+
+// getSpecOptionNames returns the names of the spec's options, keyed by their lower case form, as option names
+// are matched case insensitively
+func getSpecOptionNames() map[string]string {
+	specOptionNames := map[string]string{}
+
+	specType := reflect.TypeOf(Spec{})
+	for fieldIdx := 0; fieldIdx < specType.NumField(); fieldIdx++ {
+		if name := parseJSONTag(specType.Field(fieldIdx)); name != "" {
+			specOptionNames[strings.ToLower(name)] = name
+		}
+	}
+
+	return specOptionNames
+}
+
+// getSimilarOptionName returns the spec option an unknown option is probably a misspelling of, if any
+func getSimilarOptionName(optionName string, specOptionNames map[string]string) string {
+	similarOptionName := ""
+	similarOptionDistance := maxOptionTypoDistance + 1
+
+	for lowerSpecOptionName, specOptionName := range specOptionNames {
+		distance := getEditDistance(strings.ToLower(optionName), lowerSpecOptionName)
+		if distance < similarOptionDistance ||
+			(distance == similarOptionDistance && specOptionName < similarOptionName) {
+			similarOptionName = specOptionName
+			similarOptionDistance = distance
+		}
+	}
+
+	return similarOptionName
+}
+
+// getEditDistance returns the Levenshtein distance of two strings
+func getEditDistance(first string, second string) int {
+	previousRow := make([]int, len(second)+1)
+	currentRow := make([]int, len(second)+1)
+
+	for secondIdx := range previousRow {
+		previousRow[secondIdx] = secondIdx
+	}
+
+	for firstIdx := 1; firstIdx <= len(first); firstIdx++ {
+		currentRow[0] = firstIdx
+
+		for secondIdx := 1; secondIdx <= len(second); secondIdx++ {
+			substitutionCost := 1
+			if first[firstIdx-1] == second[secondIdx-1] {
+				substitutionCost = 0
+			}
+
+			currentRow[secondIdx] = minInt(previousRow[secondIdx]+1,
+				minInt(currentRow[secondIdx-1]+1, previousRow[secondIdx-1]+substitutionCost))
+		}
+
+		previousRow, currentRow = currentRow, previousRow
+	}
+
+	return previousRow[len(second)]
+}
+
+func minInt(first int, second int) int {
+	if first < second {
+		return first
+	}
+
+	return second
+}
+
+// GetVolumeName answers kubelet's getvolumename call with a name identifying the volume by its cluster, container
+// and sub path, so the same volume maps to the same name across pods. A spec without a container doesn't identify
+// a volume, and is left for kubelet to name
+func GetVolumeName(specString string) *Response {
+	spec, err := parseSpec(specString)
+	if err != nil {
+		return NewPermanentFailResponse("Failed to unmarshal spec", err)
+	}
+
+	if spec.Container == "" {
+		return NewNotSupportedResponse("Spec has no container to name the volume by")
+	}
+
+	response := NewSuccessResponse("Got volume name")
+	response.VolumeName = spec.getVolumeName()
+
+	return response
+}
+
+// getVolumeName names a volume by a hash of its cluster, container and sub path, as the sub path may hold
+// characters a volume name can't
+func (s *Spec) getVolumeName() string {
+	identity := strings.Join([]string{s.GetClusterName(), s.Container, filepath.Clean("/" + s.SubPath)}, "\x00")
+
+	return "v3io-" + fmt.Sprintf("%x", sha256.Sum256([]byte(identity)))[:16]
 }
 
 func (s *Spec) decodeOrDefault(value string) string {
@@ -31,18 +255,73 @@ func (s *Spec) decodeOrDefault(value string) string {
 	return string(bytes)
 }
 
-func (s *Spec) validate() error {
-	if s.AccessKey == "" && s.OverrideAccessKey == "" {
-		return errors.New("required access key is missing")
+// validate checks the spec's fields and their combinations. In link mode the access key is only needed by the
+// first mount of a link, which is checked when the link is mounted
+func (s *Spec) validate(linkMode bool) error {
+	if !linkMode && s.GetAccessKey() == "" {
+		return s.getMissingAccessKeyError()
 	}
 
 	if s.SubPath != "" && s.Container == "" {
-		return errors.New("can't have subpath without container value")
+		return fmt.Errorf("subPath %s requires container to be set", s.SubPath)
+	}
+
+	// both are path components of the link path
+	for _, pathComponent := range []struct {
+		name  string
+		value string
+	}{
+		{"container", s.Container},
+		{"kubernetes.io/pod.namespace", s.Namespace},
+	} {
+		if pathComponent.value != "" && !isSinglePathComponent(pathComponent.value) {
+			return fmt.Errorf("%s must be a single path component, got %q", pathComponent.name, pathComponent.value)
+		}
+	}
+
+	for _, transferSize := range []struct {
+		name  string
+		value string
+	}{
+		{"maxRead", s.MaxRead},
+		{"maxWrite", s.MaxWrite},
+	} {
+		if transferSize.value == "" {
+			continue
+		}
+
+		size, err := parseByteSize(transferSize.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %s", transferSize.name, err)
+		}
+
+		if size < minTransferSize || size > maxTransferSize {
+			return fmt.Errorf("%s must be between %d and %d bytes, got %d",
+				transferSize.name,
+				minTransferSize,
+				maxTransferSize,
+				size)
+		}
 	}
 
 	return nil
 }
 
+// GetFuseOptions returns the spec's fuse mount options, passed to the mounter with -o
+func (s *Spec) GetFuseOptions() []string {
+	var options []string
+
+	if maxRead, err := parseByteSize(s.MaxRead); err == nil {
+		options = append(options, fmt.Sprintf("max_read=%d", maxRead))
+	}
+
+	if maxWrite, err := parseByteSize(s.MaxWrite); err == nil {
+		options = append(options, fmt.Sprintf("max_write=%d", maxWrite))
+	}
+
+	return options
+}
+
 func (s *Spec) GetAccessKey() string {
 	if s.OverrideAccessKey == "" {
 		return s.decodeOrDefault(s.AccessKey)
@@ -50,6 +329,20 @@ func (s *Spec) GetAccessKey() string {
 	return s.OverrideAccessKey
 }
 
+// getMissingAccessKeyError explains a spec without an access key. A pod's access key comes from a secret of its
+// namespace, which kubelet can't read once the namespace is being deleted
+func (s *Spec) getMissingAccessKeyError() error {
+	if s.Namespace != "" {
+		return fmt.Errorf("%w, namespace %s may be terminating (accessKey or the kubernetes.io/secret/accessKey "+
+			"secret is required)",
+			ErrAccessKeySecretNotFound,
+			s.Namespace)
+	}
+
+	return fmt.Errorf("%w (accessKey or the kubernetes.io/secret/accessKey secret is required)",
+		ErrAccessKeySecretNotFound)
+}
+
 func (s *Spec) GetClusterName() string {
 	if s.Cluster == "" {
 		return "default"
@@ -57,3 +350,28 @@ func (s *Spec) GetClusterName() string {
 
 	return s.Cluster
 }
+
+// parseByteSize parses a size in bytes, optionally with a Ki or Mi suffix
+func parseByteSize(size string) (int, error) {
+	multiplier := 1
+
+	switch {
+	case strings.HasSuffix(size, "Ki"):
+		multiplier = 1 << 10
+		size = strings.TrimSuffix(size, "Ki")
+	case strings.HasSuffix(size, "Mi"):
+		multiplier = 1 << 20
+		size = strings.TrimSuffix(size, "Mi")
+	}
+
+	value, err := strconv.Atoi(size)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a byte size", size)
+	}
+
+	if value <= 0 {
+		return 0, fmt.Errorf("%q is not a positive byte size", size)
+	}
+
+	return value * multiplier, nil
+}
@@ -0,0 +1,350 @@
+package flex
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetFuseOptions(t *testing.T) {
+	for _, testCase := range []struct {
+		name            string
+		spec            Spec
+		expectedOptions []string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:            "bytes",
+			spec:            Spec{MaxRead: "131072"},
+			expectedOptions: []string{"max_read=131072"},
+		},
+		{
+			name:            "suffixed",
+			spec:            Spec{MaxRead: "128Ki", MaxWrite: "1Mi"},
+			expectedOptions: []string{"max_read=131072", "max_write=1048576"},
+		},
+		{
+			name:            "write only",
+			spec:            Spec{MaxWrite: "64Ki"},
+			expectedOptions: []string{"max_write=65536"},
+		},
+		{
+			name:            "invalid is left out",
+			spec:            Spec{MaxRead: "128KB", MaxWrite: "-1"},
+			expectedOptions: nil,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if options := testCase.spec.GetFuseOptions(); !reflect.DeepEqual(options, testCase.expectedOptions) {
+				t.Fatalf("Expected %v, got %v", testCase.expectedOptions, options)
+			}
+		})
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for _, testCase := range []struct {
+		size         string
+		expectedSize int
+		expectError  bool
+	}{
+		{size: "4096", expectedSize: 4096},
+		{size: "4Ki", expectedSize: 4096},
+		{size: "16Mi", expectedSize: 16 << 20},
+		{size: "", expectError: true},
+		{size: "0", expectError: true},
+		{size: "-4Ki", expectError: true},
+		{size: "4KiB", expectError: true},
+		{size: "4k", expectError: true},
+	} {
+		size, err := parseByteSize(testCase.size)
+		if (err != nil) != testCase.expectError {
+			t.Fatalf("Size %q: expected error: %t, got %v", testCase.size, testCase.expectError, err)
+		}
+
+		if size != testCase.expectedSize {
+			t.Fatalf("Size %q: expected %d, got %d", testCase.size, testCase.expectedSize, size)
+		}
+	}
+}
+
+func TestValidateTransferSizes(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		spec        Spec
+		expectError bool
+	}{
+		{name: "minimum", spec: Spec{MaxRead: "4Ki"}},
+		{name: "maximum", spec: Spec{MaxWrite: "16Mi"}},
+		{name: "below minimum", spec: Spec{MaxRead: "4095"}, expectError: true},
+		{name: "above maximum", spec: Spec{MaxWrite: "17Mi"}, expectError: true},
+		{name: "invalid", spec: Spec{MaxRead: "big"}, expectError: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if err := testCase.spec.validate(true); (err != nil) != testCase.expectError {
+				t.Fatalf("Expected error: %t, got %v", testCase.expectError, err)
+			}
+		})
+	}
+}
+
+func TestParseSpecAliases(t *testing.T) {
+	for _, testCase := range []struct {
+		name         string
+		specString   string
+		expectedSpec Spec
+	}{
+		{name: "current names", specString: `{"container": "bigdata", "subPath": "/a"}`,
+			expectedSpec: Spec{Container: "bigdata", SubPath: "/a"}},
+		{name: "legacy names", specString: `{"containerName": "bigdata", "sub_path": "/a", "clusterName": "c1",
+			"access_key": "key", "dirs_to_create": "[]", "max_read": "1Mi", "max_write": "128Ki"}`,
+			expectedSpec: Spec{Container: "bigdata", SubPath: "/a", Cluster: "c1", OverrideAccessKey: "key",
+				DirsToCreate: "[]", MaxRead: "1Mi", MaxWrite: "128Ki"}},
+		{name: "current name wins", specString: `{"containerName": "legacy", "container": "bigdata"}`,
+			expectedSpec: Spec{Container: "bigdata"}},
+		{name: "case insensitive", specString: `{"Container": "bigdata", "SUBPATH": "/a"}`,
+			expectedSpec: Spec{Container: "bigdata", SubPath: "/a"}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			spec, err := parseSpec(testCase.specString)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(*spec, testCase.expectedSpec) {
+				t.Fatalf("Expected %+v, got %+v", testCase.expectedSpec, *spec)
+			}
+		})
+	}
+}
+
+func TestSpecFieldAliasesTargetSpecOptions(t *testing.T) {
+	specOptionNames := getSpecOptionNames()
+
+	for alias, fieldName := range specFieldAliases {
+		if _, found := specOptionNames[strings.ToLower(fieldName)]; !found {
+			t.Fatalf("Alias %s maps to unknown option %s", alias, fieldName)
+		}
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		spec          Spec
+		linkMode      bool
+		expectedError string
+	}{
+		{name: "valid", spec: Spec{Container: "bigdata", SubPath: "/a", AccessKey: "key"}},
+		{name: "valid link without access key", spec: Spec{Container: "bigdata", Namespace: "default"},
+			linkMode: true},
+		{name: "missing access key", spec: Spec{Container: "bigdata"}, expectedError: "access key"},
+		{name: "sub path without container", spec: Spec{SubPath: "/a", AccessKey: "key"},
+			expectedError: "subPath /a requires container to be set"},
+		{name: "container with separator", spec: Spec{Container: "big/data", AccessKey: "key"},
+			expectedError: `container must be a single path component, got "big/data"`},
+		{name: "container traversal", spec: Spec{Container: "..", AccessKey: "key"},
+			expectedError: `container must be a single path component, got ".."`},
+		{name: "namespace with separator", spec: Spec{Container: "bigdata", Namespace: "a/b"}, linkMode: true,
+			expectedError: `kubernetes.io/pod.namespace must be a single path component, got "a/b"`},
+		{name: "invalid max read", spec: Spec{AccessKey: "key", MaxRead: "lots"}, expectedError: "invalid maxRead"},
+		{name: "max write out of range", spec: Spec{AccessKey: "key", MaxWrite: "1"},
+			expectedError: "maxWrite must be between"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := testCase.spec.validate(testCase.linkMode)
+			if testCase.expectedError == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), testCase.expectedError) {
+				t.Fatalf("Expected an error with %q, got %v", testCase.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestParseSpecOptions(t *testing.T) {
+	// kubelet's own options, as passed along with the driver's
+	kubeletOptions := `"kubernetes.io/fsType": "", "kubernetes.io/readwrite": "rw",
+		"kubernetes.io/pod.name": "jupyter-7d9f", "kubernetes.io/pod.namespace": "default-tenant",
+		"kubernetes.io/pod.uid": "0c1d2e3f", "kubernetes.io/pvOrVolumeName": "v3io-fuse",
+		"kubernetes.io/serviceAccount.name": "default", "kubernetes.io/secret/accessKey": "a2V5"`
+
+	// withKubeletOptions adds the spec fields parsed from kubelet's options
+	withKubeletOptions := func(spec Spec) Spec {
+		spec.PodName = "jupyter-7d9f"
+		spec.Namespace = "default-tenant"
+		spec.PodUID = "0c1d2e3f"
+		spec.Name = "v3io-fuse"
+		spec.AccessKey = "a2V5"
+
+		return spec
+	}
+
+	for _, testCase := range []struct {
+		name             string
+		specString       string
+		expectedSpec     Spec
+		expectedWarnings []string
+		expectError      bool
+	}{
+		{
+			name:         "kubelet options",
+			specString:   `{"container": "bigdata", "subPath": "/a", "maxRead": "1Mi", ` + kubeletOptions + `}`,
+			expectedSpec: withKubeletOptions(Spec{Container: "bigdata", SubPath: "/a", MaxRead: "1Mi"}),
+		},
+		{
+			name:         "misspelled options",
+			specString:   `{"container": "bigdata", "subpth": "/a", "maxRaed": "1Mi", ` + kubeletOptions + `}`,
+			expectedSpec: withKubeletOptions(Spec{Container: "bigdata"}),
+			expectedWarnings: []string{
+				"Ignoring unknown option, it may be a misspelling: [option maxRaed similarOption maxRead]",
+				"Ignoring unknown option, it may be a misspelling: [option subpth similarOption subPath]",
+			},
+		},
+		{
+			name:             "unknown option",
+			specString:       `{"container": "bigdata", "readOnly": "true", ` + kubeletOptions + `}`,
+			expectedSpec:     withKubeletOptions(Spec{Container: "bigdata"}),
+			expectedWarnings: []string{"Ignoring unknown option: [option readOnly]"},
+		},
+		{
+			name:        "non string option",
+			specString:  `{"container": "bigdata", "maxRead": 1048576, ` + kubeletOptions + `}`,
+			expectError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			getLogs := captureJournal(t)
+
+			spec, err := parseSpec(testCase.specString)
+			if testCase.expectError {
+				if err == nil {
+					t.Fatalf("Expected spec %s to be refused", testCase.specString)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(*spec, testCase.expectedSpec) {
+				t.Fatalf("Expected %+v, got %+v", testCase.expectedSpec, *spec)
+			}
+
+			// kubelet's informational options are ignored quietly
+			var warnings []string
+			for _, line := range strings.Split(getLogs(), "\n") {
+				if warningIdx := strings.Index(line, " WARN "); warningIdx != -1 {
+					warnings = append(warnings, line[warningIdx+len(" WARN "):])
+				}
+			}
+
+			if !reflect.DeepEqual(warnings, testCase.expectedWarnings) {
+				t.Fatalf("Expected warnings %v, got %v", testCase.expectedWarnings, warnings)
+			}
+		})
+	}
+}
+
+func TestGetVolumeName(t *testing.T) {
+	for _, testCase := range []struct {
+		name        string
+		specString  string
+		otherSpec   string
+		expectEqual bool
+	}{
+		{
+			name:        "identical",
+			specString:  `{"cluster": "c1", "container": "bigdata", "subPath": "/a"}`,
+			otherSpec:   `{"cluster": "c1", "container": "bigdata", "subPath": "/a"}`,
+			expectEqual: true,
+		},
+		{
+			name: "pod and access key differ",
+			specString: `{"container": "bigdata", "subPath": "/a", "accessKey": "key1",
+				"kubernetes.io/pod.name": "jupyter", "kubernetes.io/pod.uid": "uid1"}`,
+			otherSpec: `{"container": "bigdata", "subPath": "/a", "accessKey": "key2",
+				"kubernetes.io/pod.name": "spark", "kubernetes.io/pod.uid": "uid2"}`,
+			expectEqual: true,
+		},
+		{
+			name:        "equivalent sub paths",
+			specString:  `{"container": "bigdata", "subPath": "a/b/"}`,
+			otherSpec:   `{"container": "bigdata", "subPath": "/a//b"}`,
+			expectEqual: true,
+		},
+		{
+			name:        "default cluster",
+			specString:  `{"container": "bigdata"}`,
+			otherSpec:   `{"cluster": "default", "container": "bigdata"}`,
+			expectEqual: true,
+		},
+		{
+			name:       "clusters differ",
+			specString: `{"cluster": "c1", "container": "bigdata", "subPath": "/a"}`,
+			otherSpec:  `{"cluster": "c2", "container": "bigdata", "subPath": "/a"}`,
+		},
+		{
+			name:       "containers differ",
+			specString: `{"container": "bigdata", "subPath": "/a"}`,
+			otherSpec:  `{"container": "users", "subPath": "/a"}`,
+		},
+		{
+			name:       "sub paths differ",
+			specString: `{"container": "bigdata", "subPath": "/a"}`,
+			otherSpec:  `{"container": "bigdata", "subPath": "/b"}`,
+		},
+		{
+			name:       "fields don't run together",
+			specString: `{"container": "big", "subPath": "data"}`,
+			otherSpec:  `{"container": "bigdata"}`,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			response := GetVolumeName(testCase.specString)
+			otherResponse := GetVolumeName(testCase.otherSpec)
+
+			for _, response := range []*Response{response, otherResponse} {
+				if response.Status != "Success" || !strings.HasPrefix(response.VolumeName, "v3io-") {
+					t.Fatalf("Expected a volume name, got %+v", response)
+				}
+			}
+
+			if equal := response.VolumeName == otherResponse.VolumeName; equal != testCase.expectEqual {
+				t.Fatalf("Expected equal volume names: %t, got %s and %s",
+					testCase.expectEqual,
+					response.VolumeName,
+					otherResponse.VolumeName)
+			}
+		})
+	}
+}
+
+func TestGetVolumeNameFallback(t *testing.T) {
+	for _, testCase := range []struct {
+		name           string
+		specString     string
+		expectedStatus string
+	}{
+		{name: "no container", specString: `{"subPath": "/a", "accessKey": "key"}`, expectedStatus: "Not supported"},
+		{name: "invalid spec", specString: `{"container": `, expectedStatus: "Failure"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			// kubelet falls back to its own naming on any status but success
+			response := GetVolumeName(testCase.specString)
+			if response.Status != testCase.expectedStatus || response.VolumeName != "" {
+				t.Fatalf("Expected status %s without a volume name, got %+v", testCase.expectedStatus, response)
+			}
+		})
+	}
+}
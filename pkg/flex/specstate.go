@@ -0,0 +1,155 @@
+package flex
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+// mountSpecsDir holds the specs targets were mounted with. It's a variable so that tests can keep their specs apart
+// from the node's
+var mountSpecsDir = "/var/run/v3io-fuse/specs"
+
+// mountRecord is what is recorded about each mounted target
+type mountRecord struct {
+	TargetPath  string    `json:"targetPath"`
+	MountedAt   time.Time `json:"mountedAt"`
+	Spec        Spec      `json:"spec"`
+	Image       string    `json:"image,omitempty"`
+	ImageDigest string    `json:"imageDigest,omitempty"`
+
+	// DriverVersion and DriverGitCommit identify the driver build that mounted the target, so mounts by a build
+	// with a since fixed bug can be found and remounted
+	DriverVersion   string `json:"driverVersion,omitempty"`
+	DriverGitCommit string `json:"driverGitCommit,omitempty"`
+}
+
+// saveMountSpec records the spec a target was mounted with, so a later mount of the same target can tell whether
+// the spec changed, along with the image it was mounted with. The spec holds the access key, hence the file is
+// only readable by root
+func (m *Mounter) saveMountSpec(targetPath string, spec *Spec, imageDigest string) error {
+	if err := os.MkdirAll(mountSpecsDir, 0700); err != nil {
+		return fmt.Errorf("Failed to create mount specs directory: %s", err)
+	}
+
+	recordBytes, err := json.Marshal(mountRecord{
+		TargetPath:  targetPath,
+		MountedAt:   time.Now(),
+		Spec:        *spec,
+		Image:       m.Config.getClusterImage(spec.GetClusterName()),
+		ImageDigest: imageDigest,
+
+		DriverVersion:   DriverVersion,
+		DriverGitCommit: DriverGitCommit,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to marshal spec: %s", err)
+	}
+
+	if err := ioutil.WriteFile(getMountSpecFilePath(targetPath), recordBytes, 0600); err != nil {
+		return fmt.Errorf("Failed to save mount spec: %s", err)
+	}
+
+	return nil
+}
+
+// loadMountSpec returns the spec a target was mounted with, or nil if none was recorded
+func loadMountSpec(targetPath string) (*Spec, error) {
+	record, err := loadMountRecord(getMountSpecFilePath(targetPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &record.Spec, nil
+}
+
+// loadMountRecords returns the records of all mounted targets
+func loadMountRecords() ([]mountRecord, error) {
+	recordFiles, err := ioutil.ReadDir(mountSpecsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("Failed to read mount specs directory: %s", err)
+	}
+
+	var records []mountRecord
+	for _, recordFile := range recordFiles {
+		record, err := loadMountRecord(path.Join(mountSpecsDir, recordFile.Name()))
+		if err != nil {
+
+			// the target may have been unmounted since the directory was read
+			if !os.IsNotExist(err) {
+				journal.Warn("Failed to load mount record", "name", recordFile.Name(), "err", err.Error())
+			}
+
+			continue
+		}
+
+		records = append(records, *record)
+	}
+
+	return records, nil
+}
+
+func loadMountRecord(recordFilePath string) (*mountRecord, error) {
+	recordBytes, err := ioutil.ReadFile(recordFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	record := mountRecord{}
+	if err := json.Unmarshal(recordBytes, &record); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal mount spec: %s", err)
+	}
+
+	return &record, nil
+}
+
+func removeMountSpec(targetPath string) {
+	if err := os.Remove(getMountSpecFilePath(targetPath)); err != nil && !os.IsNotExist(err) {
+		journal.Warn("Failed to remove mount spec", "target", targetPath, "err", err.Error())
+	}
+}
+
+func getMountSpecFilePath(targetPath string) string {
+	return path.Join(mountSpecsDir, sanitizePath(targetPath)+".json")
+}
+
+// diffSpecs returns the json names of the fields that differ between two specs, split into those that only take
+// effect by recreating the fuse container (tagged recreate:"true") and cosmetic ones
+func diffSpecs(oldSpec *Spec, newSpec *Spec) ([]string, []string) {
+	var recreateFields, cosmeticFields []string
+
+	oldValue := reflect.ValueOf(*oldSpec)
+	newValue := reflect.ValueOf(*newSpec)
+	specType := oldValue.Type()
+
+	for fieldIdx := 0; fieldIdx < specType.NumField(); fieldIdx++ {
+		field := specType.Field(fieldIdx)
+
+		if reflect.DeepEqual(oldValue.Field(fieldIdx).Interface(), newValue.Field(fieldIdx).Interface()) {
+			continue
+		}
+
+		name := parseJSONTag(field)
+		if field.Tag.Get("recreate") == "true" {
+			recreateFields = append(recreateFields, name)
+		} else {
+			cosmeticFields = append(cosmeticFields, name)
+		}
+	}
+
+	return recreateFields, cosmeticFields
+}
@@ -0,0 +1,93 @@
+package flex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSpecs(t *testing.T) {
+	mountedSpec := Spec{
+		Container:    "bigdata",
+		SubPath:      "a",
+		AccessKey:    "a2V5",
+		PodName:      "pod",
+		Namespace:    "default",
+		DirsToCreate: `[{"name": "a"}]`,
+	}
+
+	for _, testCase := range []struct {
+		name                   string
+		modify                 func(spec *Spec)
+		expectedRecreateFields []string
+		expectedCosmeticFields []string
+	}{
+		{
+			name:   "unchanged",
+			modify: func(spec *Spec) {},
+		},
+		{
+			name:                   "sub path",
+			modify:                 func(spec *Spec) { spec.SubPath = "b" },
+			expectedRecreateFields: []string{"subPath"},
+		},
+		{
+			name:                   "access key",
+			modify:                 func(spec *Spec) { spec.AccessKey = "b3RoZXI=" },
+			expectedRecreateFields: []string{"kubernetes.io/secret/accessKey"},
+		},
+		{
+			name:                   "overriding access key",
+			modify:                 func(spec *Spec) { spec.OverrideAccessKey = "key" },
+			expectedRecreateFields: []string{"accessKey"},
+		},
+		{
+			name: "container and cluster",
+			modify: func(spec *Spec) {
+				spec.Container = "users"
+				spec.Cluster = "dr"
+			},
+			expectedRecreateFields: []string{"container", "cluster"},
+		},
+		{
+			name:                   "transfer size",
+			modify:                 func(spec *Spec) { spec.MaxWrite = "1Mi" },
+			expectedRecreateFields: []string{"maxWrite"},
+		},
+		{
+			name: "pod metadata",
+			modify: func(spec *Spec) {
+				spec.PodName = "other-pod"
+				spec.PodUID = "uid"
+			},
+			expectedCosmeticFields: []string{"kubernetes.io/pod.name", "kubernetes.io/pod.uid"},
+		},
+		{
+			name:                   "folders",
+			modify:                 func(spec *Spec) { spec.DirsToCreate = `[{"name": "b"}]` },
+			expectedCosmeticFields: []string{"dirsToCreate"},
+		},
+		{
+			name: "both",
+			modify: func(spec *Spec) {
+				spec.SubPath = ""
+				spec.Namespace = "other"
+			},
+			expectedRecreateFields: []string{"subPath"},
+			expectedCosmeticFields: []string{"kubernetes.io/pod.namespace"},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			spec := mountedSpec
+			testCase.modify(&spec)
+
+			recreateFields, cosmeticFields := diffSpecs(&mountedSpec, &spec)
+			if !reflect.DeepEqual(recreateFields, testCase.expectedRecreateFields) {
+				t.Fatalf("Expected recreate fields %v, got %v", testCase.expectedRecreateFields, recreateFields)
+			}
+
+			if !reflect.DeepEqual(cosmeticFields, testCase.expectedCosmeticFields) {
+				t.Fatalf("Expected cosmetic fields %v, got %v", testCase.expectedCosmeticFields, cosmeticFields)
+			}
+		})
+	}
+}
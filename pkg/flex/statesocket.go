@@ -0,0 +1,138 @@
+package flex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+// MountState is a mount as reported to local agents over the state socket. It deliberately leaves out the
+// spec's secrets
+type MountState struct {
+	TargetPath    string    `json:"targetPath"`
+	ContainerName string    `json:"containerName,omitempty"`
+	Cluster       string    `json:"cluster"`
+	Container     string    `json:"container,omitempty"`
+	SubPath       string    `json:"subPath,omitempty"`
+	PodName       string    `json:"podName,omitempty"`
+	Namespace     string    `json:"namespace,omitempty"`
+	MountedAt     time.Time `json:"mountedAt"`
+	Health        string    `json:"health"`
+}
+
+// ServeState serves the node's mount inventory (/mounts) and a summary of its mounts' health in the prometheus
+// text format (/metrics) on the read-only unix socket at StateSocketPath, until the server fails. The driver
+// itself runs per call, so the inventory is read from the records mounts leave behind on every request, and is as
+// current as the last mount or unmount
+func (m *Mounter) ServeState() error {
+	if m.Config.StateSocketPath == "" {
+		return errors.New("state_socket_path is not configured")
+	}
+
+	// a socket left behind by a previous server would fail the listen
+	if err := os.Remove(m.Config.StateSocketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove stale state socket: %s", err)
+	}
+
+	listener, err := net.Listen("unix", m.Config.StateSocketPath)
+	if err != nil {
+		return fmt.Errorf("Failed to listen on state socket %s: %s", m.Config.StateSocketPath, err)
+	}
+
+	defer listener.Close() // nolint: errcheck
+
+	journal.Info("Serving mount state", "socketPath", m.Config.StateSocketPath)
+
+	serveMux := http.NewServeMux()
+	serveMux.HandleFunc("/mounts", m.handleMountsRequest)
+	serveMux.HandleFunc("/metrics", m.handleMetricsRequest)
+
+	return http.Serve(listener, serveMux)
+}
+
+func (m *Mounter) handleMountsRequest(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(responseWriter, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	records, err := loadMountRecords()
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mountStates := []MountState{}
+	for _, record := range records {
+		mountState := MountState{
+			TargetPath: record.TargetPath,
+			Cluster:    record.Spec.GetClusterName(),
+			Container:  record.Spec.Container,
+			SubPath:    record.Spec.SubPath,
+			PodName:    record.Spec.PodName,
+			Namespace:  record.Spec.Namespace,
+			MountedAt:  record.MountedAt,
+			Health:     string(m.mountpointHealth(record.TargetPath)),
+		}
+
+		if containerName, err := m.getContainerName(record.TargetPath, &record.Spec); err == nil {
+			mountState.ContainerName = containerName
+		}
+
+		mountStates = append(mountStates, mountState)
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(responseWriter).Encode(mountStates); err != nil {
+		journal.Warn("Failed to write mount state", "err", err.Error())
+	}
+}
+
+// handleMetricsRequest reports how many of the node's v3io mounts are in each health, as found in the mount table
+// at the time of the scrape, and the latency histograms of the mounts and unmounts done since the node booted
+func (m *Mounter) handleMetricsRequest(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(responseWriter, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mountPoints, err := m.listV3IOMounts()
+	if err != nil {
+		http.Error(responseWriter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mountsByHealth := map[mountHealth]int{
+		mountHealthHealthy:    0,
+		mountHealthDead:       0,
+		mountHealthNotMounted: 0,
+	}
+
+	for _, mountPoint := range mountPoints {
+		mountsByHealth[m.mountpointHealth(mountPoint)]++
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(responseWriter, "# HELP v3io_fuse_mounts Number of v3io fuse mounts on the node by health")
+	fmt.Fprintln(responseWriter, "# TYPE v3io_fuse_mounts gauge")
+
+	for _, health := range []mountHealth{mountHealthHealthy, mountHealthDead, mountHealthNotMounted} {
+		fmt.Fprintf(responseWriter, "v3io_fuse_mounts{health=%q} %d\n", health, mountsByHealth[health])
+	}
+
+	latencyHistograms, err := loadLatencyHistograms()
+	if err != nil {
+		journal.Warn("Failed to load latency histograms", "err", err.Error())
+		return
+	}
+
+	writeLatencyMetrics(responseWriter, latencyHistograms)
+}
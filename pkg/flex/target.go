@@ -0,0 +1,48 @@
+package flex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const defaultKubeletRootDir = "/var/lib/kubelet"
+
+var ErrTargetOutsideKubeletRoot = errors.New("target is outside of kubelet root")
+
+// resolveTargetPath returns the real path of a target that is itself a symlink (as in some CSI migration setups),
+// since mount, umount and the mount table all deal in real paths. A target that resolves outside the kubelet root
+// is rejected. A target that doesn't exist yet is returned as is
+func (m *Mounter) resolveTargetPath(targetPath string) (string, error) {
+	targetInfo, err := m.filesystem.Lstat(targetPath)
+	if err != nil || targetInfo.Mode()&os.ModeSymlink == 0 {
+		return targetPath, nil
+	}
+
+	resolvedTargetPath, err := m.filesystem.EvalSymlinks(targetPath)
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve symlinked target %s: %s", targetPath, err)
+	}
+
+	// the kubelet root may itself be a symlink (e.g. to a data disk)
+	kubeletRootDir, err := m.filesystem.EvalSymlinks(m.Config.getKubeletRootDir())
+	if err != nil {
+		return "", fmt.Errorf("Failed to resolve kubelet root %s: %s", m.Config.getKubeletRootDir(), err)
+	}
+
+	if !strings.HasPrefix(resolvedTargetPath, kubeletRootDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s links to %s, outside of kubelet root %s",
+			ErrTargetOutsideKubeletRoot,
+			targetPath,
+			resolvedTargetPath,
+			kubeletRootDir)
+	}
+
+	journal.Debug("Resolved symlinked target", "target", targetPath, "resolvedTarget", resolvedTargetPath)
+
+	return resolvedTargetPath, nil
+}
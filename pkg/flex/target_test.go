@@ -0,0 +1,111 @@
+package flex
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveTargetPath(t *testing.T) {
+	const volumesDir = "/var/lib/kubelet/pods/uid/volumes/v3io~fuse"
+
+	for _, testCase := range []struct {
+		name             string
+		kubeletRootDir   string
+		setup            func(filesystem *memoryFilesystem)
+		targetPath       string
+		expectedPath     string
+		expectOutsideErr bool
+	}{
+		{
+			name:         "real",
+			targetPath:   volumesDir + "/real",
+			expectedPath: volumesDir + "/real",
+		},
+		{
+			name:         "missing",
+			targetPath:   volumesDir + "/missing",
+			expectedPath: volumesDir + "/missing",
+		},
+		{
+			name: "relative link inside",
+			setup: func(filesystem *memoryFilesystem) {
+				filesystem.Symlink("real", volumesDir+"/link") // nolint: errcheck
+			},
+			targetPath:   volumesDir + "/link",
+			expectedPath: volumesDir + "/real",
+		},
+		{
+			name: "absolute link inside",
+			setup: func(filesystem *memoryFilesystem) {
+				filesystem.MkdirAll("/var/lib/kubelet/plugins/v3io/target", 0755)              // nolint: errcheck
+				filesystem.Symlink("/var/lib/kubelet/plugins/v3io/target", volumesDir+"/link") // nolint: errcheck
+			},
+			targetPath:   volumesDir + "/link",
+			expectedPath: "/var/lib/kubelet/plugins/v3io/target",
+		},
+		{
+			name: "link outside",
+			setup: func(filesystem *memoryFilesystem) {
+				filesystem.MkdirAll("/outside", 0755)                // nolint: errcheck
+				filesystem.Symlink("/outside", volumesDir+"/escape") // nolint: errcheck
+			},
+			targetPath:       volumesDir + "/escape",
+			expectOutsideErr: true,
+		},
+		{
+			name: "link to a sibling of the kubelet root",
+			setup: func(filesystem *memoryFilesystem) {
+				filesystem.MkdirAll("/var/lib/kubelet-other/target", 0755)                // nolint: errcheck
+				filesystem.Symlink("/var/lib/kubelet-other/target", volumesDir+"/escape") // nolint: errcheck
+			},
+			targetPath:       volumesDir + "/escape",
+			expectOutsideErr: true,
+		},
+		{
+			name: "link to the kubelet root itself",
+			setup: func(filesystem *memoryFilesystem) {
+				filesystem.Symlink("/var/lib/kubelet", volumesDir+"/escape") // nolint: errcheck
+			},
+			targetPath:       volumesDir + "/escape",
+			expectOutsideErr: true,
+		},
+		{
+			name:           "symlinked kubelet root",
+			kubeletRootDir: "/kubelet",
+			setup: func(filesystem *memoryFilesystem) {
+				filesystem.Symlink("/var/lib/kubelet", "/kubelet")         // nolint: errcheck
+				filesystem.Symlink(volumesDir+"/real", volumesDir+"/link") // nolint: errcheck
+			},
+			targetPath:   volumesDir + "/link",
+			expectedPath: volumesDir + "/real",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			filesystem := newMemoryFilesystem()
+			filesystem.MkdirAll(volumesDir+"/real", 0755) // nolint: errcheck
+
+			if testCase.setup != nil {
+				testCase.setup(filesystem)
+			}
+
+			mounter := newTestMounter(&Config{KubeletRootDir: testCase.kubeletRootDir}, filesystem)
+
+			resolvedPath, err := mounter.resolveTargetPath(testCase.targetPath)
+			if testCase.expectOutsideErr {
+				if !errors.Is(err, ErrTargetOutsideKubeletRoot) {
+					t.Fatalf("Expected %s to be rejected, got %v", testCase.targetPath, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if resolvedPath != testCase.expectedPath {
+				t.Fatalf("Expected %s, got %s", testCase.expectedPath, resolvedPath)
+			}
+		})
+	}
+}
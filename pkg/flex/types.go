@@ -1,6 +1,12 @@
 package flex
 
+// ClusterConfig is a cluster mounts can be of, looked up by name. A spec that doesn't name its cluster is for the
+// cluster named default. Clusters are configured as a list rather than a map keyed by name, as existing config
+// files have them, and their names are validated to be unique instead
 type ClusterConfig struct {
 	Name     string   `json:"name"`
 	DataUrls []string `json:"data_urls"`
+
+	// Image overrides the fuse image for mounts of the cluster (e.g. one running another platform version)
+	Image string `json:"image"`
 }
@@ -0,0 +1,60 @@
+package flex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const (
+	fuseConfigDir          = "/etc/v3io/fuse"
+	stagedV3ioConfigSuffix = ".conf"
+)
+
+// stagedV3ioConfigsDir holds the staged v3io configs. It's a variable so that tests can stage configs apart from
+// the node's
+var stagedV3ioConfigsDir = fuseConfigDir + "/staged"
+
+// stageV3ioConfig returns the path the fuse container should read V3ioConfigPath from. Only fuseConfigDir is
+// mounted into the container, so a config outside it is copied into stagedV3ioConfigsDir under a name derived
+// from the target, to be removed by removeStagedV3ioConfig once the target is unmounted
+func (m *Mounter) stageV3ioConfig(targetPath string) (string, error) {
+	v3ioConfigPath := m.Config.V3ioConfigPath
+	if v3ioConfigPath == "" || isSubPath(fuseConfigDir, filepath.Clean(v3ioConfigPath)) {
+		return v3ioConfigPath, nil
+	}
+
+	v3ioConfigContents, err := ioutil.ReadFile(v3ioConfigPath)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read v3io config %s: %s", v3ioConfigPath, err)
+	}
+
+	if err := os.MkdirAll(stagedV3ioConfigsDir, 0700); err != nil {
+		return "", fmt.Errorf("Failed to create staged v3io configs directory: %s", err)
+	}
+
+	stagedV3ioConfigPath := getStagedV3ioConfigPath(targetPath)
+
+	journal.Debug("Staging v3io config", "v3ioConfigPath", v3ioConfigPath, "stagedPath", stagedV3ioConfigPath)
+
+	if err := ioutil.WriteFile(stagedV3ioConfigPath, v3ioConfigContents, 0600); err != nil {
+		return "", fmt.Errorf("Failed to stage v3io config: %s", err)
+	}
+
+	return stagedV3ioConfigPath, nil
+}
+
+// removeStagedV3ioConfig removes the v3io config staged for a target, if any
+func removeStagedV3ioConfig(targetPath string) {
+	if err := os.Remove(getStagedV3ioConfigPath(targetPath)); err != nil && !os.IsNotExist(err) {
+		journal.Warn("Failed to remove staged v3io config", "target", targetPath, "err", err.Error())
+	}
+}
+
+func getStagedV3ioConfigPath(targetPath string) string {
+	return path.Join(stagedV3ioConfigsDir, sanitizePath(targetPath)+stagedV3ioConfigSuffix)
+}
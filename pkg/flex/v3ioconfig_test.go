@@ -0,0 +1,67 @@
+package flex
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStagedV3ioConfigRemovedAtUnmount(t *testing.T) {
+	originalStagedV3ioConfigsDir := stagedV3ioConfigsDir
+	stagedV3ioConfigsDir = filepath.Join(t.TempDir(), "staged")
+
+	t.Cleanup(func() { stagedV3ioConfigsDir = originalStagedV3ioConfigsDir })
+
+	v3ioConfigPath := filepath.Join(t.TempDir(), "v3io.conf")
+	ioutil.WriteFile(v3ioConfigPath, []byte("{}"), 0600) // nolint: errcheck
+
+	mounter, criInstance := newFakeCRIMounter(t, &Config{
+		Clusters:       []ClusterConfig{{Name: "default", DataUrls: []string{"tcp://10.0.0.1:1234"}}},
+		V3ioConfigPath: v3ioConfigPath,
+	})
+	mounter.filesystem.MkdirAll(fakeTargetPath, 0755) // nolint: errcheck
+
+	if err := mounter.createV3IOFUSEContainer(context.Background(), &Spec{}, fakeTargetPath); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	stagedV3ioConfigPath := getStagedV3ioConfigPath(fakeTargetPath)
+	if _, err := os.Stat(stagedV3ioConfigPath); err != nil {
+		t.Fatalf("Expected a staged config at %s, got %s", stagedV3ioConfigPath, err)
+	}
+
+	for _, args := range criInstance.createArgs {
+		if !strings.Contains(strings.Join(args, " "), "-f "+stagedV3ioConfigPath) {
+			t.Fatalf("Expected the fuse args to read the staged config, got %v", args)
+		}
+	}
+
+	if response := mounter.completeUnmount(fakeTargetPath); response.Status != "Success" {
+		t.Fatalf("Expected success, got %+v", response)
+	}
+
+	if _, err := os.Stat(stagedV3ioConfigPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected the staged config to be removed, got %v", err)
+	}
+
+	if _, err := os.Stat(v3ioConfigPath); err != nil {
+		t.Fatalf("Expected the original config to remain, got %s", err)
+	}
+}
+
+func TestStageV3ioConfigInFuseConfigDir(t *testing.T) {
+	v3ioConfigPath := filepath.Join(fuseConfigDir, "v3io.conf")
+	mounter := newTestMounter(&Config{V3ioConfigPath: v3ioConfigPath}, newMemoryFilesystem())
+
+	stagedV3ioConfigPath, err := mounter.stageV3ioConfig(fakeTargetPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if stagedV3ioConfigPath != v3ioConfigPath {
+		t.Fatalf("Expected %s to be used as is, got %s", v3ioConfigPath, stagedV3ioConfigPath)
+	}
+}
@@ -0,0 +1,17 @@
+package flex
+
+// DriverVersion and DriverGitCommit identify the driver build. They're set at build time, with
+// -ldflags "-X github.com/v3io/flex-fuse/pkg/flex.DriverVersion=<version>"
+var (
+	DriverVersion   = "unstable"
+	DriverGitCommit = ""
+)
+
+// getDriverVersion returns the driver's version, along with its git commit if known
+func getDriverVersion() string {
+	if DriverGitCommit == "" {
+		return DriverVersion
+	}
+
+	return DriverVersion + "-" + DriverGitCommit
+}
@@ -0,0 +1,93 @@
+package flex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/v3io/flex-fuse/pkg/journal"
+)
+
+const (
+	defaultEventWebhookTimeout = 2 * time.Second
+
+	eventTypeMount   = "mount"
+	eventTypeUnmount = "unmount"
+)
+
+// volumeEvent is what the event webhook receives. It only has the spec's non-secret fields
+type volumeEvent struct {
+	Type       string    `json:"type"`
+	TargetPath string    `json:"targetPath"`
+	Time       time.Time `json:"time"`
+	Message    string    `json:"message"`
+	Cluster    string    `json:"cluster,omitempty"`
+	Container  string    `json:"container,omitempty"`
+	SubPath    string    `json:"subPath,omitempty"`
+	PodName    string    `json:"podName,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	PodUID     string    `json:"podUID,omitempty"`
+	VolumeName string    `json:"volumeName,omitempty"`
+}
+
+// sendEvent posts a successful mount or unmount to EventWebhookURL. The driver exits once it responds to kubelet,
+// so the post isn't left in the background, but bounded by EventWebhookTimeoutSeconds. Failures are only logged
+func (m *Mounter) sendEvent(eventType string, targetPath string, spec *Spec, response *Response) {
+	if m.Config.EventWebhookURL == "" || response.Status != "Success" {
+		return
+	}
+
+	event := volumeEvent{
+		Type:       eventType,
+		TargetPath: targetPath,
+		Time:       time.Now(),
+		Message:    response.Message,
+	}
+
+	if spec != nil {
+		event.Cluster = spec.GetClusterName()
+		event.Container = spec.Container
+		event.SubPath = spec.SubPath
+		event.PodName = spec.PodName
+		event.Namespace = spec.Namespace
+		event.PodUID = spec.PodUID
+		event.VolumeName = spec.Name
+	}
+
+	if err := m.postEvent(&event); err != nil {
+		journal.Warn("Failed to send event to webhook", "type", eventType, "target", targetPath, "err", err.Error())
+	}
+}
+
+func (m *Mounter) postEvent(event *volumeEvent) error {
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal event: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Config.getEventWebhookTimeout())
+	defer cancel()
+
+	request, err := http.NewRequest(http.MethodPost, m.Config.EventWebhookURL, bytes.NewReader(eventBytes))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close() // nolint: errcheck
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Webhook responded with status %s", response.Status)
+	}
+
+	return nil
+}
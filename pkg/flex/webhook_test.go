@@ -0,0 +1,200 @@
+package flex
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWebhook is a webhook server that records the events posted to it, responding with statusCode
+type fakeWebhook struct {
+	lock       sync.Mutex
+	statusCode int
+	events     []string
+	release    chan struct{}
+}
+
+func newFakeWebhook(t *testing.T, statusCode int, block bool) (*fakeWebhook, string) {
+	webhook := &fakeWebhook{statusCode: statusCode}
+	if block {
+		webhook.release = make(chan struct{})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(webhook.handle))
+
+	// a blocked request must be released before the server can close
+	t.Cleanup(func() {
+		if webhook.release != nil {
+			close(webhook.release)
+		}
+
+		server.Close()
+	})
+
+	return webhook, server.URL
+}
+
+func (w *fakeWebhook) handle(responseWriter http.ResponseWriter, request *http.Request) {
+	body, _ := ioutil.ReadAll(request.Body)
+
+	w.lock.Lock()
+	if request.Method == http.MethodPost && request.Header.Get("Content-Type") == "application/json" {
+		w.events = append(w.events, string(body))
+	}
+	w.lock.Unlock()
+
+	if w.release != nil {
+		<-w.release
+	}
+
+	responseWriter.WriteHeader(w.statusCode)
+}
+
+func (w *fakeWebhook) getEvents() []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return append([]string{}, w.events...)
+}
+
+func TestSendEvent(t *testing.T) {
+	const accessKey = "secret-access-key"
+
+	spec := &Spec{
+		Container:         "bigdata",
+		SubPath:           "/a",
+		PodName:           "jupyter",
+		Namespace:         "default-tenant",
+		PodUID:            "uid",
+		Name:              "v3io",
+		OverrideAccessKey: accessKey,
+	}
+
+	for _, testCase := range []struct {
+		name            string
+		statusCode      int
+		block           bool
+		noURL           bool
+		eventType       string
+		response        *Response
+		expectEvent     bool
+		expectedWarning string
+	}{
+		{
+			name:        "mount",
+			statusCode:  http.StatusOK,
+			eventType:   eventTypeMount,
+			response:    NewSuccessResponse("Successfully mounted"),
+			expectEvent: true,
+		},
+		{
+			name:        "unmount",
+			statusCode:  http.StatusNoContent,
+			eventType:   eventTypeUnmount,
+			response:    NewSuccessResponse("Successfully unmounted"),
+			expectEvent: true,
+		},
+		{
+			name:       "failed mount",
+			statusCode: http.StatusOK,
+			eventType:  eventTypeMount,
+			response:   NewFailResponse("Failed to mount", nil),
+		},
+		{
+			name:      "no webhook",
+			noURL:     true,
+			eventType: eventTypeMount,
+			response:  NewSuccessResponse("Successfully mounted"),
+		},
+		{
+			name:            "webhook fails",
+			statusCode:      http.StatusInternalServerError,
+			eventType:       eventTypeMount,
+			response:        NewSuccessResponse("Successfully mounted"),
+			expectEvent:     true,
+			expectedWarning: "Webhook responded with status 500",
+		},
+		{
+			name:            "webhook hangs",
+			statusCode:      http.StatusOK,
+			block:           true,
+			eventType:       eventTypeMount,
+			response:        NewSuccessResponse("Successfully mounted"),
+			expectEvent:     true,
+			expectedWarning: "Failed to send event to webhook",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			getLogs := captureJournal(t)
+			webhook, webhookURL := newFakeWebhook(t, testCase.statusCode, testCase.block)
+
+			config := &Config{EventWebhookURL: webhookURL, EventWebhookTimeoutSeconds: 1}
+			if testCase.noURL {
+				config.EventWebhookURL = ""
+			}
+
+			mounter := newTestMounter(config, newMemoryFilesystem())
+
+			startTime := time.Now()
+			mounter.sendEvent(testCase.eventType, fakeTargetPath, spec, testCase.response)
+
+			// the webhook never holds up the mount past its timeout
+			if elapsed := time.Since(startTime); elapsed > 2*time.Second {
+				t.Fatalf("Expected the event to be sent within its timeout, took %s", elapsed)
+			}
+
+			events := webhook.getEvents()
+			if !testCase.expectEvent {
+				if len(events) != 0 {
+					t.Fatalf("Expected no events, got %v", events)
+				}
+
+				return
+			}
+
+			if len(events) != 1 {
+				t.Fatalf("Expected 1 event, got %v", events)
+			}
+
+			if strings.Contains(events[0], accessKey) {
+				t.Fatalf("Expected the access key to be left out of the event, got %s", events[0])
+			}
+
+			event := volumeEvent{}
+			if err := json.Unmarshal([]byte(events[0]), &event); err != nil {
+				t.Fatalf("Failed to unmarshal event %s: %s", events[0], err)
+			}
+
+			expectedEvent := volumeEvent{
+				Type:       testCase.eventType,
+				TargetPath: fakeTargetPath,
+				Time:       event.Time,
+				Message:    testCase.response.Message,
+				Cluster:    spec.GetClusterName(),
+				Container:  "bigdata",
+				SubPath:    "/a",
+				PodName:    "jupyter",
+				Namespace:  "default-tenant",
+				PodUID:     "uid",
+				VolumeName: "v3io",
+			}
+
+			if event != expectedEvent {
+				t.Fatalf("Expected event %+v, got %+v", expectedEvent, event)
+			}
+
+			if event.Time.IsZero() {
+				t.Fatal("Expected the event to have a time")
+			}
+
+			if logs := getLogs(); !strings.Contains(logs, testCase.expectedWarning) {
+				t.Fatalf("Expected %q in the logs, got %s", testCase.expectedWarning, logs)
+			}
+		})
+	}
+}
@@ -29,13 +29,23 @@ type Logger struct {
 }
 
 func (j *Logger) journal(priority journal.Priority, message interface{}, vars ...interface{}) {
-	format := ""
-	if len(vars) > 0 {
-		format = fmt.Sprintf("%s: %s", message, vars)
-	} else {
-		format = fmt.Sprint(message)
+	if !isLevelEnabled(priority) {
+		return
 	}
-	journal.Send(format, priority, nil) // nolint: errcheck
+
+	// only debug messages are repetitive enough to flood the logs, e.g. on every poll of a retry loop
+	if priority == journal.PriDebug {
+		allowed, summary := debugRateLimiter.allow(fmt.Sprint(message))
+		if !allowed {
+			return
+		}
+
+		if summary != "" {
+			getSink().send(priority, formatMessage(priority, summary, nil)) // nolint: errcheck
+		}
+	}
+
+	getSink().send(priority, formatMessage(priority, message, vars)) // nolint: errcheck
 }
 
 func (j *Logger) Error(message interface{}, vars ...interface{}) {
@@ -111,6 +121,7 @@ func (j *Logger) DebugWithCtx(ctx context.Context, format interface{}, vars ...i
 }
 
 func (j *Logger) Flush() {
+	Flush()
 }
 
 func (j *Logger) GetChild(name string) logger.Logger {
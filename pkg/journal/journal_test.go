@@ -0,0 +1,58 @@
+package journal
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/coreos/go-systemd/journal"
+)
+
+// captureSink keeps the messages sent to it
+type captureSink struct {
+	lock     sync.Mutex
+	messages []string
+}
+
+func (s *captureSink) send(priority journal.Priority, message string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.messages = append(s.messages, message)
+
+	return nil
+}
+
+func (s *captureSink) getMessages() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.messages...)
+}
+
+// captureOutput captures a test's logs, restoring the output, level, format and debug rate limit once it's done
+func captureOutput(t *testing.T) *captureSink {
+	sink := &captureSink{}
+
+	sinkLock.Lock()
+	originalSink := currentSink
+	currentSink = sink
+	sinkLock.Unlock()
+
+	levelLock.Lock()
+	originalLevel, originalFormat := currentLevel, currentFormat
+	levelLock.Unlock()
+
+	t.Cleanup(func() {
+		sinkLock.Lock()
+		currentSink = originalSink
+		sinkLock.Unlock()
+
+		levelLock.Lock()
+		currentLevel, currentFormat = originalLevel, originalFormat
+		levelLock.Unlock()
+
+		SetDebugRateLimit(DefaultDebugRatePerSecond, DefaultDebugBurst)
+	})
+
+	return sink
+}
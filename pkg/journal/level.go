@@ -0,0 +1,171 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/journal"
+)
+
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+const (
+	LevelEnvVar  = "FLEX_FUSE_LOG_LEVEL"
+	FormatEnvVar = "FLEX_FUSE_LOG_FORMAT"
+)
+
+var (
+	currentLevel  = journal.PriDebug
+	currentFormat = FormatText
+	levelLock     sync.Mutex
+)
+
+// SetLevel sets the least severe level that is logged (debug, info, warn, error). Messages below it are dropped
+func SetLevel(level string) error {
+	priority, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	levelLock.Lock()
+	defer levelLock.Unlock()
+
+	currentLevel = priority
+
+	return nil
+}
+
+// SetFormat sets how messages are formatted: text, as the message followed by its vars, or json, as an object of
+// the time, level, message and vars
+func SetFormat(format string) error {
+	switch format {
+	case FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("Log format must be one of %s or %s, got %s", FormatText, FormatJSON, format)
+	}
+
+	levelLock.Lock()
+	defer levelLock.Unlock()
+
+	currentFormat = format
+
+	return nil
+}
+
+// SetFromEnvironment applies the level and format set in LevelEnvVar and FormatEnvVar, if set. Invalid values
+// are ignored with a warning
+func SetFromEnvironment() {
+	if level := os.Getenv(LevelEnvVar); level != "" {
+		if err := SetLevel(level); err != nil {
+			Warn("Ignoring invalid log level", "envVar", LevelEnvVar, "err", err.Error())
+		}
+	}
+
+	if format := os.Getenv(FormatEnvVar); format != "" {
+		if err := SetFormat(format); err != nil {
+			Warn("Ignoring invalid log format", "envVar", FormatEnvVar, "err", err.Error())
+		}
+	}
+}
+
+func parseLevel(level string) (journal.Priority, error) {
+	switch strings.ToLower(level) {
+	case LevelDebug:
+		return journal.PriDebug, nil
+	case LevelInfo:
+		return journal.PriInfo, nil
+	case LevelWarn:
+		return journal.PriWarning, nil
+	case LevelError:
+		return journal.PriErr, nil
+	default:
+		return 0, fmt.Errorf("Log level must be one of %s, %s, %s or %s, got %s",
+			LevelDebug,
+			LevelInfo,
+			LevelWarn,
+			LevelError,
+			level)
+	}
+}
+
+func isLevelEnabled(priority journal.Priority) bool {
+	levelLock.Lock()
+	defer levelLock.Unlock()
+
+	return priority <= currentLevel
+}
+
+func getFormat() string {
+	levelLock.Lock()
+	defer levelLock.Unlock()
+
+	return currentFormat
+}
+
+// formatMessage formats a message and its vars, which are key/value pairs, by the current format
+func formatMessage(priority journal.Priority, message interface{}, vars []interface{}) string {
+	if getFormat() != FormatJSON {
+		if len(vars) > 0 {
+			return fmt.Sprintf("%s: %s", message, vars)
+		}
+
+		return fmt.Sprint(message)
+	}
+
+	record := map[string]interface{}{}
+
+	for varIdx := 0; varIdx < len(vars); varIdx += 2 {
+		key := fmt.Sprint(vars[varIdx])
+
+		// a trailing key without a value is kept, rather than silently dropped
+		if varIdx+1 >= len(vars) {
+			record[key] = nil
+			break
+		}
+
+		record[key] = jsonValue(vars[varIdx+1])
+	}
+
+	record["time"] = time.Now().Format(time.RFC3339)
+	record["level"] = strings.ToLower(priorityName(priority))
+	record["message"] = fmt.Sprint(message)
+
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+
+		// a value that can't be encoded (e.g. a channel) is logged as formatted by fmt
+		for key, value := range record {
+			record[key] = fmt.Sprint(value)
+		}
+
+		recordBytes, _ = json.Marshal(record)
+	}
+
+	return string(recordBytes)
+}
+
+// jsonValue returns how a var is encoded, errors and stringers as their text rather than as empty objects
+func jsonValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case error:
+		return typedValue.Error()
+	case fmt.Stringer:
+		return typedValue.String()
+	default:
+		return value
+	}
+}
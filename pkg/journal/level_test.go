@@ -0,0 +1,228 @@
+package journal
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-systemd/journal"
+)
+
+func TestSetLevel(t *testing.T) {
+	for _, testCase := range []struct {
+		level            string
+		expectedMessages []string
+	}{
+		{level: LevelDebug, expectedMessages: []string{"debug", "info", "warn", "error"}},
+		{level: LevelInfo, expectedMessages: []string{"info", "warn", "error"}},
+		{level: LevelWarn, expectedMessages: []string{"warn", "error"}},
+		{level: LevelError, expectedMessages: []string{"error"}},
+		{level: "WARN", expectedMessages: []string{"warn", "error"}},
+	} {
+		t.Run(testCase.level, func(t *testing.T) {
+			sink := captureOutput(t)
+			SetDebugRateLimit(0, 0)
+
+			if err := SetLevel(testCase.level); err != nil {
+				t.Fatalf("Expected level %s to be set, got %s", testCase.level, err.Error())
+			}
+
+			Debug("debug")
+			Info("info")
+			Warn("warn")
+			Error("error")
+
+			if messages := sink.getMessages(); !reflect.DeepEqual(messages, testCase.expectedMessages) {
+				t.Fatalf("Expected messages %v, got %v", testCase.expectedMessages, messages)
+			}
+		})
+	}
+}
+
+func TestSetLevelInvalid(t *testing.T) {
+	captureOutput(t)
+
+	if err := SetLevel("verbose"); err == nil {
+		t.Fatal("Expected an invalid level to be refused")
+	}
+
+	if !isLevelEnabled(priorityOf(LevelDebug)) {
+		t.Fatal("Expected an invalid level to leave the current level as is")
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	for _, testCase := range []struct {
+		name          string
+		format        string
+		vars          []interface{}
+		expectedText  string
+		expectedJSON  map[string]interface{}
+		expectedError bool
+	}{
+		{
+			name:         "text without vars",
+			format:       FormatText,
+			expectedText: "Mounting",
+		},
+		{
+			name:         "text with vars",
+			format:       FormatText,
+			vars:         []interface{}{"target", "/mnt/v3io", "mode", "link"},
+			expectedText: "Mounting: [target /mnt/v3io mode link]",
+		},
+		{
+			name:   "json without vars",
+			format: FormatJSON,
+			expectedJSON: map[string]interface{}{
+				"level":   "info",
+				"message": "Mounting",
+			},
+		},
+		{
+			name:   "json with vars",
+			format: FormatJSON,
+			vars:   []interface{}{"target", "/mnt/v3io", "attempt", 2, "err", os.ErrNotExist},
+			expectedJSON: map[string]interface{}{
+				"level":   "info",
+				"message": "Mounting",
+				"target":  "/mnt/v3io",
+				"attempt": float64(2),
+				"err":     os.ErrNotExist.Error(),
+			},
+		},
+		{
+			name:   "json with a trailing key",
+			format: FormatJSON,
+			vars:   []interface{}{"target"},
+			expectedJSON: map[string]interface{}{
+				"level":   "info",
+				"message": "Mounting",
+				"target":  nil,
+			},
+		},
+		{
+			name:          "invalid",
+			format:        "xml",
+			expectedError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			sink := captureOutput(t)
+
+			err := SetFormat(testCase.format)
+			if testCase.expectedError {
+				if err == nil {
+					t.Fatalf("Expected format %s to be refused", testCase.format)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected format %s to be set, got %s", testCase.format, err.Error())
+			}
+
+			Info("Mounting", testCase.vars...)
+
+			messages := sink.getMessages()
+			if len(messages) != 1 {
+				t.Fatalf("Expected 1 message, got %d", len(messages))
+			}
+
+			if testCase.expectedJSON == nil {
+				if messages[0] != testCase.expectedText {
+					t.Fatalf("Expected message %q, got %q", testCase.expectedText, messages[0])
+				}
+
+				return
+			}
+
+			record := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(messages[0]), &record); err != nil {
+				t.Fatalf("Expected a JSON message, got %q (%s)", messages[0], err.Error())
+			}
+
+			if _, found := record["time"]; !found {
+				t.Fatalf("Expected a time in %q", messages[0])
+			}
+
+			delete(record, "time")
+
+			if !reflect.DeepEqual(record, testCase.expectedJSON) {
+				t.Fatalf("Expected record %v, got %v", testCase.expectedJSON, record)
+			}
+		})
+	}
+}
+
+func TestSetFromEnvironment(t *testing.T) {
+	for _, testCase := range []struct {
+		name           string
+		level          string
+		format         string
+		expectedLevel  string
+		expectedFormat string
+	}{
+		{
+			name:           "unset",
+			expectedLevel:  LevelDebug,
+			expectedFormat: FormatText,
+		},
+		{
+			name:           "set",
+			level:          "error",
+			format:         "json",
+			expectedLevel:  LevelError,
+			expectedFormat: FormatJSON,
+		},
+		{
+			name:           "invalid",
+			level:          "verbose",
+			format:         "xml",
+			expectedLevel:  LevelDebug,
+			expectedFormat: FormatText,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			captureOutput(t)
+			setEnv(t, LevelEnvVar, testCase.level)
+			setEnv(t, FormatEnvVar, testCase.format)
+
+			SetLevel(LevelDebug)  // nolint: errcheck
+			SetFormat(FormatText) // nolint: errcheck
+
+			SetFromEnvironment()
+
+			if !isLevelEnabled(priorityOf(testCase.expectedLevel)) ||
+				(testCase.expectedLevel != LevelDebug && isLevelEnabled(priorityOf(LevelDebug))) {
+				t.Fatalf("Expected level %s", testCase.expectedLevel)
+			}
+
+			if format := getFormat(); format != testCase.expectedFormat {
+				t.Fatalf("Expected format %s, got %s", testCase.expectedFormat, format)
+			}
+		})
+	}
+}
+
+// setEnv sets an environment variable for the test, restoring it once it's done
+func setEnv(t *testing.T, key string, value string) {
+	originalValue, wasSet := os.LookupEnv(key)
+
+	os.Setenv(key, value) // nolint: errcheck
+
+	t.Cleanup(func() {
+		if wasSet {
+			os.Setenv(key, originalValue) // nolint: errcheck
+		} else {
+			os.Unsetenv(key) // nolint: errcheck
+		}
+	})
+}
+
+func priorityOf(level string) journal.Priority {
+	priority, _ := parseLevel(level)
+	return priority
+}
@@ -0,0 +1,207 @@
+package journal
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/journal"
+)
+
+const (
+	OutputJournal = "journal"
+	OutputStderr  = "stderr"
+	OutputFile    = "file"
+	OutputSyslog  = "syslog"
+)
+
+type OutputConfig struct {
+	Output   string
+	FilePath string
+
+	// FileMaxSizeMB rotates the log file once it would grow past it, keeping FileMaxBackups rotated files. 0
+	// doesn't rotate
+	FileMaxSizeMB  int
+	FileMaxBackups int
+
+	SyslogTag      string
+	SyslogFacility string
+}
+
+type sink interface {
+	send(priority journal.Priority, message string) error
+}
+
+var (
+	currentSink sink = &journalSink{}
+	sinkLock    sync.Mutex
+)
+
+// Configure logs to a file, rotated once it would grow past maxSizeMB, keeping maxBackups rotated files
+func Configure(path string, maxSizeMB int, maxBackups int) {
+	SetOutput(OutputConfig{
+		Output:         OutputFile,
+		FilePath:       path,
+		FileMaxSizeMB:  maxSizeMB,
+		FileMaxBackups: maxBackups,
+	})
+}
+
+// SetOutput selects where logs are written. If the destination can't be opened, logs go to stderr and a warning
+// is emitted once
+func SetOutput(config OutputConfig) {
+	newSink, err := createSink(config)
+
+	sinkLock.Lock()
+	if err != nil {
+		currentSink = &writerSink{writer: os.Stderr}
+	} else {
+		currentSink = newSink
+	}
+	sinkLock.Unlock()
+
+	if err != nil {
+		Warn("Failed to open log output, falling back to stderr", "output", config.Output, "err", err.Error())
+	}
+}
+
+func createSink(config OutputConfig) (sink, error) {
+	switch config.Output {
+	case "", OutputJournal:
+		return &journalSink{}, nil
+	case OutputStderr:
+		return &writerSink{writer: os.Stderr}, nil
+	case OutputFile:
+		if config.FilePath == "" {
+			return nil, fmt.Errorf("Log file path must be set")
+		}
+
+		if config.FileMaxSizeMB > 0 {
+			file, err := newRotatingFile(config.FilePath, config.FileMaxSizeMB, config.FileMaxBackups)
+			if err != nil {
+				return nil, err
+			}
+
+			return &writerSink{writer: file}, nil
+		}
+
+		file, err := os.OpenFile(config.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+
+		return &writerSink{writer: file}, nil
+	case OutputSyslog:
+		facility, err := parseSyslogFacility(config.SyslogFacility)
+		if err != nil {
+			return nil, err
+		}
+
+		tag := config.SyslogTag
+		if tag == "" {
+			tag = "flex-fuse"
+		}
+
+		writer, err := syslog.New(facility|syslog.LOG_DEBUG, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		return &syslogSink{writer: writer}, nil
+	default:
+		return nil, fmt.Errorf("Unknown log output: %s", config.Output)
+	}
+}
+
+func parseSyslogFacility(facility string) (syslog.Priority, error) {
+	switch strings.ToLower(facility) {
+	case "", "daemon":
+		return syslog.LOG_DAEMON, nil
+	case "user":
+		return syslog.LOG_USER, nil
+	case "local0":
+		return syslog.LOG_LOCAL0, nil
+	case "local1":
+		return syslog.LOG_LOCAL1, nil
+	case "local2":
+		return syslog.LOG_LOCAL2, nil
+	case "local3":
+		return syslog.LOG_LOCAL3, nil
+	case "local4":
+		return syslog.LOG_LOCAL4, nil
+	case "local5":
+		return syslog.LOG_LOCAL5, nil
+	case "local6":
+		return syslog.LOG_LOCAL6, nil
+	case "local7":
+		return syslog.LOG_LOCAL7, nil
+	default:
+		return 0, fmt.Errorf("Unknown syslog facility: %s", facility)
+	}
+}
+
+func getSink() sink {
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+
+	return currentSink
+}
+
+type journalSink struct{}
+
+func (s *journalSink) send(priority journal.Priority, message string) error {
+	return journal.Send(message, priority, nil)
+}
+
+type writerSink struct {
+	writer io.Writer
+	lock   sync.Mutex
+}
+
+func (s *writerSink) send(priority journal.Priority, message string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// json messages carry their own time and level
+	if getFormat() == FormatJSON {
+		_, err := fmt.Fprintln(s.writer, message)
+		return err
+	}
+
+	_, err := fmt.Fprintf(s.writer, "%s %s %s\n", time.Now().Format(time.RFC3339), priorityName(priority), message)
+	return err
+}
+
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func (s *syslogSink) send(priority journal.Priority, message string) error {
+	switch priority {
+	case journal.PriErr:
+		return s.writer.Err(message)
+	case journal.PriWarning:
+		return s.writer.Warning(message)
+	case journal.PriInfo:
+		return s.writer.Info(message)
+	default:
+		return s.writer.Debug(message)
+	}
+}
+
+func priorityName(priority journal.Priority) string {
+	switch priority {
+	case journal.PriErr:
+		return "ERROR"
+	case journal.PriWarning:
+		return "WARN"
+	case journal.PriInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
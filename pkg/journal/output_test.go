@@ -0,0 +1,124 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateSink(t *testing.T) {
+	logFilePath := filepath.Join(t.TempDir(), "fuse.log")
+
+	for _, testCase := range []struct {
+		name        string
+		config      OutputConfig
+		expectSink  func(sink) bool
+		expectError bool
+	}{
+		{
+			name:       "default",
+			config:     OutputConfig{},
+			expectSink: isJournalSink,
+		},
+		{
+			name:       "journal",
+			config:     OutputConfig{Output: OutputJournal},
+			expectSink: isJournalSink,
+		},
+		{
+			name:   "stderr",
+			config: OutputConfig{Output: OutputStderr},
+			expectSink: func(s sink) bool {
+				writerSink, ok := s.(*writerSink)
+				return ok && writerSink.writer == os.Stderr
+			},
+		},
+		{
+			name:   "file",
+			config: OutputConfig{Output: OutputFile, FilePath: logFilePath},
+			expectSink: func(s sink) bool {
+				writerSink, ok := s.(*writerSink)
+				if !ok {
+					return false
+				}
+
+				file, ok := writerSink.writer.(*os.File)
+				return ok && file.Name() == logFilePath
+			},
+		},
+		{
+			name:   "rotated file",
+			config: OutputConfig{Output: OutputFile, FilePath: logFilePath, FileMaxSizeMB: 1, FileMaxBackups: 2},
+			expectSink: func(s sink) bool {
+				writerSink, ok := s.(*writerSink)
+				if !ok {
+					return false
+				}
+
+				_, ok = writerSink.writer.(*rotatingFile)
+				return ok
+			},
+		},
+		{
+			name:        "file without a path",
+			config:      OutputConfig{Output: OutputFile},
+			expectError: true,
+		},
+		{
+			name:        "syslog with an unknown facility",
+			config:      OutputConfig{Output: OutputSyslog, SyslogFacility: "local9"},
+			expectError: true,
+		},
+		{
+			name:        "unknown",
+			config:      OutputConfig{Output: "kafka"},
+			expectError: true,
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			createdSink, err := createSink(testCase.config)
+			if testCase.expectError {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if !testCase.expectSink(createdSink) {
+				t.Fatalf("Unexpected sink %#v", createdSink)
+			}
+		})
+	}
+}
+
+func TestSetOutputFallsBackToStderr(t *testing.T) {
+	defer SetOutput(OutputConfig{})
+
+	SetOutput(OutputConfig{Output: OutputFile, FilePath: filepath.Join(t.TempDir(), "missing", "fuse.log")})
+
+	if writerSink, ok := getSink().(*writerSink); !ok || writerSink.writer != os.Stderr {
+		t.Fatalf("Expected stderr sink, got %#v", getSink())
+	}
+}
+
+func TestParseSyslogFacility(t *testing.T) {
+	for _, facility := range []string{"", "daemon", "user", "LOCAL0", "local7"} {
+		if _, err := parseSyslogFacility(facility); err != nil {
+			t.Fatalf("Facility %q: unexpected error: %s", facility, err)
+		}
+	}
+
+	if _, err := parseSyslogFacility("kern"); err == nil {
+		t.Fatal("Expected an error for an unsupported facility")
+	}
+}
+
+func isJournalSink(s sink) bool {
+	_, ok := s.(*journalSink)
+	return ok
+}
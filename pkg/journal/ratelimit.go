@@ -0,0 +1,122 @@
+package journal
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/journal"
+)
+
+const (
+	DefaultDebugRatePerSecond = 5
+	DefaultDebugBurst         = 10
+)
+
+// rateLimiter throttles repetitive messages, e.g. those logged on every poll of a retry loop. Messages are grouped
+// by their template (the message without its vars), each group having its own token bucket
+type rateLimiter struct {
+	lock          sync.Mutex
+	ratePerSecond float64
+	burst         float64
+	buckets       map[string]*tokenBucket
+	now           func() time.Time
+}
+
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+	suppressed int
+}
+
+var debugRateLimiter = newRateLimiter(DefaultDebugRatePerSecond, DefaultDebugBurst)
+
+// SetDebugRateLimit sets how many debug messages of the same template may be logged per second, after an initial
+// burst. A rate of 0 disables rate limiting
+func SetDebugRateLimit(ratePerSecond float64, burst int) {
+	debugRateLimiter.lock.Lock()
+	defer debugRateLimiter.lock.Unlock()
+
+	debugRateLimiter.ratePerSecond = ratePerSecond
+	debugRateLimiter.burst = float64(burst)
+	debugRateLimiter.buckets = map[string]*tokenBucket{}
+}
+
+// Flush logs a summary of all messages suppressed since they were last allowed
+func Flush() {
+	for _, summary := range debugRateLimiter.flush() {
+		getSink().send(journal.PriDebug, formatMessage(journal.PriDebug, summary, nil)) // nolint: errcheck
+	}
+}
+
+func newRateLimiter(ratePerSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		ratePerSecond: ratePerSecond,
+		burst:         float64(burst),
+		buckets:       map[string]*tokenBucket{},
+		now:           time.Now,
+	}
+}
+
+// allow returns whether a message of the given template may be logged. When it may, and messages of the template
+// were suppressed before it, a summary of them is returned to be logged first
+func (r *rateLimiter) allow(template string) (bool, string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.ratePerSecond <= 0 {
+		return true, ""
+	}
+
+	now := r.now()
+
+	bucket, found := r.buckets[template]
+	if !found {
+		bucket = &tokenBucket{tokens: r.burst, lastRefill: now}
+		r.buckets[template] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.lastRefill).Seconds() * r.ratePerSecond
+	if bucket.tokens > r.burst {
+		bucket.tokens = r.burst
+	}
+
+	bucket.lastRefill = now
+
+	if bucket.tokens < 1 {
+		bucket.suppressed++
+		return false, ""
+	}
+
+	bucket.tokens--
+
+	summary := ""
+	if bucket.suppressed > 0 {
+		summary = suppressedSummary(template, bucket.suppressed)
+		bucket.suppressed = 0
+	}
+
+	return true, summary
+}
+
+func (r *rateLimiter) flush() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var summaries []string
+	for template, bucket := range r.buckets {
+		if bucket.suppressed > 0 {
+			summaries = append(summaries, suppressedSummary(template, bucket.suppressed))
+			bucket.suppressed = 0
+		}
+	}
+
+	sort.Strings(summaries)
+
+	return summaries
+}
+
+func suppressedSummary(template string, suppressed int) string {
+	return fmt.Sprintf("Suppressed %d similar messages: %s", suppressed, template)
+}
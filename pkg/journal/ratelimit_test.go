@@ -0,0 +1,96 @@
+package journal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	limiter := newRateLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	for _, step := range []struct {
+		advance         time.Duration
+		template        string
+		expectAllowed   bool
+		expectedSummary string
+	}{
+		{template: "Polling", expectAllowed: true},
+		{template: "Polling", expectAllowed: true},
+		{template: "Polling"},
+		{template: "Polling"},
+
+		// each template has its own bucket
+		{template: "Waiting", expectAllowed: true},
+
+		// a second refills a token, and the suppressed messages are summarized once one is allowed
+		{advance: time.Second, template: "Polling", expectAllowed: true, expectedSummary: "Suppressed 2 similar " +
+			"messages: Polling"},
+		{template: "Polling"},
+		{advance: time.Minute, template: "Polling", expectAllowed: true, expectedSummary: "Suppressed 1 similar " +
+			"messages: Polling"},
+		{template: "Polling", expectAllowed: true},
+	} {
+		now = now.Add(step.advance)
+
+		allowed, summary := limiter.allow(step.template)
+		if allowed != step.expectAllowed || summary != step.expectedSummary {
+			t.Fatalf("At %s, expected %s allowed: %t with summary %q, got %t with %q",
+				now,
+				step.template,
+				step.expectAllowed,
+				step.expectedSummary,
+				allowed,
+				summary)
+		}
+	}
+}
+
+func TestDebugRateLimitSuppressesAndSummarizes(t *testing.T) {
+	sink := captureOutput(t)
+
+	SetDebugRateLimit(0.001, 2)
+
+	for _, attempt := range []string{"1", "2", "3", "4", "5"} {
+		Debug("Polling", "attempt", attempt)
+	}
+
+	// other levels aren't rate limited
+	for i := 0; i < 3; i++ {
+		Warn("Retrying")
+	}
+
+	Flush()
+
+	expectedMessages := []string{
+		"Polling: [attempt 1]",
+		"Polling: [attempt 2]",
+		"Retrying",
+		"Retrying",
+		"Retrying",
+		"Suppressed 3 similar messages: Polling",
+	}
+
+	if messages := sink.getMessages(); !reflect.DeepEqual(messages, expectedMessages) {
+		t.Fatalf("Expected %q, got %q", expectedMessages, messages)
+	}
+}
+
+func TestDebugRateLimitDisabled(t *testing.T) {
+	sink := captureOutput(t)
+
+	SetDebugRateLimit(0, 0)
+
+	for i := 0; i < 20; i++ {
+		Debug("Polling")
+	}
+
+	Flush()
+
+	if messages := sink.getMessages(); len(messages) != 20 {
+		t.Fatalf("Expected 20 messages, got %d", len(messages))
+	}
+}
@@ -0,0 +1,137 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// rotatingFile is a log file that is rotated once writing to it would take it past maxSize bytes, keeping
+// maxBackups rotated files (path.1 being the newest). Every driver invocation is a separate process writing to the
+// same file, so writes and rotations are serialized by a lock file, and a process whose file was rotated by
+// another reopens it
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	lockFile   *os.File
+}
+
+func newRotatingFile(path string, maxSizeMB int, maxBackups int) (*rotatingFile, error) {
+	if maxSizeMB < 0 || maxBackups < 0 {
+		return nil, fmt.Errorf("Log file max size and backups must not be negative")
+	}
+
+	lockFile, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	rotatingFile := &rotatingFile{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+		lockFile:   lockFile,
+	}
+
+	if err := rotatingFile.open(); err != nil {
+		lockFile.Close() // nolint: errcheck
+		return nil, err
+	}
+
+	return rotatingFile, nil
+}
+
+func (f *rotatingFile) Write(buffer []byte) (int, error) {
+	if err := syscall.Flock(int(f.lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return 0, err
+	}
+
+	defer syscall.Flock(int(f.lockFile.Fd()), syscall.LOCK_UN) // nolint: errcheck
+
+	if err := f.reopenIfRotated(); err != nil {
+		return 0, err
+	}
+
+	if f.maxSize > 0 {
+		fileInfo, err := f.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+
+		// a single write larger than the max size still goes to a file of its own, rather than being dropped
+		if fileInfo.Size() > 0 && fileInfo.Size()+int64(len(buffer)) > f.maxSize {
+			if err := f.rotate(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return f.file.Write(buffer)
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if f.file != nil {
+		f.file.Close() // nolint: errcheck
+	}
+
+	f.file = file
+
+	return nil
+}
+
+// reopenIfRotated reopens the file if another process rotated it, as the open file would be a backup by now
+func (f *rotatingFile) reopenIfRotated() error {
+	openFileInfo, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	pathFileInfo, err := os.Stat(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err == nil && os.SameFile(openFileInfo, pathFileInfo) {
+		return nil
+	}
+
+	return f.open()
+}
+
+// rotate shifts the backups by one, dropping the oldest, and starts a new file
+func (f *rotatingFile) rotate() error {
+	if f.maxBackups == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		return f.open()
+	}
+
+	if err := os.Remove(f.backupPath(f.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for backupIdx := f.maxBackups - 1; backupIdx >= 1; backupIdx-- {
+		if err := os.Rename(f.backupPath(backupIdx), f.backupPath(backupIdx+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(f.path, f.backupPath(1)); err != nil {
+		return err
+	}
+
+	return f.open()
+}
+
+func (f *rotatingFile) backupPath(backupIdx int) string {
+	return fmt.Sprintf("%s.%d", f.path, backupIdx)
+}
@@ -0,0 +1,144 @@
+package journal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestRotatingFileRotates(t *testing.T) {
+	line := []byte("0123456789012345678901234567890123456789\n")
+
+	for _, testCase := range []struct {
+		name                string
+		maxBackups          int
+		lines               int
+		expectedBackups     int
+		expectedLinesInFile int
+	}{
+		{name: "below the threshold", maxBackups: 2, lines: 2, expectedBackups: 0, expectedLinesInFile: 2},
+		{name: "past the threshold", maxBackups: 2, lines: 3, expectedBackups: 1, expectedLinesInFile: 1},
+		{name: "past the backup count", maxBackups: 2, lines: 11, expectedBackups: 2, expectedLinesInFile: 1},
+		{name: "no backups", maxBackups: 0, lines: 5, expectedBackups: 0, expectedLinesInFile: 1},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			logFilePath := filepath.Join(t.TempDir(), "fuse.log")
+
+			// room for 2 lines per file
+			rotatingFile := newTestRotatingFile(t, logFilePath, testCase.maxBackups, int64(len(line)*2))
+
+			for lineIdx := 0; lineIdx < testCase.lines; lineIdx++ {
+				if _, err := rotatingFile.Write(line); err != nil {
+					t.Fatalf("Expected write to succeed, got %s", err.Error())
+				}
+			}
+
+			if lines := countLines(t, logFilePath); lines != testCase.expectedLinesInFile {
+				t.Fatalf("Expected %d lines in the log file, got %d", testCase.expectedLinesInFile, lines)
+			}
+
+			backups, _ := filepath.Glob(logFilePath + ".[0-9]*")
+			if len(backups) != testCase.expectedBackups {
+				t.Fatalf("Expected %d backups, got %v", testCase.expectedBackups, backups)
+			}
+
+			for backupIdx := 1; backupIdx <= testCase.expectedBackups; backupIdx++ {
+				if lines := countLines(t, rotatingFile.backupPath(backupIdx)); lines != 2 {
+					t.Fatalf("Expected backup %d to be full, got %d lines", backupIdx, lines)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingFileConcurrentWriters(t *testing.T) {
+	logFilePath := filepath.Join(t.TempDir(), "fuse.log")
+	maxBackups := 100
+	writers := 4
+	linesPerWriter := 50
+
+	waitGroup := sync.WaitGroup{}
+
+	// each writer stands for a separate driver invocation, with a file and lock file of its own
+	for writerIdx := 0; writerIdx < writers; writerIdx++ {
+		rotatingFile := newTestRotatingFile(t, logFilePath, maxBackups, 512)
+
+		waitGroup.Add(1)
+		go func(writerIdx int) {
+			defer waitGroup.Done()
+
+			for lineIdx := 0; lineIdx < linesPerWriter; lineIdx++ {
+				rotatingFile.Write([]byte(fmt.Sprintf("writer %d line %d\n", writerIdx, lineIdx))) // nolint: errcheck
+			}
+		}(writerIdx)
+	}
+
+	waitGroup.Wait()
+
+	lines := countLines(t, logFilePath)
+	for backupIdx := 1; backupIdx <= maxBackups; backupIdx++ {
+		backupPath := fmt.Sprintf("%s.%d", logFilePath, backupIdx)
+		if _, err := os.Stat(backupPath); os.IsNotExist(err) {
+			break
+		}
+
+		fileInfo, _ := os.Stat(backupPath)
+		if fileInfo.Size() > 512 {
+			t.Fatalf("Expected backup %d to be at most 512 bytes, got %d", backupIdx, fileInfo.Size())
+		}
+
+		lines += countLines(t, backupPath)
+	}
+
+	if lines != writers*linesPerWriter {
+		t.Fatalf("Expected %d lines across the log file and its backups, got %d", writers*linesPerWriter, lines)
+	}
+}
+
+func TestNewRotatingFileNegative(t *testing.T) {
+	logFilePath := filepath.Join(t.TempDir(), "fuse.log")
+
+	for _, testCase := range []struct {
+		name       string
+		maxSizeMB  int
+		maxBackups int
+	}{
+		{name: "negative size", maxSizeMB: -1, maxBackups: 1},
+		{name: "negative backups", maxSizeMB: 1, maxBackups: -1},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			if _, err := newRotatingFile(logFilePath, testCase.maxSizeMB, testCase.maxBackups); err == nil {
+				t.Fatal("Expected a negative size or backup count to be refused")
+			}
+		})
+	}
+}
+
+// newTestRotatingFile creates a rotating file with a max size in bytes, so tests needn't write megabytes
+func newTestRotatingFile(t *testing.T, path string, maxBackups int, maxSize int64) *rotatingFile {
+	rotatingFile, err := newRotatingFile(path, 1, maxBackups)
+	if err != nil {
+		t.Fatalf("Expected rotating file to be created, got %s", err.Error())
+	}
+
+	rotatingFile.maxSize = maxSize
+
+	t.Cleanup(func() {
+		rotatingFile.file.Close()     // nolint: errcheck
+		rotatingFile.lockFile.Close() // nolint: errcheck
+	})
+
+	return rotatingFile
+}
+
+func countLines(t *testing.T, path string) int {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected %s to be readable, got %s", path, err.Error())
+	}
+
+	return bytes.Count(contents, []byte("\n"))
+}